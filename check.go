@@ -0,0 +1,378 @@
+package simplebolt
+
+// check.go provides a check of the invariants of the data structures, beyond the
+// page checks of Bolt. The type of every bucket is recorded when it is created,
+// so that it can be checked according to the data structure that it holds.
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.etcd.io/bbolt"
+)
+
+// typesBucket is the name of the bucket that maps the ID of every bucket to the
+// name of the data structure that it holds
+var typesBucket = []byte("__types")
+
+// Problem describes a violation of the invariants of a data structure, found by Check
+type Problem struct {
+	// Bucket is the ID of the bucket of the data structure
+	Bucket string
+	// Structure is the data structure, like "List"
+	Structure string
+	// Key of the element with the problem, or nil if the problem concerns the
+	// whole data structure
+	Key []byte
+	// Description of the problem
+	Description string
+}
+
+// String returns a description of the problem, including the bucket and the key
+func (p Problem) String() string {
+	if p.Key == nil {
+		return fmt.Sprintf("%s %s: %s", p.Structure, p.Bucket, p.Description)
+	}
+	return fmt.Sprintf("%s %s, key %s: %s", p.Structure, p.Bucket, hex.EncodeToString(p.Key), p.Description)
+}
+
+// Checker checks the invariants of a data structure that is stored in the
+// bucket with the given ID, and returns the problems that were found
+type Checker func(db *Database, id string) ([]Problem, error)
+
+var (
+	checkersMutex sync.RWMutex
+	checkers      = map[string]Checker{
+		"List":     checkList,
+		"Set":      checkSet,
+		"HashMap":  checkHashMap,
+		"KeyValue": checkKeyValue,
+	}
+)
+
+var (
+	reservedMutex sync.RWMutex
+	// reservedSuffixes are appended to the ID of a data structure, for the
+	// names of the buckets that belong to it
+	reservedSuffixes = []string{indexSuffix, versionsSuffix}
+)
+
+// ReserveSuffix makes ValidateID reject the IDs that end with the given suffix.
+// It is used by the packages that are built on this one, like linkedlist, for
+// the names of the buckets that belong to their data structures.
+func ReserveSuffix(suffix string) {
+	reservedMutex.Lock()
+	defer reservedMutex.Unlock()
+	reservedSuffixes = append(reservedSuffixes, suffix)
+}
+
+// ValidateID returns an error wrapping ErrReservedID if the given ID can not be
+// used for a data structure, since it is the name of the bucket where the types
+// of the buckets are recorded, or since it ends with a suffix that is used for
+// the buckets that belong to other data structures, like "__idx" for the index
+// of a List. It is called by the functions that create or open data structures.
+func ValidateID(id string) error {
+	if id == string(typesBucket) {
+		return fmt.Errorf("%w: %q is used for the types of the buckets", ErrReservedID, id)
+	}
+	reservedMutex.RLock()
+	defer reservedMutex.RUnlock()
+	for _, suffix := range reservedSuffixes {
+		if strings.HasSuffix(id, suffix) {
+			return fmt.Errorf("%w: %q ends with %q", ErrReservedID, id, suffix)
+		}
+	}
+	return nil
+}
+
+// RegisterChecker sets the Checker that Check uses for the buckets that have
+// been recorded as holding the given data structure, with RegisterBucket. It is
+// used by the packages that are built on this one, like linkedlist.
+func RegisterChecker(structure string, c Checker) {
+	checkersMutex.Lock()
+	defer checkersMutex.Unlock()
+	checkers[structure] = c
+}
+
+// RegisterBucket records, within the given read-write transaction, that the
+// bucket with the given ID holds the given data structure, so that Check can
+// check it. Returns an error wrapping ErrWrongType if another data structure
+// has already been recorded for the bucket. The data structures of this package are recorded when they are
+// created, while the packages that are built on this one, like linkedlist, call
+// RegisterBucket within the transaction that creates the bucket.
+func RegisterBucket(tx *bbolt.Tx, id, structure string) error {
+	return registerType(tx, []byte(id), structure)
+}
+
+// RecordedBucket returns the bucket with the given ID, within the given
+// transaction, if it has been recorded as holding the given data structure with
+// RegisterBucket, or nil. It is used for the buckets that belong to other data
+// structures, so that a bucket is not mistaken for one just by its name.
+func RecordedBucket(tx *bbolt.Tx, id, structure string) *bbolt.Bucket {
+	return recordedBucket(tx, []byte(id), structure)
+}
+
+// UnregisterBucket removes the record of the bucket with the given ID, within
+// the given read-write transaction, when the bucket is deleted
+func UnregisterBucket(tx *bbolt.Tx, id string) error {
+	return unregisterType(tx, []byte(id))
+}
+
+// registerType records the data structure of the bucket with the given name.
+// Returns an error wrapping ErrWrongType if another data structure has already
+// been recorded for the bucket.
+func registerType(tx *bbolt.Tx, name []byte, structure string) error {
+	if err := checkType(tx, name, structure); err != nil {
+		return err
+	}
+	types, err := tx.CreateBucketIfNotExists(typesBucket)
+	if err != nil {
+		return fmt.Errorf("Could not create bucket: %w", err)
+	}
+	if types.Get(name) != nil {
+		return nil
+	}
+	return types.Put(name, []byte(structure))
+}
+
+// checkType returns an error wrapping ErrWrongType if the bucket with the given
+// name has been recorded as holding another data structure than the given one.
+// Buckets without a recorded data structure are accepted.
+func checkType(tx *bbolt.Tx, name []byte, structure string) error {
+	types := tx.Bucket(typesBucket)
+	if types == nil {
+		return nil
+	}
+	if recorded := types.Get(name); recorded != nil && !bytes.Equal(recorded, []byte(structure)) {
+		return fmt.Errorf("%w: %s", ErrWrongType, recorded)
+	}
+	return nil
+}
+
+// recordedBucket returns the bucket with the given name, if it has been recorded
+// as holding the given data structure, or nil
+func recordedBucket(tx *bbolt.Tx, name []byte, structure string) *bbolt.Bucket {
+	types := tx.Bucket(typesBucket)
+	if types == nil || !bytes.Equal(types.Get(name), []byte(structure)) {
+		return nil
+	}
+	return tx.Bucket(name)
+}
+
+// unregisterType removes the record of the data structure of the bucket with
+// the given name
+func unregisterType(tx *bbolt.Tx, name []byte) error {
+	if types := tx.Bucket(typesBucket); types != nil {
+		return types.Delete(name)
+	}
+	return nil
+}
+
+// Check checks the invariants of every data structure in the database whose
+// type has been recorded, and returns the problems that were found, sorted by
+// bucket. For instance, the keys of a List must be sequence numbers, the
+// members of a Set must be unique and the links of a linked list must be
+// consistent. Buckets that were created by earlier versions of this package
+// have no recorded type and are not checked, and neither are buckets whose data
+// structure has no registered Checker, for instance if the package of the data
+// structure has not been imported. See also Database.Check, which checks the
+// pages of the whole database.
+//
+// Every data structure is checked within a read-only transaction of its own.
+func Check(db *Database) ([]Problem, error) {
+	types := make(map[string]string)
+	err := db.view("Database", "CheckTypes", func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(typesBucket)
+		if bucket == nil {
+			return nil // Return from View function
+		}
+		return bucket.ForEach(func(name, structure []byte) error {
+			types[string(name)] = string(structure)
+			return nil // Continue ForEach
+		})
+	})
+	if err != nil {
+		return nil, closedError(err)
+	}
+	ids := make([]string, 0, len(types))
+	for id := range types {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	var problems []Problem
+	for _, id := range ids {
+		checkersMutex.RLock()
+		check, ok := checkers[types[id]]
+		checkersMutex.RUnlock()
+		if !ok {
+			continue
+		}
+		found, err := check(db, id)
+		if errors.Is(err, ErrBucketNotFound) {
+			problems = append(problems, Problem{Bucket: id, Structure: types[id], Description: "the bucket is missing"})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		problems = append(problems, found...)
+	}
+	return problems, nil
+}
+
+// checkBucketOf calls fn with the bucket with the given ID, within a read-only
+// transaction, and a function for reporting problems with the given structure
+func checkBucketOf(db *Database, id, structure string, fn func(tx *bbolt.Tx, bucket *bbolt.Bucket, report func(key []byte, format string, args ...interface{})) error) ([]Problem, error) {
+	var problems []Problem
+	err := db.view(structure, "Check", func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte(id))
+		if bucket == nil {
+			return ErrBucketNotFound
+		}
+		return fn(tx, bucket, func(key []byte, format string, args ...interface{}) {
+			problems = append(problems, Problem{
+				Bucket:      id,
+				Structure:   structure,
+				Key:         copyBytes(key),
+				Description: fmt.Sprintf(format, args...),
+			})
+		})
+	})
+	return problems, err
+}
+
+// checkSequenceKeys reports the keys that are not 8 byte sequence numbers, and
+// the keys that are above the sequence of the bucket, which would be
+// overwritten when elements are added. If timed is true, the keys written by
+// List.AddTimed are also accepted, and they have no upper bound.
+func checkSequenceKeys(bucket *bbolt.Bucket, timed bool, report func(key []byte, format string, args ...interface{})) {
+	sequence := bucket.Sequence()
+	bucket.ForEach(func(key, _ []byte) error {
+		if timed && len(key) == timedIDLength {
+			return nil // Continue ForEach
+		}
+		if len(key) != 8 {
+			report(key, "the key is not a sequence number")
+		} else if n := binary.BigEndian.Uint64(key); n > sequence {
+			report(key, "the key is above the sequence of the bucket, %d", sequence)
+		}
+		return nil // Continue ForEach
+	})
+}
+
+// checkList checks that the keys of a list are sequence numbers or the keys of
+// AddTimed, that the values can be decoded and that the index, if any, has the
+// keys of all the elements
+func checkList(db *Database, id string) ([]Problem, error) {
+	return checkBucketOf(db, id, "List", func(tx *bbolt.Tx, bucket *bbolt.Bucket, report func(key []byte, format string, args ...interface{})) error {
+		checkSequenceKeys(bucket, true, report)
+		index := listIndex(tx, []byte(id))
+		elements, indexed := 0, 0
+		bucket.ForEach(func(key, value []byte) error {
+			elements++
+			decoded, err := db.decodeValue(value)
+			if err != nil {
+				report(key, "the value can not be decoded: %v", err)
+				return nil // Continue ForEach
+			}
+			if index == nil {
+				return nil // Continue ForEach
+			}
+			found := false
+			for _, indexedKey := range indexKeys(index, decoded) {
+				found = found || bytes.Equal(indexedKey, key)
+			}
+			if !found {
+				report(key, "the element is missing from the index")
+			}
+			return nil // Continue ForEach
+		})
+		if index == nil {
+			return nil
+		}
+		index.ForEach(func(_, stored []byte) error {
+			for len(stored) > 0 && len(stored) > int(stored[0]) {
+				indexed++
+				stored = stored[1+int(stored[0]):]
+			}
+			return nil // Continue ForEach
+		})
+		if indexed != elements {
+			report(nil, "the index has %d keys, but the list has %d elements", indexed, elements)
+		}
+		return nil
+	})
+}
+
+// checkSet checks that the keys of a set are sequence numbers and that the
+// members can be decrypted and are unique
+func checkSet(db *Database, id string) ([]Problem, error) {
+	return checkBucketOf(db, id, "Set", func(_ *bbolt.Tx, bucket *bbolt.Bucket, report func(key []byte, format string, args ...interface{})) error {
+		checkSequenceKeys(bucket, false, report)
+		seen := make(map[string]bool)
+		return bucket.ForEach(func(key, stored []byte) error {
+			value, err := db.DecryptValue(stored)
+			if err != nil {
+				report(key, "the member can not be decrypted: %v", err)
+				return nil // Continue ForEach
+			}
+			if seen[string(value)] {
+				report(key, "the member %q is not unique", value)
+			}
+			seen[string(value)] = true
+			return nil // Continue ForEach
+		})
+	})
+}
+
+// checkHashMap checks that the keys of a hash map are element IDs and keys,
+// separated by a colon, and that the values can be decoded
+func checkHashMap(db *Database, id string) ([]Problem, error) {
+	return checkBucketOf(db, id, "HashMap", func(_ *bbolt.Tx, bucket *bbolt.Bucket, report func(key []byte, format string, args ...interface{})) error {
+		return bucket.ForEach(func(key, value []byte) error {
+			if !bytes.Contains(key, []byte(":")) {
+				report(key, "the key has no element ID")
+			}
+			if _, err := db.decodeValue(value); err != nil {
+				report(key, "the value can not be decoded: %v", err)
+			}
+			return nil // Continue ForEach
+		})
+	})
+}
+
+// checkKeyValue checks that the values of a key/value store can be decoded and
+// that the versions of the keys, if any, are 8 byte numbers
+func checkKeyValue(db *Database, id string) ([]Problem, error) {
+	return checkBucketOf(db, id, "KeyValue", func(tx *bbolt.Tx, bucket *bbolt.Bucket, report func(key []byte, format string, args ...interface{})) error {
+		bucket.ForEach(func(key, value []byte) error {
+			if _, err := db.decodeValue(value); err != nil {
+				report(key, "the value can not be decoded: %v", err)
+			}
+			return nil // Continue ForEach
+		})
+		if versions := keyValueVersions(tx, []byte(id)); versions != nil {
+			versions.ForEach(func(key, version []byte) error {
+				if len(version) != 8 {
+					report(key, "the version is not a number")
+				}
+				return nil // Continue ForEach
+			})
+		}
+		return nil
+	})
+}
+
+// copyBytes returns a copy of the given bytes, or nil if they are nil
+func copyBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
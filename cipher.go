@@ -0,0 +1,58 @@
+package simplebolt
+
+// cipher.go provides encryption at rest of the stored values, with functions
+// given by the caller.
+
+import "errors"
+
+// ErrInvalidCipher is returned when setting a value cipher with only one of the
+// functions for encrypting and decrypting
+var ErrInvalidCipher = errors.New("Invalid cipher: both enc and dec must be given, or neither")
+
+// SetValueCipher sets the functions that encrypt every value that is written,
+// and decrypt the values when they are read. This covers the values of a List,
+// a KeyValue and a HashMap, the members of a Set and the data of the nodes of a
+// linked list. Values are compressed before they are encrypted, if compression
+// is enabled. Pass nil for both to store values as they are, which is the
+// default. Returns ErrInvalidCipher if only one of them is nil.
+//
+// The keys are stored as they are, since they are needed for ordering, and so
+// are the value index of a List created with NewIndexedList and the index of a
+// linked list in unique mode, which store a SHA-256 hash of every value. Since
+// enc may return a different result every time, a Set is searched for a member
+// by decrypting all the members.
+//
+// Every stored value is decrypted with dec, so changing the cipher, or setting
+// one for a database that already has values, makes the existing values
+// unreadable. The errors returned by dec are returned by the methods that read
+// the values. The functions must not modify the given slice, which may point
+// into the read-only memory map of Bolt, and they may be called from several
+// goroutines at once.
+func (db *Database) SetValueCipher(enc, dec func([]byte) ([]byte, error)) error {
+	if (enc == nil) != (dec == nil) {
+		return ErrInvalidCipher
+	}
+	db.updateSettings(func(s *settings) {
+		s.encrypt, s.decrypt = enc, dec
+	})
+	return nil
+}
+
+// EncryptValue encrypts the given value, if a value cipher has been set. It is
+// called by the packages that are built on this one, before storing a value.
+func (db *Database) EncryptValue(value []byte) ([]byte, error) {
+	if encrypt := db.settings().encrypt; encrypt != nil {
+		return encrypt(value)
+	}
+	return value, nil
+}
+
+// DecryptValue decrypts the given stored value, if a value cipher has been set.
+// Missing and empty values are returned as they are. It is called by the
+// packages that are built on this one, after reading a stored value.
+func (db *Database) DecryptValue(value []byte) ([]byte, error) {
+	if decrypt := db.settings().decrypt; decrypt != nil && len(value) > 0 {
+		return decrypt(value)
+	}
+	return value, nil
+}
@@ -0,0 +1,438 @@
+// Command simplebolt inspects and maintains Bolt database files that have been
+// written with the simplebolt and linkedlist packages, without writing any Go.
+//
+// Usage:
+//
+//	simplebolt [-json] FILE COMMAND [ARGUMENTS]
+//
+// The commands are:
+//
+//	buckets                  list the IDs of all the buckets
+//	dump BUCKET              show the keys and values of a bucket, or the nodes of a linked list, in order
+//	get BUCKET KEY           show the value of a key of a KeyValue
+//	set BUCKET KEY VALUE     set a key of a KeyValue, which is created if needed
+//	del BUCKET KEY           remove a key of a KeyValue
+//	export BUCKET [OUTFILE]  write the contents of a bucket as JSON, to stdout by default
+//	import BUCKET [INFILE]   replace the nodes of a linked list, or set the keys of a KeyValue, from JSON
+//	stats [BUCKET]           show statistics about all the buckets, or about one of them
+//	compact OUTFILE          write a compacted copy of the database to a new file
+//
+// With -json, everything that is written to stdout is JSON. Linked lists are
+// exported in the format of linkedlist.ExportJSON. Other buckets are exported
+// as an array of objects with a key and a value, which are base64 encoded, with
+// "encoding" set to "base64", if either is not valid UTF-8. Both formats can be
+// imported again.
+//
+// The commands for a KeyValue refuse buckets that have been recorded as holding
+// another data structure.
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"unicode/utf8"
+
+	"github.com/xyproto/simplebolt"
+	"github.com/xyproto/simplebolt/linkedlist"
+)
+
+const usage = `Usage: simplebolt [-json] FILE COMMAND [ARGUMENTS]
+
+Commands:
+  buckets                  list the IDs of all the buckets
+  dump BUCKET              show the contents of a bucket, in order
+  get BUCKET KEY           show the value of a key of a KeyValue
+  set BUCKET KEY VALUE     set a key of a KeyValue
+  del BUCKET KEY           remove a key of a KeyValue
+  export BUCKET [OUTFILE]  write the contents of a bucket as JSON
+  import BUCKET [INFILE]   read the contents of a bucket from JSON
+  stats [BUCKET]           show statistics about the buckets
+  compact OUTFILE          write a compacted copy of the database
+`
+
+// errUsage is returned by run if the arguments are wrong
+var errUsage = errors.New("Invalid arguments")
+
+// entry is a key and a value of a bucket that is not a linked list, as written
+// by dump -json and export
+type entry struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	// Encoding is "base64" if both Key and Value are base64 encoded
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// bucketStats is the JSON representation of the statistics of a bucket
+type bucketStats struct {
+	Bucket string `json:"bucket"`
+	Keys   int    `json:"keys"`
+	Depth  int    `json:"depth"`
+	Pages  int    `json:"pages"`
+	InUse  int    `json:"inuse"`
+}
+
+// command is one of the commands, with the allowed number of arguments
+type command struct {
+	minArgs, maxArgs int
+	run              func(c *cli, args []string) error
+}
+
+var commands = map[string]command{
+	"buckets": {0, 0, (*cli).buckets},
+	"dump":    {1, 1, (*cli).dump},
+	"get":     {2, 2, (*cli).get},
+	"set":     {3, 3, (*cli).set},
+	"del":     {2, 2, (*cli).del},
+	"export":  {1, 2, (*cli).export},
+	"import":  {1, 2, (*cli).importBucket},
+	"stats":   {0, 1, (*cli).stats},
+	"compact": {1, 1, (*cli).compact},
+}
+
+// cli holds what the commands need
+type cli struct {
+	db       *simplebolt.Database
+	json     bool
+	filename string
+	stdin    io.Reader
+	stdout   io.Writer
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		if errors.Is(err, errUsage) {
+			fmt.Fprint(os.Stderr, usage)
+		} else {
+			fmt.Fprintln(os.Stderr, "simplebolt:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+// run parses the arguments and runs the given command on the database
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("simplebolt", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	jsonOutput := flags.Bool("json", false, "write the output as JSON")
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("%w: %v", errUsage, err)
+	}
+	args = flags.Args()
+	if len(args) < 2 {
+		return errUsage
+	}
+	filename, name, args := args[0], args[1], args[2:]
+	cmd, ok := commands[name]
+	if !ok || len(args) < cmd.minArgs || len(args) > cmd.maxArgs {
+		return errUsage
+	}
+	// Do not let a typo create a new database file
+	if _, err := os.Stat(filename); err != nil {
+		return err
+	}
+	db, err := simplebolt.New(filename)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	c := &cli{db: db, json: *jsonOutput, filename: filename, stdin: stdin, stdout: stdout}
+	return cmd.run(c, args)
+}
+
+// writeJSON writes the given value as indented JSON
+func (c *cli) writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// buckets lists the IDs of all the buckets
+func (c *cli) buckets(args []string) error {
+	ids, err := c.db.Buckets()
+	if err != nil {
+		return err
+	}
+	if c.json {
+		if ids == nil {
+			ids = []string{}
+		}
+		return c.writeJSON(c.stdout, ids)
+	}
+	for _, id := range ids {
+		fmt.Fprintln(c.stdout, printable(id))
+	}
+	return nil
+}
+
+// dump shows the nodes of a linked list, or the keys and values of a bucket
+func (c *cli) dump(args []string) error {
+	if c.json {
+		return c.writeBucket(c.stdout, args[0])
+	}
+	ll, err := linkedlist.Open(c.db, args[0])
+	if err == nil {
+		return ll.ForEach(func(_, data []byte) error {
+			_, err := fmt.Fprintln(c.stdout, printable(string(data)))
+			return err
+		})
+	}
+	if !errors.Is(err, linkedlist.ErrNotLinkedList) {
+		return err
+	}
+	entries, err := c.entries(args[0])
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(c.stdout, 0, 8, 2, ' ', 0)
+	for _, e := range entries {
+		fmt.Fprintf(w, "%s\t%s\n", printable(e.Key), printable(e.Value))
+	}
+	return w.Flush()
+}
+
+// entries returns the keys and values of a bucket that is not a linked list, in
+// the order of the keys
+func (c *cli) entries(id string) ([]entry, error) {
+	kv, err := simplebolt.OpenKeyValue(c.db, id)
+	if err != nil {
+		return nil, err
+	}
+	all, err := kv.GetAllWithPrefix("")
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]entry, 0, len(all))
+	for key, value := range all {
+		entries = append(entries, entry{Key: key, Value: value})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Key < entries[j].Key
+	})
+	return entries, nil
+}
+
+// writeBucket writes the contents of a bucket as JSON
+func (c *cli) writeBucket(w io.Writer, id string) error {
+	ll, err := linkedlist.Open(c.db, id)
+	if err == nil {
+		return ll.ExportJSON(w)
+	}
+	if !errors.Is(err, linkedlist.ErrNotLinkedList) {
+		return err
+	}
+	entries, err := c.entries(id)
+	if err != nil {
+		return err
+	}
+	for i, e := range entries {
+		if !utf8.ValidString(e.Key) || !utf8.ValidString(e.Value) {
+			entries[i] = entry{
+				Key:      base64.StdEncoding.EncodeToString([]byte(e.Key)),
+				Value:    base64.StdEncoding.EncodeToString([]byte(e.Value)),
+				Encoding: "base64",
+			}
+		}
+	}
+	return c.writeJSON(w, entries)
+}
+
+// keyValue returns the KeyValue with the given ID, which is created if create is
+// true. Returns an error wrapping simplebolt.ErrWrongType if the bucket has been
+// recorded as holding another data structure.
+func (c *cli) keyValue(id string, create bool) (*simplebolt.KeyValue, error) {
+	structure, err := c.db.BucketType(id)
+	if err != nil && !(create && errors.Is(err, simplebolt.ErrBucketNotFound)) {
+		return nil, err
+	}
+	if structure != "" && structure != "KeyValue" {
+		return nil, fmt.Errorf("%w: %s is a %s, not a KeyValue", simplebolt.ErrWrongType, id, structure)
+	}
+	if create {
+		return simplebolt.NewKeyValue(c.db, id)
+	}
+	return simplebolt.OpenKeyValue(c.db, id)
+}
+
+// get shows the value of a key of a KeyValue
+func (c *cli) get(args []string) error {
+	kv, err := c.keyValue(args[0], false)
+	if err != nil {
+		return err
+	}
+	value, err := kv.Get(args[1])
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return c.writeJSON(c.stdout, value)
+	}
+	_, err = fmt.Fprintln(c.stdout, value)
+	return err
+}
+
+// set sets a key of a KeyValue
+func (c *cli) set(args []string) error {
+	kv, err := c.keyValue(args[0], true)
+	if err != nil {
+		return err
+	}
+	return kv.Set(args[1], args[2])
+}
+
+// del removes a key of a KeyValue
+func (c *cli) del(args []string) error {
+	kv, err := c.keyValue(args[0], false)
+	if err != nil {
+		return err
+	}
+	return kv.Del(args[1])
+}
+
+// export writes the contents of a bucket as JSON, to a new file or to stdout
+func (c *cli) export(args []string) error {
+	if len(args) == 1 {
+		return c.writeBucket(c.stdout, args[0])
+	}
+	f, err := os.OpenFile(args[1], os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if err := c.writeBucket(f, args[0]); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// importBucket reads the contents of a bucket from JSON, from a file or from
+// stdin. Nodes replace the nodes of a linked list, while keys and values are
+// set in a KeyValue, within a single transaction.
+func (c *cli) importBucket(args []string) error {
+	r := c.stdin
+	if len(args) == 2 {
+		f, err := os.Open(args[1])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	var objects []map[string]json.RawMessage
+	if err := json.Unmarshal(data, &objects); err != nil {
+		return err
+	}
+	if len(objects) > 0 {
+		if _, ok := objects[0]["data"]; ok {
+			ll, err := linkedlist.New(c.db, args[0])
+			if err != nil {
+				return err
+			}
+			return ll.ImportJSON(bytes.NewReader(data))
+		}
+	}
+	var entries []entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return err
+	}
+	return c.db.Do(func(txdb *simplebolt.TxDatabase) error {
+		kv, err := txdb.KeyValue(args[0])
+		if err != nil {
+			return err
+		}
+		for i, e := range entries {
+			switch e.Encoding {
+			case "":
+			case "base64":
+				key, err := base64.StdEncoding.DecodeString(e.Key)
+				if err != nil {
+					return fmt.Errorf("Could not decode the key of entry %d: %w", i, err)
+				}
+				value, err := base64.StdEncoding.DecodeString(e.Value)
+				if err != nil {
+					return fmt.Errorf("Could not decode the value of entry %d: %w", i, err)
+				}
+				e.Key, e.Value = string(key), string(value)
+			default:
+				return fmt.Errorf("Unknown encoding of entry %d: %q", i, e.Encoding)
+			}
+			if err := kv.Set(e.Key, e.Value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// stats shows statistics about all the buckets, or about the given one
+func (c *cli) stats(args []string) error {
+	ids := args
+	if len(ids) == 0 {
+		var err error
+		if ids, err = c.db.Buckets(); err != nil {
+			return err
+		}
+	}
+	all := []bucketStats{}
+	for _, id := range ids {
+		s, err := c.db.Stats(id)
+		if err != nil {
+			return err
+		}
+		all = append(all, bucketStats{id, s.Keys, s.Depth, s.Pages, s.InUse})
+	}
+	if c.json {
+		return c.writeJSON(c.stdout, all)
+	}
+	w := tabwriter.NewWriter(c.stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "BUCKET\tKEYS\tDEPTH\tPAGES\tINUSE")
+	for _, s := range all {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\n", printable(s.Bucket), s.Keys, s.Depth, s.Pages, s.InUse)
+	}
+	return w.Flush()
+}
+
+// compact writes a compacted copy of the database to a new file, and shows the
+// sizes of both files
+func (c *cli) compact(args []string) error {
+	if err := c.db.CompactTo(args[0]); err != nil {
+		return err
+	}
+	before, err := os.Stat(c.filename)
+	if err != nil {
+		return err
+	}
+	after, err := os.Stat(args[0])
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return c.writeJSON(c.stdout, map[string]int64{
+			"before": before.Size(),
+			"after":  after.Size(),
+		})
+	}
+	_, err = fmt.Fprintf(c.stdout, "Compacted %d bytes to %d bytes\n", before.Size(), after.Size())
+	return err
+}
+
+// printable returns the given string as it is, if it is valid UTF-8 without
+// control characters, or else quoted
+func printable(s string) string {
+	if strconv.CanBackquote(s) {
+		return s
+	}
+	return strconv.Quote(s)
+}
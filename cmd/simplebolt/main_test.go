@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xyproto/simplebolt"
+	"github.com/xyproto/simplebolt/linkedlist"
+)
+
+// newTestDB creates a database file with a KeyValue, a linked list and a List
+func newTestDB(t *testing.T) string {
+	filename := filepath.Join(t.TempDir(), "bolt.db")
+	db, err := simplebolt.New(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	kv, err := simplebolt.NewKeyValue(db, "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kv.Set("b", "2")
+	kv.Set("a", "1")
+	ll, err := linkedlist.New(db, "queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ll.PushBack([]byte("A"))
+	ll.PushBack([]byte("B"))
+	ll.PushFront([]byte("C"))
+	l, err := simplebolt.NewList(db, "log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Add("started")
+	return filename
+}
+
+// runCLI runs the command line tool with the given arguments and stdin, and
+// returns what was written to stdout
+func runCLI(t *testing.T, stdin string, args ...string) (string, error) {
+	var stdout bytes.Buffer
+	err := run(args, strings.NewReader(stdin), &stdout)
+	return stdout.String(), err
+}
+
+// mustRun runs the command line tool like runCLI, and fails the test on errors
+func mustRun(t *testing.T, args ...string) string {
+	out, err := runCLI(t, "", args...)
+	if err != nil {
+		t.Fatalf("Error, %v failed! %v", args, err)
+	}
+	return out
+}
+
+func TestBucketsAndDump(t *testing.T) {
+	filename := newTestDB(t)
+	if out := mustRun(t, filename, "buckets"); out != "config\nlog\nqueue\n" {
+		t.Errorf("Error, wrong buckets! %q", out)
+	}
+	if out := mustRun(t, "-json", filename, "buckets"); out != "[\n  \"config\",\n  \"log\",\n  \"queue\"\n]\n" {
+		t.Errorf("Error, wrong JSON buckets! %q", out)
+	}
+	if out := mustRun(t, filename, "dump", "queue"); out != "C\nA\nB\n" {
+		t.Errorf("Error, wrong order of the linked list! %q", out)
+	}
+	if out := mustRun(t, filename, "dump", "config"); out != "a  1\nb  2\n" {
+		t.Errorf("Error, wrong key/values! %q", out)
+	}
+	// The keys of a List are not printable
+	if out := mustRun(t, filename, "dump", "log"); !strings.Contains(out, `"\x01\x00\x00\x00\x00\x00\x00\x00"`) || !strings.HasSuffix(out, "started\n") {
+		t.Errorf("Error, wrong list! %q", out)
+	}
+	var entries []entry
+	if err := json.Unmarshal([]byte(mustRun(t, "-json", filename, "dump", "log")), &entries); err != nil || len(entries) != 1 || entries[0].Key != "\x01\x00\x00\x00\x00\x00\x00\x00" {
+		t.Errorf("Error, wrong JSON list! %v %v", entries, err)
+	}
+	if _, err := runCLI(t, "", filename, "dump", "missing"); !errors.Is(err, simplebolt.ErrBucketNotFound) {
+		t.Errorf("Error, expected ErrBucketNotFound, got %v", err)
+	}
+}
+
+func TestGetSetDel(t *testing.T) {
+	filename := newTestDB(t)
+	if out := mustRun(t, filename, "get", "config", "a"); out != "1\n" {
+		t.Errorf("Error, wrong value! %q", out)
+	}
+	mustRun(t, filename, "set", "config", "c", "3")
+	if out := mustRun(t, "-json", filename, "get", "config", "c"); out != "\"3\"\n" {
+		t.Errorf("Error, wrong JSON value! %q", out)
+	}
+	mustRun(t, filename, "del", "config", "c")
+	if _, err := runCLI(t, "", filename, "get", "config", "c"); !errors.Is(err, simplebolt.ErrKeyNotFound) {
+		t.Errorf("Error, expected ErrKeyNotFound, got %v", err)
+	}
+	// set creates the KeyValue, but get does not
+	mustRun(t, filename, "set", "new", "key", "value")
+	if _, err := runCLI(t, "", filename, "get", "other", "key"); !errors.Is(err, simplebolt.ErrBucketNotFound) {
+		t.Errorf("Error, expected ErrBucketNotFound, got %v", err)
+	}
+	// Buckets that hold other data structures are refused
+	for _, args := range [][]string{{"set", "log", "key", "value"}, {"get", "log", "key"}, {"del", "queue", "key"}, {"import", "log"}} {
+		if _, err := runCLI(t, "[]", append([]string{filename}, args...)...); !errors.Is(err, simplebolt.ErrWrongType) {
+			t.Errorf("Error, expected ErrWrongType for %v, got %v", args, err)
+		}
+	}
+	if out := mustRun(t, filename, "dump", "log"); !strings.HasSuffix(out, "started\n") {
+		t.Errorf("Error, the list was changed! %q", out)
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	filename := newTestDB(t)
+	exported := filepath.Join(t.TempDir(), "queue.json")
+	mustRun(t, filename, "export", "queue", exported)
+	if _, err := runCLI(t, "", filename, "export", "queue", exported); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("Error, expected the export file to not be overwritten, got %v", err)
+	}
+	mustRun(t, filename, "import", "queue2", exported)
+	if out := mustRun(t, filename, "dump", "queue2"); out != "C\nA\nB\n" {
+		t.Errorf("Error, wrong imported linked list! %q", out)
+	}
+
+	config := mustRun(t, filename, "export", "config")
+	if _, err := runCLI(t, config, filename, "import", "config2"); err != nil {
+		t.Error(err)
+	}
+	if out := mustRun(t, filename, "dump", "config2"); out != "a  1\nb  2\n" {
+		t.Errorf("Error, wrong imported key/values! %q", out)
+	}
+	mustRun(t, filename, "set", "binary", "\xff", "value")
+	binary := mustRun(t, filename, "export", "binary")
+	if !strings.Contains(binary, `"encoding": "base64"`) {
+		t.Errorf("Error, expected a base64 encoded entry! %s", binary)
+	}
+	if _, err := runCLI(t, binary, filename, "import", "binary2"); err != nil {
+		t.Error(err)
+	}
+	if out := mustRun(t, filename, "export", "binary2"); out != binary {
+		t.Errorf("Error, the base64 encoded entries did not survive the round trip! %q", out)
+	}
+	if _, err := runCLI(t, `[{"key": "a", "value": "b", "encoding": "rot13"}]`, filename, "import", "config3"); err == nil {
+		t.Error("Error, expected an error for an unknown encoding!")
+	}
+}
+
+func TestStatsAndCompact(t *testing.T) {
+	filename := newTestDB(t)
+	var stats []bucketStats
+	if err := json.Unmarshal([]byte(mustRun(t, "-json", filename, "stats")), &stats); err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 3 || stats[0].Bucket != "config" || stats[0].Keys != 2 {
+		t.Errorf("Error, wrong stats! %v", stats)
+	}
+	if out := mustRun(t, filename, "stats", "config"); !strings.HasPrefix(out, "BUCKET") || !strings.Contains(out, "config  2") {
+		t.Errorf("Error, wrong stats! %q", out)
+	}
+
+	compacted := filepath.Join(t.TempDir(), "compacted.db")
+	if out := mustRun(t, filename, "compact", compacted); !strings.HasPrefix(out, "Compacted ") {
+		t.Errorf("Error, wrong output! %q", out)
+	}
+	if out := mustRun(t, compacted, "dump", "queue"); out != "C\nA\nB\n" {
+		t.Errorf("Error, wrong linked list in the compacted database! %q", out)
+	}
+	if _, err := runCLI(t, "", filename, "compact", compacted); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("Error, expected the compacted file to not be overwritten, got %v", err)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	filename := newTestDB(t)
+	for _, args := range [][]string{
+		{},
+		{filename},
+		{filename, "unknown"},
+		{filename, "get", "config"},
+		{"-unknown", filename, "buckets"},
+	} {
+		if _, err := runCLI(t, "", args...); !errors.Is(err, errUsage) {
+			t.Errorf("Error, expected errUsage for %v, got %v", args, err)
+		}
+	}
+	missing := filepath.Join(t.TempDir(), "missing.db")
+	if _, err := runCLI(t, "", missing, "buckets"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Error, expected fs.ErrNotExist, got %v", err)
+	}
+	if _, err := os.Stat(missing); err == nil {
+		t.Error("Error, the database file was created!")
+	}
+}
@@ -0,0 +1,220 @@
+package simplebolt
+
+// codec.go provides encoding of arbitrary values, such as structs, so that they
+// can be stored in a List, KeyValue or HashMap without marshaling them at every
+// call site.
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"reflect"
+)
+
+// Codec is a method for encoding values to bytes and back
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// JSONCodec encodes values as JSON. This is the default codec.
+type JSONCodec struct{}
+
+// Marshal encodes v as JSON
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal decodes the JSON in data into v
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// GobCodec encodes values with encoding/gob. Each value is encoded on its own,
+// together with the description of its type.
+type GobCodec struct{}
+
+// Marshal encodes v with gob
+func (GobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal decodes the gob in data into v
+func (GobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// ErrInvalidOutput is returned by GetAllValues when not given a pointer to a slice
+var ErrInvalidOutput = errors.New("Output must be a pointer to a slice")
+
+// SetCodec sets the codec used by AddValue, GetAllValues, SetValue and GetValue.
+// Values that have been stored with one codec can not be read with another, so
+// the codec should be set once, right after opening the database. Pass nil to
+// go back to the default, JSONCodec.
+func (db *Database) SetCodec(codec Codec) {
+	db.updateSettings(func(s *settings) {
+		s.codec = codec
+	})
+}
+
+// Codec returns the codec used for encoding values
+func (db *Database) Codec() Codec {
+	if codec := db.settings().codec; codec != nil {
+		return codec
+	}
+	return JSONCodec{}
+}
+
+// AddValue encodes the given value with the codec of the database, and adds it
+// to the list
+func (l *List) AddValue(value interface{}) error {
+	if !l.exists() {
+		return ErrDoesNotExist
+	}
+	data, err := l.db.Codec().Marshal(value)
+	if err != nil {
+		return wrapError("List.AddValue", l.name, "", err)
+	}
+	return l.Add(string(data))
+}
+
+// GetAllValues decodes all elements in the list with the codec of the
+// database, and stores them in the slice that out points to, replacing its
+// contents. Returns ErrInvalidOutput if out is not a pointer to a slice.
+//
+//	var users []User
+//	err := list.GetAllValues(&users)
+func (l *List) GetAllValues(out interface{}) error {
+	if !l.exists() {
+		return ErrDoesNotExist
+	}
+	ptr := reflect.ValueOf(out)
+	if ptr.Kind() != reflect.Ptr || ptr.IsNil() || ptr.Elem().Kind() != reflect.Slice {
+		return wrapError("List.GetAllValues", l.name, "", ErrInvalidOutput)
+	}
+	values, err := l.All()
+	if err != nil {
+		return err
+	}
+	codec := l.db.Codec()
+	slice := reflect.MakeSlice(ptr.Elem().Type(), len(values), len(values))
+	for i, value := range values {
+		if err := codec.Unmarshal([]byte(value), slice.Index(i).Addr().Interface()); err != nil {
+			return wrapError("List.GetAllValues", l.name, "", err)
+		}
+	}
+	ptr.Elem().Set(slice)
+	return nil
+}
+
+// SetValue encodes the given value with the codec of the database, and stores
+// it under the given key
+func (kv *KeyValue) SetValue(key string, value interface{}) error {
+	if !kv.exists() {
+		return ErrDoesNotExist
+	}
+	data, err := kv.db.Codec().Marshal(value)
+	if err != nil {
+		return wrapError("KeyValue.SetValue", kv.name, key, err)
+	}
+	return kv.Set(key, string(data))
+}
+
+// GetValue decodes the value stored under the given key with the codec of the
+// database, into the value that out points to
+func (kv *KeyValue) GetValue(key string, out interface{}) error {
+	if !kv.exists() {
+		return ErrDoesNotExist
+	}
+	data, err := kv.Get(key)
+	if err != nil {
+		return err
+	}
+	return wrapError("KeyValue.GetValue", kv.name, key, kv.db.Codec().Unmarshal([]byte(data), out))
+}
+
+// SetValue encodes the given value with the codec of the database, and stores
+// it in the hash map, given the element id and the key
+func (h *HashMap) SetValue(elementid, key string, value interface{}) error {
+	if !h.exists() {
+		return ErrDoesNotExist
+	}
+	data, err := h.db.Codec().Marshal(value)
+	if err != nil {
+		return wrapError("HashMap.SetValue", h.name, elementid+":"+key, err)
+	}
+	return h.Set(elementid, key, string(data))
+}
+
+// GetValue decodes the value stored in the hash map for the given element id
+// and key with the codec of the database, into the value that out points to
+func (h *HashMap) GetValue(elementid, key string, out interface{}) error {
+	if !h.exists() {
+		return ErrDoesNotExist
+	}
+	data, err := h.Get(elementid, key)
+	if err != nil {
+		return err
+	}
+	return wrapError("HashMap.GetValue", h.name, elementid+":"+key, h.db.Codec().Unmarshal([]byte(data), out))
+}
+
+// SetJSON encodes the given value as JSON and stores it under the given key,
+// regardless of the codec of the database. The JSON is stored as it is, so it
+// can also be read with Get.
+func (kv *KeyValue) SetJSON(key string, v interface{}) error {
+	if !kv.exists() {
+		return ErrDoesNotExist
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return wrapError("KeyValue.SetJSON", kv.name, key, err)
+	}
+	return kv.Set(key, string(data))
+}
+
+// GetJSON decodes the JSON stored under the given key into the value that out
+// points to, regardless of the codec of the database
+func (kv *KeyValue) GetJSON(key string, out interface{}) error {
+	if !kv.exists() {
+		return ErrDoesNotExist
+	}
+	data, err := kv.Get(key)
+	if err != nil {
+		return err
+	}
+	return wrapError("KeyValue.GetJSON", kv.name, key, json.Unmarshal([]byte(data), out))
+}
+
+// SetJSONField encodes the given value as JSON and stores it in the hash map,
+// given the element id and the key, regardless of the codec of the database.
+// The JSON is stored as it is, so it can also be read with Get.
+func (h *HashMap) SetJSONField(elementid, key string, v interface{}) error {
+	if !h.exists() {
+		return ErrDoesNotExist
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return wrapError("HashMap.SetJSONField", h.name, elementid+":"+key, err)
+	}
+	return h.Set(elementid, key, string(data))
+}
+
+// GetJSONField decodes the JSON stored in the hash map for the given element id
+// and key into the value that out points to, regardless of the codec of the
+// database
+func (h *HashMap) GetJSONField(elementid, key string, out interface{}) error {
+	if !h.exists() {
+		return ErrDoesNotExist
+	}
+	data, err := h.Get(elementid, key)
+	if err != nil {
+		return err
+	}
+	return wrapError("HashMap.GetJSONField", h.name, elementid+":"+key, json.Unmarshal([]byte(data), out))
+}
@@ -0,0 +1,81 @@
+// Package codec provides encoding of values of a given type to bytes and back,
+// for the typed wrappers of the data structures in simplebolt and linkedlist.
+// A codec for another encoding, like protobuf or msgpack, only needs to
+// implement the Codec interface to be usable with all of them.
+package codec
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+)
+
+// Codec encodes values of type T to bytes, and decodes them back
+type Codec[T any] interface {
+	Marshal(value T) ([]byte, error)
+	Unmarshal(data []byte) (T, error)
+}
+
+// JSONCodec encodes values as JSON
+type JSONCodec[T any] struct{}
+
+// Marshal encodes the given value as JSON
+func (JSONCodec[T]) Marshal(value T) ([]byte, error) {
+	return json.Marshal(value)
+}
+
+// Unmarshal decodes a value from the given JSON
+func (JSONCodec[T]) Unmarshal(data []byte) (T, error) {
+	var value T
+	err := json.Unmarshal(data, &value)
+	return value, err
+}
+
+// GobCodec encodes values with encoding/gob. Each value is encoded on its own,
+// together with the description of its type.
+type GobCodec[T any] struct{}
+
+// Marshal encodes the given value with gob
+func (GobCodec[T]) Marshal(value T) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(value); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal decodes a value from the given gob data
+func (GobCodec[T]) Unmarshal(data []byte) (T, error) {
+	var value T
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&value)
+	return value, err
+}
+
+// RawBytesCodec stores byte slices as they are
+type RawBytesCodec struct{}
+
+// Marshal returns the given bytes
+func (RawBytesCodec) Marshal(value []byte) ([]byte, error) {
+	return value, nil
+}
+
+// Unmarshal returns a copy of the given bytes
+func (RawBytesCodec) Unmarshal(data []byte) ([]byte, error) {
+	return append([]byte{}, data...), nil
+}
+
+// Funcs is a Codec that uses the given functions
+type Funcs[T any] struct {
+	MarshalFunc   func(value T) ([]byte, error)
+	UnmarshalFunc func(data []byte) (T, error)
+}
+
+// Marshal encodes the given value with MarshalFunc
+func (c Funcs[T]) Marshal(value T) ([]byte, error) {
+	return c.MarshalFunc(value)
+}
+
+// Unmarshal decodes the given data with UnmarshalFunc
+func (c Funcs[T]) Unmarshal(data []byte) (T, error) {
+	return c.UnmarshalFunc(data)
+}
@@ -0,0 +1,42 @@
+package codec
+
+import (
+	"bytes"
+	"testing"
+)
+
+type point struct {
+	X, Y int
+}
+
+func TestCodecs(t *testing.T) {
+	for name, c := range map[string]Codec[point]{
+		"json": JSONCodec[point]{},
+		"gob":  GobCodec[point]{},
+		"funcs": Funcs[point]{
+			MarshalFunc:   JSONCodec[point]{}.Marshal,
+			UnmarshalFunc: JSONCodec[point]{}.Unmarshal,
+		},
+	} {
+		data, err := c.Marshal(point{1, 2})
+		if err != nil {
+			t.Errorf("Error, could not marshal with %s! %v", name, err)
+		}
+		if p, err := c.Unmarshal(data); err != nil || p != (point{1, 2}) {
+			t.Errorf("Error, wrong value from %s! %v %v", name, p, err)
+		}
+		if _, err := c.Unmarshal([]byte("\x00garbage")); err == nil {
+			t.Errorf("Error, expected %s to fail for invalid data!", name)
+		}
+	}
+	data := []byte("raw")
+	encoded, _ := RawBytesCodec{}.Marshal(data)
+	decoded, _ := RawBytesCodec{}.Unmarshal(encoded)
+	if !bytes.Equal(decoded, data) {
+		t.Errorf("Error, wrong raw bytes! %q", decoded)
+	}
+	decoded[0] = 'x'
+	if !bytes.Equal(encoded, data) {
+		t.Errorf("Error, expected Unmarshal to return a copy!")
+	}
+}
@@ -0,0 +1,106 @@
+package simplebolt
+
+// compression.go provides transparent compression of the values stored in
+// List, KeyValue and HashMap buckets.
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io/ioutil"
+)
+
+// Compression is a method for compressing stored values
+type Compression int
+
+const (
+	// NoCompression stores values as they are. This is the default.
+	NoCompression Compression = iota
+	// Gzip compresses values with gzip before they are stored
+	Gzip
+)
+
+// compressedHeader is stored in front of every compressed value. It is followed by
+// the gzip header (0x1f, 0x8b), which makes it very unlikely that an uncompressed
+// value is mistaken for a compressed one.
+const compressedHeader = 0x00
+
+// escapedHeader is stored in front of the uncompressed values that begin with
+// compressedHeader and 0x1f, so that they are not mistaken for compressed or
+// escaped values when they are read
+var escapedHeader = []byte{compressedHeader, 0x1f, 0x00}
+
+// ErrInvalidCompression is returned when setting an unknown compression method
+var ErrInvalidCompression = errors.New("Invalid compression method")
+
+// SetCompression sets the compression method used for the values that are
+// written to List, KeyValue and HashMap buckets from now on. Values are decompressed
+// when they are read, regardless of this setting, so compressed and
+// uncompressed values can be mixed within the same bucket.
+func (db *Database) SetCompression(c Compression) error {
+	if c != NoCompression && c != Gzip {
+		return ErrInvalidCompression
+	}
+	db.updateSettings(func(s *settings) {
+		s.compression = c
+	})
+	return nil
+}
+
+// Compression returns the compression method used for writing values
+func (db *Database) Compression() Compression {
+	return db.settings().compression
+}
+
+// encodeValue compresses the given value, if compression is enabled, and then
+// encrypts it, if a value cipher has been set. An uncompressed value that begins
+// like a compressed one is escaped.
+func (db *Database) encodeValue(value []byte) ([]byte, error) {
+	if err := db.Fault("encode"); err != nil {
+		return nil, err
+	}
+	if db.settings().compression != Gzip {
+		if len(value) > 1 && value[0] == compressedHeader && value[1] == 0x1f {
+			value = append(append([]byte{}, escapedHeader...), value...)
+		}
+	} else {
+		var buf bytes.Buffer
+		buf.WriteByte(compressedHeader)
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(value); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		value = buf.Bytes()
+	}
+	return db.EncryptValue(value)
+}
+
+// isCompressed checks if the given stored value has been compressed
+func isCompressed(value []byte) bool {
+	return len(value) > 2 && value[0] == compressedHeader && value[1] == 0x1f && value[2] == 0x8b
+}
+
+// decodeValue decrypts the given stored value, if a value cipher has been set,
+// and decompresses or unescapes it. The returned slice is the given slice, or a
+// part of it, if the value was neither encrypted nor compressed.
+func (db *Database) decodeValue(value []byte) ([]byte, error) {
+	value, err := db.DecryptValue(value)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(value, escapedHeader) {
+		return value[len(escapedHeader):], nil
+	}
+	if !isCompressed(value) {
+		return value, nil
+	}
+	r, err := gzip.NewReader(bytes.NewReader(value[1:]))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
@@ -16,6 +16,12 @@ func NewCreator(db *Database) *BoltCreator {
 	return &BoltCreator{db}
 }
 
+// Database returns the database that the data structures are created in. It
+// can be used by packages that extend the creator with other data structures.
+func (b *BoltCreator) Database() *Database {
+	return b.db
+}
+
 // NewList can create a new List with the given ID
 func (b *BoltCreator) NewList(id string) (pinterface.IList, error) {
 	return NewList(b.db, id)
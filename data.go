@@ -13,7 +13,7 @@ type StoredData interface {
 	// Update resets the value of the element at
 	// which the item refers to with newData.
 	//
-	// Returns "Empty data" error if newData is nil.
+	// Returns ErrEmptyData if newData is nil.
 	//
 	// It may also return an error in case of bbolt Update or protocol buffer
 	// serialization/deserialization fail. In both cases, the data isn't updated.
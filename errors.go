@@ -0,0 +1,58 @@
+package simplebolt
+
+// errors.go defines the error type that is used for giving context to the
+// errors returned by the methods of the data structures.
+
+import (
+	"errors"
+
+	"go.etcd.io/bbolt"
+)
+
+// OpError is the error type returned by the methods of List, Set, HashMap and
+// KeyValue. It wraps the underlying error together with the name of the failed
+// operation and the bucket and key that were involved.
+//
+// Use errors.Is to check for the underlying error, and errors.As to retrieve
+// the context:
+//
+//	var opErr *simplebolt.OpError
+//	if errors.As(err, &opErr) {
+//		log.Println("failed bucket:", opErr.Bucket)
+//	}
+type OpError struct {
+	Op     string // the operation, for instance "KeyValue.Get"
+	Bucket string // the name of the bucket
+	Key    string // the key or value involved, if any
+	Err    error  // the underlying error
+}
+
+// Error returns a description of the failed operation
+func (e *OpError) Error() string {
+	if e.Key == "" {
+		return e.Op + " " + e.Bucket + ": " + e.Err.Error()
+	}
+	return e.Op + " " + e.Bucket + " " + e.Key + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *OpError) Unwrap() error {
+	return e.Err
+}
+
+// wrapError returns err wrapped in an *OpError, or nil if err is nil
+func wrapError(op string, bucket []byte, key string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &OpError{Op: op, Bucket: string(bucket), Key: key, Err: closedError(err)}
+}
+
+// closedError returns ErrDatabaseClosed instead of the error that Bolt returns
+// when a closed database is used, and any other error as it is
+func closedError(err error) error {
+	if errors.Is(err, bbolt.ErrDatabaseNotOpen) {
+		return ErrDatabaseClosed
+	}
+	return err
+}
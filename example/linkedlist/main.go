@@ -8,68 +8,45 @@ import (
 
 	"github.com/golang/protobuf/proto"
 	"github.com/xyproto/simplebolt"
+	"github.com/xyproto/simplebolt/codec"
 	pb "github.com/xyproto/simplebolt/example/linkedlist/currencypb"
 	"github.com/xyproto/simplebolt/linkedlist"
 )
 
-type cryptoCurrency struct {
-	cc *pb.Currency
-}
+// protoCodec encodes and decodes currencies with protocol buffers. It implements
+// codec.Codec, so it can be used with any of the typed data structures.
+type protoCodec struct{}
 
-func (data *cryptoCurrency) MustMarshal() []byte {
-	b, err := proto.Marshal(data.cc)
-	if err != nil {
-		log.Fatalf("Could not marshal. %v\n", err)
-	}
-	return b
+func (protoCodec) Marshal(cc *pb.Currency) ([]byte, error) {
+	return proto.Marshal(cc)
 }
 
-func (data *cryptoCurrency) MustUnmarshal(from []byte) {
-	err := proto.Unmarshal(from, data.cc)
-	if err != nil {
-		log.Fatalf("Could not unmarshal. %v\n", err)
+func (protoCodec) Unmarshal(data []byte) (*pb.Currency, error) {
+	cc := &pb.Currency{}
+	if err := proto.Unmarshal(data, cc); err != nil {
+		return nil, err
 	}
+	return cc, nil
 }
 
-func (data cryptoCurrency) GetName() string {
-	return data.cc.GetName()
-}
+var currencyCodec codec.Codec[*pb.Currency] = protoCodec{}
 
-var cryptoCurrencies = []*cryptoCurrency{
+var cryptoCurrencies = []*pb.Currency{
 	{
-		cc: &pb.Currency{
-			Name:             "BTC",
-			HighestPriceDate: "December 17, 2017",
-			HighestPrice:     "19,891.0 USD",
-		},
+		Name:             "BTC",
+		HighestPriceDate: "December 17, 2017",
+		HighestPrice:     "19,891.0 USD",
 	}, {
-		cc: &pb.Currency{
-			Name:             "ETH",
-			HighestPriceDate: "January 13, 2018",
-			HighestPrice:     "1,448.18 USD",
-		},
+		Name:             "ETH",
+		HighestPriceDate: "January 13, 2018",
+		HighestPrice:     "1,448.18 USD",
 	}, {
-		cc: &pb.Currency{
-			Name:             "XRP",
-			HighestPriceDate: "January 07, 2018",
-			HighestPrice:     "3.40 USD",
-		},
+		Name:             "XRP",
+		HighestPriceDate: "January 07, 2018",
+		HighestPrice:     "3.40 USD",
 	},
 }
 
-var output = &cryptoCurrency{
-	cc: &pb.Currency{},
-}
-
-func equals(a interface{}, b []byte) bool {
-	data := &cryptoCurrency{
-		cc: &pb.Currency{},
-	}
-	val := a.(string)
-	data.MustUnmarshal(b)
-	return data.cc.Name == val
-}
-
 func main() {
 	// Create and open database
 	ll, db := setUp()
@@ -77,9 +54,9 @@ func main() {
 
 	var err error
 	// Insert data at the end of the list
-	for _, data := range cryptoCurrencies {
-		fmt.Printf("PushBack data: %v\n", data.cc.Name)
-		err = ll.PushBack(data.MustMarshal())
+	for _, cc := range cryptoCurrencies {
+		fmt.Printf("PushBack data: %v\n", cc.Name)
+		err = ll.PushBack(cc)
 		if err != nil {
 			log.Fatalf("Could not push back data. %v\n", err)
 		}
@@ -91,14 +68,12 @@ func main() {
 	if err != nil {
 		log.Fatalf("Could not get last item. %v\n", err)
 	}
-	ltc := &cryptoCurrency{
-		cc: &pb.Currency{
-			Name:             "LTC",
-			HighestPriceDate: "December 18, 2017",
-			HighestPrice:     "360.66 USD",
-		},
+	ltc := &pb.Currency{
+		Name:             "LTC",
+		HighestPriceDate: "December 18, 2017",
+		HighestPrice:     "360.66 USD",
 	}
-	err = ll.InsertBefore(ltc.MustMarshal(), item)
+	err = ll.InsertBefore(ltc, item)
 	if err != nil {
 		log.Fatalf("Could not insert before back. %v\n", err)
 	}
@@ -106,12 +81,13 @@ func main() {
 	list(ll)
 
 	fmt.Println("\nGet ETH")
-	item, err = ll.GetFunc("ETH", equals)
+	item, err = ll.GetFunc(func(cc *pb.Currency) bool {
+		return cc.Name == "ETH"
+	})
 	if err != nil {
 		log.Fatalf("Could not get ETH. %v\n", err)
 	}
-	output.MustUnmarshal(item.Data.Value())
-	fmt.Printf("%v\n", output.cc.Name)
+	fmt.Printf("%v\n", item.Value.Name)
 
 	err = ll.MoveToFront(item)
 	if err != nil {
@@ -122,13 +98,12 @@ func main() {
 	if err != nil {
 		log.Fatalf("Could not get front item. %v\n", err)
 	}
-	output.MustUnmarshal(item.Data.Value())
-	fmt.Printf("Front: %v\n", output.cc.Name)
+	fmt.Printf("Front: %v\n", item.Value.Name)
 
 	list(ll)
 }
 
-func setUp() (*linkedlist.LinkedList, *simplebolt.Database) {
+func setUp() (*linkedlist.Typed[*pb.Currency], *simplebolt.Database) {
 	// Retrieve a temporary path.
 	f, err := ioutil.TempFile("", "")
 	if err != nil {
@@ -146,7 +121,7 @@ func setUp() (*linkedlist.LinkedList, *simplebolt.Database) {
 	if err != nil {
 		log.Fatalf("Could not create new list. %v", err)
 	}
-	return ll, db
+	return linkedlist.NewTyped[*pb.Currency](ll, currencyCodec), db
 }
 
 func tearDown(db *simplebolt.Database) {
@@ -154,7 +129,7 @@ func tearDown(db *simplebolt.Database) {
 	db.Close()
 }
 
-func list(ll *linkedlist.LinkedList) {
+func list(ll *linkedlist.Typed[*pb.Currency]) {
 	// Iterate forwards
 	forwards(ll)
 
@@ -162,7 +137,7 @@ func list(ll *linkedlist.LinkedList) {
 	backwards(ll)
 }
 
-func backwards(ll *linkedlist.LinkedList) {
+func backwards(ll *linkedlist.Typed[*pb.Currency]) {
 	item, err := ll.Back()
 	if err != nil {
 		log.Fatalf("Could not get last item. %v\n", err)
@@ -171,26 +146,14 @@ func backwards(ll *linkedlist.LinkedList) {
 	fmt.Println("\nBackward iteration")
 
 	for item != nil {
-		output.MustUnmarshal(item.Data.Value())
-		name := output.cc.Name
-		if item.Prev() != nil {
-			output.MustUnmarshal(item.Prev().Data.Value())
-			fmt.Printf("Prev: %v\t", output.cc.Name)
-		} else {
-			fmt.Printf("\t\t")
-		}
-		fmt.Printf("Name: %v\t", name)
-		if item.Next() != nil {
-			output.MustUnmarshal(item.Next().Data.Value())
-			fmt.Printf("Next: %v\n", output.cc.Name)
-		} else {
-			fmt.Println()
+		printItem(item)
+		if item, err = item.Prev(); err != nil {
+			log.Fatalf("Could not get previous item. %v\n", err)
 		}
-		item = item.Prev()
 	}
 }
 
-func forwards(ll *linkedlist.LinkedList) {
+func forwards(ll *linkedlist.Typed[*pb.Currency]) {
 	item, err := ll.Front()
 	if err != nil {
 		log.Fatalf("Could not get front item. %v\n", err)
@@ -199,21 +162,32 @@ func forwards(ll *linkedlist.LinkedList) {
 	fmt.Println("\nForward iteration")
 
 	for item != nil {
-		output.MustUnmarshal(item.Data.Value())
-		name := output.cc.Name
-		if item.Prev() != nil {
-			output.MustUnmarshal(item.Prev().Data.Value())
-			fmt.Printf("Prev: %v\t", output.cc.Name)
-		} else {
-			fmt.Printf("\t\t")
-		}
-		fmt.Printf("Name: %v\t", name)
-		if item.Next() != nil {
-			output.MustUnmarshal(item.Next().Data.Value())
-			fmt.Printf("Next: %v\n", output.cc.Name)
-		} else {
-			fmt.Println()
+		printItem(item)
+		if item, err = item.Next(); err != nil {
+			log.Fatalf("Could not get next item. %v\n", err)
 		}
-		item = item.Next()
+	}
+}
+
+// printItem prints the name of the given currency, together with its siblings
+func printItem(item *linkedlist.TypedItem[*pb.Currency]) {
+	prev, err := item.Prev()
+	if err != nil {
+		log.Fatalf("Could not get previous item. %v\n", err)
+	}
+	next, err := item.Next()
+	if err != nil {
+		log.Fatalf("Could not get next item. %v\n", err)
+	}
+	if prev != nil {
+		fmt.Printf("Prev: %v\t", prev.Value.Name)
+	} else {
+		fmt.Printf("\t\t")
+	}
+	fmt.Printf("Name: %v\t", item.Value.Name)
+	if next != nil {
+		fmt.Printf("Next: %v\n", next.Value.Name)
+	} else {
+		fmt.Println()
 	}
 }
@@ -0,0 +1,49 @@
+// Package expvarmetrics provides a simplebolt.Metrics that publishes the number
+// of operations, the number of failed operations and the total time spent in
+// them with expvar, where they can be scraped, for instance by the Prometheus
+// expvar collector.
+package expvarmetrics
+
+import (
+	"expvar"
+	"time"
+)
+
+// Metrics counts the operations of a simplebolt.Database in an expvar.Map. The
+// map has the maps "calls", "errors" and "nanoseconds", with the operations as
+// keys, like "List.Add".
+type Metrics struct {
+	calls       *expvar.Map
+	errors      *expvar.Map
+	nanoseconds *expvar.Map
+}
+
+// New returns a Metrics that is published with expvar under the given name.
+// Like expvar.NewMap, it panics if the name is already in use.
+func New(name string) *Metrics {
+	return NewWithMap(expvar.NewMap(name))
+}
+
+// NewWithMap returns a Metrics that stores the counters in the given map, which
+// may be published by the caller
+func NewWithMap(m *expvar.Map) *Metrics {
+	metrics := &Metrics{
+		calls:       new(expvar.Map).Init(),
+		errors:      new(expvar.Map).Init(),
+		nanoseconds: new(expvar.Map).Init(),
+	}
+	m.Set("calls", metrics.calls)
+	m.Set("errors", metrics.errors)
+	m.Set("nanoseconds", metrics.nanoseconds)
+	return metrics
+}
+
+// ObserveOp counts the given operation, and adds its duration
+func (m *Metrics) ObserveOp(structure, op string, d time.Duration, err error) {
+	key := structure + "." + op
+	m.calls.Add(key, 1)
+	if err != nil {
+		m.errors.Add(key, 1)
+	}
+	m.nanoseconds.Add(key, int64(d))
+}
@@ -0,0 +1,48 @@
+package expvarmetrics
+
+import (
+	"expvar"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/xyproto/simplebolt"
+)
+
+func TestMetrics(t *testing.T) {
+	db, err := simplebolt.New(path.Join(os.TempDir(), "bolt_expvar.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(db.Path())
+	defer db.Close()
+	published := New("simplebolt_test")
+	db.SetMetrics(published)
+	kv, err := simplebolt.NewKeyValue(db, "kv_expvar_test")
+	if err != nil {
+		t.Error(err)
+	}
+	kv.Set("a", "1")
+	kv.Set("b", "2")
+	kv.Get("missing")
+
+	m := expvar.Get("simplebolt_test").(*expvar.Map)
+	get := func(name, key string) string {
+		if v := m.Get(name).(*expvar.Map).Get(key); v != nil {
+			return v.String()
+		}
+		return ""
+	}
+	if calls := get("calls", "KeyValue.Set"); calls != "2" {
+		t.Errorf("Error, expected 2 calls, got %s", calls)
+	}
+	if errs := get("errors", "KeyValue.Get"); errs != "1" {
+		t.Errorf("Error, expected 1 error, got %s", errs)
+	}
+	if errs := get("errors", "KeyValue.Set"); errs != "" {
+		t.Errorf("Error, expected no errors, got %s", errs)
+	}
+	if ns := get("nanoseconds", "KeyValue.Set"); ns == "" || ns == "0" {
+		t.Errorf("Error, expected the duration to be counted, got %s", ns)
+	}
+}
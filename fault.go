@@ -0,0 +1,36 @@
+package simplebolt
+
+// fault.go provides a hook for injecting errors into the operations of a
+// database, so that error handling that is hard to trigger with a healthy Bolt
+// database can be tested.
+
+// SetFaultInjector sets a function that is called with the name of an internal
+// operation every time it is about to be performed. If the function returns an
+// error, the operation fails with that error, just as if it had failed by itself.
+// This is meant for testing the error handling of this package, and of packages
+// that are built on it. Pass nil to remove the fault injector.
+//
+// The operations are:
+//
+//	"encode"    encoding a value before it is stored, in List, KeyValue and HashMap
+//	"marshal"   serializing a node of a linked list, before it is stored
+//	"unmarshal" de-serializing a node of a linked list, after it is retrieved
+//
+// The fault injector is kept until the database is closed.
+func (db *Database) SetFaultInjector(fn func(op string) error) {
+	db.updateSettings(func(s *settings) {
+		s.faultInjector = fn
+	})
+}
+
+// Fault returns the error that the fault injector returns for the given
+// operation, or nil if no fault injector has been set. See SetFaultInjector.
+// It is called by the packages that are built on this one, before performing
+// one of the listed operations.
+func (db *Database) Fault(op string) error {
+	fn := db.settings().faultInjector
+	if fn == nil {
+		return nil
+	}
+	return fn(op)
+}
@@ -0,0 +1,237 @@
+package simplebolt
+
+// index.go provides an optional secondary index for lists, which maps the
+// values of a list to the keys of the elements that hold them.
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+
+	"go.etcd.io/bbolt"
+)
+
+// indexSuffix is appended to the name of a list, for the name of its index bucket
+const indexSuffix = "__idx"
+
+// indexStructure is recorded as the data structure of the index buckets, so
+// that a bucket is only used as an index if it has been created as one
+const indexStructure = "ListIndex"
+
+// NewIndexedList loads or creates a new List struct, with the given ID and
+// options, that also has a value index. The index is stored in a sibling
+// bucket, named by the ID followed by "__idx", which maps a SHA-256 hash of
+// each value to the keys of the elements with that value. If the list already
+// has elements, they are indexed. Returns an error if there already is a bucket
+// with the name of the index, that has not been created by NewIndexedList.
+//
+// The index makes Contains and RemoveByValue take logarithmic time instead of
+// linear time, and IndexOf faster, since the values do not need to be read. The
+// cost is the storage of an additional 32 byte key, and up to 13 bytes per
+// element, for every distinct value, and an extra write every time an element
+// is added or removed.
+//
+// The index is kept up to date, within the same transaction, by every method
+// that modifies the list, also when the list is loaded with NewList or OpenList
+// later on, or retrieved within Database.Do.
+func NewIndexedList(db *Database, id string, opts ...BucketOption) (*List, error) {
+	name := []byte(id)
+	if err := ValidateID(id); err != nil {
+		return nil, wrapError("NewIndexedList", name, "", err)
+	}
+	o, err := applyBucketOptions(opts)
+	if err != nil {
+		return nil, wrapError("NewIndexedList", name, "", err)
+	}
+	if err := db.update("List", "NewIndexed", func(tx *bbolt.Tx) error {
+		bucket, err := createList(tx, name)
+		if err != nil {
+			return err
+		}
+		if err := registerType(tx, name, "List"); err != nil {
+			return err
+		}
+		if listIndex(tx, name) != nil {
+			// Already indexed
+			return nil // Return from Update function
+		}
+		index, err := tx.CreateBucket(indexName(name))
+		if err != nil {
+			return fmt.Errorf("Could not create bucket: %w", err)
+		}
+		if err := registerType(tx, indexName(name), indexStructure); err != nil {
+			return err
+		}
+		return bucket.ForEach(func(key, value []byte) error {
+			decoded, err := db.decodeValue(value)
+			if err != nil {
+				return err
+			}
+			return indexAdd(index, decoded, key)
+		})
+	}); err != nil {
+		return nil, wrapError("NewIndexedList", name, "", err)
+	}
+	return (*List)(newBucket(db, name, o)), nil
+}
+
+// Contains will check if a given value is in the list
+func (l *List) Contains(value string) (bool, error) {
+	var found bool
+	if !l.exists() {
+		return false, ErrDoesNotExist
+	}
+	err := l.db.view("List", "Contains", func(tx *bbolt.Tx) error {
+		bucket := l.bucket(tx)
+		if bucket == nil {
+			return ErrBucketNotFound
+		}
+		if index := listIndex(tx, l.name); index != nil {
+			found = index.Get(indexKey([]byte(value))) != nil
+			return nil // Return from View function
+		}
+		return bucket.ForEach(func(_, byteValue []byte) error {
+			decoded, err := l.db.decodeValue(byteValue)
+			if err != nil {
+				return err
+			}
+			if value == string(decoded) {
+				found = true
+				return errFoundIt // break the ForEach by returning an error
+			}
+			return nil // Continue ForEach
+		})
+	})
+	if err == errFoundIt {
+		err = nil
+	}
+	return found, wrapError("List.Contains", l.name, value, err)
+}
+
+// RemoveByValue will remove all elements in the list that are equal to the
+// given value, and return the number of elements that were removed.
+func (l *List) RemoveByValue(value string) (int, error) {
+	if !l.exists() {
+		return 0, ErrDoesNotExist
+	}
+	removed := 0
+	err := l.db.update("List", "RemoveByValue", func(tx *bbolt.Tx) error {
+		bucket := l.bucket(tx)
+		if bucket == nil {
+			return ErrBucketNotFound
+		}
+		var keys [][]byte
+		index := listIndex(tx, l.name)
+		if index != nil {
+			keys = indexKeys(index, []byte(value))
+			if err := index.Delete(indexKey([]byte(value))); err != nil {
+				return err
+			}
+		} else {
+			// Find all the keys first, since the bucket can not be modified within ForEach
+			if err := bucket.ForEach(func(key, byteValue []byte) error {
+				decoded, err := l.db.decodeValue(byteValue)
+				if err != nil {
+					return err
+				}
+				if value == string(decoded) {
+					keys = append(keys, append([]byte{}, key...))
+				}
+				return nil // Continue ForEach
+			}); err != nil {
+				return err
+			}
+		}
+		for _, key := range keys {
+			if err := bucket.Delete(key); err != nil {
+				return err
+			}
+		}
+		removed = len(keys)
+		return nil // Return from Update function
+	})
+	if err != nil {
+		return 0, wrapError("List.RemoveByValue", l.name, value, err)
+	}
+	return removed, nil
+}
+
+// indexName returns the name of the index bucket of the list with the given name
+func indexName(name []byte) []byte {
+	return append(append([]byte{}, name...), indexSuffix...)
+}
+
+// listIndex returns the index bucket of the list with the given name, or nil
+// if the list is not indexed
+func listIndex(tx *bbolt.Tx, name []byte) *bbolt.Bucket {
+	return recordedBucket(tx, indexName(name), indexStructure)
+}
+
+// indexKey returns the key of the given value in an index bucket
+func indexKey(value []byte) []byte {
+	sum := sha256.Sum256(value)
+	return sum[:]
+}
+
+// indexKeys returns the keys of the elements with the given value, in the
+// order of the list. The keys are stored one after the other, each of them
+// after a byte with the length of the key.
+func indexKeys(index *bbolt.Bucket, value []byte) [][]byte {
+	var keys [][]byte
+	stored := index.Get(indexKey(value))
+	for len(stored) > 0 && len(stored) > int(stored[0]) {
+		n := int(stored[0])
+		keys = append(keys, append([]byte{}, stored[1:1+n]...))
+		stored = stored[1+n:]
+	}
+	return keys
+}
+
+// putIndexKeys stores the keys of the elements with the given value
+func putIndexKeys(index *bbolt.Bucket, value []byte, keys [][]byte) error {
+	if len(keys) == 0 {
+		return index.Delete(indexKey(value))
+	}
+	var buf bytes.Buffer
+	for _, key := range keys {
+		buf.WriteByte(byte(len(key)))
+		buf.Write(key)
+	}
+	return index.Put(indexKey(value), buf.Bytes())
+}
+
+// indexAdd adds the key of an element with the given value to the index
+func indexAdd(index *bbolt.Bucket, value, key []byte) error {
+	keys := indexKeys(index, value)
+	// Keep the keys in the same order as the elements in the list
+	i := len(keys)
+	for i > 0 && bytes.Compare(keys[i-1], key) > 0 {
+		i--
+	}
+	keys = append(keys, nil)
+	copy(keys[i+1:], keys[i:])
+	keys[i] = append([]byte{}, key...)
+	return putIndexKeys(index, value, keys)
+}
+
+// indexRemove removes the key of an element with the given value from the index
+func indexRemove(index *bbolt.Bucket, value, key []byte) error {
+	keys := indexKeys(index, value)
+	for i := range keys {
+		if bytes.Equal(keys[i], key) {
+			keys = append(keys[:i], keys[i+1:]...)
+			break
+		}
+	}
+	return putIndexKeys(index, value, keys)
+}
+
+// indexRemoveEncoded works like indexRemove, but for a stored value, that may
+// have been compressed or encrypted
+func (db *Database) indexRemoveEncoded(index *bbolt.Bucket, encoded, key []byte) error {
+	decoded, err := db.decodeValue(encoded)
+	if err != nil {
+		return err
+	}
+	return indexRemove(index, decoded, key)
+}
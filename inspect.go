@@ -0,0 +1,104 @@
+package simplebolt
+
+// inspect.go provides a way to look at the buckets of a database without
+// knowing which data structures they hold, for tools like cmd/simplebolt.
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// compactTxSize is the number of bytes that are copied within each transaction
+// by CompactTo
+const compactTxSize = 65536
+
+// BucketStats contains statistics about a bucket, as returned by Stats
+type BucketStats struct {
+	Keys  int // the number of keys
+	Depth int // the number of levels of the B+tree
+	Pages int // the number of branch and leaf pages, including overflow pages
+	InUse int // the number of bytes that are used by the pages
+}
+
+// Buckets returns the IDs of all the buckets in the database, in sorted order.
+// Some data structures use more than one bucket, like a List with an index. The
+// bucket where the data structures of the buckets are recorded is left out.
+func (db *Database) Buckets() ([]string, error) {
+	var ids []string
+	err := db.view("Database", "Buckets", func(tx *bbolt.Tx) error {
+		return tx.ForEach(func(name []byte, _ *bbolt.Bucket) error {
+			if bytes.Equal(name, typesBucket) {
+				return nil // Continue ForEach
+			}
+			ids = append(ids, string(name))
+			return nil // Continue ForEach
+		})
+	})
+	return ids, closedError(err)
+}
+
+// BucketType returns the data structure that has been recorded for the bucket
+// with the given ID, like "List" or "LinkedList", or an empty string if none has
+// been recorded, for instance if the bucket was created by an earlier version
+// of this package. Returns ErrBucketNotFound if the bucket does not exist.
+func (db *Database) BucketType(id string) (string, error) {
+	var structure string
+	err := db.view("Database", "BucketType", func(tx *bbolt.Tx) error {
+		if tx.Bucket([]byte(id)) == nil {
+			return ErrBucketNotFound
+		}
+		if types := tx.Bucket(typesBucket); types != nil {
+			structure = string(types.Get([]byte(id)))
+		}
+		return nil // Return from View function
+	})
+	return structure, closedError(err)
+}
+
+// Stats returns statistics about the bucket with the given ID, which may hold
+// any of the data structures. Returns ErrBucketNotFound if it does not exist.
+func (db *Database) Stats(id string) (BucketStats, error) {
+	var stats BucketStats
+	err := db.view("Database", "Stats", func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte(id))
+		if bucket == nil {
+			return ErrBucketNotFound
+		}
+		s := bucket.Stats()
+		stats = BucketStats{
+			Keys:  s.KeyN,
+			Depth: s.Depth,
+			Pages: s.BranchPageN + s.BranchOverflowN + s.LeafPageN + s.LeafOverflowN,
+			InUse: s.BranchInuse + s.LeafInuse,
+		}
+		return nil // Return from View function
+	})
+	return stats, wrapError("Database.Stats", []byte(id), "", closedError(err))
+}
+
+// CompactTo writes a compacted copy of the database to a new file with the
+// given name, which must not exist. The copy has no free pages, so it is often
+// much smaller than the original, after many elements have been removed. The
+// database is read in several read-only transactions, so it should not be
+// modified while it is copied.
+func (db *Database) CompactTo(filename string) error {
+	if _, err := os.Stat(filename); err == nil {
+		return fmt.Errorf("Could not compact to %s: %w", filename, fs.ErrExist)
+	}
+	dst, err := bbolt.Open(filename, 0600, &bbolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		return err
+	}
+	err = db.Observe("Database", "CompactTo", func() error {
+		return bbolt.Compact(dst, (*bbolt.DB)(db), compactTxSize)
+	})
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	return closedError(err)
+}
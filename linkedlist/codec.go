@@ -0,0 +1,231 @@
+package linkedlist
+
+// codec.go provides the encodings used for storing the nodes of a linked list.
+// Nodes are written with a compact binary encoding, while nodes written with the
+// protocol buffers encoding of earlier versions can still be read.
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/xyproto/simplebolt"
+	pb "github.com/xyproto/simplebolt/linkedlist/nodes_pb"
+	"go.etcd.io/bbolt"
+)
+
+const (
+	// compactHeader is the first byte of a node with the compact encoding, with
+	// the three lowest bits telling if the node has a next link, a prev link and
+	// a version. It can not be the first byte of a protocol buffers encoded node.
+	compactHeader = 0xb0
+	compactMask   = 0xf8
+	hasNext       = 0x01
+	hasPrev       = 0x02
+	hasVersion    = 0x04
+
+	// compactDataOffset is the length of the header and the two link fields
+	compactDataOffset = 1 + 2*8
+)
+
+var errCompactLength = errors.New("too short for the compact encoding")
+
+// nodeCodec encodes and decodes the nodes of a linked list
+type nodeCodec interface {
+	encode(node *pb.LinkedListNode) ([]byte, error)
+	decode(data []byte, node *pb.LinkedListNode) error
+}
+
+// compactCodec encodes a node as a header byte, followed by the next and the
+// prev link, 8 bytes each, then the version, as 8 bytes, if it is not 0, and then
+// the data. Nodes without a version are encoded just like before versions were
+// introduced.
+type compactCodec struct{}
+
+func (compactCodec) encode(node *pb.LinkedListNode) ([]byte, error) {
+	offset := compactDataOffset
+	if node.GetVersion() != 0 {
+		offset += 8
+	}
+	data := make([]byte, offset+len(node.GetData()))
+	data[0] = compactHeader
+	if next := node.GetNext(); next != nil {
+		data[0] |= hasNext
+		copy(data[1:9], next)
+	}
+	if prev := node.GetPrev(); prev != nil {
+		data[0] |= hasPrev
+		copy(data[9:17], prev)
+	}
+	if version := node.GetVersion(); version != 0 {
+		data[0] |= hasVersion
+		binary.BigEndian.PutUint64(data[compactDataOffset:offset], version)
+	}
+	copy(data[offset:], node.GetData())
+	return data, nil
+}
+
+func (compactCodec) decode(data []byte, node *pb.LinkedListNode) error {
+	offset := compactDataOffset
+	if len(data) > 0 && data[0]&hasVersion != 0 {
+		offset += 8
+	}
+	if len(data) < offset {
+		return errCompactLength
+	}
+	// Copy the data once, since it may only be valid within the transaction
+	buf := append([]byte{}, data...)
+	node.Next, node.Prev, node.Data, node.Version = nil, nil, nil, 0
+	if buf[0]&hasNext != 0 {
+		node.Next = buf[1:9:9]
+	}
+	if buf[0]&hasPrev != 0 {
+		node.Prev = buf[9:17:17]
+	}
+	if offset > compactDataOffset {
+		node.Version = binary.BigEndian.Uint64(buf[compactDataOffset:offset])
+	}
+	if len(buf) > offset {
+		node.Data = buf[offset:]
+	}
+	return nil
+}
+
+// protoCodec encodes a node with protocol buffers, like earlier versions did
+type protoCodec struct{}
+
+func (protoCodec) encode(node *pb.LinkedListNode) ([]byte, error) {
+	return proto.Marshal(node)
+}
+
+func (protoCodec) decode(data []byte, node *pb.LinkedListNode) error {
+	return proto.Unmarshal(data, node)
+}
+
+// isCompact checks if the given encoded node uses the compact encoding
+func isCompact(data []byte) bool {
+	return len(data) > 0 && data[0]&compactMask == compactHeader
+}
+
+// fault returns the error injected for the given operation into the database
+// of the given bucket, if any. See simplebolt.Database.SetFaultInjector. The
+// bucket is nil when a node is decoded outside of a transaction.
+func fault(bucket *bbolt.Bucket, op string) error {
+	if bucket == nil {
+		return nil
+	}
+	return (*simplebolt.Database)(bucket.Tx().DB()).Fault(op)
+}
+
+// marshalNode encodes the given node with the compact encoding, or with protocol
+// buffers if any of the links does not have the length of a node key. The bucket
+// is the one the node is stored in, if any. The data of the node is encrypted
+// with the value cipher of the database of the bucket, if one has been set,
+// while the links are stored as they are.
+func marshalNode(bucket *bbolt.Bucket, node *pb.LinkedListNode) ([]byte, error) {
+	if err := fault(bucket, "marshal"); err != nil {
+		return nil, err
+	}
+	if bucket != nil {
+		data, err := (*simplebolt.Database)(bucket.Tx().DB()).EncryptValue(node.GetData())
+		if err != nil {
+			return nil, err
+		}
+		// Leave the given node untouched
+		node = &pb.LinkedListNode{Next: node.GetNext(), Prev: node.GetPrev(), Data: data, Version: node.GetVersion()}
+	}
+	if (node.GetNext() == nil || isNodeKey(node.GetNext())) && (node.GetPrev() == nil || isNodeKey(node.GetPrev())) {
+		return compactCodec{}.encode(node)
+	}
+	return protoCodec{}.encode(node)
+}
+
+// unmarshalNode decodes the given node, selecting the codec by the first byte.
+// The bucket is the one the node was retrieved from, if any. The data of the
+// node is decrypted if there is a bucket, see marshalNode, and else it must be
+// decrypted with decryptNode.
+func unmarshalNode(bucket *bbolt.Bucket, data []byte, node *pb.LinkedListNode) error {
+	if err := fault(bucket, "unmarshal"); err != nil {
+		return err
+	}
+	var codec nodeCodec = protoCodec{}
+	if isCompact(data) {
+		codec = compactCodec{}
+	}
+	if err := codec.decode(data, node); err != nil {
+		return err
+	}
+	if bucket == nil {
+		return nil
+	}
+	return decryptNode((*simplebolt.Database)(bucket.Tx().DB()), node)
+}
+
+// decryptNode decrypts the data of the given node, if a value cipher has been
+// set for the given database
+func decryptNode(db *simplebolt.Database, node *pb.LinkedListNode) error {
+	data, err := db.DecryptValue(node.GetData())
+	if err != nil {
+		return err
+	}
+	node.Data = data
+	return nil
+}
+
+// reencryptNode decodes the given node, which is stored in the given database,
+// and encodes it again for the given bucket, so that its data is encrypted with
+// the value cipher of the database of the bucket
+func reencryptNode(db *simplebolt.Database, bucket *bbolt.Bucket, data []byte) ([]byte, error) {
+	node := &pb.LinkedListNode{}
+	if err := unmarshalNode(nil, data, node); err != nil {
+		return nil, fmt.Errorf("Could not unmarshal. %w", err)
+	}
+	if err := decryptNode(db, node); err != nil {
+		return nil, err
+	}
+	nodeBytes, err := marshalNode(bucket, node)
+	if err != nil {
+		return nil, fmt.Errorf("Could not marshal. %w", err)
+	}
+	return nodeBytes, nil
+}
+
+// MigrateEncoding rewrites the nodes that were written with the protocol buffers
+// encoding of earlier versions with the compact encoding, within a single
+// bbolt.Update transaction, and returns the number of rewritten nodes. Nodes with
+// either encoding can be read at any time, so migrating is optional, but it makes
+// reading the nodes faster.
+func (ll *LinkedList) MigrateEncoding() (migrated int, err error) {
+	err = update(ll.db, "MigrateEncoding", func(tx *bbolt.Tx) error {
+		bucket := ll.bucket(tx)
+		if bucket == nil {
+			return ErrBucketNotFound
+		}
+		// Find the nodes first, since the bucket can not be modified within ForEach
+		var keys [][]byte
+		if err := bucket.ForEach(func(key, nodeBytes []byte) error {
+			if isNodeKey(key) && !isCompact(nodeBytes) {
+				keys = append(keys, copyKey(key))
+			}
+			return nil // Continue ForEach
+		}); err != nil {
+			return err
+		}
+		for _, key := range keys {
+			node, err := getNode(bucket, key)
+			if err != nil {
+				return err
+			}
+			if err := putNode(bucket, key, node); err != nil {
+				return err
+			}
+		}
+		migrated = len(keys)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return migrated, nil
+}
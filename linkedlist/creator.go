@@ -0,0 +1,32 @@
+package linkedlist
+
+// creator.go provides a creator of data structures that can also create linked
+// lists. It can not be part of simplebolt.BoltCreator, since this package
+// depends on the simplebolt package.
+
+import (
+	"github.com/xyproto/simplebolt"
+)
+
+// ILinkedListCreator is implemented by data structure creators that can create
+// linked lists. Code that is written against pinterface.ICreator can type assert
+// the creator to this interface, for using linked lists when they are available.
+type ILinkedListCreator interface {
+	NewLinkedList(id string) (*LinkedList, error)
+}
+
+// Creator is a simplebolt.BoltCreator that can also create linked lists. It
+// implements both pinterface.ICreator and ILinkedListCreator.
+type Creator struct {
+	*simplebolt.BoltCreator
+}
+
+// NewCreator can create a new Creator struct, for the given database
+func NewCreator(db *simplebolt.Database) *Creator {
+	return &Creator{simplebolt.NewCreator(db)}
+}
+
+// NewLinkedList can create a new LinkedList with the given ID
+func (c *Creator) NewLinkedList(id string) (*LinkedList, error) {
+	return New(c.Database(), id)
+}
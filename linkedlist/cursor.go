@@ -0,0 +1,114 @@
+package linkedlist
+
+// cursor.go provides a cursor for traversing a linked list within a single,
+// long-lived read transaction.
+
+import (
+	pb "github.com/xyproto/simplebolt/linkedlist/nodes_pb"
+	"go.etcd.io/bbolt"
+)
+
+// LLCursor traverses a linked list by following the links between the nodes,
+// in both directions, within a single bbolt.View transaction. This gives a
+// consistent view of the list and is much faster than calling Item.Next() or
+// Item.Prev() repeatedly, which use one transaction per step.
+//
+// The cursor must be closed by calling Close, since the open transaction
+// prevents Bolt from re-using the pages that are freed by later writes, and
+// from growing the database file.
+type LLCursor struct {
+	tx     *bbolt.Tx
+	bucket *bbolt.Bucket
+	key    []byte
+	node   *pb.LinkedListNode
+	// done is set when the cursor has moved past either end of the list
+	done bool
+	err  error
+}
+
+// Cursor returns a new cursor for the linked list, positioned before the front
+// and after the back of the list. The first call to Next moves it to the front
+// of the list, while the first call to Prev moves it to the back.
+func (ll *LinkedList) Cursor() (*LLCursor, error) {
+	tx, err := (*bbolt.DB)(ll.db).Begin(false)
+	if err != nil {
+		return nil, closedError(err)
+	}
+	bucket := tx.Bucket(ll.name)
+	if bucket == nil {
+		tx.Rollback()
+		return nil, ErrBucketNotFound
+	}
+	return &LLCursor{tx: tx, bucket: bucket}, nil
+}
+
+// Next moves the cursor to the next node and returns true, or returns false if
+// there are no more nodes, if the cursor has been closed or if an error occurred.
+func (c *LLCursor) Next() bool {
+	return c.move("FRONT", func(node *pb.LinkedListNode) []byte {
+		return node.GetNext()
+	})
+}
+
+// Prev moves the cursor to the previous node and returns true, or returns false
+// if there are no more nodes, if the cursor has been closed or if an error occurred.
+func (c *LLCursor) Prev() bool {
+	return c.move("BACK", func(node *pb.LinkedListNode) []byte {
+		return node.GetPrev()
+	})
+}
+
+// move moves the cursor to the node at the given end of the list if it is not
+// positioned yet, or else to the node returned by link
+func (c *LLCursor) move(end string, link func(node *pb.LinkedListNode) []byte) bool {
+	if c.tx == nil || c.done || c.err != nil {
+		return false
+	}
+	var key []byte
+	if c.node == nil {
+		key = c.bucket.Get([]byte(end))
+	} else {
+		key = link(c.node)
+	}
+	if key == nil {
+		c.key, c.node, c.done = nil, nil, true
+		return false
+	}
+	node, err := getNode(c.bucket, key)
+	if err != nil {
+		c.key, c.node, c.err = nil, nil, err
+		return false
+	}
+	c.key, c.node = key, node
+	return true
+}
+
+// Key returns the key of the node at the cursor, or nil if the cursor is not
+// positioned at a node. It is only valid until the cursor is closed.
+func (c *LLCursor) Key() []byte {
+	return c.key
+}
+
+// Value returns the data of the node at the cursor, or nil if the cursor is not
+// positioned at a node.
+func (c *LLCursor) Value() []byte {
+	if c.node == nil {
+		return nil
+	}
+	return c.node.GetData()
+}
+
+// Err returns the error that stopped the cursor, if any
+func (c *LLCursor) Err() error {
+	return c.err
+}
+
+// Close ends the transaction of the cursor. It is safe to call Close more than once.
+func (c *LLCursor) Close() error {
+	if c.tx == nil {
+		return nil
+	}
+	err := c.tx.Rollback()
+	c.tx, c.bucket, c.key, c.node = nil, nil, nil, nil
+	return err
+}
@@ -0,0 +1,206 @@
+package linkedlist
+
+// dump.go provides a binary dump of the exact structure of a linked list, for
+// reproducing the state of a linked list from a bug report.
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	pb "github.com/xyproto/simplebolt/linkedlist/nodes_pb"
+	"go.etcd.io/bbolt"
+)
+
+// dumpMagic is written at the start of every dump, followed by the version
+const dumpMagic = "LLNODES"
+
+// ErrInvalidDump is returned by ImportNodes if the dump can not be read
+var ErrInvalidDump = errors.New("Invalid dump")
+
+// dumpVersion is the version of the dump format. Dumps of version 1 do not have
+// the versions of the nodes, which are then read as 0.
+const dumpVersion = 2
+
+// ExportNodes writes the exact structure of the linked list to w: the keys of
+// the nodes at the front and at the back, the sequence used for new keys, and
+// then every node, in the order of the keys, with its key, prev link, next link,
+// data and version. Unlike ExportJSON, which follows the links, the nodes are written as
+// they are stored, also if the links are broken.
+//
+// Every field is written as an unsigned varint length followed by the bytes,
+// except for the sequence and the versions of the nodes, which are written as
+// unsigned varints. The dump
+// starts with "LLNODES" and a version byte. ImportNodes reads it back.
+func (ll *LinkedList) ExportNodes(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	err := view(ll.db, "ExportNodes", func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(ll.name)
+		if bucket == nil {
+			return ErrBucketNotFound
+		}
+		bw.WriteString(dumpMagic)
+		bw.WriteByte(dumpVersion)
+		writeField(bw, bucket.Get([]byte("FRONT")))
+		writeField(bw, bucket.Get([]byte("BACK")))
+		writeUvarint(bw, bucket.Sequence())
+		return bucket.ForEach(func(key, _ []byte) error {
+			if !isNodeKey(key) {
+				return nil
+			}
+			node, err := getNode(bucket, key)
+			if err != nil {
+				return err
+			}
+			for _, field := range [][]byte{key, node.GetPrev(), node.GetNext(), node.GetData()} {
+				if err := writeField(bw, field); err != nil {
+					return err
+				}
+			}
+			return writeUvarint(bw, node.GetVersion())
+		})
+	})
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// ImportNodes replaces the contents of the linked list with the structure read
+// from r, as written by ExportNodes, keeping the keys and the links of the nodes
+// exactly as they were, within a single bbolt.Update transaction. Either the
+// whole dump is stored, or the linked list is left as it was.
+//
+// In unique mode, ImportNodes returns ErrExists if the dump contains duplicated
+// data. It returns ErrInvalidDump, wrapped with the details, if the dump can not be read.
+func (ll *LinkedList) ImportNodes(r io.Reader) error {
+	br := bufio.NewReader(r)
+	header := make([]byte, len(dumpMagic)+1)
+	if _, err := io.ReadFull(br, header); err != nil || string(header[:len(dumpMagic)]) != dumpMagic {
+		return fmt.Errorf("%w: no header", ErrInvalidDump)
+	}
+	version := header[len(dumpMagic)]
+	if version < 1 || version > dumpVersion {
+		return fmt.Errorf("%w: unknown version %d", ErrInvalidDump, version)
+	}
+	frontKey, err := readField(br)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidDump, err)
+	}
+	backKey, err := readField(br)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidDump, err)
+	}
+	sequence, err := binary.ReadUvarint(br)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidDump, err)
+	}
+	// Read all the nodes before modifying the linked list
+	var (
+		keys  [][]byte
+		nodes []*pb.LinkedListNode
+	)
+	for {
+		key, err := readField(br)
+		if err == io.EOF {
+			break
+		}
+		fields := [][]byte{key, nil, nil, nil}
+		for i := 1; i < len(fields) && err == nil; i++ {
+			fields[i], err = readField(br)
+		}
+		var nodeVersion uint64
+		if err == nil && version > 1 {
+			nodeVersion, err = binary.ReadUvarint(br)
+		}
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidDump, err)
+		}
+		if !isNodeKey(key) {
+			return fmt.Errorf("%w: invalid key %x", ErrInvalidDump, key)
+		}
+		keys = append(keys, key)
+		nodes = append(nodes, &pb.LinkedListNode{Prev: fields[1], Next: fields[2], Data: fields[3], Version: nodeVersion})
+	}
+	return update(ll.db, "ImportNodes", func(tx *bbolt.Tx) error {
+		bucket := ll.bucket(tx)
+		if bucket == nil {
+			return ErrBucketNotFound
+		}
+		unique := uniqueIndex(tx, ll.name)
+		if err := uniqueClear(unique); err != nil {
+			return err
+		}
+		// Seek to the first key again after each deletion, since the cursor may
+		// skip a key when Next is called after Delete
+		c := bucket.Cursor()
+		for key, _ := c.First(); key != nil; key, _ = c.First() {
+			if err := c.Delete(); err != nil {
+				return err
+			}
+		}
+		for i, node := range nodes {
+			if err := uniqueAdd(unique, node.GetData(), keys[i]); err != nil {
+				return err
+			}
+			if err := putNode(bucket, keys[i], node); err != nil {
+				return err
+			}
+		}
+		// Store the ends as they were, also if they do not match the links
+		if frontKey != nil {
+			if err := bucket.Put([]byte("FRONT"), frontKey); err != nil {
+				return err
+			}
+		}
+		if backKey != nil {
+			if err := bucket.Put([]byte("BACK"), backKey); err != nil {
+				return err
+			}
+		}
+		return bucket.SetSequence(sequence)
+	})
+}
+
+// writeUvarint writes x as an unsigned varint
+func writeUvarint(w *bufio.Writer, x uint64) error {
+	buf := make([]byte, binary.MaxVarintLen64)
+	_, err := w.Write(buf[:binary.PutUvarint(buf, x)])
+	return err
+}
+
+// writeField writes the length of the given field, followed by the field
+func writeField(w *bufio.Writer, field []byte) error {
+	if err := writeUvarint(w, uint64(len(field))); err != nil {
+		return err
+	}
+	_, err := w.Write(field)
+	return err
+}
+
+// readField reads a field written by writeField. An empty field is returned as
+// nil. It returns io.EOF if there are no more fields.
+func readField(r *bufio.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, nil
+	}
+	// Do not trust the length for allocating more than what can be read
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, r, int64(n)); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
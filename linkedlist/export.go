@@ -0,0 +1,112 @@
+package linkedlist
+
+// export.go provides a JSON export of a linked list, for debugging purposes,
+// and the corresponding import.
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
+// ErrInvalidData is returned by ImportJSON if the data of a node can not be read
+var ErrInvalidData = errors.New("Invalid data")
+
+// exportedNode is the JSON representation of a node, as written by ExportJSON
+type exportedNode struct {
+	Key uint64 `json:"key"`
+	// Data is a string if the data is valid UTF-8, a base64 encoded string if
+	// not, or the value returned by the function given to ExportJSONWith
+	Data interface{} `json:"data"`
+	// Encoding is "base64" if Data has been base64 encoded
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// ExportJSON writes the nodes of the linked list to w as a JSON array, in order
+// from the front to the back of the list. Every node is written as an object
+// with the key of the node, as an integer, and the data, as a string if it is
+// valid UTF-8. Other data is base64 encoded, and then "encoding" is "base64".
+// The list is traversed within a single bbolt.View transaction.
+func (ll *LinkedList) ExportJSON(w io.Writer) error {
+	return ll.export(w, func(data []byte) (interface{}, string, error) {
+		if utf8.Valid(data) {
+			return string(data), "", nil
+		}
+		return base64.StdEncoding.EncodeToString(data), "base64", nil
+	})
+}
+
+// ExportJSONWith works like ExportJSON, but the data of every node is converted
+// by fn, and the returned value is written as JSON. This is useful for decoding
+// for instance protocol buffers into readable JSON. The export is stopped at the
+// first error returned by fn, which is then returned.
+func (ll *LinkedList) ExportJSONWith(w io.Writer, fn func(data []byte) (interface{}, error)) error {
+	return ll.export(w, func(data []byte) (interface{}, string, error) {
+		value, err := fn(data)
+		return value, "", err
+	})
+}
+
+// export converts the data of every node with the given function and writes
+// the nodes to w. The nodes are written when the transaction has ended, so that
+// a slow writer does not keep it open.
+func (ll *LinkedList) export(w io.Writer, convert func(data []byte) (interface{}, string, error)) error {
+	nodes := []exportedNode{}
+	if err := ll.ForEach(func(key, data []byte) error {
+		value, encoding, err := convert(data)
+		if err != nil {
+			return err
+		}
+		nodes = append(nodes, exportedNode{binary.BigEndian.Uint64(key), value, encoding})
+		return nil
+	}); err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(nodes)
+}
+
+// importedNode is a node read by ImportJSON
+type importedNode struct {
+	Data     *string `json:"data"`
+	Encoding string  `json:"encoding"`
+}
+
+// ImportJSON replaces the contents of the linked list with the nodes read from r,
+// which must be in the format written by ExportJSON. The keys of the nodes are
+// ignored, and new keys are given to the nodes, in the order they are read. The
+// nodes are stored with ReplaceAll, so either all of them are stored, or the
+// linked list is left as it was.
+//
+// Returns ErrInvalidData, wrapped with the details, if the data of a node is not a string, for
+// instance if it was exported with ExportJSONWith, or can not be decoded.
+func (ll *LinkedList) ImportJSON(r io.Reader) error {
+	var nodes []importedNode
+	if err := json.NewDecoder(r).Decode(&nodes); err != nil {
+		return err
+	}
+	items := make([][]byte, len(nodes))
+	for i, node := range nodes {
+		if node.Data == nil {
+			return fmt.Errorf("%w of node %d: no data", ErrInvalidData, i)
+		}
+		switch node.Encoding {
+		case "":
+			items[i] = []byte(*node.Data)
+		case "base64":
+			data, err := base64.StdEncoding.DecodeString(*node.Data)
+			if err != nil {
+				return fmt.Errorf("%w of node %d: %v", ErrInvalidData, i, err)
+			}
+			items[i] = data
+		default:
+			return fmt.Errorf("%w of node %d: unknown encoding %q", ErrInvalidData, i, node.Encoding)
+		}
+	}
+	return ll.ReplaceAll(items)
+}
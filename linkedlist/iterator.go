@@ -0,0 +1,202 @@
+package linkedlist
+
+// iterator.go provides an iterator that reads a linked list in chunks, one
+// short read transaction per chunk.
+
+import (
+	"context"
+
+	pb "github.com/xyproto/simplebolt/linkedlist/nodes_pb"
+	"go.etcd.io/bbolt"
+)
+
+// iteratorChunkSize is the default number of nodes read per transaction by an Iterator
+const iteratorChunkSize = 100
+
+// Iterator traverses a linked list by reading chunks of nodes, one bbolt.View
+// transaction per chunk, and resuming from the last node that was read. Unlike
+// ForEach and LLCursor, no transaction is kept open between the calls to Next,
+// so the caller may do slow work, or modify the linked list, while iterating.
+//
+// If the node the iterator should resume from has been removed in the meantime,
+// it skips to the next node that can still be reached, and Skipped returns true.
+type Iterator struct {
+	ll        *LinkedList
+	reverse   bool
+	chunkSize int
+	// The keys and the data of the current chunk, and the position within it
+	keys   [][]byte
+	values [][]byte
+	pos    int
+	// The key linked from the last node of the current chunk
+	nextKey []byte
+	started bool
+	done    bool
+	skipped bool
+	err     error
+}
+
+// NewIterator returns an iterator that goes from the front to the back of the
+// linked list. Next must be called to move it to the first node.
+func (ll *LinkedList) NewIterator() *Iterator {
+	return &Iterator{ll: ll, chunkSize: iteratorChunkSize}
+}
+
+// NewReverseIterator returns an iterator that goes from the back to the front
+// of the linked list. Next must be called to move it to the first node.
+func (ll *LinkedList) NewReverseIterator() *Iterator {
+	return &Iterator{ll: ll, reverse: true, chunkSize: iteratorChunkSize}
+}
+
+// Next moves the iterator to the next node and returns true, or returns false if
+// there are no more nodes, if the iterator has been closed or if an error occurred.
+func (it *Iterator) Next() bool {
+	if it.done || it.err != nil {
+		return false
+	}
+	if it.pos+1 < len(it.keys) {
+		it.pos++
+		return true
+	}
+	if it.started && it.nextKey == nil {
+		it.done = true
+		return false
+	}
+	if it.err = it.fetch(); it.err != nil {
+		return false
+	}
+	if len(it.keys) == 0 {
+		it.done = true
+		return false
+	}
+	return true
+}
+
+// fetch reads the next chunk of nodes
+func (it *Iterator) fetch() error {
+	return view(it.ll.db, "Iterator", func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(it.ll.name)
+		if bucket == nil {
+			return ErrBucketNotFound
+		}
+		link := func(node *pb.LinkedListNode) []byte {
+			if it.reverse {
+				return node.GetPrev()
+			}
+			return node.GetNext()
+		}
+		var key []byte
+		switch {
+		case !it.started:
+			if it.reverse {
+				key = bucket.Get([]byte("BACK"))
+			} else {
+				key = bucket.Get([]byte("FRONT"))
+			}
+		case bucket.Get(it.nextKey) != nil:
+			key = it.nextKey
+		default:
+			// The node to resume from has been removed. Follow the link of the
+			// last node of the previous chunk that still exists, if any.
+			it.skipped = true
+			for i := len(it.keys) - 1; i >= 0; i-- {
+				if bucket.Get(it.keys[i]) == nil {
+					continue
+				}
+				node, err := getNode(bucket, it.keys[i])
+				if err != nil {
+					return err
+				}
+				key = link(node)
+				break
+			}
+		}
+		it.started = true
+		it.keys, it.values, it.pos, it.nextKey = nil, nil, 0, nil
+		for key != nil && len(it.keys) < it.chunkSize {
+			node, err := getNode(bucket, key)
+			if err != nil {
+				return err
+			}
+			it.keys = append(it.keys, copyKey(key))
+			it.values = append(it.values, node.GetData())
+			key = link(node)
+		}
+		it.nextKey = copyKey(key)
+		return nil
+	})
+}
+
+// Key returns a copy of the key of the node at the iterator, or nil if the
+// iterator is not positioned at a node
+func (it *Iterator) Key() []byte {
+	if it.done || it.err != nil || it.pos >= len(it.keys) {
+		return nil
+	}
+	return copyKey(it.keys[it.pos])
+}
+
+// Value returns the data of the node at the iterator, or nil if the iterator is
+// not positioned at a node
+func (it *Iterator) Value() []byte {
+	if it.done || it.err != nil || it.pos >= len(it.values) {
+		return nil
+	}
+	return it.values[it.pos]
+}
+
+// Skipped returns true if the iterator had to skip removed nodes
+func (it *Iterator) Skipped() bool {
+	return it.skipped
+}
+
+// Err returns the error that stopped the iterator, if any
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+// Close stops the iterator. Any following call to Next returns false.
+func (it *Iterator) Close() error {
+	it.done = true
+	it.keys, it.values, it.nextKey = nil, nil, nil
+	return nil
+}
+
+// Stream sends the data of every node in the linked list, from the front to the
+// back, on the returned data channel, which is closed when all the nodes have been
+// sent. The nodes are read with an Iterator, so no transaction is kept open while
+// waiting for the receiver.
+//
+// If the context is cancelled, or reading the linked list fails, the streaming
+// stops and the error is sent on the returned error channel, which is closed
+// after the data channel.
+func (ll *LinkedList) Stream(ctx context.Context) (<-chan []byte, <-chan error) {
+	data := make(chan []byte)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(errs)
+		defer close(data)
+		it := ll.NewIterator()
+		defer it.Close()
+		for {
+			// Stop promptly if the context has been cancelled
+			if err := ctx.Err(); err != nil {
+				errs <- err
+				return
+			}
+			if !it.Next() {
+				break
+			}
+			select {
+			case data <- it.Value():
+			case <-ctx.Done():
+				errs <- ctx.Err()
+				return
+			}
+		}
+		if err := it.Err(); err != nil {
+			errs <- err
+		}
+	}()
+	return data, errs
+}
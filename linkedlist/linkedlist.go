@@ -6,26 +6,39 @@ package linkedlist
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
-	"log"
+	"math"
+	"sort"
+	"sync/atomic"
 
-	"github.com/golang/protobuf/proto"
 	"github.com/xyproto/simplebolt"
 	pb "github.com/xyproto/simplebolt/linkedlist/nodes_pb"
 	"go.etcd.io/bbolt"
 )
 
+// batchSize is the maximum number of nodes that are copied within a single
+// transaction, when copying nodes between linked lists
+const batchSize = 1000
+
+// appendFillPercent is the fill percent used when pushing nodes, when no fill
+// percent has been set. The pages are then filled completely, which nearly
+// halves the number of pages compared to the default fill percent of Bolt.
+const appendFillPercent = 1.0
+
 type (
 	// Used for each of the datatypes
 	boltBucket struct {
-		db   *simplebolt.Database // the Bolt database
-		name []byte               // the bucket name
+		db          *simplebolt.Database // the Bolt database
+		name        []byte               // the bucket name
+		fillPercent atomicFloat          // the fill percent of the bucket when writing, or 0 for the default
 	}
 
 	// LinkedList is a doubly linked list. It is persisted using etcd-io/bbolt's b+tree
-	// as its underlying data structure but with a doubly linked list-like behaviour
+	// as its underlying data structure but with a doubly linked list-like behaviour.
+	// A *LinkedList is safe for concurrent use by multiple goroutines.
 	LinkedList boltBucket
 
 	// storedData uses its fields key, value and internalLinkedList to perform operations that
@@ -39,6 +52,12 @@ type (
 		// Underlying linked list at which to perform modifications (update and delete) given
 		// a key and a value. It is initialised from linked list Front() and Back() methods.
 		internalLinkedList *LinkedList
+		// stale is set when the node has been removed through this item
+		stale bool
+		// version of the node when the item was retrieved, or last modified through it
+		version uint64
+		// inUse is set while the item is being modified
+		inUse atomic.Bool
 	}
 
 	// Item is the element of the linked list returned by Front(), Back(), Next(), Prev(),
@@ -49,62 +68,282 @@ type (
 	// It can be used to traverse the linked list across every node of the data structure,
 	// by calling Prev(), Next() and any of the Getter methods. To retrieve, change or
 	// delete the underlying data, the Data field has the corresponding methods.
+	//
+	// Unlike the linked list, an Item is not safe for concurrent use. Methods that
+	// modify an item return ErrItemInUse if another goroutine is modifying the same
+	// item at the same time. Goroutines can get items of their own for the same
+	// node with GetByKey.
 	Item struct {
 		Data simplebolt.StoredData
 	}
 )
 
+// The errors that are shared with the simplebolt package are the same values,
+// so errors.Is works regardless of which package returned the error.
 var (
 	// ErrBucketNotFound may be returned if a no Bolt bucket was found
-	ErrBucketNotFound = errors.New("Bucket not found")
+	ErrBucketNotFound = simplebolt.ErrBucketNotFound
 
 	// ErrKeyNotFound will be returned if the key was not found in a HashMap or KeyValue struct
-	ErrKeyNotFound = errors.New("Key not found")
+	ErrKeyNotFound = simplebolt.ErrKeyNotFound
 
 	// ErrDoesNotExist will be returned if an element was not found. Used in List, Set, HashMap and KeyValue.
-	ErrDoesNotExist = errors.New("Does not exist")
+	ErrDoesNotExist = simplebolt.ErrDoesNotExist
 
 	// ErrExistsInSet is only returned if an element is added to a Set, but it already exists
-	ErrExistsInSet = errors.New("Element already exists in set")
+	ErrExistsInSet = simplebolt.ErrExistsInSet
 
 	// ErrInvalidID is only returned if adding an element to a HashMap that contains a colon (:)
-	ErrInvalidID = errors.New("Element ID can not contain \":\"")
+	ErrInvalidID = simplebolt.ErrInvalidID
+
+	// ErrReservedID is returned when creating or opening a linked list with an
+	// ID that is reserved for the buckets that are used internally, see
+	// simplebolt.ValidateID
+	ErrReservedID = simplebolt.ErrReservedID
+
+	// ErrWrongType is returned by New when the bucket with the given ID has
+	// been recorded as holding another data structure
+	ErrWrongType = simplebolt.ErrWrongType
+
+	// ErrOutOfRange is returned if an index is out of range
+	ErrOutOfRange = simplebolt.ErrOutOfRange
+
+	// ErrDatabaseClosed is returned when using a linked list after the database has been closed
+	ErrDatabaseClosed = simplebolt.ErrDatabaseClosed
+
+	// ErrEmptyData is returned when pushing, inserting or updating with empty data
+	ErrEmptyData = simplebolt.ErrEmptyData
 
+	// ErrEmptyList is returned when an operation needs a node, but the linked list is empty
+	ErrEmptyList = simplebolt.ErrEmptyList
+
+	// ErrDifferentDatabase is returned when combining two linked lists that are
+	// not stored in the same database
+	ErrDifferentDatabase = simplebolt.ErrDifferentDatabase
+
+	// ErrNilFunc is returned when the given comparing function is nil
+	ErrNilFunc = simplebolt.ErrNilFunc
+
+	// ErrInvalidOption is returned by New and Open when given an option with an
+	// invalid value. It is wrapped with the details.
+	ErrInvalidOption = simplebolt.ErrInvalidOption
+)
+
+var (
 	// ErrFoundIt is only used internally, for breaking out of Bolt DB style for-loops
 	ErrFoundIt = errors.New("Found it")
 
-	// errReachedEnd is used internally by traversing methods to indicate that the
-	// end of the data structure has been reached.
-	errReachedEnd = errors.New("Reached end of data structure")
+	// ErrStaleItem is returned when using an item whose node has been removed, either
+	// through the item itself or by other means
+	ErrStaleItem = errors.New("Stale item: the node has been removed")
+
+	// ErrNotLinkedList is returned by Open if the bucket holds something else
+	ErrNotLinkedList = errors.New("Not a linked list")
+
+	// ErrItemInUse is returned when an item is modified while another goroutine is
+	// modifying the same item. See Item.
+	ErrItemInUse = errors.New("Item in use by another goroutine")
+
+	// ErrInvalidMark is returned when the mark given to one of the methods that
+	// search or insert relative to a mark was not returned by one of the methods
+	// of the linked list. The error may be wrapped with more details.
+	ErrInvalidMark = errors.New("Invalid mark")
+
+	// ErrConflict is returned by Item.UpdateIfUnchanged and Item.RemoveIfUnchanged
+	// if the node has been modified since the item was retrieved
+	ErrConflict = errors.New("Conflict: the node has been modified")
+
+	// ErrEmptyValue is returned when searching for an empty value
+	ErrEmptyValue = errors.New("Empty value")
+
+	// ErrNilMark is returned when the mark given to one of the methods that
+	// search or insert relative to a mark is nil
+	ErrNilMark = errors.New("Empty mark")
+
+	// ErrNilItem is returned when the given item is nil
+	ErrNilItem = errors.New("Nil item")
+
+	// ErrInvalidItem is returned when the given item was not returned by one of
+	// the methods of the linked list. The error may be wrapped with more details.
+	ErrInvalidItem = errors.New("Invalid item")
+
+	// ErrInvalidMove is returned when moving an item to where it already is
+	ErrInvalidMove = errors.New("Invalid move")
+
+	// ErrNilLinkedList is returned when the given linked list is nil
+	ErrNilLinkedList = errors.New("Nil linked list")
+
+	// ErrInvalidLinkedList is returned when a linked list is combined with
+	// itself. The error is wrapped with more details.
+	ErrInvalidLinkedList = errors.New("Invalid linked list")
+
+	// ErrBucketExists is returned when copying a linked list to an id that is
+	// already in use
+	ErrBucketExists = errors.New("Bucket already exists")
+
+	// ErrNilDatabase is returned when the given database is nil
+	ErrNilDatabase = errors.New("Nil database")
+
+	// ErrStop can be returned by the function passed to ForEach and ForEachReverse
+	// in order to stop the iteration early. It is never returned by those methods.
+	ErrStop = errors.New("Stop iteration")
 )
 
-// New returns a new doubly linkedlist with the given id as its identifier
-func New(db *simplebolt.Database, id string) (*LinkedList, error) {
-	name := []byte(id)
-	if err := (*bbolt.DB)(db).Update(func(tx *bbolt.Tx) error {
-		if _, err := tx.CreateBucketIfNotExists(name); err != nil {
-			return errors.New("Could not create bucket: " + err.Error())
+// Option configures a linked list, when given to New or Open
+type Option func(ll *LinkedList) error
+
+// WithFillPercent sets the fill percent of the linked list, see SetFillPercent.
+// It must be 0, for the default, or between 0.1 and 1.0.
+func WithFillPercent(fillPercent float64) Option {
+	return func(ll *LinkedList) error {
+		if fillPercent != 0 && (fillPercent < 0.1 || fillPercent > 1.0) {
+			return fmt.Errorf("%w: fill percent %v is not between 0.1 and 1.0", ErrInvalidOption, fillPercent)
 		}
+		ll.fillPercent.Store(fillPercent)
 		return nil
+	}
+}
+
+// newLinkedList returns a linked list with the given name, configured with the
+// given options, or the first error returned by an option
+func newLinkedList(db *simplebolt.Database, name []byte, opts []Option) (*LinkedList, error) {
+	ll := &LinkedList{db: db, name: name}
+	for _, opt := range opts {
+		if err := opt(ll); err != nil {
+			return nil, err
+		}
+	}
+	return ll, nil
+}
+
+// New returns a new doubly linkedlist with the given id as its identifier,
+// configured with the given options, like WithFillPercent
+func New(db *simplebolt.Database, id string, opts ...Option) (*LinkedList, error) {
+	if err := simplebolt.ValidateID(id); err != nil {
+		return nil, err
+	}
+	name := []byte(id)
+	ll, err := newLinkedList(db, name, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := update(db, "New", func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(name)
+		if err != nil {
+			return fmt.Errorf("Could not create bucket: %w", err)
+		}
+		if err := migrateEnds(bucket); err != nil {
+			return err
+		}
+		return simplebolt.RegisterBucket(tx, id, "LinkedList")
 	}); err != nil {
 		return nil, err
 	}
 	// Success
-	return &LinkedList{db, name}, nil
+	return ll, nil
+}
+
+// Open returns an existing linked list with the given id as its identifier,
+// without creating or changing anything. Returns ErrBucketNotFound if there is
+// no bucket with the given id, and ErrNotLinkedList if the bucket is not empty
+// but has no front and back of a linked list, for instance if it holds another
+// data structure, or a linked list that has not been opened with New since it
+// was written by an earlier version of this package. The linked list is
+// configured with the given options, like WithFillPercent.
+func Open(db *simplebolt.Database, id string, opts ...Option) (*LinkedList, error) {
+	if err := simplebolt.ValidateID(id); err != nil {
+		return nil, err
+	}
+	name := []byte(id)
+	ll, err := newLinkedList(db, name, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := view(db, "Open", func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(name)
+		if bucket == nil {
+			return ErrBucketNotFound
+		}
+		if bucket.Get([]byte("FRONT")) == nil || bucket.Get([]byte("BACK")) == nil {
+			if key, _ := bucket.Cursor().First(); key != nil {
+				return ErrNotLinkedList
+			}
+		}
+		return nil // Return from View function
+	}); err != nil {
+		return nil, err
+	}
+	return ll, nil
+}
+
+// SetFillPercent sets how full the pages of the bucket of the linked list are
+// filled when they are split, by the methods that modify the linked list. Bolt
+// uses 0.5 by default, which leaves room for inserting keys in the middle of the
+// pages. Since the keys of new nodes are always increasing, also when they are
+// inserted in the middle of the list, a value close to 1.0, like 0.9, makes the
+// pages fuller. Then fewer pages are split when pushing many nodes, and the
+// database file is smaller, but updating or removing nodes may split more
+// pages. Bolt limits the value to between 0.1 and 1.0.
+//
+// When no fill percent has been set, or it is reset with 0, the methods that
+// push nodes fill the pages completely, and the other methods use the default.
+func (ll *LinkedList) SetFillPercent(fillPercent float64) {
+	ll.fillPercent.Store(fillPercent)
+}
+
+// bucket returns the bucket of the linked list within the given transaction,
+// with the fill percent of the linked list, or nil if the bucket does not exist
+func (ll *LinkedList) bucket(tx *bbolt.Tx) *bbolt.Bucket {
+	return withFillPercent(tx.Bucket(ll.name), ll.fillPercent.Load(), 0)
+}
+
+// appendBucket returns the bucket of the linked list, like bucket, for pushing
+// nodes. Unless a fill percent has been set, the pages are filled completely,
+// since the keys of new nodes are always increasing.
+func (ll *LinkedList) appendBucket(tx *bbolt.Tx) *bbolt.Bucket {
+	return withFillPercent(tx.Bucket(ll.name), ll.fillPercent.Load(), appendFillPercent)
+}
+
+// atomicFloat is a float64 that can be loaded and stored atomically
+type atomicFloat struct {
+	bits atomic.Uint64
+}
+
+// Load returns the value
+func (f *atomicFloat) Load() float64 {
+	return math.Float64frombits(f.bits.Load())
+}
+
+// Store sets the value
+func (f *atomicFloat) Store(value float64) {
+	f.bits.Store(math.Float64bits(value))
+}
+
+// withFillPercent sets the fill percent of the given bucket, if it is not nil,
+// to the given fill percent, or to the fallback if it is 0. The default of Bolt
+// is kept if both are 0.
+func withFillPercent(bucket *bbolt.Bucket, fillPercent, fallback float64) *bbolt.Bucket {
+	if fillPercent == 0 {
+		fillPercent = fallback
+	}
+	if bucket != nil && fillPercent != 0 {
+		bucket.FillPercent = fillPercent
+	}
+	return bucket
 }
 
 // PushBack inserts data at the end of the doubly linked list.
-// Returns an "Empty data" error if data is nil. It also may fail if either
+// Returns ErrEmptyData if data is nil. It also may fail if either
 // bbolt operations or protocol buffer serialization/deserialization fail
 func (ll *LinkedList) PushBack(data []byte) error {
 	// Checks whether there is new data.
 	// Nothing gets pushed if data is nil and returns an Empty data error.
 	if data == nil {
 		// No data to push
-		return fmt.Errorf("Empty data")
+		return ErrEmptyData
 	}
-	return (*bbolt.DB)(ll.db).Update(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket(ll.name)
+	return update(ll.db, "PushBack", func(tx *bbolt.Tx) error {
+		bucket := ll.appendBucket(tx)
 		if bucket == nil {
 			return ErrBucketNotFound
 		}
@@ -116,6 +355,10 @@ func (ll *LinkedList) PushBack(data []byte) error {
 		// Get the id of the new node
 		id, _ = bucket.NextSequence()
 		newNodeID := byteID(id)
+		// Refuse duplicated data in unique mode
+		if err = uniqueAdd(uniqueIndex(tx, ll.name), data, newNodeID); err != nil {
+			return err
+		}
 
 		newNode := &pb.LinkedListNode{
 			Data: data,
@@ -130,20 +373,20 @@ func (ll *LinkedList) PushBack(data []byte) error {
 		if backKey == nil {
 			// This is the first node, no need to link previous nodes to this one.
 			// Serialize the first node
-			if nodeBytes, err = proto.Marshal(newNode); err != nil {
-				return fmt.Errorf("Could not marshal. %v", err)
+			if nodeBytes, err = marshalNode(bucket, newNode); err != nil {
+				return fmt.Errorf("Could not marshal. %w", err)
 			}
 			// Save the first node
 			if err = bucket.Put(newNodeID, nodeBytes); err != nil {
-				return fmt.Errorf("Could not save the first node. %v", err)
+				return fmt.Errorf("Could not save the first node. %w", err)
 			}
 			// Set the front of the list
 			if err = bucket.Put([]byte("FRONT"), newNodeID); err != nil {
-				return fmt.Errorf("Could not set front of the linked list. %v", err)
+				return fmt.Errorf("Could not set front of the linked list. %w", err)
 			}
 			// Set the back of the list
 			if err = bucket.Put([]byte("BACK"), newNodeID); err != nil {
-				return fmt.Errorf("Could not set back of the linked list. %v", err)
+				return fmt.Errorf("Could not set back of the linked list. %w", err)
 			}
 			return nil
 		}
@@ -157,28 +400,28 @@ func (ll *LinkedList) PushBack(data []byte) error {
 
 		// De-serialize the last node to access the next link
 		lastNode := &pb.LinkedListNode{}
-		if err = proto.Unmarshal(nodeBytes, lastNode); err != nil {
-			return fmt.Errorf("Could not unmarshal. %v", err)
+		if err = unmarshalNode(bucket, nodeBytes, lastNode); err != nil {
+			return fmt.Errorf("Could not unmarshal. %w", err)
 		}
 		// Set the next link of the last node to the ID of the new node
 		lastNode.Next = newNodeID
 		// Serialize back the last node
-		if nodeBytes, err = proto.Marshal(lastNode); err != nil {
-			return fmt.Errorf("Could not marshal. %v", err)
+		if nodeBytes, err = marshalNode(bucket, lastNode); err != nil {
+			return fmt.Errorf("Could not marshal. %w", err)
 		}
 		// Save changes to the last node.
 		if err = bucket.Put(backKey, nodeBytes); err != nil {
-			return fmt.Errorf("Could not save changes to the last node. %v", err)
+			return fmt.Errorf("Could not save changes to the last node. %w", err)
 		}
 		// Link the new node to the last node
 		newNode.Prev = backKey
 		// Serialize the new node
-		if nodeBytes, err = proto.Marshal(newNode); err != nil {
-			return fmt.Errorf("Could not marshal. %v", err)
+		if nodeBytes, err = marshalNode(bucket, newNode); err != nil {
+			return fmt.Errorf("Could not marshal. %w", err)
 		}
 		// Save the new node
 		if err = bucket.Put(newNodeID, nodeBytes); err != nil {
-			return fmt.Errorf("Could not save the new node. %v", err)
+			return fmt.Errorf("Could not save the new node. %w", err)
 		}
 		// Reset the back node key
 		return bucket.Put([]byte("BACK"), newNodeID)
@@ -186,17 +429,17 @@ func (ll *LinkedList) PushBack(data []byte) error {
 }
 
 // PushFront inserts data at the beginning of the doubly linked list.
-// Returns an "Empty data" error if data is nil. It also may fail if either
+// Returns ErrEmptyData if data is nil. It also may fail if either
 // bbolt operations or protocol buffer serialization/deserialization fail
 func (ll *LinkedList) PushFront(data []byte) error {
 	// Checks whether there is new data.
 	// Nothing gets pushed if data is nil and returns an Empty data error.
 	if data == nil {
 		// No data to push
-		return fmt.Errorf("Empty data")
+		return ErrEmptyData
 	}
-	return (*bbolt.DB)(ll.db).Update(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket(ll.name)
+	return update(ll.db, "PushFront", func(tx *bbolt.Tx) error {
+		bucket := ll.appendBucket(tx)
 		if bucket == nil {
 			return ErrBucketNotFound
 		}
@@ -208,6 +451,10 @@ func (ll *LinkedList) PushFront(data []byte) error {
 		// Get the id of the new node
 		id, _ = bucket.NextSequence()
 		newNodeID := byteID(id)
+		// Refuse duplicated data in unique mode
+		if err = uniqueAdd(uniqueIndex(tx, ll.name), data, newNodeID); err != nil {
+			return err
+		}
 
 		newNode := &pb.LinkedListNode{
 			Data: data,
@@ -222,23 +469,24 @@ func (ll *LinkedList) PushFront(data []byte) error {
 		if frontKey == nil {
 			// This is the first node, no need to link this node to other ones.
 			// Serialize the first node
-			if nodeBytes, err = proto.Marshal(newNode); err != nil {
-				return fmt.Errorf("Could not marshal. %v", err)
+			if nodeBytes, err = marshalNode(bucket, newNode); err != nil {
+				return fmt.Errorf("Could not marshal. %w", err)
 			}
 			// Save the first node
 			if err = bucket.Put(newNodeID, nodeBytes); err != nil {
-				return fmt.Errorf("Could not save the first node. %v", err)
+				return fmt.Errorf("Could not save the first node. %w", err)
 			}
 			// Set the front of the list
 			if err = bucket.Put([]byte("FRONT"), newNodeID); err != nil {
-				return fmt.Errorf("Could not set front of the linked list. %v", err)
+				return fmt.Errorf("Could not set front of the linked list. %w", err)
 			}
 			// Set the back of the list
 			if err = bucket.Put([]byte("BACK"), newNodeID); err != nil {
-				return fmt.Errorf("Could not set back of the linked list. %v", err)
+				return fmt.Errorf("Could not set back of the linked list. %w", err)
 			}
+			return nil
 		}
-		// This is *not* the first node. Get the node at the back of the linked list.
+		// This is *not* the first node. Get the node at the front of the linked list.
 		nodeBytes = bucket.Get(frontKey)
 		if nodeBytes == nil {
 			return ErrDoesNotExist
@@ -248,67 +496,261 @@ func (ll *LinkedList) PushFront(data []byte) error {
 
 		// De-serialize the first node to access the prev link
 		firstNode := &pb.LinkedListNode{}
-		if err = proto.Unmarshal(nodeBytes, firstNode); err != nil {
-			return fmt.Errorf("Could not unmarshal. %v", err)
+		if err = unmarshalNode(bucket, nodeBytes, firstNode); err != nil {
+			return fmt.Errorf("Could not unmarshal. %w", err)
 		}
 		// Set the prev link of the first node to the ID of the new node
 		firstNode.Prev = newNodeID
 
 		// Serialize back the first node
-		if nodeBytes, err = proto.Marshal(firstNode); err != nil {
-			return fmt.Errorf("Could not marshal. %v", err)
+		if nodeBytes, err = marshalNode(bucket, firstNode); err != nil {
+			return fmt.Errorf("Could not marshal. %w", err)
 		}
 		// Save the changes to the first node
 		if err = bucket.Put(frontKey, nodeBytes); err != nil {
-			return fmt.Errorf("Could not save changes to the first node. %v", err)
+			return fmt.Errorf("Could not save changes to the first node. %w", err)
 		}
 		// Link the new node to the first node
 		newNode.Next = frontKey
 
 		// Serialize the new node
-		if nodeBytes, err = proto.Marshal(newNode); err != nil {
-			return fmt.Errorf("Could not marshal. %v", err)
+		if nodeBytes, err = marshalNode(bucket, newNode); err != nil {
+			return fmt.Errorf("Could not marshal. %w", err)
 		}
 		// Save the new node
 		if err = bucket.Put(newNodeID, nodeBytes); err != nil {
-			return fmt.Errorf("Could not save the new node. %v", err)
+			return fmt.Errorf("Could not save the new node. %w", err)
 		}
 		// Reset the front node key
 		return bucket.Put([]byte("FRONT"), newNodeID)
 	})
 }
 
-// Front returns the element at the front of the linked list.
-// Returns a nil item if the list is empty.
+// PushBackAll inserts all the given data at the end of the doubly linked list,
+// preserving the order of the arguments. All the nodes are written within a
+// single bbolt.Update transaction, which is much faster than calling PushBack
+// for each of them.
 //
-// It may return an error in case of:
+// Returns ErrEmptyData if any of the given data is nil, in which case
+// nothing is pushed.
+func (ll *LinkedList) PushBackAll(items [][]byte) error {
+	return ll.pushAll(context.Background(), items, false)
+}
+
+// PushBackAllCtx works like PushBackAll, but stops and returns the error of the
+// context as soon as it is cancelled. The context is checked between batches
+// of nodes, and then the transaction is rolled back, so nothing is pushed.
+func (ll *LinkedList) PushBackAllCtx(ctx context.Context, items [][]byte) error {
+	return ll.pushAll(ctx, items, false)
+}
+
+// PushFrontAll inserts all the given data at the beginning of the doubly linked
+// list, preserving the order of the arguments, so that the first of the given
+// data ends up at the front of the list. All the nodes are written within a
+// single bbolt.Update transaction.
 //
-// bbolt.View() error
+// Returns ErrEmptyData if any of the given data is nil, in which case
+// nothing is pushed.
+func (ll *LinkedList) PushFrontAll(items [][]byte) error {
+	return ll.pushAll(context.Background(), items, true)
+}
+
+// PushFrontAllCtx works like PushFrontAll, but stops and returns the error of
+// the context as soon as it is cancelled, just like PushBackAllCtx.
+func (ll *LinkedList) PushFrontAllCtx(ctx context.Context, items [][]byte) error {
+	return ll.pushAll(ctx, items, true)
+}
+
+// ReplaceAll replaces the contents of the linked list with the given data, in
+// the same order, within a single bbolt.Update transaction. Either the whole
+// replacement is stored, or the linked list is left as it was. The keys of the
+// removed nodes are not reused, so items retrieved before the replacement can not
+// refer to the new nodes.
 //
-// proto.Unmarshal() error
-func (ll *LinkedList) Front() (i *Item, err error) {
-	return i, (*bbolt.DB)(ll.db).View(func(tx *bbolt.Tx) error {
-		k, val, empty, err := ll.first()
+// Returns ErrEmptyData if any of the given data is nil, in which case
+// nothing is replaced.
+func (ll *LinkedList) ReplaceAll(items [][]byte) error {
+	for _, data := range items {
+		if data == nil {
+			return ErrEmptyData
+		}
+	}
+	return update(ll.db, "ReplaceAll", func(tx *bbolt.Tx) error {
+		bucket := ll.bucket(tx)
+		if bucket == nil {
+			return ErrBucketNotFound
+		}
+		return replaceAll(bucket, uniqueIndex(tx, ll.name), items)
+	})
+}
+
+// replaceAll removes all the nodes in the given bucket, while keeping its
+// sequence, and then inserts the given data as new nodes. The unique index is
+// nil if the linked list is not in unique mode.
+func replaceAll(bucket, unique *bbolt.Bucket, items [][]byte) error {
+	// Seek to the first key again after each deletion, since the cursor may
+	// skip a key when Next is called after Delete
+	c := bucket.Cursor()
+	for key, _ := c.First(); key != nil; key, _ = c.First() {
+		if err := c.Delete(); err != nil {
+			return err
+		}
+	}
+	if err := uniqueClear(unique); err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	return pushAll(bucket, unique, items, false)
+}
+
+// pushAll inserts all the given data at the front or the back of the list,
+// within a single transaction, checking the context between batches of nodes
+func (ll *LinkedList) pushAll(ctx context.Context, items [][]byte, front bool) error {
+	for _, data := range items {
+		if data == nil {
+			return ErrEmptyData
+		}
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	op := "PushBackAll"
+	if front {
+		op = "PushFrontAll"
+	}
+	return update(ll.db, op, func(tx *bbolt.Tx) error {
+		bucket := ll.appendBucket(tx)
+		if bucket == nil {
+			return ErrBucketNotFound
+		}
+		unique := uniqueIndex(tx, ll.name)
+		for start := 0; start < len(items); start += batchSize {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			end := start + batchSize
+			if end > len(items) {
+				end = len(items)
+			}
+			batch := items[start:end]
+			if front {
+				// Push the batches in reverse order, to keep the order of the data
+				batch = items[len(items)-end : len(items)-start]
+			}
+			if err := pushAll(bucket, unique, batch, front); err != nil {
+				return err
+			}
+		}
+		// Roll back if the context was cancelled during the last batch
+		return ctx.Err()
+	})
+}
+
+// pushAll links the given data together as new nodes and inserts them at the
+// front or the back of the list stored in the given bucket. Only the node at the
+// boundary between the existing and the new nodes is updated. The unique index
+// is nil if the linked list is not in unique mode.
+func pushAll(bucket, unique *bbolt.Bucket, items [][]byte, front bool) error {
+	// Get the ids of all the new nodes
+	keys := make([][]byte, len(items))
+	for i, data := range items {
+		id, err := bucket.NextSequence()
 		if err != nil {
 			return err
 		}
-		if empty {
-			i, err = nil, nil
+		keys[i] = byteID(id)
+		// Refuse duplicated data in unique mode, also among the new nodes
+		if err := uniqueAdd(unique, data, keys[i]); err != nil {
 			return err
 		}
-		llFirstNode := &pb.LinkedListNode{}
-		if err := proto.Unmarshal(val, llFirstNode); err != nil {
-			return fmt.Errorf("Could not unmarshal. %v", err)
+	}
+	firstKey, lastKey := keys[0], keys[len(keys)-1]
+	frontKey := copyKey(bucket.Get([]byte("FRONT")))
+	backKey := copyKey(bucket.Get([]byte("BACK")))
+	// Save the new nodes, linked among themselves
+	for i, data := range items {
+		node := &pb.LinkedListNode{Data: data}
+		if i > 0 {
+			node.Prev = keys[i-1]
+		} else if !front {
+			// Link the first new node to the node at the back, if any
+			node.Prev = backKey
+		}
+		if i < len(items)-1 {
+			node.Next = keys[i+1]
+		} else if front {
+			// Link the last new node to the node at the front, if any
+			node.Next = frontKey
+		}
+		if err := putNode(bucket, keys[i], node); err != nil {
+			return err
 		}
-		i = &Item{
-			Data: &storedData{
-				key:                k,
-				value:              llFirstNode.Data,
-				internalLinkedList: ll,
-			},
+	}
+	if front {
+		// Link the node at the front to the last new node
+		if frontKey != nil {
+			frontNode, err := getNode(bucket, frontKey)
+			if err != nil {
+				return err
+			}
+			frontNode.Prev = lastKey
+			if err := putNode(bucket, frontKey, frontNode); err != nil {
+				return err
+			}
+		} else {
+			backKey = lastKey
 		}
-		return nil
-	})
+		return setEnds(bucket, firstKey, backKey)
+	}
+	// Link the node at the back to the first new node
+	if backKey != nil {
+		backNode, err := getNode(bucket, backKey)
+		if err != nil {
+			return err
+		}
+		backNode.Next = firstKey
+		if err := putNode(bucket, backKey, backNode); err != nil {
+			return err
+		}
+	} else {
+		frontKey = firstKey
+	}
+	return setEnds(bucket, frontKey, lastKey)
+}
+
+// Front returns the element at the front of the linked list.
+// Returns a nil item if the list is empty.
+//
+// It may return an error in case of:
+//
+// bbolt.View() error
+//
+// unmarshalNode() error
+func (ll *LinkedList) Front() (i *Item, err error) {
+	k, val, empty, err := ll.first()
+	if err != nil || empty {
+		return nil, err
+	}
+	if val == nil {
+		return nil, ErrDoesNotExist
+	}
+	llFirstNode := &pb.LinkedListNode{}
+	if err := unmarshalNode(nil, val, llFirstNode); err != nil {
+		return nil, fmt.Errorf("Could not unmarshal. %w", err)
+	}
+	if err := decryptNode(ll.db, llFirstNode); err != nil {
+		return nil, err
+	}
+	return &Item{
+		Data: &storedData{
+			key:                k,
+			value:              llFirstNode.Data,
+			internalLinkedList: ll,
+			version:            llFirstNode.GetVersion(),
+		},
+	}, nil
 }
 
 // Back returns the element at the back of the linked list.
@@ -318,64 +760,68 @@ func (ll *LinkedList) Front() (i *Item, err error) {
 //
 // bbolt.View() error
 //
-// proto.Unmarshal() error
+// unmarshalNode() error
 func (ll *LinkedList) Back() (i *Item, err error) {
-	return i, (*bbolt.DB)(ll.db).View(func(tx *bbolt.Tx) error {
-		k, val, empty, err := ll.last()
-		if err != nil {
-			return err
-		}
-		if empty {
-			i, err = nil, nil
-			return err
-		}
-		llLastNode := &pb.LinkedListNode{}
-		if err := proto.Unmarshal(val, llLastNode); err != nil {
-			return fmt.Errorf("Could not unmarshal. %v", err)
-		}
-		i = &Item{
-			Data: &storedData{
-				key:                k,
-				value:              llLastNode.Data,
-				internalLinkedList: ll,
-			},
-		}
-		return nil
-	})
+	k, val, empty, err := ll.last()
+	if err != nil || empty {
+		return nil, err
+	}
+	if val == nil {
+		return nil, ErrDoesNotExist
+	}
+	llLastNode := &pb.LinkedListNode{}
+	if err := unmarshalNode(nil, val, llLastNode); err != nil {
+		return nil, fmt.Errorf("Could not unmarshal. %w", err)
+	}
+	if err := decryptNode(ll.db, llLastNode); err != nil {
+		return nil, err
+	}
+	return &Item{
+		Data: &storedData{
+			key:                k,
+			value:              llLastNode.Data,
+			internalLinkedList: ll,
+			version:            llLastNode.GetVersion(),
+		},
+	}, nil
 }
 
-// first checks whether the linked list has elements and returns the first key/value pair
+// first checks whether the linked list has elements and returns the key and the
+// serialized node at the front. The value is nil if the node does not exist.
 func (ll *LinkedList) first() (key, val []byte, empty bool, err error) {
-	err = (*bbolt.DB)(ll.db).View(func(tx *bbolt.Tx) error {
+	err = view(ll.db, "Front", func(tx *bbolt.Tx) error {
 		var bucket *bbolt.Bucket
-		if bucket = tx.Bucket(ll.name); bucket == nil {
+		if bucket = ll.bucket(tx); bucket == nil {
 			return ErrBucketNotFound
 		}
-		key = bucket.Get([]byte("FRONT"))
+		// Copy the key and the value, since they are only valid within the transaction
+		key = copyKey(bucket.Get([]byte("FRONT")))
 		if key == nil {
 			empty = true
-		} else {
+		} else if nodeBytes := bucket.Get(key); nodeBytes != nil {
 			empty = false
-			val = bucket.Get(key)
+			val = append([]byte{}, nodeBytes...)
 		}
 		return nil
 	})
 	return
 }
 
-// last checks whether the linked list has elements and returns the last key/value pair
+// last checks whether the linked list has elements and returns the key and the
+// serialized node at the back. The value is nil if the node does not exist.
 func (ll *LinkedList) last() (key, val []byte, empty bool, err error) {
-	err = (*bbolt.DB)(ll.db).View(func(tx *bbolt.Tx) error {
+	err = view(ll.db, "Back", func(tx *bbolt.Tx) error {
 		var bucket *bbolt.Bucket
-		if bucket = tx.Bucket(ll.name); bucket == nil {
+		if bucket = ll.bucket(tx); bucket == nil {
 			return ErrBucketNotFound
 		}
-		key = bucket.Get([]byte("BACK"))
+		// Copy the key and the value, since they are only valid within the transaction
+		key = copyKey(bucket.Get([]byte("BACK")))
 		if key == nil {
 			empty = true
-		} else {
+		} else if nodeBytes := bucket.Get(key); nodeBytes != nil {
 			empty = false
-			val = bucket.Get(key)
+			val = append([]byte{}, nodeBytes...)
 		}
 		return nil
 	})
@@ -394,8 +840,8 @@ func (ll *LinkedList) last() (key, val []byte, empty bool, err error) {
 // If Get can't find any match, it returns an nil item and a nil error.
 //
 // It may return an error due to a failed call to ll.Front().
-// It also returns either an "Empty list" error when called on a list with no elements,
-// or an "Empty val" error when called with a nil []byte val. In all the cases, the
+// It also returns either ErrEmptyList when called on a list with no elements,
+// or ErrEmptyValue when called with a nil []byte val. In all the cases, the
 // returned item is nil.
 //
 // Note that both Get and GetFunc always return the first match, if any. If you inserted
@@ -405,28 +851,20 @@ func (ll *LinkedList) last() (key, val []byte, empty bool, err error) {
 // methods.
 func (ll *LinkedList) Get(val []byte) (*Item, error) {
 	// Check whether the list has no elements
-	front, err := ll.Front()
+	_, _, empty, err := ll.first()
 	if err != nil {
 		return nil, err
 	}
-	if front == nil {
-		return nil, fmt.Errorf("Empty list")
+	if empty {
+		return nil, ErrEmptyList
 	}
 	// Check whether the user provided a value to get
 	if val == nil {
-		return nil, fmt.Errorf("Empty val")
+		return nil, ErrEmptyValue
 	}
-	var it *Item
 	// Search from the front of the list until either
 	// the end of the list or a match has been found.
-	for k := front; k != nil; k = k.Next() {
-		if bytes.Equal(val, k.Data.Value()) {
-			// Found it!
-			it = k
-			break
-		}
-	}
-	return it, nil
+	return ll.search(val, nil, false, bytesEqual)
 }
 
 // GetFunc compares val with the value of every single node in the linked list,
@@ -437,9 +875,9 @@ func (ll *LinkedList) Get(val []byte) (*Item, error) {
 // If GetFunc can't find any matches, it returns an nil item and a nil error.
 //
 // It may return an error due to a failed call to ll.Front().
-// It also returns either an "Empty list" error when called on a list with no elements,
-// an "Empty val" error when called with a nil interface{} val or an "Empty comparing
-// function" when called with a nil function to compare. In all the cases, the returned
+// It also returns either ErrEmptyList when called on a list with no elements,
+// ErrEmptyValue when called with a nil interface{} val or ErrNilFunc
+// when called with a nil function to compare. In all the cases, the returned
 // item is nil.
 //
 // Note that both Get and GetFunc always return the first match, if any. If you inserted
@@ -451,32 +889,53 @@ func (ll *LinkedList) Get(val []byte) (*Item, error) {
 // For an example on the usage, see example/linkedlist/main.go
 func (ll *LinkedList) GetFunc(val interface{}, equal func(a interface{}, b []byte) bool) (*Item, error) {
 	// Check whether the list has no elements
-	front, err := ll.Front()
+	_, _, empty, err := ll.first()
 	if err != nil {
 		return nil, err
 	}
-	if front == nil {
-		return nil, fmt.Errorf("Empty list")
+	if empty {
+		return nil, ErrEmptyList
 	}
 	// Check whether the user provided a value to get
 	if val == nil {
-		return nil, fmt.Errorf("Empty val")
+		return nil, ErrEmptyValue
 	}
 	// Check whether the user provided a function to compare for equality
 	if equal == nil {
-		return nil, fmt.Errorf("Empty comparing function")
+		return nil, ErrNilFunc
 	}
-	var it *Item
 	// Search from the front of the list until either
 	// the end of the list or a match has been found.
-	for k := front; k != nil; k = k.Next() {
-		if equal(val, k.Data.Value()) {
-			// Found it!
-			it = k
-			break
-		}
+	return ll.search(val, nil, false, equal)
+}
+
+// GetFuncReverse works like GetFunc, but searches from the back to the front of
+// the linked list, and thus returns the last match, if any. This is faster than
+// GetFunc when the match is likely to be near the back, for instance for the most
+// recent match in a list where new items are pushed to the back.
+//
+// To find earlier matches, call GetPrevFunc with the returned item as the mark.
+// It returns the same errors as GetFunc.
+func (ll *LinkedList) GetFuncReverse(val interface{}, equal func(a interface{}, b []byte) bool) (*Item, error) {
+	// Check whether the list has no elements
+	_, _, empty, err := ll.last()
+	if err != nil {
+		return nil, err
+	}
+	if empty {
+		return nil, ErrEmptyList
 	}
-	return it, nil
+	// Check whether the user provided a value to get
+	if val == nil {
+		return nil, ErrEmptyValue
+	}
+	// Check whether the user provided a function to compare for equality
+	if equal == nil {
+		return nil, ErrNilFunc
+	}
+	// Search from the back of the list until either
+	// the front of the list or a match has been found.
+	return ll.search(val, nil, true, equal)
 }
 
 // GetNext compares val with the value of every single node in the linked list,
@@ -488,42 +947,21 @@ func (ll *LinkedList) GetFunc(val interface{}, equal func(a interface{}, b []byt
 // If GetNext can't find any match, it returns an nil item and a nil error.
 //
 // It may return an error due to a failed call to bbolt.View.
-// It returns either an "Empty list" error when called on a list with no elements,
-// an "Empty val" error when called with a nil val to get, or an "Empty mark" error
-// when called with a nil mark to begin from. In all the cases the item returned
-// is nil.
+// It returns either ErrEmptyList when called on a list with no elements,
+// ErrEmptyValue when called with a nil val to get, ErrNilMark
+// when called with a nil mark to begin from, ErrInvalidMark when the mark is not a
+// linked list item or belongs to another linked list, or ErrStaleItem when the
+// node of the mark has been removed. In all the cases the item returned is nil.
 //
 // Note that you must pass in a []byte with a value in exactly the same
 // format as the stored data in the linked list. For a more flexible criteria on
 // the equality of the given value and the value in the stored data, see GetFunc and
 // GetNextFunc.
 func (ll *LinkedList) GetNext(val []byte, mark *Item) (*Item, error) {
-	// Check whether the linked list has no elements
-	_, _, empty, err := ll.first()
-	if err != nil {
-		return nil, err
-	}
-	if empty {
-		return nil, fmt.Errorf("Empty list")
-	}
-	// Check whether the user provided a value to get
 	if val == nil {
-		return nil, fmt.Errorf("Empty val")
-	}
-	// Check whether the user provided a mark to begin from
-	if mark == nil {
-		return nil, fmt.Errorf("Empty mark")
-	}
-	var it *Item
-	// Search from the mark either until the end of the list or a match has been found.
-	for k := mark; k != nil; k = k.Next() {
-		if bytes.Equal(val, k.Data.Value()) {
-			// Found it!
-			it = k
-			break
-		}
+		return nil, ErrEmptyValue
 	}
-	return it, nil
+	return ll.GetNextFunc(val, mark, bytesEqual)
 }
 
 // GetNextFunc compares val with the value of every single node in the linked list,
@@ -534,10 +972,11 @@ func (ll *LinkedList) GetNext(val []byte, mark *Item) (*Item, error) {
 //
 // If GetNextFunc can't find any matches, it returns an nil item and a nil error.
 //
-// It returns either an "Empty val" error when called with a nil []byte val, an
-// "Empty mark" error when called with a nil beginning mark, an "Invalid mark" error when
-// the passed item is not a linked list item or belongs to another linked list, or an
-// "Empty comparing  function" error when called with a nil function to compare.
+// It returns either ErrEmptyValue when called with a nil []byte val,
+// ErrNilMark when called with a nil beginning mark, ErrInvalidMark when
+// the passed item is not a linked list item or belongs to another linked list,
+// ErrStaleItem when the node of the mark has been removed, or ErrNilFunc
+// when called with a nil function to compare.
 //
 // For an example on the usage, see example/linkedlist/main.go
 func (ll *LinkedList) GetNextFunc(val interface{}, mark *Item, equal func(a interface{}, b []byte) bool) (*Item, error) {
@@ -547,241 +986,540 @@ func (ll *LinkedList) GetNextFunc(val interface{}, mark *Item, equal func(a inte
 		return nil, err
 	}
 	if empty {
-		return nil, fmt.Errorf("Empty list")
+		return nil, ErrEmptyList
 	}
 	// Check whether the user provided a value to get
 	if val == nil {
-		return nil, fmt.Errorf("Empty val")
+		return nil, ErrEmptyValue
 	}
 	// Check whether the user provided a mark to begin from
 	if mark == nil {
-		return nil, fmt.Errorf("Empty mark")
+		return nil, ErrNilMark
 	}
 	// Check whether the provided mark is a valid linked list item
 	sd, ok := mark.Data.(*storedData)
 	if !ok {
-		return nil, fmt.Errorf("Invalid mark")
+		return nil, ErrInvalidMark
+	}
+	if sd.stale {
+		return nil, ErrStaleItem
 	}
 	// Check whether the provided mark belongs to the linked list
 	if ll != sd.internalLinkedList {
-		return nil, fmt.Errorf("Invalid mark: item belongs to another linked list")
+		return nil, fmt.Errorf("%w: item belongs to another linked list", ErrInvalidMark)
 	}
 	// Check ehwther the user provided a function to compare for equality
 	if equal == nil {
-		return nil, fmt.Errorf("Empty comparing function")
+		return nil, ErrNilFunc
 	}
-	var it *Item
-	// Search from the mark either until the end of the list or a match has been found.
-	for k := mark; k != nil; k = k.Next() {
-		if equal(val, k.Data.Value()) {
-			// Found it!
-			it = k
-			break
-		}
-	}
-	return it, nil
+	// Search from the item next to the mark either until the end of the list or a
+	// match has been found. The mark itself is skipped, so that successive calls
+	// advance through duplicated values.
+	return ll.search(val, sd.key, false, equal)
 }
 
-// Next returns the next item pointed to by the current linked list item.
+// GetPrev compares val with the value of every single node in the linked list,
+// starting from the previous item of the element pointed to by mark and moving
+// towards the front of the list, using bytes.Equal(). If it finds that val and the
+// value of some node are equal, then GetPrev returns the item containing the value
+// of the stored data.
 //
-// It should be called after Front() or any Getter method. Otherwise always returns nil.
+// If GetPrev can't find any match, it returns an nil item and a nil error.
 //
-// Note that it panics if the item is an invalid linked list item, i.e. its Data field
-// has been modified or not returned by one of the linked list methods.
-func (i *Item) Next() (next *Item) {
-	// Type assert the StoredData interface to a *storedData type
-	sd, ok := i.Data.(*storedData)
-	if !ok {
-		// Returns nil in case of an invalid linked list item.
-		return
-	}
-	// Check whether the item refers to an actual item
-	// Returns nil if not.
-	currentKey := sd.key
-	if currentKey == nil {
-		return
-	}
-	ll := sd.internalLinkedList
-	listName := ll.name
-	db := (*bbolt.DB)(ll.db)
-	err := db.View(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket(listName)
-		if bucket == nil {
-			return ErrBucketNotFound
-		}
-		// Retrieve this node to get prev node's link
-		val := bucket.Get(currentKey)
-		if val == nil {
-			return ErrDoesNotExist
-		}
-		currentNode := &pb.LinkedListNode{}
-		if err := proto.Unmarshal(val, currentNode); err != nil {
-			return fmt.Errorf("Could not unmarshal. %v", err)
-		}
-		// Get next key
-		nextKey := currentNode.GetNext()
-		if nextKey == nil {
-			return errReachedEnd
-		}
-		// Get next node
-		val = bucket.Get(nextKey)
-		if val == nil {
-			return ErrDoesNotExist
-		}
-		// Get next node
-		nextNode := &pb.LinkedListNode{}
-		if err := proto.Unmarshal(val, nextNode); err != nil {
-			return fmt.Errorf("Could not unmarshal. %v", err)
-		}
-		// Set the item with next node's data
-		next = &Item{
-			Data: &storedData{
-				key:                nextKey,
-				value:              nextNode.GetData(),
-				internalLinkedList: ll,
-			},
-		}
-		return nil
-	})
-	if err != nil {
-		if err != errReachedEnd {
-			log.Fatalf("Could not get next: %v\n", err)
-		}
+// It returns either ErrEmptyList when called on a list with no elements,
+// ErrEmptyValue when called with a nil val to get, ErrNilMark
+// when called with a nil mark to begin from, ErrInvalidMark when the passed
+// item is not a linked list item or belongs to another linked list, or
+// ErrStaleItem when the node of the mark has been removed. In all the cases the
+// item returned is nil.
+func (ll *LinkedList) GetPrev(val []byte, mark *Item) (*Item, error) {
+	if val == nil {
+		return nil, ErrEmptyValue
 	}
-	return
+	return ll.GetPrevFunc(val, mark, bytesEqual)
 }
 
-// Prev returns the previous item pointed to by the current linked list item.
+// GetPrevFunc compares val with the value of every single node in the linked list,
+// starting from the previous item of the element pointed to by mark and moving
+// towards the front of the list, using the provided function. If it finds that val
+// and the value of some node are equal, according to its criteria, then GetPrevFunc
+// returns the item containing the value of the stored data.
 //
-// It should be called after Back() or any Getter method. Otherwise always returns nil.
+// If GetPrevFunc can't find any matches, it returns an nil item and a nil error.
 //
-// Note that it panics if the item is an invalid linked list item, i.e. its Data field
-// has been modified or not returned by one of the linked list methods.
-func (i *Item) Prev() (prev *Item) {
-	// Type assert the item to a *storedData type and check whether the LinkedList Item
-	// refers to a valid linkedlist item. Returns nil if not.
-	sd, ok := i.Data.(*storedData)
+// It returns the same errors as GetNextFunc.
+func (ll *LinkedList) GetPrevFunc(val interface{}, mark *Item, equal func(a interface{}, b []byte) bool) (*Item, error) {
+	// Check whether the linked list has no elements
+	_, _, empty, err := ll.first()
+	if err != nil {
+		return nil, err
+	}
+	if empty {
+		return nil, ErrEmptyList
+	}
+	// Check whether the user provided a value to get
+	if val == nil {
+		return nil, ErrEmptyValue
+	}
+	// Check whether the user provided a mark to begin from
+	if mark == nil {
+		return nil, ErrNilMark
+	}
+	// Check whether the provided mark is a valid linked list item
+	sd, ok := mark.Data.(*storedData)
 	if !ok {
-		return
+		return nil, ErrInvalidMark
 	}
-	currentKey := sd.key
-	// Check whether the LinkedListItem refers to an actual item.
-	// Returns nil if not.
-	if currentKey == nil {
-		return
+	if sd.stale {
+		return nil, ErrStaleItem
 	}
-	ll := sd.internalLinkedList
-	listName := ll.name
-	db := (*bbolt.DB)(ll.db)
-	err := db.View(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket(listName)
+	// Check whether the provided mark belongs to the linked list
+	if ll != sd.internalLinkedList {
+		return nil, fmt.Errorf("%w: item belongs to another linked list", ErrInvalidMark)
+	}
+	// Check whether the user provided a function to compare for equality
+	if equal == nil {
+		return nil, ErrNilFunc
+	}
+	// Search from the item previous to the mark either until the front of the list
+	// or a match has been found.
+	return ll.search(val, sd.key, true, equal)
+}
+
+// Contains reports whether any node of the linked list has exactly the given
+// data. It is cheaper than Get, since no item is created, and the search stops
+// at the first match. In unique mode, the unique index is used instead of
+// walking the list. The search is done within a single bbolt.View transaction.
+//
+// An empty linked list contains nothing, so no error is returned for it. It
+// returns ErrEmptyValue when called with a nil val.
+func (ll *LinkedList) Contains(val []byte) (bool, error) {
+	if val == nil {
+		return false, ErrEmptyValue
+	}
+	return ll.contains("Contains", val, val, bytesEqual)
+}
+
+// ContainsFunc works like Contains, but compares val with the data of the nodes
+// using the given function, like GetFunc. It returns ErrEmptyValue when called
+// with a nil val, and ErrNilFunc when called with a nil function.
+func (ll *LinkedList) ContainsFunc(val interface{}, equal func(a interface{}, b []byte) bool) (bool, error) {
+	if val == nil {
+		return false, ErrEmptyValue
+	}
+	if equal == nil {
+		return false, ErrNilFunc
+	}
+	return ll.contains("ContainsFunc", nil, val, equal)
+}
+
+// contains walks the linked list from the front until a node matches val
+// according to the given function. If exact is not nil, the unique index is
+// searched for it instead, if the linked list is in unique mode.
+func (ll *LinkedList) contains(op string, exact []byte, val interface{}, equal func(a interface{}, b []byte) bool) (found bool, err error) {
+	err = view(ll.db, op, func(tx *bbolt.Tx) error {
+		bucket := ll.bucket(tx)
 		if bucket == nil {
 			return ErrBucketNotFound
 		}
-		// Retrieve this node to get prev node's link
-		val := bucket.Get(currentKey)
-		if val == nil {
-			return ErrDoesNotExist
+		if unique := uniqueIndex(tx, ll.name); unique != nil && exact != nil {
+			found = uniqueCheck(unique, exact) != nil
+			return nil // Return from View function
 		}
-		currentNode := &pb.LinkedListNode{}
-		if err := proto.Unmarshal(val, currentNode); err != nil {
-			return fmt.Errorf("Could not unmarshal. %v", err)
+		err := walk(bucket, false, func(_ []byte, node *pb.LinkedListNode) error {
+			if equal(val, node.GetData()) {
+				found = true
+				return ErrFoundIt // break the walk by returning an error
+			}
+			return nil // Continue walking
+		})
+		if err == ErrFoundIt {
+			return nil
 		}
-		// Get prev key
-		prevKey := currentNode.GetPrev()
-		if prevKey == nil {
-			return errReachedEnd
+		return err
+	})
+	return found, err
+}
+
+// search compares val with the value of the nodes in the linked list using the
+// given function, within a single bbolt.View transaction, and returns the item of
+// the first match, or nil if there are no matches.
+//
+// If markKey is nil, the search starts from the front of the list (or the back, if
+// reverse is true). Otherwise, it starts from the node next to (or previous to, if
+// reverse is true) the node with the given key.
+func (ll *LinkedList) search(val interface{}, markKey []byte, reverse bool, equal func(a interface{}, b []byte) bool) (it *Item, err error) {
+	err = view(ll.db, "Get", func(tx *bbolt.Tx) error {
+		bucket := ll.bucket(tx)
+		if bucket == nil {
+			return ErrBucketNotFound
 		}
-		// Get prev node
-		val = bucket.Get(prevKey)
-		if val == nil {
-			return ErrDoesNotExist
+		var key []byte
+		switch {
+		case markKey == nil && reverse:
+			key = bucket.Get([]byte("BACK"))
+		case markKey == nil:
+			key = bucket.Get([]byte("FRONT"))
+		default:
+			markNode, err := getNode(bucket, markKey)
+			if err == ErrDoesNotExist {
+				// The node of the mark has been removed through another item
+				return ErrStaleItem
+			} else if err != nil {
+				return err
+			}
+			if reverse {
+				key = markNode.GetPrev()
+			} else {
+				key = markNode.GetNext()
+			}
 		}
-		// Get prev node
-		prevNode := &pb.LinkedListNode{}
-		if err := proto.Unmarshal(val, prevNode); err != nil {
-			return fmt.Errorf("Could not unmarshal. %v", err)
+		for key != nil {
+			node, err := getNode(bucket, key)
+			if err != nil {
+				return err
+			}
+			if equal(val, node.GetData()) {
+				// Found it!
+				it = ll.newItem(key, node)
+				return nil
+			}
+			if reverse {
+				key = node.GetPrev()
+			} else {
+				key = node.GetNext()
+			}
+		}
+		return nil
+	})
+	return it, err
+}
+
+// bytesEqual is the comparing function used by Get, GetNext and the other getters
+// that look for values in exactly the same format as the stored data.
+func bytesEqual(a interface{}, b []byte) bool {
+	return bytes.Equal(a.([]byte), b)
+}
+
+// Next returns the next item pointed to by the current linked list item.
+//
+// It should be called after Front() or any Getter method. Otherwise always returns nil.
+// The returned item is a new one, the current item is left untouched, so that
+// several positions in the list can be held at the same time.
+//
+// It returns nil if the item is stale, see NextItem. It also returns nil if the
+// next node can not be read, after logging the error to the Logger of the
+// database, see simplebolt.Database.SetLogger. Use NextItem to get the error.
+func (i *Item) Next() *Item {
+	next, err := i.NextItem()
+	if err != nil && err != ErrStaleItem {
+		i.logf("Could not get next: %v", err)
+	}
+	return next
+}
+
+// NextItem returns the next item pointed to by the current linked list item, or
+// nil if the current item is at the back of the linked list.
+//
+// It returns ErrStaleItem if the node of the current item has been removed, and
+// ErrInvalidItem if the item was not returned by one of the linked list
+// methods.
+func (i *Item) NextItem() (*Item, error) {
+	return i.sibling(false)
+}
+
+// Prev returns the previous item pointed to by the current linked list item.
+//
+// It should be called after Back() or any Getter method. Otherwise always returns nil.
+// The returned item is a new one, the current item is left untouched.
+//
+// It returns nil if the item is stale, see PrevItem. It also returns nil if the
+// previous node can not be read, after logging the error, like Next. Use
+// PrevItem to get the error.
+func (i *Item) Prev() *Item {
+	prev, err := i.PrevItem()
+	if err != nil && err != ErrStaleItem {
+		i.logf("Could not get prev: %v", err)
+	}
+	return prev
+}
+
+// PrevItem returns the previous item pointed to by the current linked list item,
+// or nil if the current item is at the front of the linked list.
+//
+// It returns ErrStaleItem if the node of the current item has been removed, and
+// ErrInvalidItem if the item was not returned by one of the linked list
+// methods.
+func (i *Item) PrevItem() (*Item, error) {
+	return i.sibling(true)
+}
+
+// logf writes a warning to the logger of the database of the item, if the item
+// belongs to a linked list
+func (i *Item) logf(format string, v ...interface{}) {
+	if sd, ok := i.Data.(*storedData); ok && sd.internalLinkedList != nil {
+		sd.internalLinkedList.db.Logf(format, v...)
+	}
+}
+
+// sibling returns the item linked to by the node of the current item
+func (i *Item) sibling(prev bool) (sibling *Item, err error) {
+	// Type assert the StoredData interface to a *storedData type
+	sd, ok := i.Data.(*storedData)
+	if !ok {
+		return nil, ErrInvalidItem
+	}
+	if sd.stale {
+		return nil, ErrStaleItem
+	}
+	// Check whether the item refers to an actual item
+	currentKey := sd.key
+	ll := sd.internalLinkedList
+	if currentKey == nil || ll == nil {
+		return nil, ErrInvalidItem
+	}
+	op := "Next"
+	if prev {
+		op = "Prev"
+	}
+	err = view(ll.db, op, func(tx *bbolt.Tx) error {
+		bucket := ll.bucket(tx)
+		if bucket == nil {
+			return ErrBucketNotFound
+		}
+		// Retrieve this node to get the link to the sibling
+		if bucket.Get(currentKey) == nil {
+			return ErrStaleItem
+		}
+		currentNode, err := getNode(bucket, currentKey)
+		if err != nil {
+			return err
+		}
+		siblingKey := currentNode.GetNext()
+		if prev {
+			siblingKey = currentNode.GetPrev()
+		}
+		if siblingKey == nil {
+			// Reached the end of the linked list
+			return nil
 		}
-		// Set the item with prev node's data
-		prev = &Item{
-			Data: &storedData{
-				key:                prevKey,
-				value:              prevNode.GetData(),
-				internalLinkedList: ll,
-			},
+		siblingNode, err := getNode(bucket, siblingKey)
+		if err != nil {
+			return err
 		}
+		// Set the item with the sibling node's data
+		sibling = ll.newItem(siblingKey, siblingNode)
 		return nil
 	})
 	if err != nil {
-		if err != errReachedEnd {
-			log.Fatalf("Could not get prev: %v\n", err)
-		}
+		return nil, err
 	}
-	return
+	return sibling, nil
+}
+
+// Key returns a copy of the key of the node at which the item refers to, or nil if
+// the item is not a valid linked list item. The key can be stored and later be
+// passed to LinkedList.GetByKey to retrieve the same node again.
+func (i *Item) Key() []byte {
+	sd, ok := i.Data.(*storedData)
+	if !ok || sd.key == nil {
+		return nil
+	}
+	return append([]byte{}, sd.key...)
+}
+
+// Version returns the version of the node at which the item refers to, as it
+// was when the item was retrieved, or last modified through the item. The version
+// of a node starts at 0, and is increased every time its data is updated, or it is
+// moved with MoveToFront, MoveToBack or MoveToIndex. It is also increased when
+// its links are changed by Reverse, Rotate or Sort. Nodes stored by earlier versions of this
+// package have version 0. Returns 0 if the item is not a valid linked list item.
+func (i *Item) Version() uint64 {
+	sd, ok := i.Data.(*storedData)
+	if !ok {
+		return 0
+	}
+	return sd.version
+}
+
+// UpdateIfUnchanged works like Item.Data.Update, but returns ErrConflict, and
+// leaves the data as it is, if the node has been modified since the item was
+// retrieved, i.e. if its version differs from Item.Version. The versions are
+// compared within the same transaction as the update. On success, the version of
+// the item is the new version of the node.
+func (i *Item) UpdateIfUnchanged(newData []byte) error {
+	sd, ok := i.Data.(*storedData)
+	if !ok {
+		return ErrInvalidItem
+	}
+	return sd.update(newData, true)
+}
+
+// RemoveIfUnchanged works like Item.Data.Remove, but returns ErrConflict, and
+// leaves the node in place, if the node has been modified since the item was
+// retrieved, i.e. if its version differs from Item.Version. The versions are
+// compared within the same transaction as the removal.
+func (i *Item) RemoveIfUnchanged() error {
+	sd, ok := i.Data.(*storedData)
+	if !ok {
+		return ErrInvalidItem
+	}
+	return sd.remove(true)
+}
+
+// GetByKey returns the item that refers to the node with the given key, as
+// returned by Item.Key(). Returns ErrDoesNotExist if there is no such node.
+func (ll *LinkedList) GetByKey(key []byte) (i *Item, err error) {
+	if !isNodeKey(key) {
+		return nil, ErrDoesNotExist
+	}
+	err = view(ll.db, "GetByKey", func(tx *bbolt.Tx) error {
+		bucket := ll.bucket(tx)
+		if bucket == nil {
+			return ErrBucketNotFound
+		}
+		node, err := getNode(bucket, key)
+		if err != nil {
+			return err
+		}
+		i = ll.newItem(key, node)
+		return nil
+	})
+	return i, err
 }
 
 // Value returns the current value of the element at which the item refers to.
-func (sd storedData) Value() []byte {
+func (sd *storedData) Value() []byte {
 	return sd.value
 }
 
+// acquire marks the item as being modified, and returns ErrItemInUse if it
+// already is
+func (sd *storedData) acquire() error {
+	if !sd.inUse.CompareAndSwap(false, true) {
+		return ErrItemInUse
+	}
+	return nil
+}
+
+// release marks the item as no longer being modified
+func (sd *storedData) release() {
+	sd.inUse.Store(false)
+}
+
 // Update resets the value of the element at which the item refers
-// to with the newData. Returns "Empty data" error if newData is nil.
+// to with the newData. Returns ErrEmptyData if newData is nil, and
+// ErrStaleItem if the element has been removed. On success, Value returns a
+// copy of newData.
+//
+// The version of the node is increased, but the version of the item is not
+// compared with it, so the last update wins. See Item.UpdateIfUnchanged.
 //
 // It may also return an error in case of bbolt Update or protocol buffer
 // serialization/deserialization fail. In both cases, the data isn't updated.
 func (sd *storedData) Update(newData []byte) error {
+	return sd.update(newData, false)
+}
+
+// update works like Update, but returns ErrConflict if checkVersion is true and
+// the version of the node differs from the version of the item
+func (sd *storedData) update(newData []byte, checkVersion bool) error {
 	// Checks whether there is new data.
 	// Nothing gets updated if newData is nil and returns Empty data.
 	if newData == nil {
-		return fmt.Errorf("Empty data")
+		return ErrEmptyData
+	}
+	if err := sd.acquire(); err != nil {
+		return err
+	}
+	defer sd.release()
+	if sd.stale {
+		return ErrStaleItem
+	}
+	if sd.internalLinkedList == nil {
+		return ErrInvalidItem
 	}
 
 	listName := sd.internalLinkedList.name
-	db := (*bbolt.DB)(sd.internalLinkedList.db)
 
-	return db.Update(func(tx *bbolt.Tx) error {
+	var version uint64
+	err := update(sd.internalLinkedList.db, "Item.Update", func(tx *bbolt.Tx) error {
 		bucket := tx.Bucket(listName)
 		if bucket == nil {
 			return ErrBucketNotFound
 		}
-		// Get serialized current node
+		// Get serialized current node. It has been removed by other means if it is missing.
 		currentNodeBytes := bucket.Get(sd.key)
 		if currentNodeBytes == nil {
-			return ErrDoesNotExist
+			return ErrStaleItem
 		}
 		var err error
 		// De-serialize current node to access its data
 		currentNode := &pb.LinkedListNode{}
-		if err = proto.Unmarshal(currentNodeBytes, currentNode); err != nil {
-			return fmt.Errorf("Could not unmarshal. %v", err)
+		if err = unmarshalNode(bucket, currentNodeBytes, currentNode); err != nil {
+			return fmt.Errorf("Could not unmarshal. %w", err)
+		}
+		if checkVersion && currentNode.GetVersion() != sd.version {
+			return ErrConflict
+		}
+		// Refuse duplicated data in unique mode
+		if unique := uniqueIndex(tx, listName); unique != nil && !bytes.Equal(currentNode.GetData(), newData) {
+			if err = uniqueRemove(unique, currentNode.GetData()); err != nil {
+				return err
+			}
+			if err = uniqueAdd(unique, newData, sd.key); err != nil {
+				return err
+			}
 		}
 		// Reset data of current node
 		currentNode.Data = newData
+		currentNode.Version++
+		version = currentNode.Version
 		// Serialize back the current node
-		if currentNodeBytes, err = proto.Marshal(currentNode); err != nil {
-			return fmt.Errorf("Could not marshal. %v", err)
+		if currentNodeBytes, err = marshalNode(bucket, currentNode); err != nil {
+			return fmt.Errorf("Could not marshal. %w", err)
 		}
 		// Save changes to current node
 		if err = bucket.Put(sd.key, currentNodeBytes); err != nil {
-			return fmt.Errorf("Could not update. %v", err)
+			return fmt.Errorf("Could not update. %w", err)
 		}
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+	// Let the item reflect its own write
+	sd.value = append([]byte{}, newData...)
+	sd.version = version
+	return nil
 }
 
 // Remove deletes from Bolt the element at which the item data refers to.
+// Afterwards the item is stale, and using it returns ErrStaleItem. The same error
+// is returned if the element has already been removed by other means.
 //
 // It may return an error in case of bbolt Update or protocol buffer
 // serialization/deserialization fail. In both cases, the data isn't removed.
 func (sd *storedData) Remove() error {
+	return sd.remove(false)
+}
+
+// remove works like Remove, but returns ErrConflict if checkVersion is true and
+// the version of the node differs from the version of the item
+func (sd *storedData) remove(checkVersion bool) error {
+	if err := sd.acquire(); err != nil {
+		return err
+	}
+	defer sd.release()
+	if sd.stale {
+		return ErrStaleItem
+	}
 	if sd.internalLinkedList == nil {
-		return fmt.Errorf("Invalid item")
+		return ErrInvalidItem
 	}
 	listName := sd.internalLinkedList.name
-	db := (*bbolt.DB)(sd.internalLinkedList.db)
 
-	return db.Update(func(tx *bbolt.Tx) error {
+	err := update(sd.internalLinkedList.db, "Item.Remove", func(tx *bbolt.Tx) error {
 		// Get key of current item
 		currentKey := sd.key
 
@@ -790,16 +1528,19 @@ func (sd *storedData) Remove() error {
 			return ErrBucketNotFound
 		}
 
-		// Get serialized current node
+		// Get serialized current node. It has been removed by other means if it is missing.
 		currentNodeBytes := bucket.Get(currentKey)
 		if currentNodeBytes == nil {
-			return ErrDoesNotExist
+			return ErrStaleItem
 		}
 		var err error
 		// De-serialize the current node to access next/prev links
 		currentNode := &pb.LinkedListNode{}
-		if err = proto.Unmarshal(currentNodeBytes, currentNode); err != nil {
-			return fmt.Errorf("Could not unmarshal. %v", err)
+		if err = unmarshalNode(bucket, currentNodeBytes, currentNode); err != nil {
+			return fmt.Errorf("Could not unmarshal. %w", err)
+		}
+		if checkVersion && currentNode.GetVersion() != sd.version {
+			return ErrConflict
 		}
 
 		// Get link of prev/next nodes
@@ -816,27 +1557,21 @@ func (sd *storedData) Remove() error {
 			}
 			// De-serialize the previous node to reset its next link
 			prevNode := &pb.LinkedListNode{}
-			err = proto.Unmarshal(prevNodeBytes, prevNode)
+			err = unmarshalNode(bucket, prevNodeBytes, prevNode)
 			if err != nil {
-				return fmt.Errorf("Could not unmarshal. %v", err)
+				return fmt.Errorf("Could not unmarshal. %w", err)
 			}
 			// Reset next link of previous node
 			prevNode.Next = nextKey
 			// Serialize back the next node
-			prevNodeBytes, err = proto.Marshal(prevNode)
+			prevNodeBytes, err = marshalNode(bucket, prevNode)
 			if err != nil {
-				return fmt.Errorf("Could not marshal. %v", err)
+				return fmt.Errorf("Could not marshal. %w", err)
 			}
 			// Save changes to prev nodes
 			err = bucket.Put(prevKey, prevNodeBytes)
 			if err != nil {
-				return fmt.Errorf("Could not update previous node's link. %v", err)
-			}
-		} else {
-			// The node being removed is the at front of the linked list.
-			// The next node must be updated to become the front of the linked list.
-			if err = bucket.Put([]byte("FRONT"), nextKey); err != nil {
-				return fmt.Errorf("Could not reset front. %v", err)
+				return fmt.Errorf("Could not update previous node's link. %w", err)
 			}
 		}
 
@@ -849,129 +1584,973 @@ func (sd *storedData) Remove() error {
 			}
 			// De-serialize the next node to reset its prev link
 			nextNode := &pb.LinkedListNode{}
-			err = proto.Unmarshal(nextNodeBytes, nextNode)
+			err = unmarshalNode(bucket, nextNodeBytes, nextNode)
 			if err != nil {
-				return fmt.Errorf("Could not unmarshal. %v", err)
+				return fmt.Errorf("Could not unmarshal. %w", err)
 			}
 			// Reset prev link of next node
 			nextNode.Prev = prevKey
 			// Serialize back the next node
-			nextNodeBytes, err = proto.Marshal(nextNode)
+			nextNodeBytes, err = marshalNode(bucket, nextNode)
 			if err != nil {
-				return fmt.Errorf("Could not marshal. %v", err)
+				return fmt.Errorf("Could not marshal. %w", err)
 			}
 			// Save changes to next node
 			err = bucket.Put(nextKey, nextNodeBytes)
 			if err != nil {
-				return fmt.Errorf("Could not update next node's link. %v", err)
+				return fmt.Errorf("Could not update next node's link. %w", err)
 			}
-		} else {
-			// The node being removed is the at back of the linked list.
-			// The next node must be updated to become the back of the linked list.
-			if err = bucket.Put([]byte("BACK"), prevKey); err != nil {
-				return fmt.Errorf("Could not reset back. %v", err)
+		}
+
+		// Checks whether the node being removed is at the front or at the back of the
+		// linked list. If so, its siblings become the new front or back, and the list
+		// is reset if it was the only node.
+		if prevKey == nil || nextKey == nil {
+			frontKey := copyKey(bucket.Get([]byte("FRONT")))
+			backKey := copyKey(bucket.Get([]byte("BACK")))
+			if prevKey == nil {
+				frontKey = nextKey
+			}
+			if nextKey == nil {
+				backKey = prevKey
 			}
+			if err = setEnds(bucket, frontKey, backKey); err != nil {
+				return err
+			}
+		}
+
+		if err = uniqueRemove(uniqueIndex(tx, listName), currentNode.GetData()); err != nil {
+			return err
 		}
 
 		// Remove this node from Bolt
 		if err = bucket.Delete(currentKey); err != nil {
-			return fmt.Errorf("Could not delete key. %v", err)
+			return fmt.Errorf("Could not delete key. %w", err)
 		}
 
-		// Let the Go Garbage Collector do its job.
-		sd.key = nil
-		sd.value = nil
-		sd.internalLinkedList = nil
-		sd = nil
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+	// Mark the item as stale and let the Go Garbage Collector do its job.
+	sd.key = nil
+	sd.value = nil
+	sd.internalLinkedList = nil
+	sd.stale = true
+	return nil
 }
 
-// MoveToFront moves the element pointed to by the given Item to the front of the
-// linked list.
+// DeleteFunc removes every node of the linked list for which match returns true,
+// and returns the number of removed nodes. It works just like RemoveFunc.
 //
-// The element being moved must belong to the linkedlist at which it is being moved.
-// Otherwise, this method returns an "Invalid move" error.
+// It returns ErrNilFunc when called with a nil match
+// function.
+func (ll *LinkedList) DeleteFunc(match func(value []byte) bool) (int, error) {
+	return ll.RemoveFunc(match)
+}
+
+// RemoveFunc removes every node of the linked list for which pred returns true,
+// and returns the number of removed nodes. The nodes that are left are linked
+// together again, including the front and the back of the list.
 //
-// It returns a "Nil item" error in case of a nil Item argument, an "Empty list" error in
-// case of being called on a list with no elements, and an "Invalid item" error in case
-// of passing an item that wasn't returned by one of the linkedlist methods.
+// The whole operation is done within a single bbolt.Update transaction, so either
+// all the matching nodes are removed or none of them are.
 //
-// Other errors returned may be due to Bolt read/write or serialization/deserialization of
-// the data operation fail.
-func (ll *LinkedList) MoveToFront(it *Item) error {
-	// Check whether the item is nil
-	if it == nil {
-		return fmt.Errorf("Nil item")
-	}
-	// Get item's internal metadata by type asserting the Data field of the given Item.
-	// Check whether the item is a valid linkedlist item by analyzing the type assert.
-	sd, ok := it.Data.(*storedData)
-	if !ok {
-		// The item is not a valid linkedlist item
-		return fmt.Errorf("Invalid item")
-	}
-	// Get key of current node
-	currentKey := sd.key
-	// Check whether the item's internal linkedlist is the same as the linkedlist
-	// at which the item is being moved. If not, return "Invalid move" error.
-	if sd.internalLinkedList != ll {
-		return fmt.Errorf("Invalid move")
+// It returns ErrNilFunc when called with a nil pred
+// function.
+func (ll *LinkedList) RemoveFunc(pred func(data []byte) bool) (removed int, err error) {
+	if pred == nil {
+		return 0, ErrNilFunc
 	}
-	// Check whether the linkedlist is empty. If so, return an "Empty list" error
-	frontKey, frontNodeBytes, empty, err := ll.first()
+	err = update(ll.db, "RemoveFunc", func(tx *bbolt.Tx) error {
+		bucket := ll.bucket(tx)
+		if bucket == nil {
+			return ErrBucketNotFound
+		}
+		removed = 0
+		unique := uniqueIndex(tx, ll.name)
+		var (
+			frontKey []byte
+			// The last node that was kept
+			keptKey  []byte
+			keptNode *pb.LinkedListNode
+		)
+		key := copyKey(bucket.Get([]byte("FRONT")))
+		for key != nil {
+			node, err := getNode(bucket, key)
+			if err != nil {
+				return err
+			}
+			nextKey := node.GetNext()
+			if pred(node.GetData()) {
+				if err := uniqueRemove(unique, node.GetData()); err != nil {
+					return err
+				}
+				if err := bucket.Delete(key); err != nil {
+					return fmt.Errorf("Could not delete key. %w", err)
+				}
+				removed++
+				key = nextKey
+				continue
+			}
+			// Link the node to the last node that was kept
+			if !bytes.Equal(node.GetPrev(), keptKey) {
+				node.Prev = keptKey
+				if err := putNode(bucket, key, node); err != nil {
+					return err
+				}
+			}
+			if keptNode == nil {
+				frontKey = key
+			} else if !bytes.Equal(keptNode.GetNext(), key) {
+				keptNode.Next = key
+				if err := putNode(bucket, keptKey, keptNode); err != nil {
+					return err
+				}
+			}
+			keptKey, keptNode = key, node
+			key = nextKey
+		}
+		// The last node that was kept is the new back of the list
+		if keptNode != nil && keptNode.GetNext() != nil {
+			keptNode.Next = nil
+			if err := putNode(bucket, keptKey, keptNode); err != nil {
+				return err
+			}
+		}
+		return setEnds(bucket, frontKey, keptKey)
+	})
 	if err != nil {
-		return err
+		return 0, err
 	}
-	if empty {
-		return fmt.Errorf("Empty list")
+	return removed, nil
+}
+
+// Truncate keeps the first n nodes of the linked list and removes the rest, and
+// returns the number of removed nodes. The n-th node becomes the new back of the
+// list. Nothing is removed if the list has n nodes or less.
+//
+// The whole operation is done within a single bbolt.Update transaction, so either
+// all the nodes after the n-th node are removed or none of them are.
+//
+// It returns ErrOutOfRange if n is negative.
+func (ll *LinkedList) Truncate(n int) (removed int, err error) {
+	return ll.truncate(n, false)
+}
+
+// TruncateFront keeps the last n nodes of the linked list and removes the rest,
+// and returns the number of removed nodes. It works just like Truncate, but from
+// the back of the list, so the n-th node from the back becomes the new front.
+//
+// Calling TruncateFront after pushing nodes to the back keeps a rolling window
+// of the n newest nodes, for instance for a linked list that is used as a log.
+func (ll *LinkedList) TruncateFront(n int) (removed int, err error) {
+	return ll.truncate(n, true)
+}
+
+// truncate keeps n nodes, counting from the front, or from the back if reverse
+// is true, and removes the nodes after them
+func (ll *LinkedList) truncate(n int, reverse bool) (removed int, err error) {
+	if n < 0 {
+		return 0, ErrOutOfRange
 	}
-	// Check whether the item is the one at the front of the linkedlist. If so, there's
-	// no need to move anything. Return a nil error in that case.
-	if bytes.Equal(frontKey, currentKey) {
-		return nil
+	op := "Truncate"
+	if reverse {
+		op = "TruncateFront"
 	}
-	return (*bbolt.DB)(ll.db).Update(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket(ll.name)
+	err = update(ll.db, op, func(tx *bbolt.Tx) error {
+		bucket := ll.bucket(tx)
 		if bucket == nil {
 			return ErrBucketNotFound
 		}
-		// Get serialized current node
-		currentNodeBytes := bucket.Get(currentKey)
-		// Check whether this node exists
-		if currentNodeBytes == nil {
-			return ErrDoesNotExist
+		// Find the n-th node, after which the nodes are removed
+		var (
+			cutKey  []byte
+			cutNode *pb.LinkedListNode
+		)
+		key := copyKey(bucket.Get([]byte("FRONT")))
+		if reverse {
+			key = copyKey(bucket.Get([]byte("BACK")))
 		}
-		// De-serialize current node to access its data
-		currentNode := &pb.LinkedListNode{}
-		if err = proto.Unmarshal(currentNodeBytes, currentNode); err != nil {
-			return fmt.Errorf("Could not unmarshal. %v", err)
+		for i := 0; i < n && key != nil; i++ {
+			node, err := getNode(bucket, key)
+			if err != nil {
+				return err
+			}
+			cutKey, cutNode = key, node
+			if reverse {
+				key = copyKey(node.GetPrev())
+			} else {
+				key = copyKey(node.GetNext())
+			}
 		}
-		// Get link of prev/next nodes. Prev should exist, since it's been checked
-		// that the item's node is not at the front of the linkedlist.
-		prevKey := currentNode.GetPrev()
-		// nextKey may be nil, which is ok.
-		nextKey := currentNode.GetNext()
+		removed, err = removeBeyond(bucket, uniqueIndex(tx, ll.name), cutKey, cutNode, reverse)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return removed, nil
+}
 
-		// De-serialize the node at the front to access its prev node link.
+// RemoveAfter removes all the nodes after the node of the given mark, and
+// returns the number of removed nodes. The node of the mark becomes the new back
+// of the linked list, and the mark stays valid.
+//
+// The whole operation is done within a single bbolt.Update transaction, so either
+// all the nodes after the mark are removed or none of them are.
+//
+// It returns ErrNilMark in case of a nil mark, ErrInvalidMark if the
+// mark was not returned by one of the methods of this linked list, and
+// ErrStaleItem if the node of the mark has been removed.
+func (ll *LinkedList) RemoveAfter(mark *Item) (removed int, err error) {
+	return ll.cutAt(mark, false)
+}
+
+// RemoveBefore removes all the nodes before the node of the given mark, and
+// returns the number of removed nodes. The node of the mark becomes the new front
+// of the linked list, and the mark stays valid. It works just like RemoveAfter.
+func (ll *LinkedList) RemoveBefore(mark *Item) (removed int, err error) {
+	return ll.cutAt(mark, true)
+}
+
+// cutAt removes the nodes after the node of the given mark, or before it if
+// reverse is true
+func (ll *LinkedList) cutAt(mark *Item, reverse bool) (removed int, err error) {
+	if mark == nil {
+		return 0, ErrNilMark
+	}
+	sd, ok := mark.Data.(*storedData)
+	if !ok {
+		return 0, ErrInvalidMark
+	}
+	if sd.stale {
+		return 0, ErrStaleItem
+	}
+	if sd.internalLinkedList != ll {
+		return 0, fmt.Errorf("%w: linkedlists are not equal", ErrInvalidMark)
+	}
+	markKey := sd.key
+	op := "RemoveAfter"
+	if reverse {
+		op = "RemoveBefore"
+	}
+	err = update(ll.db, op, func(tx *bbolt.Tx) error {
+		bucket := ll.bucket(tx)
+		if bucket == nil {
+			return ErrBucketNotFound
+		}
+		if bucket.Get(markKey) == nil {
+			return ErrStaleItem
+		}
+		markNode, err := getNode(bucket, markKey)
+		if err != nil {
+			return err
+		}
+		removed, err = removeBeyond(bucket, uniqueIndex(tx, ll.name), markKey, markNode, reverse)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return removed, nil
+}
+
+// removeBeyond removes the nodes after the given node, or before it if reverse
+// is true, and makes the node the new back, or front, of the list. All the nodes
+// are removed if the given node is nil. The unique index may be nil.
+func removeBeyond(bucket, unique *bbolt.Bucket, cutKey []byte, cutNode *pb.LinkedListNode, reverse bool) (removed int, err error) {
+	// The end of the list that the given node becomes
+	end, first := []byte("BACK"), []byte("FRONT")
+	if reverse {
+		end, first = first, end
+	}
+	var key []byte
+	switch {
+	case cutNode == nil:
+		key = copyKey(bucket.Get(first))
+	case reverse:
+		key = copyKey(cutNode.GetPrev())
+	default:
+		key = copyKey(cutNode.GetNext())
+	}
+	if key == nil {
+		// There is nothing to remove
+		return 0, nil
+	}
+	for key != nil {
+		node, err := getNode(bucket, key)
+		if err != nil {
+			return 0, err
+		}
+		if err := uniqueRemove(unique, node.GetData()); err != nil {
+			return 0, err
+		}
+		if err := bucket.Delete(key); err != nil {
+			return 0, fmt.Errorf("Could not delete key. %w", err)
+		}
+		removed++
+		if reverse {
+			key = copyKey(node.GetPrev())
+		} else {
+			key = copyKey(node.GetNext())
+		}
+	}
+	if cutNode == nil {
+		// Every node has been removed
+		return removed, setEnds(bucket, nil, nil)
+	}
+	// Sever the link from the given node to the removed nodes
+	if reverse {
+		cutNode.Prev = nil
+	} else {
+		cutNode.Next = nil
+	}
+	if err := putNode(bucket, cutKey, cutNode); err != nil {
+		return 0, err
+	}
+	if err := bucket.Put(end, cutKey); err != nil {
+		return 0, fmt.Errorf("Could not update the end of the linked list. %w", err)
+	}
+	return removed, nil
+}
+
+// Reverse reverses the order of the linked list, by swapping the prev and next
+// links of every node and the front and the back of the list. The keys and the
+// data of the nodes are left untouched, while their versions are increased, see
+// Item.Version. Everything is done within a single bbolt.Update transaction.
+func (ll *LinkedList) Reverse() error {
+	return update(ll.db, "Reverse", func(tx *bbolt.Tx) error {
+		bucket := ll.bucket(tx)
+		if bucket == nil {
+			return ErrBucketNotFound
+		}
+		var (
+			keys  [][]byte
+			nodes []*pb.LinkedListNode
+		)
+		// Collect the nodes first, since the bucket can not be modified while walking it
+		if err := walk(bucket, false, func(key []byte, node *pb.LinkedListNode) error {
+			keys = append(keys, copyKey(key))
+			nodes = append(nodes, node)
+			return nil
+		}); err != nil {
+			return err
+		}
+		if len(keys) == 0 {
+			return nil
+		}
+		if len(keys) == 1 {
+			// The links of a single node do not change
+			return nil
+		}
+		for i, node := range nodes {
+			node.Prev, node.Next = node.Next, node.Prev
+			node.Version++
+			if err := putNode(bucket, keys[i], node); err != nil {
+				return err
+			}
+		}
+		return setEnds(bucket, keys[len(keys)-1], keys[0])
+	})
+}
+
+// Rotate shifts the front of the linked list n positions towards the back, so
+// that the node at position n becomes the front and the nodes before it are moved
+// to the back, in order. A negative n rotates the other way, and n is taken modulo
+// the length of the list. Rotating an empty list, or a list with a single node,
+// does nothing.
+//
+// Only the links of the nodes at the old and the new ends of the list, and the
+// front and the back of the list, are changed, and only the versions of those
+// nodes are increased, see Item.Version. The data of the nodes is not
+// rewritten. Everything is done within a single bbolt.Update transaction.
+func (ll *LinkedList) Rotate(n int) error {
+	return update(ll.db, "Rotate", func(tx *bbolt.Tx) error {
+		bucket := ll.bucket(tx)
+		if bucket == nil {
+			return ErrBucketNotFound
+		}
+		count := countNodes(bucket)
+		if count < 2 {
+			return nil
+		}
+		n = ((n % count) + count) % count
+		if n == 0 {
+			return nil
+		}
+		frontKey := copyKey(bucket.Get([]byte("FRONT")))
+		backKey := copyKey(bucket.Get([]byte("BACK")))
+		newFrontKey, newFrontNode, err := nodeAt(bucket, count, n)
+		if err != nil {
+			return err
+		}
+		newFrontKey = copyKey(newFrontKey)
+		newBackKey := copyKey(newFrontNode.GetPrev())
+		// Link the node at the back to the node at the front, and then cut the list
+		// between the new back and the new front. The same node may be at more than
+		// one of the ends, so every link is set on its own.
+		if err := setLink(bucket, backKey, frontKey, true); err != nil {
+			return err
+		}
+		if err := setLink(bucket, frontKey, backKey, false); err != nil {
+			return err
+		}
+		if err := setLink(bucket, newBackKey, nil, true); err != nil {
+			return err
+		}
+		if err := setLink(bucket, newFrontKey, nil, false); err != nil {
+			return err
+		}
+		// Increase the version of every node whose links were changed, once
+		ends := [][]byte{frontKey, backKey, newFrontKey, newBackKey}
+		for i, key := range ends {
+			if containsKey(ends[:i], key) {
+				continue
+			}
+			if err := bumpVersion(bucket, key); err != nil {
+				return err
+			}
+		}
+		return setEnds(bucket, newFrontKey, newBackKey)
+	})
+}
+
+// Sort sorts the linked list according to the given less function, by
+// re-linking the nodes. The keys and the data of the nodes stay in place, only
+// the order of the list changes, and the versions of the nodes whose links
+// change are increased, see Item.Version. The sort is stable, so nodes with
+// equal data keep their relative order. Everything is done within a single bbolt.Update
+// transaction, so either the whole list is sorted or nothing is changed.
+func (ll *LinkedList) Sort(less func(a, b []byte) bool) error {
+	if less == nil {
+		return ErrNilFunc
+	}
+	return update(ll.db, "Sort", func(tx *bbolt.Tx) error {
+		bucket := ll.bucket(tx)
+		if bucket == nil {
+			return ErrBucketNotFound
+		}
+		var (
+			keys  [][]byte
+			nodes []*pb.LinkedListNode
+		)
+		if err := walk(bucket, false, func(key []byte, node *pb.LinkedListNode) error {
+			keys = append(keys, copyKey(key))
+			nodes = append(nodes, node)
+			return nil
+		}); err != nil {
+			return err
+		}
+		if len(keys) == 0 {
+			return nil
+		}
+		order := make([]int, len(keys))
+		for i := range order {
+			order[i] = i
+		}
+		sort.SliceStable(order, func(i, j int) bool {
+			return less(nodes[order[i]].GetData(), nodes[order[j]].GetData())
+		})
+		// Re-link the nodes in sorted order, saving only those that changed
+		for i, n := range order {
+			var prevKey, nextKey []byte
+			if i > 0 {
+				prevKey = keys[order[i-1]]
+			}
+			if i < len(order)-1 {
+				nextKey = keys[order[i+1]]
+			}
+			node := nodes[n]
+			if bytes.Equal(node.GetPrev(), prevKey) && bytes.Equal(node.GetNext(), nextKey) {
+				continue
+			}
+			node.Prev, node.Next = prevKey, nextKey
+			node.Version++
+			if err := putNode(bucket, keys[n], node); err != nil {
+				return err
+			}
+		}
+		return setEnds(bucket, keys[order[0]], keys[order[len(order)-1]])
+	})
+}
+
+// Concat appends the nodes of the other linked list to the back of this linked
+// list, in order. The nodes are copied with new keys, while the other linked list
+// is left untouched. Both linked lists must be stored in the same database.
+//
+// The nodes are copied in batches, one bbolt.Update transaction per batch, so the
+// other linked list should not be modified while it is being copied.
+func (ll *LinkedList) Concat(other *LinkedList) error {
+	if other == nil {
+		return ErrNilLinkedList
+	}
+	if other.db != ll.db {
+		return ErrDifferentDatabase
+	}
+	if bytes.Equal(other.name, ll.name) {
+		return fmt.Errorf("%w: can not concatenate a linked list with itself", ErrInvalidLinkedList)
+	}
+	// The key of the next node to copy from the other linked list
+	var key []byte
+	for first := true; first || key != nil; first = false {
+		if err := update(ll.db, "Concat", func(tx *bbolt.Tx) error {
+			bucket := ll.bucket(tx)
+			otherBucket := tx.Bucket(other.name)
+			if bucket == nil || otherBucket == nil {
+				return ErrBucketNotFound
+			}
+			if first {
+				key = copyKey(otherBucket.Get([]byte("FRONT")))
+			}
+			var items [][]byte
+			for key != nil && len(items) < batchSize {
+				node, err := getNode(otherBucket, key)
+				if err != nil {
+					return err
+				}
+				items = append(items, node.GetData())
+				key = node.GetNext()
+			}
+			if len(items) == 0 {
+				return nil
+			}
+			return pushAll(bucket, uniqueIndex(tx, ll.name), items, false)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ConcatAndClear appends the nodes of the other linked list to the back of this
+// linked list, like Concat, and then removes all the nodes of the other linked list.
+func (ll *LinkedList) ConcatAndClear(other *LinkedList) error {
+	if err := ll.Concat(other); err != nil {
+		return err
+	}
+	return other.clear()
+}
+
+// MergeSorted merges the nodes of the linked lists a and b, which must both be
+// sorted according to the given less function, and appends them to the back of
+// this linked list, in sorted order. For equal data, the nodes of a come first.
+// The nodes are copied with new keys, while a and b are left untouched. All the
+// linked lists must be stored in the same database.
+//
+// Both chains are walked node by node, and the nodes are copied in batches, one
+// bbolt.Update transaction per batch, so a and b should not be modified while
+// they are being merged.
+func (ll *LinkedList) MergeSorted(a, b *LinkedList, less func(x, y []byte) bool) error {
+	if a == nil || b == nil {
+		return ErrNilLinkedList
+	}
+	if less == nil {
+		return ErrNilFunc
+	}
+	if a.db != ll.db || b.db != ll.db {
+		return ErrDifferentDatabase
+	}
+	if bytes.Equal(a.name, ll.name) || bytes.Equal(b.name, ll.name) {
+		return fmt.Errorf("%w: can not merge a linked list into itself", ErrInvalidLinkedList)
+	}
+	// The keys of the next nodes to copy from a and b
+	var keyA, keyB []byte
+	for first := true; first || keyA != nil || keyB != nil; first = false {
+		if err := update(ll.db, "MergeSorted", func(tx *bbolt.Tx) error {
+			bucket := ll.bucket(tx)
+			bucketA := tx.Bucket(a.name)
+			bucketB := tx.Bucket(b.name)
+			if bucket == nil || bucketA == nil || bucketB == nil {
+				return ErrBucketNotFound
+			}
+			if first {
+				keyA = copyKey(bucketA.Get([]byte("FRONT")))
+				keyB = copyKey(bucketB.Get([]byte("FRONT")))
+			}
+			var (
+				nodeA, nodeB *pb.LinkedListNode
+				items        [][]byte
+				err          error
+			)
+			for (keyA != nil || keyB != nil) && len(items) < batchSize {
+				if keyA != nil && nodeA == nil {
+					if nodeA, err = getNode(bucketA, keyA); err != nil {
+						return err
+					}
+				}
+				if keyB != nil && nodeB == nil {
+					if nodeB, err = getNode(bucketB, keyB); err != nil {
+						return err
+					}
+				}
+				if nodeB == nil || (nodeA != nil && !less(nodeB.GetData(), nodeA.GetData())) {
+					items = append(items, nodeA.GetData())
+					keyA, nodeA = copyKey(nodeA.GetNext()), nil
+				} else {
+					items = append(items, nodeB.GetData())
+					keyB, nodeB = copyKey(nodeB.GetNext()), nil
+				}
+			}
+			if len(items) == 0 {
+				return nil
+			}
+			return pushAll(bucket, uniqueIndex(tx, ll.name), items, false)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MergeSortedAndClear merges the nodes of the linked lists a and b into this
+// linked list, like MergeSorted, and then removes all the nodes of a and b.
+func (ll *LinkedList) MergeSortedAndClear(a, b *LinkedList, less func(x, y []byte) bool) error {
+	if err := ll.MergeSorted(a, b, less); err != nil {
+		return err
+	}
+	if err := a.clear(); err != nil {
+		return err
+	}
+	return b.clear()
+}
+
+// SplitAt cuts the linked list in two at the given item. The item and all the
+// items after it are moved to a new linked list with the given id, which is
+// returned. The item before the given one becomes the back of this linked list.
+//
+// The nodes keep their keys and are moved in batches, one bbolt.Update transaction
+// per batch. Both linked lists are consistent after every batch. It returns an
+// error if a bucket with the given id already exists.
+func (ll *LinkedList) SplitAt(mark *Item, newID string) (*LinkedList, error) {
+	if mark == nil {
+		return nil, ErrNilItem
+	}
+	sd, ok := mark.Data.(*storedData)
+	if !ok {
+		return nil, ErrInvalidItem
+	}
+	if sd.internalLinkedList != ll {
+		return nil, fmt.Errorf("%w: item belongs to another linked list", ErrInvalidItem)
+	}
+	if err := simplebolt.ValidateID(newID); err != nil {
+		return nil, err
+	}
+	name := []byte(newID)
+	frontKey := copyKey(sd.key)
+	key := frontKey
+	// The key of the last node that was moved
+	var lastKey []byte
+	for first := true; key != nil; first = false {
+		if err := update(ll.db, "SplitAt", func(tx *bbolt.Tx) error {
+			bucket := ll.bucket(tx)
+			if bucket == nil {
+				return ErrBucketNotFound
+			}
+			var newBucket *bbolt.Bucket
+			if first {
+				node, err := getNode(bucket, key)
+				if err != nil {
+					return err
+				}
+				if tx.Bucket(name) != nil {
+					return ErrBucketExists
+				}
+				if newBucket, err = tx.CreateBucket(name); err != nil {
+					return fmt.Errorf("Could not create bucket: %w", err)
+				}
+				if err := simplebolt.RegisterBucket(tx, newID, "LinkedList"); err != nil {
+					return err
+				}
+				// Keep the ids of new nodes unique in both linked lists
+				if err := newBucket.SetSequence(bucket.Sequence()); err != nil {
+					return err
+				}
+				// Cut the link between the two linked lists
+				prevKey := node.GetPrev()
+				if prevKey == nil {
+					if err := setEnds(bucket, nil, nil); err != nil {
+						return err
+					}
+				} else {
+					prevNode, err := getNode(bucket, prevKey)
+					if err != nil {
+						return err
+					}
+					prevNode.Next = nil
+					if err := putNode(bucket, prevKey, prevNode); err != nil {
+						return err
+					}
+					if err := setEnds(bucket, copyKey(bucket.Get([]byte("FRONT"))), prevKey); err != nil {
+						return err
+					}
+				}
+			} else {
+				newBucket = tx.Bucket(name)
+				if newBucket == nil {
+					return ErrBucketNotFound
+				}
+				// Link the last node of the previous batch to the first node of this one
+				lastNode, err := getNode(newBucket, lastKey)
+				if err != nil {
+					return err
+				}
+				lastNode.Next = key
+				if err := putNode(newBucket, lastKey, lastNode); err != nil {
+					return err
+				}
+			}
+			for count := 0; key != nil && count < batchSize; count++ {
+				node, err := getNode(bucket, key)
+				if err != nil {
+					return err
+				}
+				nextKey := node.GetNext()
+				if first && count == 0 {
+					node.Prev = nil
+				}
+				if count == batchSize-1 {
+					// The rest of the nodes are linked by the next batch
+					node.Next = nil
+				}
+				if err := putNode(newBucket, key, node); err != nil {
+					return err
+				}
+				if err := uniqueRemove(uniqueIndex(tx, ll.name), node.GetData()); err != nil {
+					return err
+				}
+				if err := bucket.Delete(key); err != nil {
+					return fmt.Errorf("Could not delete key. %w", err)
+				}
+				lastKey, key = key, nextKey
+			}
+			return setEnds(newBucket, frontKey, lastKey)
+		}); err != nil {
+			return nil, err
+		}
+	}
+	// Success
+	return &LinkedList{db: ll.db, name: name}, nil
+}
+
+// CopyTo copies the linked list to a new linked list with the given id, in the
+// same database, and returns the new linked list. See CopyToDatabase.
+func (ll *LinkedList) CopyTo(newID string) (*LinkedList, error) {
+	return ll.CopyToDatabase(ll.db, newID)
+}
+
+// CopyToDatabase copies the linked list to a new linked list with the given id,
+// in the given database, and returns the new linked list. All the nodes are
+// copied verbatim, keeping their keys, together with the sequence used for
+// creating new keys. The copy is independent from the original linked list.
+// When copying to another database, the data of the nodes is encrypted with the
+// value cipher of that database instead, see simplebolt.Database.SetValueCipher.
+//
+// The nodes are copied in batches, one bbolt.Update transaction per batch, so the
+// linked list should not be modified while it is being copied. It returns an error
+// if a bucket with the given id already exists.
+func (ll *LinkedList) CopyToDatabase(db *simplebolt.Database, newID string) (*LinkedList, error) {
+	if db == nil {
+		return nil, ErrNilDatabase
+	}
+	if err := simplebolt.ValidateID(newID); err != nil {
+		return nil, err
+	}
+	name := []byte(newID)
+	if db == ll.db && bytes.Equal(name, ll.name) {
+		return nil, fmt.Errorf("%w: can not copy a linked list to itself", ErrInvalidLinkedList)
+	}
+	var (
+		// The key of the last record that was copied
+		lastKey []byte
+		done    bool
+	)
+	for first := true; !done; first = false {
+		var (
+			keys, values [][]byte
+			sequence     uint64
+		)
+		// Read the next batch of records from this linked list
+		if err := view(ll.db, "CopyToDatabase", func(tx *bbolt.Tx) error {
+			bucket := ll.bucket(tx)
+			if bucket == nil {
+				return ErrBucketNotFound
+			}
+			sequence = bucket.Sequence()
+			c := bucket.Cursor()
+			var key, value []byte
+			if first {
+				key, value = c.First()
+			} else {
+				key, value = c.Seek(lastKey)
+				if bytes.Equal(key, lastKey) {
+					key, value = c.Next()
+				}
+			}
+			for ; key != nil && len(keys) < batchSize; key, value = c.Next() {
+				keys = append(keys, copyKey(key))
+				values = append(values, append([]byte{}, value...))
+			}
+			done = key == nil
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+		// Write the batch of records to the new linked list
+		if err := update(db, "CopyToDatabase", func(tx *bbolt.Tx) error {
+			var newBucket *bbolt.Bucket
+			if first {
+				if tx.Bucket(name) != nil {
+					return ErrBucketExists
+				}
+				var err error
+				if newBucket, err = tx.CreateBucket(name); err != nil {
+					return fmt.Errorf("Could not create bucket: %w", err)
+				}
+				if err := simplebolt.RegisterBucket(tx, newID, "LinkedList"); err != nil {
+					return err
+				}
+			} else if newBucket = tx.Bucket(name); newBucket == nil {
+				return ErrBucketNotFound
+			}
+			if err := newBucket.SetSequence(sequence); err != nil {
+				return err
+			}
+			for i, key := range keys {
+				value := values[i]
+				if db != ll.db && isNodeKey(key) {
+					var err error
+					if value, err = reencryptNode(ll.db, newBucket, value); err != nil {
+						return err
+					}
+				}
+				if err := newBucket.Put(key, value); err != nil {
+					return fmt.Errorf("Could not copy key. %w", err)
+				}
+			}
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+		if len(keys) > 0 {
+			lastKey = keys[len(keys)-1]
+		}
+	}
+	// Success
+	return &LinkedList{db: db, name: name}, nil
+}
+
+// clear removes all the nodes of the linked list, by re-creating its bucket
+func (ll *LinkedList) clear() error {
+	return update(ll.db, "Clear", func(tx *bbolt.Tx) error {
+		if err := tx.DeleteBucket(ll.name); err == bbolt.ErrBucketNotFound {
+			return ErrBucketNotFound
+		} else if err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucket(ll.name); err != nil {
+			return fmt.Errorf("Could not create bucket: %w", err)
+		}
+		return uniqueClear(uniqueIndex(tx, ll.name))
+	})
+}
+
+// MoveToFront moves the element pointed to by the given Item to the front of the
+// linked list. The version of the node is increased, see Item.Version.
+//
+// The element being moved must belong to the linkedlist at which it is being moved.
+// Otherwise, this method returns ErrInvalidMove.
+//
+// It returns ErrNilItem in case of a nil Item argument, ErrEmptyList in
+// case of being called on a list with no elements, ErrInvalidItem in case
+// of passing an item that wasn't returned by one of the linkedlist methods, and
+// ErrStaleItem if the node of the item has been removed.
+//
+// Other errors returned may be due to Bolt read/write or serialization/deserialization of
+// the data operation fail.
+func (ll *LinkedList) MoveToFront(it *Item) error {
+	// Check whether the item is nil
+	if it == nil {
+		return ErrNilItem
+	}
+	// Get item's internal metadata by type asserting the Data field of the given Item.
+	// Check whether the item is a valid linkedlist item by analyzing the type assert.
+	sd, ok := it.Data.(*storedData)
+	if !ok {
+		// The item is not a valid linkedlist item
+		return ErrInvalidItem
+	}
+	if err := sd.acquire(); err != nil {
+		return err
+	}
+	defer sd.release()
+	// Get key of current node
+	currentKey := sd.key
+	// Check whether the item's internal linkedlist is the same as the linkedlist
+	// at which the item is being moved. If not, return ErrInvalidMove.
+	if sd.internalLinkedList != ll {
+		return ErrInvalidMove
+	}
+	// The version of the node, which is increased if it is moved
+	version := sd.version
+	err := update(ll.db, "MoveToFront", func(tx *bbolt.Tx) error {
+		bucket := ll.bucket(tx)
+		if bucket == nil {
+			return ErrBucketNotFound
+		}
+		// Get serialized current node
+		currentNodeBytes := bucket.Get(currentKey)
+		// Check whether this node exists. If not, it has been removed through
+		// another item.
+		if currentNodeBytes == nil {
+			return ErrStaleItem
+		}
+		// Check whether the linkedlist is empty. If so, return ErrEmptyList
+		frontKey := copyKey(bucket.Get([]byte("FRONT")))
+		if frontKey == nil {
+			return ErrEmptyList
+		}
+		// Check whether the item is the one at the front of the linkedlist. If so, there's
+		// no need to move anything. Return a nil error in that case.
+		if bytes.Equal(frontKey, currentKey) {
+			return nil
+		}
+		frontNodeBytes := bucket.Get(frontKey)
+		if frontNodeBytes == nil {
+			return ErrDoesNotExist
+		}
+		var err error
+		// De-serialize current node to access its data
+		currentNode := &pb.LinkedListNode{}
+		if err = unmarshalNode(bucket, currentNodeBytes, currentNode); err != nil {
+			return fmt.Errorf("Could not unmarshal. %w", err)
+		}
+		// Get link of prev/next nodes. Prev should exist, since it's been checked
+		// that the item's node is not at the front of the linkedlist.
+		prevKey := currentNode.GetPrev()
+		// nextKey may be nil, which is ok.
+		nextKey := currentNode.GetNext()
+
+		// De-serialize the node at the front to access its prev node link.
 		frontNode := &pb.LinkedListNode{}
-		if err = proto.Unmarshal(frontNodeBytes, frontNode); err != nil {
-			return fmt.Errorf("Could not unmarshal. %v", err)
+		if err = unmarshalNode(bucket, frontNodeBytes, frontNode); err != nil {
+			return fmt.Errorf("Could not unmarshal. %w", err)
 		}
 		// Update the prev link of the node at the front to point to the node to be moved.
 		frontNode.Prev = currentKey
 		// Serialize back the node at the front
-		frontNodeBytes, err = proto.Marshal(frontNode)
+		frontNodeBytes, err = marshalNode(bucket, frontNode)
 		if err != nil {
-			return fmt.Errorf("Could not marshal. %v", err)
+			return fmt.Errorf("Could not marshal. %w", err)
 		}
 		// Save changes to the node at the front
 		if err = bucket.Put(frontKey, frontNodeBytes); err != nil {
-			return fmt.Errorf("Could not update the node at the front. %v", err)
+			return fmt.Errorf("Could not update the node at the front. %w", err)
 		}
 		// Update key of node at the front
 		if err = bucket.Put([]byte("FRONT"), currentKey); err != nil {
-			return fmt.Errorf("Could not update key of node at the front. %v", err)
+			return fmt.Errorf("Could not update key of node at the front. %w", err)
 		}
 
 		// Get serialized previous node
@@ -982,21 +2561,21 @@ func (ll *LinkedList) MoveToFront(it *Item) error {
 
 		// De-serialize the previous node to reset its next link
 		prevNode := &pb.LinkedListNode{}
-		err = proto.Unmarshal(prevNodeBytes, prevNode)
+		err = unmarshalNode(bucket, prevNodeBytes, prevNode)
 		if err != nil {
-			return fmt.Errorf("Could not unmarshal. %v", err)
+			return fmt.Errorf("Could not unmarshal. %w", err)
 		}
 		// Reset next link of previous node. nextKey may be nil, which is ok.
 		prevNode.Next = nextKey
 		// Serialize back the previous node
-		prevNodeBytes, err = proto.Marshal(prevNode)
+		prevNodeBytes, err = marshalNode(bucket, prevNode)
 		if err != nil {
-			return fmt.Errorf("Could not marshal. %v", err)
+			return fmt.Errorf("Could not marshal. %w", err)
 		}
 		// Save changes to previous node
 		err = bucket.Put(prevKey, prevNodeBytes)
 		if err != nil {
-			return fmt.Errorf("Could not update previous node's link. %v", err)
+			return fmt.Errorf("Could not update previous node's link. %w", err)
 		}
 
 		// Checks whether the current node is linked to a next node.
@@ -1008,21 +2587,27 @@ func (ll *LinkedList) MoveToFront(it *Item) error {
 			}
 			// De-serialize the next node to reset its prev link
 			nextNode := &pb.LinkedListNode{}
-			err = proto.Unmarshal(nextNodeBytes, nextNode)
+			err = unmarshalNode(bucket, nextNodeBytes, nextNode)
 			if err != nil {
-				return fmt.Errorf("Could not unmarshal. %v", err)
+				return fmt.Errorf("Could not unmarshal. %w", err)
 			}
 			// Reset prev link of next node
 			nextNode.Prev = prevKey
 			// Serialize back the next node
-			nextNodeBytes, err = proto.Marshal(nextNode)
+			nextNodeBytes, err = marshalNode(bucket, nextNode)
 			if err != nil {
-				return fmt.Errorf("Could not marshal. %v", err)
+				return fmt.Errorf("Could not marshal. %w", err)
 			}
 			// Save changes to next node
 			err = bucket.Put(nextKey, nextNodeBytes)
 			if err != nil {
-				return fmt.Errorf("Could not update next node's link. %v", err)
+				return fmt.Errorf("Could not update next node's link. %w", err)
+			}
+		} else {
+			// The node being moved was at the back of the linked list.
+			// The previous node becomes the back of the linked list.
+			if err = bucket.Put([]byte("BACK"), prevKey); err != nil {
+				return fmt.Errorf("Could not update key of node at the back. %w", err)
 			}
 		}
 		// Now the node's siblings has been both updated.
@@ -1030,102 +2615,118 @@ func (ll *LinkedList) MoveToFront(it *Item) error {
 		currentNode.Next = frontKey
 		// Update the prev link of the current node to nil
 		currentNode.Prev = nil
+		currentNode.Version++
+		version = currentNode.Version
 		// Serialize back the current node.
-		currentNodeBytes, err = proto.Marshal(currentNode)
+		currentNodeBytes, err = marshalNode(bucket, currentNode)
 		if err != nil {
-			return fmt.Errorf("Could not marshal. %v", err)
+			return fmt.Errorf("Could not marshal. %w", err)
 		}
 		// Save changes to current node.
 		err = bucket.Put(currentKey, currentNodeBytes)
 		if err != nil {
-			return fmt.Errorf("Could not update current node's link. %v", err)
+			return fmt.Errorf("Could not update current node's link. %w", err)
 		}
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+	sd.version = version
+	return nil
 }
 
 // MoveToBack moves the element pointed to by the given Item to the back of the
-// linked list.
+// linked list. The version of the node is increased, see Item.Version.
 //
 // The element being moved must belong to the linkedlist at which it is being moved.
-// Otherwise, this method returns an "Invalid move" error.
+// Otherwise, this method returns ErrInvalidMove.
 //
-// It returns a "Nil item" error in case of a nil Item argument, an "Empty list" error in
-// case of being called on a list with no elements, and an "Invalid item" error in case
-// of passing an Item that wasn't returned by one of the linkedlist methods.
+// It returns ErrNilItem in case of a nil Item argument, ErrEmptyList in
+// case of being called on a list with no elements, ErrInvalidItem in case
+// of passing an Item that wasn't returned by one of the linkedlist methods, and
+// ErrStaleItem if the node of the item has been removed.
 //
 // Other errors returned may be due to Bolt read/write or serialization/deserialization of
 // the data operation fail.
 func (ll *LinkedList) MoveToBack(it *Item) error {
 	// Check whether the item is nil
 	if it == nil {
-		return fmt.Errorf("Nil item")
+		return ErrNilItem
 	}
 	// Get item's internal metadata by type asserting the Data field of the given Item.
 	// Check whether the item is a valid linkedlist item by analyzing the type assert.
 	sd, ok := it.Data.(*storedData)
 	if !ok {
 		// The item is not a valid linkedlist item
-		return fmt.Errorf("Invalid item")
+		return ErrInvalidItem
+	}
+	if err := sd.acquire(); err != nil {
+		return err
 	}
+	defer sd.release()
 	// Check whether the item's internal linkedlist is the same as the linkedlist
-	// at which the item is being moved into. If not, return "Invalid move" error.
+	// at which the item is being moved into. If not, return ErrInvalidMove.
 	if sd.internalLinkedList != ll {
-		return fmt.Errorf("Invalid move")
+		return ErrInvalidMove
 	}
 	// Get key of current node
 	currentKey := sd.key
-	// Check whether the linkedlist is empty. If so, return an "Empty list" error
-	backKey, backNodeBytes, empty, err := ll.last()
-	if err != nil {
-		return err
-	}
-	if empty {
-		return fmt.Errorf("Empty list")
-	}
-	// Check whether the item is the one at the back of the linkedlist. If so, there's
-	// no need to move anything. Return a nil error in that case.
-	if bytes.Equal(backKey, currentKey) {
-		return nil
-	}
-	return (*bbolt.DB)(ll.db).Update(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket(ll.name)
+	// The version of the node, which is increased if it is moved
+	version := sd.version
+	err := update(ll.db, "MoveToBack", func(tx *bbolt.Tx) error {
+		bucket := ll.bucket(tx)
 		if bucket == nil {
 			return ErrBucketNotFound
 		}
 		// Get serialized current node
 		currentNodeBytes := bucket.Get(currentKey)
-		// Check whether this node exists
+		// Check whether this node exists. If not, it has been removed through
+		// another item.
 		if currentNodeBytes == nil {
-			return ErrDoesNotExist
+			return ErrStaleItem
 		}
-
+		// Check whether the linkedlist is empty. If so, return ErrEmptyList
+		backKey := copyKey(bucket.Get([]byte("BACK")))
+		if backKey == nil {
+			return ErrEmptyList
+		}
+		// Check whether the item is the one at the back of the linkedlist. If so, there's
+		// no need to move anything. Return a nil error in that case.
+		if bytes.Equal(backKey, currentKey) {
+			return nil
+		}
+		backNodeBytes := bucket.Get(backKey)
+		if backNodeBytes == nil {
+			return ErrDoesNotExist
+		}
+		// De-serialize current node to access its data
+		currentNode := &pb.LinkedListNode{}
+		err := unmarshalNode(bucket, currentNodeBytes, currentNode)
+		if err != nil {
+			return fmt.Errorf("Could not unmarshal. %w", err)
+		}
+
 		// De-serialize the node at the back to access its next node link.
 		backNode := &pb.LinkedListNode{}
-		if err = proto.Unmarshal(backNodeBytes, backNode); err != nil {
-			return fmt.Errorf("Could not unmarshal. %v", err)
+		if err = unmarshalNode(bucket, backNodeBytes, backNode); err != nil {
+			return fmt.Errorf("Could not unmarshal. %w", err)
 		}
 		// Update the next link of the node at the back to point to the node to be moved.
 		backNode.Next = currentKey
 		// Serialize back the node at the back
-		backNodeBytes, err = proto.Marshal(backNode)
+		backNodeBytes, err = marshalNode(bucket, backNode)
 		if err != nil {
-			return fmt.Errorf("Could not marshal. %v", err)
+			return fmt.Errorf("Could not marshal. %w", err)
 		}
 		// Save changes to the node at the back
 		err = bucket.Put(backKey, backNodeBytes)
 		if err != nil {
-			return fmt.Errorf("Could not update the node at the back. %v", err)
+			return fmt.Errorf("Could not update the node at the back. %w", err)
 		}
 		// Update key of node at the back
 		if err = bucket.Put([]byte("BACK"), currentKey); err != nil {
-			return fmt.Errorf("Could not update key of node at the back. %v", err)
-		}
-
-		// De-serialize current node to access its data
-		currentNode := &pb.LinkedListNode{}
-		if err = proto.Unmarshal(currentNodeBytes, currentNode); err != nil {
-			return fmt.Errorf("Could not unmarshal. %v", err)
+			return fmt.Errorf("Could not update key of node at the back. %w", err)
 		}
 
 		// Get link of prev/next nodes. Next should exist, since it's been checked
@@ -1141,21 +2742,21 @@ func (ll *LinkedList) MoveToBack(it *Item) error {
 		}
 		// De-serialize the next node to reset its prev link
 		nextNode := &pb.LinkedListNode{}
-		err = proto.Unmarshal(nextNodeBytes, nextNode)
+		err = unmarshalNode(bucket, nextNodeBytes, nextNode)
 		if err != nil {
-			return fmt.Errorf("Could not unmarshal. %v", err)
+			return fmt.Errorf("Could not unmarshal. %w", err)
 		}
 		// Reset prev link of next node
 		nextNode.Prev = prevKey
 		// Serialize back the next node
-		nextNodeBytes, err = proto.Marshal(nextNode)
+		nextNodeBytes, err = marshalNode(bucket, nextNode)
 		if err != nil {
-			return fmt.Errorf("Could not marshal. %v", err)
+			return fmt.Errorf("Could not marshal. %w", err)
 		}
 		// Save changes to next node
 		err = bucket.Put(nextKey, nextNodeBytes)
 		if err != nil {
-			return fmt.Errorf("Could not update next node's link. %v", err)
+			return fmt.Errorf("Could not update next node's link. %w", err)
 		}
 
 		// Check whether the current node is linked to a prev node
@@ -1167,21 +2768,27 @@ func (ll *LinkedList) MoveToBack(it *Item) error {
 			}
 			// De-serialize the previous node to reset its next link
 			prevNode := &pb.LinkedListNode{}
-			err = proto.Unmarshal(prevNodeBytes, prevNode)
+			err = unmarshalNode(bucket, prevNodeBytes, prevNode)
 			if err != nil {
-				return fmt.Errorf("Could not unmarshal. %v", err)
+				return fmt.Errorf("Could not unmarshal. %w", err)
 			}
 			// Reset next link of previous node. nextKey may be nil, which is ok.
 			prevNode.Next = nextKey
 			// Serialize back the next node
-			prevNodeBytes, err = proto.Marshal(prevNode)
+			prevNodeBytes, err = marshalNode(bucket, prevNode)
 			if err != nil {
-				return fmt.Errorf("Could not marshal. %v", err)
+				return fmt.Errorf("Could not marshal. %w", err)
 			}
 			// Save changes to prev nodes
 			err = bucket.Put(prevKey, prevNodeBytes)
 			if err != nil {
-				return fmt.Errorf("Could not update previous node's link. %v", err)
+				return fmt.Errorf("Could not update previous node's link. %w", err)
+			}
+		} else {
+			// The node being moved was at the front of the linked list.
+			// The next node becomes the front of the linked list.
+			if err = bucket.Put([]byte("FRONT"), nextKey); err != nil {
+				return fmt.Errorf("Could not update key of node at the front. %w", err)
 			}
 		}
 		// Now the node's siblings has been both updated.
@@ -1189,48 +2796,182 @@ func (ll *LinkedList) MoveToBack(it *Item) error {
 		currentNode.Prev = backKey
 		// Update the next link of the current node to point at nil.
 		currentNode.Next = nil
+		currentNode.Version++
+		version = currentNode.Version
 		// Serialize back the current node.
-		currentNodeBytes, err = proto.Marshal(currentNode)
+		currentNodeBytes, err = marshalNode(bucket, currentNode)
 		if err != nil {
-			return fmt.Errorf("Could not marshal. %v", err)
+			return fmt.Errorf("Could not marshal. %w", err)
 		}
 		// Save changes to current node.
 		err = bucket.Put(currentKey, currentNodeBytes)
 		if err != nil {
-			return fmt.Errorf("Could not update current node's link. %v", err)
+			return fmt.Errorf("Could not update current node's link. %w", err)
 		}
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+	sd.version = version
+	return nil
+}
+
+// MoveToIndex moves the element pointed to by the given Item, so that it ends up
+// at the given position in the linked list, counting from 0. Negative positions
+// count from the back of the list, -1 being the last position. Moving an element
+// to its current position does nothing. Otherwise, the version of the node is
+// increased, see Item.Version.
+//
+// The list is traversed for finding the current position of the element, and all
+// the links are updated within a single bbolt.Update transaction.
+//
+// It returns ErrOutOfRange if there is no such position, ErrNilItem in
+// case of a nil Item argument, ErrInvalidItem in case of passing an Item
+// that wasn't returned by one of the linkedlist methods, ErrInvalidMove
+// if the Item belongs to another linked list, and ErrStaleItem if the node of the
+// Item has been removed.
+func (ll *LinkedList) MoveToIndex(it *Item, index int) error {
+	if it == nil {
+		return ErrNilItem
+	}
+	sd, ok := it.Data.(*storedData)
+	if !ok {
+		return ErrInvalidItem
+	}
+	if err := sd.acquire(); err != nil {
+		return err
+	}
+	defer sd.release()
+	if sd.stale {
+		return ErrStaleItem
+	}
+	if sd.internalLinkedList != ll {
+		return ErrInvalidMove
+	}
+	currentKey := sd.key
+	// The version of the node, which is increased if it is moved
+	version := sd.version
+	err := update(ll.db, "MoveToIndex", func(tx *bbolt.Tx) error {
+		bucket := ll.bucket(tx)
+		if bucket == nil {
+			return ErrBucketNotFound
+		}
+		if bucket.Get(currentKey) == nil {
+			return ErrStaleItem
+		}
+		// Find the keys in order, and the current position of the node
+		var keys [][]byte
+		current := -1
+		if err := walk(bucket, false, func(key []byte, _ *pb.LinkedListNode) error {
+			if bytes.Equal(key, currentKey) {
+				current = len(keys)
+			}
+			keys = append(keys, copyKey(key))
+			return nil
+		}); err != nil {
+			return err
+		}
+		if index < 0 {
+			index += len(keys)
+		}
+		if index < 0 || index >= len(keys) {
+			return ErrOutOfRange
+		}
+		if current == -1 {
+			return ErrDoesNotExist
+		}
+		if current == index {
+			return nil
+		}
+		// Unlink the node from its current neighbours
+		var oldPrev, oldNext []byte
+		if current > 0 {
+			oldPrev = keys[current-1]
+		}
+		if current < len(keys)-1 {
+			oldNext = keys[current+1]
+		}
+		if err := setLink(bucket, oldPrev, oldNext, true); err != nil {
+			return err
+		}
+		if err := setLink(bucket, oldNext, oldPrev, false); err != nil {
+			return err
+		}
+		// Find the new neighbours, in the list without the node
+		keys = append(keys[:current], keys[current+1:]...)
+		var newPrev, newNext []byte
+		if index > 0 {
+			newPrev = keys[index-1]
+		}
+		if index < len(keys) {
+			newNext = keys[index]
+		}
+		if err := setLink(bucket, newPrev, currentKey, true); err != nil {
+			return err
+		}
+		if err := setLink(bucket, newNext, currentKey, false); err != nil {
+			return err
+		}
+		currentNode, err := getNode(bucket, currentKey)
+		if err != nil {
+			return err
+		}
+		currentNode.Prev, currentNode.Next = newPrev, newNext
+		currentNode.Version++
+		version = currentNode.Version
+		if err := putNode(bucket, currentKey, currentNode); err != nil {
+			return err
+		}
+		// The node may have been moved to, or from, one of the ends
+		frontKey, backKey := currentKey, currentKey
+		if index > 0 {
+			frontKey = keys[0]
+		}
+		if index < len(keys) {
+			backKey = keys[len(keys)-1]
+		}
+		return setEnds(bucket, frontKey, backKey)
+	})
+	if err != nil {
+		return err
+	}
+	sd.version = version
+	return nil
 }
 
 // InsertAfter inserts the given data after the element pointed to by the given mark, so
 // that all the pointers involving the new data and its siblings gets updated.
 //
 // The element at which the given mark points to must belong to the same linkedlist as the
-// linkedlist at which the method is being called. Otherwise, it returns an "Invalid mark:
-// linkedlists are not equal" error.
+// linkedlist at which the method is being called. Otherwise, it returns ErrInvalidMark,
+// wrapped with "linkedlists are not equal".
 //
-// It returns a "Nil mark" error in case of a nil mark argument, an "Empty list" error in
-// case of being called on a list with no elements, and an "Invalid mark" error in case
-// of passing an Item that wasn't returned by one of the linkedlist methods.
+// It returns ErrNilMark in case of a nil mark argument, ErrEmptyList in
+// case of being called on a list with no elements, ErrInvalidMark in case
+// of passing an Item that wasn't returned by one of the linkedlist methods, and
+// ErrStaleItem if the node of the mark has been removed.
 //
 // Other errors returned may be due to Bolt read/write or serialization/deserialization of
 // the data operations fail.
 func (ll *LinkedList) InsertAfter(data []byte, mark *Item) error {
 	if data == nil {
-		return fmt.Errorf("Empty data")
+		return ErrEmptyData
 	}
 	if mark == nil {
-		return fmt.Errorf("Empty mark")
+		return ErrNilMark
 	}
 	// Check whether mark is a valid LinkedList Item, i.e. it has not been modified.
 	sd, ok := mark.Data.(*storedData)
 	if !ok {
-		return fmt.Errorf("Invalid mark")
+		return ErrInvalidMark
+	}
+	if sd.stale {
+		return ErrStaleItem
 	}
 	// Check whether the internalLinkedList of mark is the same as ll
 	if sd.internalLinkedList != ll {
-		return fmt.Errorf("Invalid mark: linkedlists are not equal")
+		return fmt.Errorf("%w: linkedlists are not equal", ErrInvalidMark)
 	}
 	markKey := sd.key
 	// Check whether the given mark is the node at the back of the linkedlist. If so,
@@ -1240,27 +2981,28 @@ func (ll *LinkedList) InsertAfter(data []byte, mark *Item) error {
 		return err
 	}
 	if empty {
-		return fmt.Errorf("Empty list")
+		return ErrEmptyList
 	}
 	if bytes.Equal(backKey, markKey) {
 		// The mark is the back of the linked list. The data will be pushed at the back.
 		return ll.PushBack(data)
 	}
 	// The mark is other than the back of the linked list
-	return (*bbolt.DB)(ll.db).Update(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket(ll.name)
+	return update(ll.db, "InsertAfter", func(tx *bbolt.Tx) error {
+		bucket := ll.bucket(tx)
 		if bucket == nil {
 			return ErrBucketNotFound
 		}
-		// Get serialized data of mark
+		// Get serialized data of mark. If it does not exist, it has been
+		// removed through another item.
 		markNodeBytes := bucket.Get(markKey)
 		if markNodeBytes == nil {
-			return ErrDoesNotExist
+			return ErrStaleItem
 		}
 		// De-serialize data of mark to access its next/prev links
 		markNode := &pb.LinkedListNode{}
-		if err = proto.Unmarshal(markNodeBytes, markNode); err != nil {
-			return fmt.Errorf("Could not unmarshal. %v", err)
+		if err = unmarshalNode(bucket, markNodeBytes, markNode); err != nil {
+			return fmt.Errorf("Could not unmarshal. %w", err)
 		}
 		nextKey := markNode.GetNext()
 		// Set new node
@@ -1271,27 +3013,31 @@ func (ll *LinkedList) InsertAfter(data []byte, mark *Item) error {
 		}
 		id, _ := bucket.NextSequence()
 		newKey := byteID(id)
+		// Refuse duplicated data in unique mode
+		if err = uniqueAdd(uniqueIndex(tx, ll.name), data, newKey); err != nil {
+			return err
+		}
 		// Serialize the new node
-		newNodeBytes, err := proto.Marshal(newNode)
+		newNodeBytes, err := marshalNode(bucket, newNode)
 		if err != nil {
-			return fmt.Errorf("Could not marshal. %v", err)
+			return fmt.Errorf("Could not marshal. %w", err)
 		}
 		// Insert data into Bolt
 		err = bucket.Put(newKey, newNodeBytes)
 		if err != nil {
-			return fmt.Errorf("Could not save new data. %v", err)
+			return fmt.Errorf("Could not save new data. %w", err)
 		}
 		// Update link to next node of the mark to point to the new node
 		markNode.Next = newKey
 		// Serialize back the mark node
-		markNodeBytes, err = proto.Marshal(markNode)
+		markNodeBytes, err = marshalNode(bucket, markNode)
 		if err != nil {
-			return fmt.Errorf("Could not marshal. %v", err)
+			return fmt.Errorf("Could not marshal. %w", err)
 		}
 		// Save changes to the mark node
 		err = bucket.Put(markKey, markNodeBytes)
 		if err != nil {
-			return fmt.Errorf("Could not save changes to mark. %v", err)
+			return fmt.Errorf("Could not save changes to mark. %w", err)
 		}
 		// Get mark's serialized next node
 		nextNodeBytes := bucket.Get(nextKey)
@@ -1300,16 +3046,16 @@ func (ll *LinkedList) InsertAfter(data []byte, mark *Item) error {
 		}
 		// De-serialize next node to access its link to prev node
 		nextNode := &pb.LinkedListNode{}
-		err = proto.Unmarshal(nextNodeBytes, nextNode)
+		err = unmarshalNode(bucket, nextNodeBytes, nextNode)
 		if err != nil {
-			return fmt.Errorf("Could not unmarshal. %v", err)
+			return fmt.Errorf("Could not unmarshal. %w", err)
 		}
 		// Reset next node's prev link to point to the new node
 		nextNode.Prev = newKey
 		// Serialize back next node
-		nextNodeBytes, err = proto.Marshal(nextNode)
+		nextNodeBytes, err = marshalNode(bucket, nextNode)
 		if err != nil {
-			return fmt.Errorf("Could not marshal. %v", err)
+			return fmt.Errorf("Could not marshal. %w", err)
 		}
 		// Save back next node
 		return bucket.Put(nextKey, nextNodeBytes)
@@ -1320,30 +3066,34 @@ func (ll *LinkedList) InsertAfter(data []byte, mark *Item) error {
 // that all the pointers involving the new data and its siblings gets updated.
 //
 // The element at which the given mark points to must belong to the same linkedlist as the
-// linkedlist at which the method is being called. Otherwise, it returns an "Invalid mark:
-// linkedlists are not equal" error.
+// linkedlist at which the method is being called. Otherwise, it returns ErrInvalidMark,
+// wrapped with "linkedlists are not equal".
 //
-// It returns a "Nil mark" error in case of a nil mark argument, an "Empty list" error in
-// case of being called on a list with no elements, and an "Invalid mark" error in case
-// of passing an Item that wasn't returned by one of the linkedlist methods.
+// It returns ErrNilMark in case of a nil mark argument, ErrEmptyList in
+// case of being called on a list with no elements, ErrInvalidMark in case
+// of passing an Item that wasn't returned by one of the linkedlist methods, and
+// ErrStaleItem if the node of the mark has been removed.
 //
 // Other errors returned may be due to Bolt read/write or serialization/deserialization of
 // the data operations fail.
 func (ll *LinkedList) InsertBefore(data []byte, mark *Item) error {
 	if data == nil {
-		return fmt.Errorf("Empty data")
+		return ErrEmptyData
 	}
 	if mark == nil {
-		return fmt.Errorf("Empty mark")
+		return ErrNilMark
 	}
 	// Check whether mark is a valid LinkedList Item, i.e. it has not been modified.
 	sd, ok := mark.Data.(*storedData)
 	if !ok {
-		return fmt.Errorf("Invalid mark")
+		return ErrInvalidMark
+	}
+	if sd.stale {
+		return ErrStaleItem
 	}
 	// Check whether the internalLinkedList of mark is the same as ll
 	if sd.internalLinkedList != ll {
-		return fmt.Errorf("Invalid mark: linkedlists are not equal")
+		return fmt.Errorf("%w: linkedlists are not equal", ErrInvalidMark)
 	}
 	markKey := sd.key
 	// Check whether the given mark is the node at the front of the linkedlist. If so,
@@ -1353,27 +3103,28 @@ func (ll *LinkedList) InsertBefore(data []byte, mark *Item) error {
 		return err
 	}
 	if empty {
-		return fmt.Errorf("Empty list")
+		return ErrEmptyList
 	}
 	if bytes.Equal(frontKey, markKey) {
 		// The mark is the front of the linked list. The data will be pushed at the front.
 		return ll.PushFront(data)
 	}
 	// The mark is other than the front of the linked list
-	return (*bbolt.DB)(ll.db).Update(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket(ll.name)
+	return update(ll.db, "InsertBefore", func(tx *bbolt.Tx) error {
+		bucket := ll.bucket(tx)
 		if bucket == nil {
 			return ErrBucketNotFound
 		}
-		// Get serialized data of mark
+		// Get serialized data of mark. If it does not exist, it has been
+		// removed through another item.
 		markNodeBytes := bucket.Get(markKey)
 		if markNodeBytes == nil {
-			return ErrDoesNotExist
+			return ErrStaleItem
 		}
 		// De-serialize data of mark to access its next/prev links
 		markNode := &pb.LinkedListNode{}
-		if err = proto.Unmarshal(markNodeBytes, markNode); err != nil {
-			return fmt.Errorf("Could not unmarshal. %v", err)
+		if err = unmarshalNode(bucket, markNodeBytes, markNode); err != nil {
+			return fmt.Errorf("Could not unmarshal. %w", err)
 		}
 		prevKey := markNode.GetPrev()
 		// Set new node
@@ -1384,27 +3135,31 @@ func (ll *LinkedList) InsertBefore(data []byte, mark *Item) error {
 		}
 		id, _ := bucket.NextSequence()
 		newKey := byteID(id)
+		// Refuse duplicated data in unique mode
+		if err = uniqueAdd(uniqueIndex(tx, ll.name), data, newKey); err != nil {
+			return err
+		}
 		// Serialize the new node
-		newNodeBytes, err := proto.Marshal(newNode)
+		newNodeBytes, err := marshalNode(bucket, newNode)
 		if err != nil {
-			return fmt.Errorf("Could not marshal. %v", err)
+			return fmt.Errorf("Could not marshal. %w", err)
 		}
 		// Insert data into Bolt
 		err = bucket.Put(newKey, newNodeBytes)
 		if err != nil {
-			return fmt.Errorf("Could not save new data. %v", err)
+			return fmt.Errorf("Could not save new data. %w", err)
 		}
 		// Update link to prev node of the mark to point to the new node
 		markNode.Prev = newKey
 		// Serialize back the mark node
-		markNodeBytes, err = proto.Marshal(markNode)
+		markNodeBytes, err = marshalNode(bucket, markNode)
 		if err != nil {
-			return fmt.Errorf("Could not marshal. %v", err)
+			return fmt.Errorf("Could not marshal. %w", err)
 		}
 		// Save changes to the mark node
 		err = bucket.Put(markKey, markNodeBytes)
 		if err != nil {
-			return fmt.Errorf("Could not save changes to mark. %v", err)
+			return fmt.Errorf("Could not save changes to mark. %w", err)
 		}
 		// Get mark's serialized prev node
 		prevNodeBytes := bucket.Get(prevKey)
@@ -1413,25 +3168,767 @@ func (ll *LinkedList) InsertBefore(data []byte, mark *Item) error {
 		}
 		// De-serialize prev node to reset its link to the next node
 		prevNode := &pb.LinkedListNode{}
-		err = proto.Unmarshal(prevNodeBytes, prevNode)
+		err = unmarshalNode(bucket, prevNodeBytes, prevNode)
 		if err != nil {
-			return fmt.Errorf("Could not unmarshal. %v", err)
+			return fmt.Errorf("Could not unmarshal. %w", err)
 		}
 		// Reset prev node's next link to point to the new node.
 		prevNode.Next = newKey
 		// Serialize back prev node
-		prevNodeBytes, err = proto.Marshal(prevNode)
+		prevNodeBytes, err = marshalNode(bucket, prevNode)
 		if err != nil {
-			return fmt.Errorf("Could not marshal. %v", err)
+			return fmt.Errorf("Could not marshal. %w", err)
 		}
 		// Save back prev node
 		return bucket.Put(prevKey, prevNodeBytes)
 	})
 }
 
+// InsertSorted inserts the given data before the first node for which
+// less(data, node data) returns true, or at the back of the linked list if there
+// is no such node. If the linked list is sorted according to less, it stays
+// sorted, and data that is equal to existing data is inserted after it.
+//
+// Finding the position and inserting the data is done within a single
+// bbolt.Update transaction, so other insertions can not come in between.
+//
+// It returns ErrEmptyData if data is nil, and ErrNilFunc
+// when called with a nil less function.
+func (ll *LinkedList) InsertSorted(data []byte, less func(a, b []byte) bool) error {
+	if data == nil {
+		return ErrEmptyData
+	}
+	if less == nil {
+		return ErrNilFunc
+	}
+	return update(ll.db, "InsertSorted", func(tx *bbolt.Tx) error {
+		bucket := ll.bucket(tx)
+		if bucket == nil {
+			return ErrBucketNotFound
+		}
+		unique := uniqueIndex(tx, ll.name)
+		// Find the first node that should come after the new one
+		var (
+			nextKey  []byte
+			nextNode *pb.LinkedListNode
+		)
+		if err := walk(bucket, false, func(key []byte, node *pb.LinkedListNode) error {
+			if less(data, node.GetData()) {
+				nextKey, nextNode = copyKey(key), node
+				return ErrFoundIt
+			}
+			return nil
+		}); err != nil && err != ErrFoundIt {
+			return err
+		}
+		if nextNode == nil {
+			// The new node goes at the back of the linked list
+			return pushAll(bucket, unique, [][]byte{data}, false)
+		}
+		return insertNode(bucket, unique, data, nextKey, nextNode, false)
+	})
+}
+
+// InsertAfterKey inserts the given data after the node stored at the given key,
+// as returned by Item.Key, without the need for an item. The node is looked up
+// and the data is inserted within a single bbolt.Update transaction.
+//
+// It returns ErrEmptyData if data is nil, and ErrDoesNotExist if there is no
+// node with the given key, for instance if it has been removed.
+func (ll *LinkedList) InsertAfterKey(data, key []byte) error {
+	return ll.insertAtKey(data, key, true)
+}
+
+// InsertBeforeKey inserts the given data before the node stored at the given
+// key, as returned by Item.Key, without the need for an item. The node is looked
+// up and the data is inserted within a single bbolt.Update transaction.
+//
+// It returns ErrEmptyData if data is nil, and ErrDoesNotExist if there is no
+// node with the given key, for instance if it has been removed.
+func (ll *LinkedList) InsertBeforeKey(data, key []byte) error {
+	return ll.insertAtKey(data, key, false)
+}
+
+// insertAtKey inserts the given data after, or before, the node with the given key
+func (ll *LinkedList) insertAtKey(data, key []byte, after bool) error {
+	if data == nil {
+		return ErrEmptyData
+	}
+	if !isNodeKey(key) {
+		return ErrDoesNotExist
+	}
+	op := "InsertBeforeKey"
+	if after {
+		op = "InsertAfterKey"
+	}
+	return update(ll.db, op, func(tx *bbolt.Tx) error {
+		bucket := ll.bucket(tx)
+		if bucket == nil {
+			return ErrBucketNotFound
+		}
+		markNode, err := getNode(bucket, key)
+		if err != nil {
+			return err
+		}
+		return insertNode(bucket, uniqueIndex(tx, ll.name), data, copyKey(key), markNode, after)
+	})
+}
+
+// ForEach calls fn with the key and the data of every node in the linked list,
+// following the links from the front to the back of the list. The whole traversal
+// is done within a single bbolt.View transaction, so it is consistent and much
+// faster than calling Item.Next() repeatedly.
+//
+// The iteration stops at the first error returned by fn, which is then returned by
+// ForEach, with the exception of ErrStop, which just stops the iteration.
+// The slices passed to fn are only valid during the call.
+func (ll *LinkedList) ForEach(fn func(key, data []byte) error) error {
+	return ll.forEach(context.Background(), fn, false)
+}
+
+// ForEachCtx works like ForEach, but stops and returns the error of the context
+// as soon as it is cancelled. The context is checked before every call to fn.
+func (ll *LinkedList) ForEachCtx(ctx context.Context, fn func(key, data []byte) error) error {
+	return ll.forEach(ctx, fn, false)
+}
+
+// ForEachReverse works like ForEach, but follows the links from the back to the
+// front of the linked list.
+func (ll *LinkedList) ForEachReverse(fn func(key, data []byte) error) error {
+	return ll.forEach(context.Background(), fn, true)
+}
+
+// Each calls fn with the position, counting from 0, and the data of every node
+// in the linked list, from the front to the back of the list, within a single
+// bbolt.View transaction. The iteration stops at the first error returned by fn,
+// which is then returned by Each, just like for ForEach.
+func (ll *LinkedList) Each(fn func(index int, value []byte) error) error {
+	index := 0
+	return ll.ForEach(func(_, data []byte) error {
+		if err := fn(index, data); err != nil {
+			return err
+		}
+		index++
+		return nil
+	})
+}
+
+// GetAll returns a copy of the data of every node in the linked list, in order
+// from the front to the back of the list. The list is traversed within a single
+// bbolt.View transaction.
+func (ll *LinkedList) GetAll() ([][]byte, error) {
+	return ll.getAll(context.Background(), false)
+}
+
+// GetAllCtx works like GetAll, but stops and returns the error of the context
+// as soon as it is cancelled
+func (ll *LinkedList) GetAllCtx(ctx context.Context) ([][]byte, error) {
+	return ll.getAll(ctx, false)
+}
+
+// GetAllReverse returns a copy of the data of every node in the linked list, in
+// order from the back to the front of the list.
+func (ll *LinkedList) GetAllReverse() ([][]byte, error) {
+	return ll.getAll(context.Background(), true)
+}
+
+// GetAllItems returns an item for every node in the linked list, in order from
+// the front to the back of the list. Each of the returned items is independent of
+// the others, and can be used for updating or removing its node, or as a starting
+// point for Next and Prev. The list is traversed within a single bbolt.View
+// transaction.
+func (ll *LinkedList) GetAllItems() ([]*Item, error) {
+	var items []*Item
+	err := view(ll.db, "GetAllItems", func(tx *bbolt.Tx) error {
+		bucket := ll.bucket(tx)
+		if bucket == nil {
+			return ErrBucketNotFound
+		}
+		return walk(bucket, false, func(key []byte, node *pb.LinkedListNode) error {
+			items = append(items, ll.newItem(key, node))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// getAll collects the data of the linked list in one direction
+func (ll *LinkedList) getAll(ctx context.Context, reverse bool) ([][]byte, error) {
+	var all [][]byte
+	err := ll.forEach(ctx, func(_, data []byte) error {
+		all = append(all, append([]byte{}, data...))
+		return nil
+	}, reverse)
+	if err != nil {
+		return nil, err
+	}
+	return all, nil
+}
+
+// GetAllFunc compares val with the value of every single node in the linked list,
+// using the provided function, and returns an item for every match, in order from
+// the front to the back of the list. The list is traversed within a single
+// bbolt.View transaction and each of the returned items is independent of the others.
+//
+// If there are no matches, or if the list is empty, it returns an empty slice and
+// a nil error. It returns ErrEmptyValue when called with a nil val and an
+// ErrNilFunc when called with a nil function to compare.
+func (ll *LinkedList) GetAllFunc(val interface{}, equal func(a interface{}, b []byte) bool) ([]*Item, error) {
+	// Check whether the user provided a value to get
+	if val == nil {
+		return nil, ErrEmptyValue
+	}
+	// Check whether the user provided a function to compare for equality
+	if equal == nil {
+		return nil, ErrNilFunc
+	}
+	var items []*Item
+	err := view(ll.db, "GetAllFunc", func(tx *bbolt.Tx) error {
+		bucket := ll.bucket(tx)
+		if bucket == nil {
+			return ErrBucketNotFound
+		}
+		return walk(bucket, false, func(key []byte, node *pb.LinkedListNode) error {
+			if equal(val, node.GetData()) {
+				items = append(items, ll.newItem(key, node))
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// GetAllByValue works like GetAllFunc, but compares val with the value of every
+// single node in the linked list using bytes.Equal().
+func (ll *LinkedList) GetAllByValue(val []byte) ([]*Item, error) {
+	if val == nil {
+		return nil, ErrEmptyValue
+	}
+	return ll.GetAllFunc(val, bytesEqual)
+}
+
+// FindByPrefix returns an item for every node in the linked list whose data
+// starts with the given prefix, in order from the front to the back of the list.
+// Each of the returned items is independent of the others.
+//
+// If there are no matches, it returns an empty slice and a nil error.
+func (ll *LinkedList) FindByPrefix(prefix []byte) ([]*Item, error) {
+	var items []*Item
+	err := view(ll.db, "FindByPrefix", func(tx *bbolt.Tx) error {
+		bucket := ll.bucket(tx)
+		if bucket == nil {
+			return ErrBucketNotFound
+		}
+		return walk(bucket, false, func(key []byte, node *pb.LinkedListNode) error {
+			if bytes.HasPrefix(node.GetData(), prefix) {
+				items = append(items, ll.newItem(key, node))
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// newItem returns an item that refers to the given node, stored at the given key.
+// Both key and data are copied, so that the item is valid outside of the
+// transaction they were retrieved in.
+func (ll *LinkedList) newItem(key []byte, node *pb.LinkedListNode) *Item {
+	return &Item{
+		Data: &storedData{
+			key:                append([]byte{}, key...),
+			value:              append([]byte{}, node.GetData()...),
+			internalLinkedList: ll,
+			version:            node.GetVersion(),
+		},
+	}
+}
+
+// Len returns the number of nodes in the linked list
+func (ll *LinkedList) Len() (n int, err error) {
+	err = view(ll.db, "Len", func(tx *bbolt.Tx) error {
+		bucket := ll.bucket(tx)
+		if bucket == nil {
+			return ErrBucketNotFound
+		}
+		n = countNodes(bucket)
+		return nil
+	})
+	return n, err
+}
+
+// At returns the item at the given position in the linked list, counting from 0.
+// Negative positions count from the back of the list, -1 being the last item.
+// The list is traversed from the nearest end, within a single bbolt.View transaction.
+//
+// Returns ErrOutOfRange if there is no item at the given position.
+func (ll *LinkedList) At(i int) (it *Item, err error) {
+	err = view(ll.db, "At", func(tx *bbolt.Tx) error {
+		bucket := ll.bucket(tx)
+		if bucket == nil {
+			return ErrBucketNotFound
+		}
+		n := countNodes(bucket)
+		if i < 0 {
+			i += n
+		}
+		if i < 0 || i >= n {
+			return ErrOutOfRange
+		}
+		key, node, err := nodeAt(bucket, n, i)
+		if err != nil {
+			return err
+		}
+		it = ll.newItem(key, node)
+		return nil
+	})
+	return it, err
+}
+
+// Slice returns the items from position from up to, but not including, position
+// to, just like slicing a Go slice. Negative positions count from the back of the
+// list. The list is traversed from the nearest end, within a single bbolt.View
+// transaction.
+//
+// Returns ErrOutOfRange if the positions are out of range or from is larger than to.
+func (ll *LinkedList) Slice(from, to int) (items []*Item, err error) {
+	err = view(ll.db, "Slice", func(tx *bbolt.Tx) error {
+		bucket := ll.bucket(tx)
+		if bucket == nil {
+			return ErrBucketNotFound
+		}
+		n := countNodes(bucket)
+		if from < 0 {
+			from += n
+		}
+		if to < 0 {
+			to += n
+		}
+		if from < 0 || to > n || from > to {
+			return ErrOutOfRange
+		}
+		if from == to {
+			return nil
+		}
+		key, node, err := nodeAt(bucket, n, from)
+		if err != nil {
+			return err
+		}
+		for i := from; i < to; i++ {
+			if i > from {
+				key = node.GetNext()
+				if node, err = getNode(bucket, key); err != nil {
+					return err
+				}
+			}
+			items = append(items, ll.newItem(key, node))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// IndexOf returns the position of the given item in the linked list, counting
+// from 0. The list is traversed from the front, within a single bbolt.View
+// transaction.
+//
+// It returns ErrNilItem in case of a nil item, ErrInvalidItem in
+// case of passing an item that wasn't returned by one of the methods of this
+// linked list, and ErrDoesNotExist if the node has been removed since the item
+// was obtained.
+func (ll *LinkedList) IndexOf(it *Item) (index int, err error) {
+	if it == nil {
+		return -1, ErrNilItem
+	}
+	sd, ok := it.Data.(*storedData)
+	if !ok {
+		return -1, ErrInvalidItem
+	}
+	if sd.internalLinkedList != ll {
+		return -1, fmt.Errorf("%w: item belongs to another linked list", ErrInvalidItem)
+	}
+	index = -1
+	err = view(ll.db, "IndexOf", func(tx *bbolt.Tx) error {
+		bucket := ll.bucket(tx)
+		if bucket == nil {
+			return ErrBucketNotFound
+		}
+		if sd.key == nil || bucket.Get(sd.key) == nil {
+			return ErrDoesNotExist
+		}
+		i := 0
+		return walk(bucket, false, func(key []byte, _ *pb.LinkedListNode) error {
+			if bytes.Equal(key, sd.key) {
+				index = i
+				return ErrStop
+			}
+			i++
+			return nil
+		})
+	})
+	if err == ErrStop {
+		return index, nil
+	}
+	if err == nil {
+		// The node exists, but can not be reached from the front of the list
+		return -1, ErrDoesNotExist
+	}
+	return -1, err
+}
+
+// Equal returns true if the other linked list has the same length as this one,
+// and the same data at every position. Both linked lists are read in order, from
+// the front, within bbolt.View transactions.
+func (ll *LinkedList) Equal(other *LinkedList) (equal bool, err error) {
+	if other == nil {
+		return false, ErrNilLinkedList
+	}
+	compare := func(bucket, otherBucket *bbolt.Bucket) error {
+		if bucket == nil || otherBucket == nil {
+			return ErrBucketNotFound
+		}
+		key := bucket.Get([]byte("FRONT"))
+		otherKey := otherBucket.Get([]byte("FRONT"))
+		for key != nil && otherKey != nil {
+			node, err := getNode(bucket, key)
+			if err != nil {
+				return err
+			}
+			otherNode, err := getNode(otherBucket, otherKey)
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(node.GetData(), otherNode.GetData()) {
+				return nil
+			}
+			key, otherKey = node.GetNext(), otherNode.GetNext()
+		}
+		// Both linked lists must end at the same position
+		equal = key == nil && otherKey == nil
+		return nil
+	}
+	err = view(ll.db, "Equal", func(tx *bbolt.Tx) error {
+		if other.db == ll.db {
+			return compare(ll.bucket(tx), tx.Bucket(other.name))
+		}
+		return view(other.db, "Equal", func(otherTx *bbolt.Tx) error {
+			return compare(ll.bucket(tx), otherTx.Bucket(other.name))
+		})
+	})
+	if err != nil {
+		return false, err
+	}
+	return equal, nil
+}
+
+// nodeAt returns the node at position i in the list stored in the given bucket,
+// which has n nodes, by following the links from the nearest end of the list.
+func nodeAt(bucket *bbolt.Bucket, n, i int) (key []byte, node *pb.LinkedListNode, err error) {
+	if i < n/2 {
+		key = bucket.Get([]byte("FRONT"))
+		for ; ; i-- {
+			if node, err = getNode(bucket, key); err != nil {
+				return nil, nil, err
+			}
+			if i == 0 {
+				return key, node, nil
+			}
+			key = node.GetNext()
+		}
+	}
+	key = bucket.Get([]byte("BACK"))
+	for i = n - 1 - i; ; i-- {
+		if node, err = getNode(bucket, key); err != nil {
+			return nil, nil, err
+		}
+		if i == 0 {
+			return key, node, nil
+		}
+		key = node.GetPrev()
+	}
+}
+
+// countNodes returns the number of nodes in the list stored in the given bucket
+func countNodes(bucket *bbolt.Bucket) int {
+	n := 0
+	c := bucket.Cursor()
+	for key, _ := c.First(); key != nil; key, _ = c.Next() {
+		if isNodeKey(key) {
+			n++
+		}
+	}
+	return n
+}
+
+// forEach traverses the linked list in one direction within a single transaction
+func (ll *LinkedList) forEach(ctx context.Context, fn func(key, data []byte) error, reverse bool) error {
+	op := "ForEach"
+	if reverse {
+		op = "ForEachReverse"
+	}
+	err := view(ll.db, op, func(tx *bbolt.Tx) error {
+		bucket := ll.bucket(tx)
+		if bucket == nil {
+			return ErrBucketNotFound
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return walk(bucket, reverse, func(key []byte, node *pb.LinkedListNode) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			return fn(key, node.GetData())
+		})
+	})
+	if err == ErrStop {
+		return nil
+	}
+	return err
+}
+
+// walk calls fn for every node of the linked list stored in the given bucket,
+// starting from the front (or the back, if reverse is true) and following the
+// next (or prev) links. It stops at the first error returned by fn.
+func walk(bucket *bbolt.Bucket, reverse bool, fn func(key []byte, node *pb.LinkedListNode) error) error {
+	var key []byte
+	if reverse {
+		key = bucket.Get([]byte("BACK"))
+	} else {
+		key = bucket.Get([]byte("FRONT"))
+	}
+	for key != nil {
+		node, err := getNode(bucket, key)
+		if err != nil {
+			return err
+		}
+		if err := fn(key, node); err != nil {
+			return err
+		}
+		if reverse {
+			key = node.GetPrev()
+		} else {
+			key = node.GetNext()
+		}
+	}
+	return nil
+}
+
+// getNode retrieves and de-serializes the node stored at the given key
+func getNode(bucket *bbolt.Bucket, key []byte) (*pb.LinkedListNode, error) {
+	nodeBytes := bucket.Get(key)
+	if nodeBytes == nil {
+		return nil, ErrDoesNotExist
+	}
+	node := &pb.LinkedListNode{}
+	if err := unmarshalNode(bucket, nodeBytes, node); err != nil {
+		return nil, fmt.Errorf("Could not unmarshal. %w", err)
+	}
+	return node, nil
+}
+
+// putNode serializes the given node and stores it at the given key
+func putNode(bucket *bbolt.Bucket, key []byte, node *pb.LinkedListNode) error {
+	nodeBytes, err := marshalNode(bucket, node)
+	if err != nil {
+		return fmt.Errorf("Could not marshal. %w", err)
+	}
+	if err := bucket.Put(key, nodeBytes); err != nil {
+		return fmt.Errorf("Could not save node. %w", err)
+	}
+	return nil
+}
+
+// setLink sets the next link, or the prev link if next is false, of the node
+// stored at the given key. Nothing is done if the key is nil.
+func setLink(bucket *bbolt.Bucket, key, target []byte, next bool) error {
+	if key == nil {
+		return nil
+	}
+	node, err := getNode(bucket, key)
+	if err != nil {
+		return err
+	}
+	if next {
+		node.Next = target
+	} else {
+		node.Prev = target
+	}
+	return putNode(bucket, key, node)
+}
+
+// bumpVersion increases the version of the node with the given key
+func bumpVersion(bucket *bbolt.Bucket, key []byte) error {
+	node, err := getNode(bucket, key)
+	if err != nil {
+		return err
+	}
+	node.Version++
+	return putNode(bucket, key, node)
+}
+
+// containsKey checks whether the given keys contain the given key
+func containsKey(keys [][]byte, key []byte) bool {
+	for _, k := range keys {
+		if bytes.Equal(k, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// insertNode stores a new node with the given data after, or before, the given
+// mark node, and updates the links of its siblings and the ends of the list
+func insertNode(bucket, unique *bbolt.Bucket, data, markKey []byte, markNode *pb.LinkedListNode, after bool) error {
+	id, err := bucket.NextSequence()
+	if err != nil {
+		return err
+	}
+	newKey := byteID(id)
+	// Refuse duplicated data in unique mode
+	if err := uniqueAdd(unique, data, newKey); err != nil {
+		return err
+	}
+	newNode := &pb.LinkedListNode{Data: data}
+	var siblingKey []byte
+	if after {
+		siblingKey = markNode.GetNext()
+		newNode.Prev, newNode.Next = markKey, siblingKey
+		markNode.Next = newKey
+	} else {
+		siblingKey = markNode.GetPrev()
+		newNode.Prev, newNode.Next = siblingKey, markKey
+		markNode.Prev = newKey
+	}
+	if err := putNode(bucket, newKey, newNode); err != nil {
+		return err
+	}
+	if err := putNode(bucket, markKey, markNode); err != nil {
+		return err
+	}
+	if siblingKey != nil {
+		return setLink(bucket, siblingKey, newKey, !after)
+	}
+	// The new node is the new back, or the new front, of the linked list
+	frontKey, backKey := copyKey(bucket.Get([]byte("FRONT"))), copyKey(bucket.Get([]byte("BACK")))
+	if after {
+		backKey = newKey
+	} else {
+		frontKey = newKey
+	}
+	return setEnds(bucket, frontKey, backKey)
+}
+
+// setEnds stores the keys of the nodes at the front and at the back of the list.
+// Both keys are removed if either is nil, i.e. the list is empty.
+func setEnds(bucket *bbolt.Bucket, frontKey, backKey []byte) error {
+	if frontKey == nil || backKey == nil {
+		if err := bucket.Delete([]byte("FRONT")); err != nil {
+			return fmt.Errorf("Could not reset front. %w", err)
+		}
+		if err := bucket.Delete([]byte("BACK")); err != nil {
+			return fmt.Errorf("Could not reset back. %w", err)
+		}
+		return nil
+	}
+	if err := bucket.Put([]byte("FRONT"), frontKey); err != nil {
+		return fmt.Errorf("Could not set front of the linked list. %w", err)
+	}
+	if err := bucket.Put([]byte("BACK"), backKey); err != nil {
+		return fmt.Errorf("Could not set back of the linked list. %w", err)
+	}
+	return nil
+}
+
+// migrateEnds stores the keys of the nodes at the front and at the back of the
+// linked list, for buckets that were created without them. The nodes without a
+// prev and without a next link are used.
+func migrateEnds(bucket *bbolt.Bucket) error {
+	if bucket.Get([]byte("FRONT")) != nil && bucket.Get([]byte("BACK")) != nil {
+		return nil
+	}
+	var frontKey, backKey []byte
+	if err := bucket.ForEach(func(key, nodeBytes []byte) error {
+		if !isNodeKey(key) {
+			return nil // Continue ForEach
+		}
+		node := &pb.LinkedListNode{}
+		if err := unmarshalNode(bucket, nodeBytes, node); err != nil {
+			return fmt.Errorf("Could not unmarshal. %w", err)
+		}
+		if frontKey == nil && node.GetPrev() == nil {
+			frontKey = copyKey(key)
+		}
+		if backKey == nil && node.GetNext() == nil {
+			backKey = copyKey(key)
+		}
+		return nil // Continue ForEach
+	}); err != nil {
+		return err
+	}
+	if frontKey == nil && backKey == nil {
+		// Nothing to migrate
+		return nil
+	}
+	return setEnds(bucket, frontKey, backKey)
+}
+
+// copyKey returns a copy of the given key, or nil if the key is nil. Keys retrieved
+// from Bolt are copied before being used for modifying the bucket.
+func copyKey(key []byte) []byte {
+	if key == nil {
+		return nil
+	}
+	return append([]byte{}, key...)
+}
+
+// isNodeKey checks whether the given key may refer to a node, as opposed to
+// the keys used for storing the front and back of the list.
+func isNodeKey(key []byte) bool {
+	return len(key) == 8
+}
+
 // Create a byte slice from an uint64
 func byteID(x uint64) []byte {
 	b := make([]byte, 8)
 	binary.BigEndian.PutUint64(b, x)
 	return b
 }
+
+// update calls fn within a read-write transaction, observed as the given
+// operation by the Metrics of the database, if any. Returns ErrDatabaseClosed
+// if the database has been closed.
+func update(db *simplebolt.Database, op string, fn func(tx *bbolt.Tx) error) error {
+	return db.Observe("LinkedList", op, func() error {
+		return closedError((*bbolt.DB)(db).Update(fn))
+	})
+}
+
+// view calls fn within a read-only transaction, observed as the given operation
+// by the Metrics of the database, if any. Returns ErrDatabaseClosed if the
+// database has been closed.
+func view(db *simplebolt.Database, op string, fn func(tx *bbolt.Tx) error) error {
+	return db.Observe("LinkedList", op, func() error {
+		return closedError((*bbolt.DB)(db).View(fn))
+	})
+}
+
+// closedError returns ErrDatabaseClosed if the given error is the one that Bolt
+// returns when the database is not open, or else the given error
+func closedError(err error) error {
+	if errors.Is(err, bbolt.ErrDatabaseNotOpen) {
+		return ErrDatabaseClosed
+	}
+	return err
+}
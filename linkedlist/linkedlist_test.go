@@ -2,15 +2,26 @@ package linkedlist
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"log"
 	"os"
 	"path/filepath"
 	"reflect"
 	"runtime"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/golang/protobuf/proto"
+	"github.com/xyproto/pinterface"
 	"github.com/xyproto/simplebolt"
+	"github.com/xyproto/simplebolt/codec"
+	pb "github.com/xyproto/simplebolt/linkedlist/nodes_pb"
+	"go.etcd.io/bbolt"
 )
 
 type TestLL struct {
@@ -96,6 +107,266 @@ func TestGetters(t *testing.T) {
 	assert(t, notIn == nil, "GetFunc expected nil")
 }
 
+func TestGetNextDuplicates(t *testing.T) {
+	ll := NewTestLL()
+	defer ll.Close()
+
+	data := [][]byte{
+		[]byte("ABC"),
+		[]byte("DUP"),
+		[]byte("DEF"),
+		[]byte("DUP"),
+		[]byte("DUP"),
+	}
+	var err error
+	for _, d := range data {
+		err = ll.PushBack(d)
+		ok(t, err)
+	}
+	dup, err := ll.Get([]byte("DUP"))
+	ok(t, err)
+	assert(t, dup != nil, "Get expected an item")
+
+	// Chain GetNext to retrieve the remaining copies
+	found := 1
+	for {
+		dup, err = ll.GetNext([]byte("DUP"), dup)
+		ok(t, err)
+		if dup == nil {
+			break
+		}
+		equals(t, []byte("DUP"), dup.Data.Value())
+		found++
+		assert(t, found <= 3, "GetNext does not advance past the mark")
+	}
+	equals(t, 3, found)
+
+	// The same goes for GetNextFunc
+	dup, err = ll.GetFunc([]byte("DU"), getfunc)
+	ok(t, err)
+	found = 1
+	for {
+		dup, err = ll.GetNextFunc([]byte("DU"), dup, getfunc)
+		ok(t, err)
+		if dup == nil {
+			break
+		}
+		found++
+		assert(t, found <= 3, "GetNextFunc does not advance past the mark")
+	}
+	equals(t, 3, found)
+}
+
+func TestGetFuncReverse(t *testing.T) {
+	ll := NewTestLL()
+	defer ll.Close()
+
+	_, err := ll.GetFuncReverse([]byte("DUP"), getfunc)
+	assert(t, err != nil, "GetFuncReverse expected an error for an empty list")
+
+	err = ll.PushBackAll([][]byte{
+		[]byte("DUP1"),
+		[]byte("ABC"),
+		[]byte("DUP2"),
+		[]byte("DEF"),
+	})
+	ok(t, err)
+	// The last match is returned
+	dup, err := ll.GetFuncReverse([]byte("DUP"), getfunc)
+	ok(t, err)
+	equals(t, []byte("DUP2"), dup.Data.Value())
+	// Earlier matches can be found with GetPrevFunc
+	dup, err = ll.GetPrevFunc([]byte("DUP"), dup, getfunc)
+	ok(t, err)
+	equals(t, []byte("DUP1"), dup.Data.Value())
+	missing, err := ll.GetFuncReverse([]byte("GHI"), getfunc)
+	ok(t, err)
+	assert(t, missing == nil, "GetFuncReverse expected no match")
+
+	// Validation
+	_, err = ll.GetFuncReverse(nil, getfunc)
+	assert(t, err != nil, "GetFuncReverse expected an error for a nil val")
+	_, err = ll.GetFuncReverse([]byte("DUP"), nil)
+	assert(t, err != nil, "GetFuncReverse expected an error for a nil function")
+}
+
+// fakeData is a StoredData that does not belong to any linked list
+type fakeData []byte
+
+func (fd fakeData) Value() []byte               { return fd }
+func (fd fakeData) Update(newData []byte) error { return nil }
+func (fd fakeData) Remove() error               { return nil }
+
+func TestMarkValidation(t *testing.T) {
+	ll := NewTestLL()
+	defer ll.Close()
+	err := ll.PushBackAll([][]byte{[]byte("ABC"), []byte("DEF"), []byte("ABC")})
+	ok(t, err)
+	other := NewTestLL()
+	defer other.Close()
+	err = other.PushBackAll([][]byte{[]byte("ABC"), []byte("ABC")})
+	ok(t, err)
+	otherFront, err := other.Front()
+	ok(t, err)
+	replaced, err := ll.Front()
+	ok(t, err)
+	replaced.Data = fakeData("ABC")
+	stale, err := ll.Back()
+	ok(t, err)
+	err = ll.PushBack([]byte("GHI"))
+	ok(t, err)
+	err = stale.Data.Remove()
+	ok(t, err)
+
+	searches := map[string]func(mark *Item) (*Item, error){
+		"GetNext": func(mark *Item) (*Item, error) {
+			return ll.GetNext([]byte("ABC"), mark)
+		},
+		"GetNextFunc": func(mark *Item) (*Item, error) {
+			return ll.GetNextFunc([]byte("ABC"), mark, getfunc)
+		},
+		"GetPrev": func(mark *Item) (*Item, error) {
+			return ll.GetPrev([]byte("ABC"), mark)
+		},
+		"GetPrevFunc": func(mark *Item) (*Item, error) {
+			return ll.GetPrevFunc([]byte("ABC"), mark, getfunc)
+		},
+	}
+	for name, search := range searches {
+		it, err := search(otherFront)
+		assert(t, errors.Is(err, ErrInvalidMark), "%s expected ErrInvalidMark for a mark from another list, got %v", name, err)
+		assert(t, it == nil, "%s expected no item", name)
+		it, err = search(replaced)
+		assert(t, errors.Is(err, ErrInvalidMark), "%s expected ErrInvalidMark for a replaced mark, got %v", name, err)
+		assert(t, it == nil, "%s expected no item", name)
+		it, err = search(stale)
+		assert(t, errors.Is(err, ErrStaleItem), "%s expected ErrStaleItem for a removed mark, got %v", name, err)
+		assert(t, it == nil, "%s expected no item", name)
+	}
+	// Inserting relative to an invalid mark fails in the same way
+	err = ll.InsertAfter([]byte("JKL"), otherFront)
+	assert(t, errors.Is(err, ErrInvalidMark), "InsertAfter expected ErrInvalidMark, got %v", err)
+	err = ll.InsertBefore([]byte("JKL"), replaced)
+	assert(t, errors.Is(err, ErrInvalidMark), "InsertBefore expected ErrInvalidMark, got %v", err)
+}
+
+func TestGetPrevDuplicates(t *testing.T) {
+	ll := NewTestLL()
+	defer ll.Close()
+
+	data := [][]byte{
+		[]byte("DUP"),
+		[]byte("DUP"),
+		[]byte("DEF"),
+		[]byte("DUP"),
+		[]byte("ABC"),
+	}
+	var err error
+	for _, d := range data {
+		err = ll.PushBack(d)
+		ok(t, err)
+	}
+	back, err := ll.Back()
+	ok(t, err)
+
+	// Chain GetPrev to retrieve every copy, from the back to the front
+	dup := back
+	found := 0
+	for {
+		dup, err = ll.GetPrev([]byte("DUP"), dup)
+		ok(t, err)
+		if dup == nil {
+			break
+		}
+		equals(t, []byte("DUP"), dup.Data.Value())
+		found++
+		assert(t, found <= 3, "GetPrev does not advance past the mark")
+	}
+	equals(t, 3, found)
+
+	// The same goes for GetPrevFunc
+	dup = back
+	found = 0
+	for {
+		dup, err = ll.GetPrevFunc([]byte("DU"), dup, getfunc)
+		ok(t, err)
+		if dup == nil {
+			break
+		}
+		found++
+		assert(t, found <= 3, "GetPrevFunc does not advance past the mark")
+	}
+	equals(t, 3, found)
+
+	def, err := ll.GetPrev([]byte("DEF"), back)
+	ok(t, err)
+	equals(t, []byte("DEF"), def.Data.Value())
+
+	// Validation
+	_, err = ll.GetPrev(nil, back)
+	assert(t, err != nil, "GetPrev expected an error for a nil val")
+	_, err = ll.GetPrev([]byte("DUP"), nil)
+	assert(t, err != nil, "GetPrev expected an error for a nil mark")
+	other := NewTestLL()
+	defer other.Close()
+	err = other.PushBack([]byte("DUP"))
+	ok(t, err)
+	otherBack, err := other.Back()
+	ok(t, err)
+	_, err = ll.GetPrev([]byte("DUP"), otherBack)
+	assert(t, err != nil, "GetPrev expected an error for a mark of another list")
+}
+
+func TestIndependentItems(t *testing.T) {
+	ll := NewTestLL()
+	defer ll.Close()
+
+	data := []string{"ABC", "DEF", "GHI", "JKL"}
+	for _, d := range data {
+		err := ll.PushBack([]byte(d))
+		ok(t, err)
+	}
+	front, err := ll.Front()
+	ok(t, err)
+	cursor := front
+	for _, d := range data[1:] {
+		cursor = cursor.Next()
+		equals(t, []byte(d), cursor.Data.Value())
+		// The captured item still refers to its original node
+		equals(t, []byte("ABC"), front.Data.Value())
+		equals(t, []byte("DEF"), front.Next().Data.Value())
+	}
+	back := cursor
+	for i := len(data) - 2; i >= 0; i-- {
+		cursor = cursor.Prev()
+		equals(t, []byte(data[i]), cursor.Data.Value())
+		equals(t, []byte("JKL"), back.Data.Value())
+		equals(t, []byte("GHI"), back.Prev().Data.Value())
+	}
+
+	// Several readers may traverse the list at the same time
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for r := 0; r < 8; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var values []string
+			for k := front; k != nil; k = k.Next() {
+				values = append(values, string(k.Data.Value()))
+			}
+			if !reflect.DeepEqual(data, values) {
+				errs <- fmt.Errorf("Unexpected traversal: %v", values)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		ok(t, err)
+	}
+}
+
 func TestModifiers(t *testing.T) {
 	ll := NewTestLL()
 	defer ll.Close()
@@ -143,6 +414,2975 @@ func TestModifiers(t *testing.T) {
 	equals(t, string(next.Data.Value()), string(prev.Data.Value()))
 }
 
+func TestForEach(t *testing.T) {
+	ll := NewTestLL()
+	defer ll.Close()
+
+	data := [][]byte{
+		[]byte("ABC"),
+		[]byte("DEF"),
+		[]byte("GHI"),
+	}
+	var err error
+	for _, d := range data {
+		err = ll.PushBack(d)
+		ok(t, err)
+	}
+	// Reorder the list so that the key order differs from the list order
+	def, err := ll.Get([]byte("DEF"))
+	ok(t, err)
+	err = ll.MoveToFront(def)
+	ok(t, err)
+
+	var values []string
+	err = ll.ForEach(func(_, data []byte) error {
+		values = append(values, string(data))
+		return nil
+	})
+	ok(t, err)
+	equals(t, []string{"DEF", "ABC", "GHI"}, values)
+
+	values = nil
+	err = ll.ForEachReverse(func(_, data []byte) error {
+		values = append(values, string(data))
+		return nil
+	})
+	ok(t, err)
+	equals(t, []string{"GHI", "ABC", "DEF"}, values)
+
+	// Stop early
+	values = nil
+	err = ll.ForEach(func(_, data []byte) error {
+		values = append(values, string(data))
+		if len(values) == 2 {
+			return ErrStop
+		}
+		return nil
+	})
+	ok(t, err)
+	equals(t, []string{"DEF", "ABC"}, values)
+
+	// Other errors are passed on
+	errTest := fmt.Errorf("Test error")
+	err = ll.ForEach(func(_, _ []byte) error {
+		return errTest
+	})
+	equals(t, errTest, err)
+}
+
+func TestEach(t *testing.T) {
+	ll := NewTestLL()
+	defer ll.Close()
+
+	err := ll.PushBackAll([][]byte{[]byte("ABC"), []byte("DEF"), []byte("GHI")})
+	ok(t, err)
+	var lines []string
+	err = ll.Each(func(index int, value []byte) error {
+		lines = append(lines, fmt.Sprintf("%d. %s", index+1, value))
+		if index == 1 {
+			return ErrStop
+		}
+		return nil
+	})
+	ok(t, err)
+	equals(t, []string{"1. ABC", "2. DEF"}, lines)
+}
+
+func TestGetAll(t *testing.T) {
+	ll := NewTestLL()
+	defer ll.Close()
+
+	all, err := ll.GetAll()
+	ok(t, err)
+	equals(t, 0, len(all))
+
+	for _, d := range []string{"ABC", "DEF", "GHI"} {
+		err = ll.PushBack([]byte(d))
+		ok(t, err)
+	}
+	// Reorder the list, so that it no longer follows the key order
+	err = ll.PushFront([]byte("XYZ"))
+	ok(t, err)
+	def, err := ll.Get([]byte("DEF"))
+	ok(t, err)
+	err = ll.MoveToFront(def)
+	ok(t, err)
+
+	all, err = ll.GetAll()
+	ok(t, err)
+	equals(t, [][]byte{[]byte("DEF"), []byte("XYZ"), []byte("ABC"), []byte("GHI")}, all)
+
+	all, err = ll.GetAllReverse()
+	ok(t, err)
+	equals(t, [][]byte{[]byte("GHI"), []byte("ABC"), []byte("XYZ"), []byte("DEF")}, all)
+}
+
+func TestMoveToIndex(t *testing.T) {
+	data := []string{"A", "B", "C", "D", "E"}
+	for _, tc := range []struct {
+		item     string
+		index    int
+		expected string
+	}{
+		{"C", 0, "CABDE"},
+		{"C", 4, "ABDEC"},
+		{"C", -1, "ABDEC"},
+		{"A", 3, "BCDAE"},
+		{"E", 1, "AEBCD"},
+		{"B", 2, "ACBDE"},
+		{"C", 1, "ACBDE"},
+		{"A", 1, "BACDE"},
+		{"E", 3, "ABCED"},
+		{"A", 4, "BCDEA"},
+		{"E", 0, "EABCD"},
+		{"C", 2, "ABCDE"},
+	} {
+		ll := NewTestLL()
+		for _, d := range data {
+			err := ll.PushBack([]byte(d))
+			ok(t, err)
+		}
+		it, err := ll.Get([]byte(tc.item))
+		ok(t, err)
+		err = ll.MoveToIndex(it, tc.index)
+		ok(t, err)
+
+		var forward, backward string
+		err = ll.ForEach(func(_, data []byte) error {
+			forward += string(data)
+			return nil
+		})
+		ok(t, err)
+		equals(t, tc.expected, forward)
+		err = ll.ForEachReverse(func(_, data []byte) error {
+			backward = string(data) + backward
+			return nil
+		})
+		ok(t, err)
+		equals(t, tc.expected, backward)
+		problems, err := ll.ValidateLinks()
+		ok(t, err)
+		equals(t, 0, len(problems))
+		if tc.expected == "ABCDE" {
+			equals(t, uint64(0), it.Version())
+		} else {
+			equals(t, uint64(1), it.Version())
+		}
+		ll.Close()
+	}
+
+	ll := NewTestLL()
+	defer ll.Close()
+	err := ll.PushBackAll([][]byte{[]byte("A"), []byte("B")})
+	ok(t, err)
+	it, err := ll.Front()
+	ok(t, err)
+	err = ll.MoveToIndex(it, 2)
+	equals(t, ErrOutOfRange, err)
+	err = ll.MoveToIndex(it, -3)
+	equals(t, ErrOutOfRange, err)
+	err = it.Data.Remove()
+	ok(t, err)
+	err = ll.MoveToIndex(it, 0)
+	equals(t, ErrStaleItem, err)
+}
+
+func TestGetAllItems(t *testing.T) {
+	ll := NewTestLL()
+	defer ll.Close()
+
+	items, err := ll.GetAllItems()
+	ok(t, err)
+	equals(t, 0, len(items))
+
+	err = ll.PushBackAll([][]byte{[]byte("ABC"), []byte("DEF"), []byte("GHI"), []byte("JKL")})
+	ok(t, err)
+	items, err = ll.GetAllItems()
+	ok(t, err)
+	equals(t, 4, len(items))
+	equals(t, []byte("ABC"), items[0].Data.Value())
+	equals(t, []byte("JKL"), items[3].Data.Value())
+
+	// The items are independent of each other
+	err = items[1].Data.Update([]byte("XYZ"))
+	ok(t, err)
+	equals(t, []byte("ABC"), items[0].Data.Value())
+	equals(t, []byte("XYZ"), items[1].Data.Value())
+	err = items[2].Data.Remove()
+	ok(t, err)
+	all, err := ll.GetAll()
+	ok(t, err)
+	equals(t, [][]byte{[]byte("ABC"), []byte("XYZ"), []byte("JKL")}, all)
+
+	// The other items can still be used for traversing the list
+	next := items[1].Next()
+	equals(t, []byte("JKL"), next.Data.Value())
+	prev := items[3].Prev()
+	equals(t, []byte("XYZ"), prev.Data.Value())
+	_, err = items[2].NextItem()
+	equals(t, ErrStaleItem, err)
+}
+
+func TestFindByPrefix(t *testing.T) {
+	ll := NewTestLL()
+	defer ll.Close()
+
+	for _, d := range []string{"ABC", "ABD", "DEF", "ABE"} {
+		err := ll.PushBack([]byte(d))
+		ok(t, err)
+	}
+	items, err := ll.FindByPrefix([]byte("AB"))
+	ok(t, err)
+	equals(t, 3, len(items))
+	equals(t, []byte("ABC"), items[0].Data.Value())
+	equals(t, []byte("ABD"), items[1].Data.Value())
+	equals(t, []byte("ABE"), items[2].Data.Value())
+
+	// The items are independent of each other
+	next := items[0].Next()
+	equals(t, []byte("ABD"), next.Data.Value())
+	equals(t, []byte("ABC"), items[0].Data.Value())
+
+	items, err = ll.FindByPrefix([]byte("X"))
+	ok(t, err)
+	equals(t, 0, len(items))
+}
+
+func TestGetByKey(t *testing.T) {
+	ll := NewTestLL()
+	defer ll.Close()
+
+	for _, d := range []string{"ABC", "DEF", "GHI"} {
+		err := ll.PushBack([]byte(d))
+		ok(t, err)
+	}
+	def, err := ll.Get([]byte("DEF"))
+	ok(t, err)
+	key := def.Key()
+	assert(t, key != nil, "Key expected a key")
+
+	item, err := ll.GetByKey(key)
+	ok(t, err)
+	equals(t, []byte("DEF"), item.Data.Value())
+	equals(t, []byte("GHI"), item.Next().Data.Value())
+
+	err = item.Data.Remove()
+	ok(t, err)
+	_, err = ll.GetByKey(key)
+	equals(t, ErrDoesNotExist, err)
+
+	_, err = ll.GetByKey([]byte("FRONT"))
+	equals(t, ErrDoesNotExist, err)
+}
+
+func TestDeleteFunc(t *testing.T) {
+	ll := NewTestLL()
+	defer ll.Close()
+
+	for _, d := range []string{"X1", "ABC", "X2", "X3", "DEF", "X4"} {
+		err := ll.PushBack([]byte(d))
+		ok(t, err)
+	}
+	removed, err := ll.DeleteFunc(func(value []byte) bool {
+		return bytes.HasPrefix(value, []byte("X"))
+	})
+	ok(t, err)
+	equals(t, 4, removed)
+
+	all, err := ll.GetAll()
+	ok(t, err)
+	equals(t, [][]byte{[]byte("ABC"), []byte("DEF")}, all)
+	all, err = ll.GetAllReverse()
+	ok(t, err)
+	equals(t, [][]byte{[]byte("DEF"), []byte("ABC")}, all)
+}
+
+func TestGetAllFunc(t *testing.T) {
+	ll := NewTestLL()
+	defer ll.Close()
+
+	items, err := ll.GetAllFunc([]byte("D"), getfunc)
+	ok(t, err)
+	equals(t, 0, len(items))
+
+	for _, d := range []string{"DUP", "ABC", "DEF", "DUP"} {
+		err = ll.PushBack([]byte(d))
+		ok(t, err)
+	}
+	items, err = ll.GetAllFunc([]byte("D"), getfunc)
+	ok(t, err)
+	equals(t, 3, len(items))
+	equals(t, []byte("DUP"), items[0].Data.Value())
+	equals(t, []byte("DEF"), items[1].Data.Value())
+	equals(t, []byte("DUP"), items[2].Data.Value())
+
+	items, err = ll.GetAllByValue([]byte("DUP"))
+	ok(t, err)
+	equals(t, 2, len(items))
+	// Each item refers to its own node
+	assert(t, items[0].Next() != nil, "the first DUP should have a next item")
+	assert(t, items[1].Next() == nil, "the second DUP should be at the back")
+
+	_, err = ll.GetAllFunc(nil, getfunc)
+	assert(t, err != nil, "GetAllFunc expected an error for a nil val")
+	_, err = ll.GetAllFunc([]byte("D"), nil)
+	assert(t, err != nil, "GetAllFunc expected an error for a nil function")
+}
+
+func TestRemoveFunc(t *testing.T) {
+	isX := func(data []byte) bool {
+		return bytes.HasPrefix(data, []byte("X"))
+	}
+	for _, tc := range []struct {
+		data []string
+		left []string
+	}{
+		{[]string{"X1", "ABC", "DEF"}, []string{"ABC", "DEF"}},
+		{[]string{"ABC", "DEF", "X1"}, []string{"ABC", "DEF"}},
+		{[]string{"ABC", "X1", "X2", "X3", "DEF"}, []string{"ABC", "DEF"}},
+		{[]string{"X1", "X2", "ABC", "X3", "DEF", "X4", "X5"}, []string{"ABC", "DEF"}},
+		{[]string{"X1", "ABC", "X2", "DEF", "X3"}, []string{"ABC", "DEF"}},
+		{[]string{"ABC", "DEF"}, []string{"ABC", "DEF"}},
+		{[]string{"X1", "X2", "X3"}, nil},
+		{nil, nil},
+	} {
+		ll := NewTestLL()
+		for _, d := range tc.data {
+			err := ll.PushBack([]byte(d))
+			ok(t, err)
+		}
+		removed, err := ll.RemoveFunc(isX)
+		ok(t, err)
+		equals(t, len(tc.data)-len(tc.left), removed)
+
+		var forward, backward []string
+		err = ll.ForEach(func(_, data []byte) error {
+			forward = append(forward, string(data))
+			return nil
+		})
+		ok(t, err)
+		equals(t, tc.left, forward)
+		err = ll.ForEachReverse(func(_, data []byte) error {
+			backward = append([]string{string(data)}, backward...)
+			return nil
+		})
+		ok(t, err)
+		equals(t, tc.left, backward)
+
+		// The list can still be modified afterwards
+		err = ll.PushBack([]byte("GHI"))
+		ok(t, err)
+		back, err := ll.Back()
+		ok(t, err)
+		equals(t, []byte("GHI"), back.Data.Value())
+		front, err := ll.Front()
+		ok(t, err)
+		if len(tc.left) > 0 {
+			equals(t, []byte(tc.left[0]), front.Data.Value())
+		} else {
+			equals(t, []byte("GHI"), front.Data.Value())
+		}
+		ll.Close()
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	data := []string{"A", "B", "C", "D", "E"}
+	for _, tc := range []struct {
+		n       int
+		reverse bool
+		left    []string
+	}{
+		{0, false, nil},
+		{2, false, []string{"A", "B"}},
+		{4, false, []string{"A", "B", "C", "D"}},
+		{5, false, data},
+		{9, false, data},
+		{0, true, nil},
+		{2, true, []string{"D", "E"}},
+		{5, true, data},
+	} {
+		ll := NewTestLL()
+		for _, d := range data {
+			err := ll.PushBack([]byte(d))
+			ok(t, err)
+		}
+		err := ll.SetUnique(true)
+		ok(t, err)
+		var removed int
+		if tc.reverse {
+			removed, err = ll.TruncateFront(tc.n)
+		} else {
+			removed, err = ll.Truncate(tc.n)
+		}
+		ok(t, err)
+		equals(t, len(data)-len(tc.left), removed)
+
+		var forward, backward []string
+		err = ll.ForEach(func(_, data []byte) error {
+			forward = append(forward, string(data))
+			return nil
+		})
+		ok(t, err)
+		equals(t, tc.left, forward)
+		err = ll.ForEachReverse(func(_, data []byte) error {
+			backward = append([]string{string(data)}, backward...)
+			return nil
+		})
+		ok(t, err)
+		equals(t, tc.left, backward)
+		problems, err := ll.ValidateLinks()
+		ok(t, err)
+		equals(t, 0, len(problems))
+		n, err := ll.Len()
+		ok(t, err)
+		equals(t, len(tc.left), n)
+
+		// The removed data is no longer in the unique index
+		err = ll.PushBack([]byte("E"))
+		if len(tc.left) > 0 && tc.left[len(tc.left)-1] == "E" {
+			equals(t, ErrExists, err)
+		} else {
+			ok(t, err)
+			back, err := ll.Back()
+			ok(t, err)
+			equals(t, []byte("E"), back.Data.Value())
+		}
+		ll.Close()
+	}
+
+	ll := NewTestLL()
+	defer ll.Close()
+	_, err := ll.Truncate(-1)
+	equals(t, ErrOutOfRange, err)
+}
+
+func TestRemoveBeforeAfter(t *testing.T) {
+	data := []string{"A", "B", "C", "D", "E"}
+	for _, tc := range []struct {
+		mark   string
+		before bool
+		left   []string
+	}{
+		{"C", false, []string{"A", "B", "C"}},
+		{"A", false, []string{"A"}},
+		{"E", false, data},
+		{"C", true, []string{"C", "D", "E"}},
+		{"E", true, []string{"E"}},
+		{"A", true, data},
+	} {
+		ll := NewTestLL()
+		for _, d := range data {
+			err := ll.PushBack([]byte(d))
+			ok(t, err)
+		}
+		mark, err := ll.Get([]byte(tc.mark))
+		ok(t, err)
+		var removed int
+		if tc.before {
+			removed, err = ll.RemoveBefore(mark)
+		} else {
+			removed, err = ll.RemoveAfter(mark)
+		}
+		ok(t, err)
+		equals(t, len(data)-len(tc.left), removed)
+
+		var forward, backward []string
+		err = ll.ForEach(func(_, data []byte) error {
+			forward = append(forward, string(data))
+			return nil
+		})
+		ok(t, err)
+		equals(t, tc.left, forward)
+		err = ll.ForEachReverse(func(_, data []byte) error {
+			backward = append([]string{string(data)}, backward...)
+			return nil
+		})
+		ok(t, err)
+		equals(t, tc.left, backward)
+		problems, err := ll.ValidateLinks()
+		ok(t, err)
+		equals(t, 0, len(problems))
+
+		// The mark is still valid
+		err = mark.Data.Update([]byte("X"))
+		ok(t, err)
+		if tc.before {
+			assert(t, mark.Prev() == nil, "RemoveBefore expected the mark at the front")
+		} else {
+			assert(t, mark.Next() == nil, "RemoveAfter expected the mark at the back")
+		}
+		ll.Close()
+	}
+
+	ll := NewTestLL()
+	defer ll.Close()
+	err := ll.PushBackAll([][]byte{[]byte("A"), []byte("B")})
+	ok(t, err)
+	mark, err := ll.Front()
+	ok(t, err)
+	err = mark.Data.Remove()
+	ok(t, err)
+	_, err = ll.RemoveAfter(mark)
+	equals(t, ErrStaleItem, err)
+	_, err = ll.RemoveBefore(&Item{})
+	equals(t, ErrInvalidMark, err)
+	_, err = ll.RemoveBefore(nil)
+	assert(t, err != nil, "RemoveBefore expected an error for a nil mark")
+}
+
+func TestPushAll(t *testing.T) {
+	ll := NewTestLL()
+	defer ll.Close()
+
+	err := ll.PushBackAll([][]byte{[]byte("DEF"), []byte("GHI")})
+	ok(t, err)
+	err = ll.PushBackAll([][]byte{[]byte("JKL")})
+	ok(t, err)
+	err = ll.PushFrontAll([][]byte{[]byte("ABC"), []byte("ABD")})
+	ok(t, err)
+	err = ll.PushBackAll(nil)
+	ok(t, err)
+
+	expected := [][]byte{[]byte("ABC"), []byte("ABD"), []byte("DEF"), []byte("GHI"), []byte("JKL")}
+	all, err := ll.GetAll()
+	ok(t, err)
+	equals(t, expected, all)
+	all, err = ll.GetAllReverse()
+	ok(t, err)
+	equals(t, len(expected), len(all))
+	for i := range all {
+		equals(t, expected[len(expected)-1-i], all[i])
+	}
+
+	// Nil data is rejected and nothing is pushed
+	err = ll.PushBackAll([][]byte{[]byte("XYZ"), nil})
+	assert(t, err != nil, "PushBackAll expected an error for nil data")
+	err = ll.PushFrontAll([][]byte{nil})
+	assert(t, err != nil, "PushFrontAll expected an error for nil data")
+	all, err = ll.GetAll()
+	ok(t, err)
+	equals(t, expected, all)
+
+	// Pushing to the front of an empty list
+	empty := NewTestLL()
+	defer empty.Close()
+	err = empty.PushFrontAll([][]byte{[]byte("ABC"), []byte("DEF")})
+	ok(t, err)
+	back, err := empty.Back()
+	ok(t, err)
+	equals(t, []byte("DEF"), back.Data.Value())
+	equals(t, []byte("ABC"), back.Prev().Data.Value())
+}
+
+func TestReverse(t *testing.T) {
+	for _, n := range []int{0, 1, 2, 3, 100} {
+		ll := NewTestLL()
+		err := ll.PushBackAll(benchData(n))
+		ok(t, err)
+		original, err := ll.GetAll()
+		ok(t, err)
+		backward, err := ll.GetAllReverse()
+		ok(t, err)
+
+		err = ll.Reverse()
+		ok(t, err)
+		forward, err := ll.GetAll()
+		ok(t, err)
+		equals(t, backward, forward)
+		problems, err := ll.ValidateLinks()
+		ok(t, err)
+		equals(t, 0, len(problems))
+
+		// Reversing twice gives the original order
+		err = ll.Reverse()
+		ok(t, err)
+		forward, err = ll.GetAll()
+		ok(t, err)
+		equals(t, original, forward)
+		ll.Close()
+	}
+}
+
+func TestRotate(t *testing.T) {
+	for _, size := range []int{0, 1, 2, 3, 5} {
+		for _, n := range []int{0, 1, 2, 3, 4, -1, -2, 11, -11} {
+			ll := NewTestLL()
+			data := benchData(size)
+			err := ll.PushBackAll(data)
+			ok(t, err)
+
+			err = ll.Rotate(n)
+			ok(t, err)
+			var expected [][]byte
+			for i := range data {
+				shift := 0
+				if size > 0 {
+					shift = ((n%size)+size)%size + i
+				}
+				expected = append(expected, data[shift%size])
+			}
+			all, err := ll.GetAll()
+			ok(t, err)
+			equals(t, expected, all)
+			backward, err := ll.GetAllReverse()
+			ok(t, err)
+			for i := range backward {
+				equals(t, expected[len(expected)-1-i], backward[i])
+			}
+			problems, err := ll.ValidateLinks()
+			ok(t, err)
+			equals(t, 0, len(problems))
+			ll.Close()
+		}
+	}
+}
+
+func TestSort(t *testing.T) {
+	ll := NewTestLL()
+	defer ll.Close()
+
+	// Sort by the first letter only, to check that the sort is stable
+	byFirst := func(a, b []byte) bool {
+		return a[0] < b[0]
+	}
+	err := ll.Sort(byFirst)
+	ok(t, err)
+
+	data := [][]byte{[]byte("D1"), []byte("B1"), []byte("A1"), []byte("D2"), []byte("C1"), []byte("B2"), []byte("A2")}
+	err = ll.PushBackAll(data)
+	ok(t, err)
+	err = ll.Sort(byFirst)
+	ok(t, err)
+
+	expected := [][]byte{[]byte("A1"), []byte("A2"), []byte("B1"), []byte("B2"), []byte("C1"), []byte("D1"), []byte("D2")}
+	all, err := ll.GetAll()
+	ok(t, err)
+	equals(t, expected, all)
+	n, err := ll.Len()
+	ok(t, err)
+	equals(t, len(data), n)
+	problems, err := ll.ValidateLinks()
+	ok(t, err)
+	equals(t, 0, len(problems))
+
+	// Sorting in reverse order
+	err = ll.Sort(func(a, b []byte) bool {
+		return bytes.Compare(a, b) > 0
+	})
+	ok(t, err)
+	all, err = ll.GetAllReverse()
+	ok(t, err)
+	equals(t, expected, all)
+
+	err = ll.Sort(nil)
+	assert(t, err != nil, "Sort expected an error for a nil function")
+}
+
+func TestConcat(t *testing.T) {
+	ll := NewTestLL()
+	defer ll.Close()
+	other, err := New(ll.db, "otherLLname")
+	ok(t, err)
+
+	err = ll.PushBackAll([][]byte{[]byte("ABC"), []byte("DEF")})
+	ok(t, err)
+	// More nodes than fit in a single batch
+	data := benchData(2*batchSize + 1)
+	err = other.PushBackAll(data)
+	ok(t, err)
+
+	err = ll.Concat(other)
+	ok(t, err)
+	expected := append([][]byte{[]byte("ABC"), []byte("DEF")}, data...)
+	all, err := ll.GetAll()
+	ok(t, err)
+	equals(t, expected, all)
+	all, err = ll.GetAllReverse()
+	ok(t, err)
+	for i := range all {
+		equals(t, expected[len(expected)-1-i], all[i])
+	}
+	// The other list is left untouched
+	all, err = other.GetAll()
+	ok(t, err)
+	equals(t, data, all)
+
+	// Concatenating onto an empty list, and then clearing the other list
+	empty, err := New(ll.db, "emptyLLname")
+	ok(t, err)
+	err = empty.ConcatAndClear(other)
+	ok(t, err)
+	all, err = empty.GetAll()
+	ok(t, err)
+	equals(t, data, all)
+	n, err := other.Len()
+	ok(t, err)
+	equals(t, 0, n)
+	err = other.PushBack([]byte("GHI"))
+	ok(t, err)
+
+	err = ll.Concat(ll.LinkedList)
+	assert(t, err != nil, "Concat expected an error for the same list")
+	err = ll.Concat(nil)
+	assert(t, err != nil, "Concat expected an error for a nil list")
+}
+
+func TestMergeSorted(t *testing.T) {
+	less := func(x, y []byte) bool {
+		return bytes.Compare(x, y) < 0
+	}
+	toBytes := func(values []string) [][]byte {
+		var items [][]byte
+		for _, value := range values {
+			items = append(items, []byte(value))
+		}
+		return items
+	}
+	for _, tc := range []struct {
+		a, b, merged []string
+	}{
+		{[]string{"a", "c", "e"}, []string{"b", "d", "f"}, []string{"a", "b", "c", "d", "e", "f"}},
+		{[]string{"a", "b", "b"}, []string{"b", "c"}, []string{"a", "b", "b", "b", "c"}},
+		{[]string{"a", "b"}, []string{"x", "y"}, []string{"a", "b", "x", "y"}},
+		{[]string{"x", "y"}, []string{"a", "b"}, []string{"a", "b", "x", "y"}},
+		{nil, []string{"a", "b"}, []string{"a", "b"}},
+		{nil, nil, nil},
+	} {
+		ll := NewTestLL()
+		a, err := New(ll.db, "mergeA")
+		ok(t, err)
+		err = a.PushBackAll(toBytes(tc.a))
+		ok(t, err)
+		b, err := New(ll.db, "mergeB")
+		ok(t, err)
+		err = b.PushBackAll(toBytes(tc.b))
+		ok(t, err)
+
+		err = ll.MergeSorted(a, b, less)
+		ok(t, err)
+		all, err := ll.GetAll()
+		ok(t, err)
+		equals(t, toBytes(tc.merged), all)
+		problems, err := ll.ValidateLinks()
+		ok(t, err)
+		equals(t, 0, len(problems))
+		// The sources are left intact
+		all, err = a.GetAll()
+		ok(t, err)
+		equals(t, toBytes(tc.a), all)
+		all, err = b.GetAll()
+		ok(t, err)
+		equals(t, toBytes(tc.b), all)
+		ll.Close()
+	}
+
+	// More nodes than fit in a single batch, merged into a list with nodes
+	ll := NewTestLL()
+	defer ll.Close()
+	err := ll.PushBack([]byte("first"))
+	ok(t, err)
+	a, err := New(ll.db, "mergeA")
+	ok(t, err)
+	b, err := New(ll.db, "mergeB")
+	ok(t, err)
+	var expected [][]byte
+	for i := 0; i < 2*batchSize+1; i++ {
+		data := []byte(fmt.Sprintf("%06d", i))
+		expected = append(expected, data)
+		if i%3 == 0 {
+			err = a.PushBack(data)
+		} else {
+			err = b.PushBack(data)
+		}
+		ok(t, err)
+	}
+	err = ll.MergeSortedAndClear(a, b, less)
+	ok(t, err)
+	all, err := ll.GetAll()
+	ok(t, err)
+	equals(t, append([][]byte{[]byte("first")}, expected...), all)
+	n, err := a.Len()
+	ok(t, err)
+	equals(t, 0, n)
+	n, err = b.Len()
+	ok(t, err)
+	equals(t, 0, n)
+
+	err = ll.MergeSorted(ll.LinkedList, b, less)
+	assert(t, err != nil, "MergeSorted expected an error for merging into a source")
+	err = ll.MergeSorted(a, nil, less)
+	assert(t, err != nil, "MergeSorted expected an error for a nil list")
+}
+
+func TestSplitAt(t *testing.T) {
+	for _, tc := range []struct {
+		n, at int
+	}{
+		{1, 0},
+		{3, 0},
+		{3, 1},
+		{3, 2},
+		{2*batchSize + 5, 7},
+	} {
+		ll := NewTestLL()
+		data := benchData(tc.n)
+		err := ll.PushBackAll(data)
+		ok(t, err)
+		mark, err := ll.At(tc.at)
+		ok(t, err)
+		tail, err := ll.SplitAt(mark, "tailLLname")
+		ok(t, err)
+
+		for _, list := range []struct {
+			ll       *LinkedList
+			expected [][]byte
+		}{
+			{ll.LinkedList, data[:tc.at]},
+			{tail, data[tc.at:]},
+		} {
+			all, err := list.ll.GetAll()
+			ok(t, err)
+			equals(t, len(list.expected), len(all))
+			for i := range all {
+				equals(t, list.expected[i], all[i])
+			}
+			all, err = list.ll.GetAllReverse()
+			ok(t, err)
+			equals(t, len(list.expected), len(all))
+			for i := range all {
+				equals(t, list.expected[len(list.expected)-1-i], all[i])
+			}
+			problems, err := list.ll.ValidateLinks()
+			ok(t, err)
+			equals(t, 0, len(problems))
+		}
+
+		// Both lists can be modified afterwards
+		err = ll.PushBack([]byte("ABC"))
+		ok(t, err)
+		err = tail.PushBack([]byte("DEF"))
+		ok(t, err)
+		back, err := tail.Back()
+		ok(t, err)
+		equals(t, []byte("DEF"), back.Data.Value())
+
+		// The new bucket must not already exist
+		front, err := ll.Front()
+		ok(t, err)
+		_, err = ll.SplitAt(front, "tailLLname")
+		assert(t, err != nil, "SplitAt expected an error for an existing bucket")
+		ll.Close()
+	}
+}
+
+func TestEqual(t *testing.T) {
+	ll := NewTestLL()
+	defer ll.Close()
+	// A list in another database
+	other := NewTestLL()
+	defer other.Close()
+
+	equal, err := ll.Equal(other.LinkedList)
+	ok(t, err)
+	assert(t, equal, "Equal expected two empty lists to be equal")
+
+	err = ll.PushBackAll([][]byte{[]byte("ABC"), []byte("DEF"), []byte("GHI")})
+	ok(t, err)
+	err = other.PushBackAll([][]byte{[]byte("ABC"), []byte("DEF")})
+	ok(t, err)
+	equal, err = ll.Equal(other.LinkedList)
+	ok(t, err)
+	assert(t, !equal, "Equal expected lists of different lengths to differ")
+	equal, err = other.Equal(ll.LinkedList)
+	ok(t, err)
+	assert(t, !equal, "Equal expected lists of different lengths to differ")
+
+	err = other.PushBack([]byte("GHI"))
+	ok(t, err)
+	equal, err = ll.Equal(other.LinkedList)
+	ok(t, err)
+	assert(t, equal, "Equal expected the lists to be equal")
+
+	// A list in the same database
+	same, err := New(ll.db, "sameLLname")
+	ok(t, err)
+	err = same.PushBackAll([][]byte{[]byte("ABC"), []byte("GHI"), []byte("DEF")})
+	ok(t, err)
+	equal, err = ll.Equal(same)
+	ok(t, err)
+	assert(t, !equal, "Equal expected lists in a different order to differ")
+	err = same.Reverse()
+	ok(t, err)
+	equal, err = ll.Equal(same)
+	ok(t, err)
+	assert(t, !equal, "Equal expected lists in a different order to differ")
+	err = same.Sort(func(a, b []byte) bool {
+		return bytes.Compare(a, b) < 0
+	})
+	ok(t, err)
+	equal, err = ll.Equal(same)
+	ok(t, err)
+	assert(t, equal, "Equal expected the lists to be equal")
+}
+
+func TestCopyTo(t *testing.T) {
+	ll := NewTestLL()
+	defer ll.Close()
+	other := NewTestLL()
+	defer other.Close()
+
+	data := benchData(batchSize + 10)
+	err := ll.PushBackAll(data)
+	ok(t, err)
+
+	copied, err := ll.CopyTo("copyLLname")
+	ok(t, err)
+	copiedElsewhere, err := ll.CopyToDatabase(other.db, "copyLLname")
+	ok(t, err)
+	for _, c := range []*LinkedList{copied, copiedElsewhere} {
+		equal, err := ll.Equal(c)
+		ok(t, err)
+		assert(t, equal, "CopyTo expected the copy to be equal to the original")
+		problems, err := c.ValidateLinks()
+		ok(t, err)
+		equals(t, 0, len(problems))
+	}
+
+	// The copies are independent of the original
+	err = copied.PushBack([]byte("ABC"))
+	ok(t, err)
+	err = copiedElsewhere.PushFront([]byte("DEF"))
+	ok(t, err)
+	front, err := ll.Front()
+	ok(t, err)
+	err = front.Data.Remove()
+	ok(t, err)
+	all, err := ll.GetAll()
+	ok(t, err)
+	equals(t, data[1:], all)
+	all, err = copied.GetAll()
+	ok(t, err)
+	equals(t, append(append([][]byte{}, data...), []byte("ABC")), all)
+	all, err = copiedElsewhere.GetAll()
+	ok(t, err)
+	equals(t, append([][]byte{[]byte("DEF")}, data...), all)
+
+	// The new bucket must not already exist
+	_, err = ll.CopyTo("copyLLname")
+	assert(t, err != nil, "CopyTo expected an error for an existing bucket")
+}
+
+func TestFrontBack(t *testing.T) {
+	ll := NewTestLL()
+	defer ll.Close()
+
+	// PushFront on an empty list, then PushBack
+	err := ll.PushFront([]byte("DEF"))
+	ok(t, err)
+	front, err := ll.Front()
+	ok(t, err)
+	equals(t, []byte("DEF"), front.Data.Value())
+	err = ll.PushBack([]byte("GHI"))
+	ok(t, err)
+	err = ll.PushFront([]byte("ABC"))
+	ok(t, err)
+	front, err = ll.Front()
+	ok(t, err)
+	equals(t, []byte("ABC"), front.Data.Value())
+	back, err := ll.Back()
+	ok(t, err)
+	equals(t, []byte("GHI"), back.Data.Value())
+
+	// Moving the node at the back to the front
+	err = ll.MoveToFront(back)
+	ok(t, err)
+	front, err = ll.Front()
+	ok(t, err)
+	equals(t, []byte("GHI"), front.Data.Value())
+	back, err = ll.Back()
+	ok(t, err)
+	equals(t, []byte("DEF"), back.Data.Value())
+
+	// Moving the node at the front to the back
+	err = ll.MoveToBack(front)
+	ok(t, err)
+	front, err = ll.Front()
+	ok(t, err)
+	equals(t, []byte("ABC"), front.Data.Value())
+	back, err = ll.Back()
+	ok(t, err)
+	equals(t, []byte("GHI"), back.Data.Value())
+	all, err := ll.GetAll()
+	ok(t, err)
+	equals(t, [][]byte{[]byte("ABC"), []byte("DEF"), []byte("GHI")}, all)
+	problems, err := ll.ValidateLinks()
+	ok(t, err)
+	equals(t, 0, len(problems))
+
+	// Removing all the nodes, one at a time
+	for front != nil {
+		err = front.Data.Remove()
+		ok(t, err)
+		front, err = ll.Front()
+		ok(t, err)
+	}
+	back, err = ll.Back()
+	ok(t, err)
+	assert(t, back == nil, "Back expected a nil item for an empty list")
+	err = ll.PushBack([]byte("JKL"))
+	ok(t, err)
+	front, err = ll.Front()
+	ok(t, err)
+	equals(t, []byte("JKL"), front.Data.Value())
+}
+
+func TestMigrateEnds(t *testing.T) {
+	ll := NewTestLL()
+	defer ll.Close()
+
+	err := ll.PushBackAll([][]byte{[]byte("ABC"), []byte("DEF"), []byte("GHI")})
+	ok(t, err)
+	// Remove the keys of the front and the back, like in older versions
+	err = (*bbolt.DB)(ll.db).Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(ll.name)
+		if err := bucket.Delete([]byte("FRONT")); err != nil {
+			return err
+		}
+		return bucket.Delete([]byte("BACK"))
+	})
+	ok(t, err)
+
+	migrated, err := New(ll.db, string(ll.name))
+	ok(t, err)
+	front, err := migrated.Front()
+	ok(t, err)
+	equals(t, []byte("ABC"), front.Data.Value())
+	back, err := migrated.Back()
+	ok(t, err)
+	equals(t, []byte("GHI"), back.Data.Value())
+}
+
+func TestCursor(t *testing.T) {
+	ll := NewTestLL()
+	defer ll.Close()
+
+	c, err := ll.Cursor()
+	ok(t, err)
+	assert(t, !c.Next(), "Next expected false for an empty list")
+	ok(t, c.Close())
+
+	data := [][]byte{[]byte("ABC"), []byte("DEF"), []byte("GHI")}
+	err = ll.PushBackAll(data)
+	ok(t, err)
+
+	c, err = ll.Cursor()
+	ok(t, err)
+	defer c.Close()
+	var forward [][]byte
+	for c.Next() {
+		forward = append(forward, c.Value())
+	}
+	ok(t, c.Err())
+	equals(t, data, forward)
+	assert(t, c.Value() == nil, "Value expected nil past the back of the list")
+
+	c, err = ll.Cursor()
+	ok(t, err)
+	assert(t, c.Prev(), "Prev expected to move to the back of the list")
+	equals(t, []byte("GHI"), c.Value())
+	assert(t, c.Prev(), "Prev expected to move to the previous node")
+	equals(t, []byte("DEF"), c.Value())
+	assert(t, c.Next(), "Next expected to move to the next node")
+	equals(t, []byte("GHI"), c.Value())
+	back, err := ll.Back()
+	ok(t, err)
+	equals(t, back.Key(), c.Key())
+	ok(t, c.Close())
+	ok(t, c.Close())
+	assert(t, !c.Next(), "Next expected false for a closed cursor")
+}
+
+func TestIterator(t *testing.T) {
+	ll := NewTestLL()
+	defer ll.Close()
+
+	it := ll.NewIterator()
+	assert(t, !it.Next(), "Next expected false for an empty list")
+
+	data := benchData(10)
+	err := ll.PushBackAll(data)
+	ok(t, err)
+	for _, chunkSize := range []int{1, 3, 10, iteratorChunkSize} {
+		it = ll.NewIterator()
+		it.chunkSize = chunkSize
+		var forward [][]byte
+		for it.Next() {
+			forward = append(forward, it.Value())
+		}
+		ok(t, it.Err())
+		equals(t, data, forward)
+		assert(t, !it.Skipped(), "Skipped expected false")
+
+		it = ll.NewReverseIterator()
+		it.chunkSize = chunkSize
+		var backward [][]byte
+		for it.Next() {
+			backward = append([][]byte{it.Value()}, backward...)
+		}
+		ok(t, it.Err())
+		equals(t, data, backward)
+	}
+
+	// Removing nodes between chunks
+	for _, remove := range [][]int{{2}, {1, 2}, {0, 1, 2}} {
+		ll := NewTestLL()
+		err := ll.PushBackAll(data)
+		ok(t, err)
+		it := ll.NewIterator()
+		it.chunkSize = 2
+		assert(t, it.Next(), "Next expected to move to the first node")
+		assert(t, it.Next(), "Next expected to move to the second node")
+		equals(t, data[1], it.Value())
+		for _, i := range remove {
+			item, err := ll.Get(data[i])
+			ok(t, err)
+			err = item.Data.Remove()
+			ok(t, err)
+		}
+		var rest [][]byte
+		for it.Next() {
+			rest = append(rest, it.Value())
+		}
+		ok(t, it.Err())
+		assert(t, it.Skipped(), "Skipped expected true after removing nodes")
+		if len(remove) < 3 {
+			equals(t, data[3:], rest)
+		} else {
+			// No node of the previous chunk is left to resume from
+			equals(t, 0, len(rest))
+		}
+		ll.Close()
+	}
+
+	it = ll.NewIterator()
+	assert(t, it.Next(), "Next expected to move to the first node")
+	ok(t, it.Close())
+	assert(t, !it.Next(), "Next expected false for a closed iterator")
+}
+
+func TestStream(t *testing.T) {
+	ll := NewTestLL()
+	defer ll.Close()
+	data := benchData(2*iteratorChunkSize + 1)
+	err := ll.PushBackAll(data)
+	ok(t, err)
+
+	// Draining everything
+	values, errs := ll.Stream(context.Background())
+	var all [][]byte
+	for value := range values {
+		all = append(all, value)
+	}
+	ok(t, <-errs)
+	equals(t, data, all)
+
+	// Cancelling in the middle of the list
+	ctx, cancel := context.WithCancel(context.Background())
+	values, errs = ll.Stream(ctx)
+	for i := 0; i < 10; i++ {
+		equals(t, data[i], <-values)
+	}
+	cancel()
+	// The goroutine stops promptly and closes both channels
+	received := 0
+	for range values {
+		received++
+	}
+	assert(t, received <= 1, "Stream expected to stop after cancellation")
+	equals(t, context.Canceled, <-errs)
+	_, open := <-errs
+	assert(t, !open, "Stream expected the error channel to be closed")
+
+	// The database can be written to, since no transaction is held
+	err = ll.PushBack([]byte("ABC"))
+	ok(t, err)
+}
+
+func TestUpdateValue(t *testing.T) {
+	ll := NewTestLL()
+	defer ll.Close()
+	err := ll.PushBack([]byte("ABC"))
+	ok(t, err)
+	front, err := ll.Front()
+	ok(t, err)
+	data := []byte("DEF")
+	err = front.Data.Update(data)
+	ok(t, err)
+	// The item reflects the write, and keeps a copy of the data
+	equals(t, []byte("DEF"), front.Data.Value())
+	data[0] = 'X'
+	equals(t, []byte("DEF"), front.Data.Value())
+	fetched, err := ll.Get([]byte("DEF"))
+	ok(t, err)
+	equals(t, front.Data.Value(), fetched.Data.Value())
+	// A failed update leaves the value untouched
+	err = front.Data.Update(nil)
+	assert(t, err != nil, "Update expected an error for nil data")
+	equals(t, []byte("DEF"), front.Data.Value())
+}
+
+func TestStaleItem(t *testing.T) {
+	ll := NewTestLL()
+	defer ll.Close()
+	err := ll.PushBackAll([][]byte{[]byte("ABC"), []byte("DEF"), []byte("GHI")})
+	ok(t, err)
+
+	// Removing the same item twice
+	def, err := ll.Get([]byte("DEF"))
+	ok(t, err)
+	err = def.Data.Remove()
+	ok(t, err)
+	equals(t, ErrStaleItem, def.Data.Remove())
+	equals(t, ErrStaleItem, def.Data.Update([]byte("XYZ")))
+	_, err = def.NextItem()
+	equals(t, ErrStaleItem, err)
+	_, err = def.PrevItem()
+	equals(t, ErrStaleItem, err)
+	assert(t, def.Next() == nil, "Next expected nil for a stale item")
+	assert(t, def.Prev() == nil, "Prev expected nil for a stale item")
+	equals(t, ErrStaleItem, ll.InsertAfter([]byte("XYZ"), def))
+	equals(t, ErrStaleItem, ll.InsertBefore([]byte("XYZ"), def))
+
+	// Removing a node while another item for it is held
+	ghi, err := ll.Get([]byte("GHI"))
+	ok(t, err)
+	held, err := ll.Get([]byte("GHI"))
+	ok(t, err)
+	err = ghi.Data.Remove()
+	ok(t, err)
+	equals(t, ErrStaleItem, held.Data.Update([]byte("XYZ")))
+	equals(t, ErrStaleItem, held.Data.Remove())
+	_, err = held.NextItem()
+	equals(t, ErrStaleItem, err)
+	assert(t, held.Prev() == nil, "Prev expected nil for a stale item")
+	_, err = ll.GetNext([]byte("ABC"), held)
+	equals(t, ErrStaleItem, err)
+	_, err = ll.GetPrev([]byte("ABC"), held)
+	equals(t, ErrStaleItem, err)
+	equals(t, ErrStaleItem, ll.MoveToFront(held))
+	equals(t, ErrStaleItem, ll.MoveToBack(held))
+	equals(t, ErrStaleItem, ll.InsertAfter([]byte("XYZ"), held))
+	equals(t, ErrStaleItem, ll.InsertBefore([]byte("XYZ"), held))
+
+	// The remaining item still works
+	abc, err := ll.Front()
+	ok(t, err)
+	next, err := abc.NextItem()
+	ok(t, err)
+	assert(t, next == nil, "NextItem expected nil at the back of the list")
+	err = abc.Data.Update([]byte("XYZ"))
+	ok(t, err)
+}
+
+func TestTyped(t *testing.T) {
+	ll := NewTestLL()
+	defer ll.Close()
+
+	// Stores numbers as decimal strings
+	decimal := codec.Funcs[int]{
+		MarshalFunc: func(n int) ([]byte, error) {
+			return []byte(fmt.Sprint(n)), nil
+		},
+		UnmarshalFunc: func(data []byte) (n int, err error) {
+			_, err = fmt.Sscan(string(data), &n)
+			return n, err
+		},
+	}
+	typed := NewTyped[int](ll.LinkedList, decimal)
+	front, err := typed.Front()
+	ok(t, err)
+	assert(t, front == nil, "Front expected nil for an empty list")
+
+	for _, n := range []int{2, 3, 5} {
+		err = typed.PushBack(n)
+		ok(t, err)
+	}
+	err = typed.PushFront(1)
+	ok(t, err)
+	all, err := typed.GetAll()
+	ok(t, err)
+	equals(t, []int{1, 2, 3, 5}, all)
+
+	three, err := typed.GetFunc(func(n int) bool {
+		return n > 2
+	})
+	ok(t, err)
+	equals(t, 3, three.Value)
+	err = typed.InsertAfter(4, three)
+	ok(t, err)
+	next, err := three.Next()
+	ok(t, err)
+	equals(t, 4, next.Value)
+	prev, err := three.Prev()
+	ok(t, err)
+	equals(t, 2, prev.Value)
+	err = three.Update(30)
+	ok(t, err)
+	err = prev.Remove()
+	ok(t, err)
+	all, err = typed.GetAll()
+	ok(t, err)
+	equals(t, []int{1, 30, 4, 5}, all)
+
+	// Decoding errors are reported for the node that could not be decoded
+	err = ll.PushBack([]byte("six"))
+	ok(t, err)
+	back, err := ll.Back()
+	ok(t, err)
+	_, err = typed.GetAll()
+	var decodeErr *DecodeError
+	assert(t, errors.As(err, &decodeErr), "GetAll expected a DecodeError")
+	equals(t, back.Key(), decodeErr.Key)
+	equals(t, "tempLLname", decodeErr.ID)
+	_, err = typed.Back()
+	assert(t, errors.As(err, &decodeErr), "Back expected a DecodeError")
+	equals(t, "tempLLname", decodeErr.ID)
+	one, err := typed.GetFunc(func(n int) bool {
+		return n == 1
+	})
+	ok(t, err)
+	equals(t, 1, one.Value)
+}
+
+func TestTypedCodec(t *testing.T) {
+	ll := NewTestLL()
+	defer ll.Close()
+	type point struct{ X, Y int }
+	// The codecs of the codec package can be used directly
+	typed := NewTyped[point](ll.LinkedList, codec.JSONCodec[point]{})
+	ok(t, typed.PushBack(point{1, 2}))
+	ok(t, typed.PushBack(point{3, 4}))
+	all, err := typed.GetAll()
+	ok(t, err)
+	equals(t, []point{{1, 2}, {3, 4}}, all)
+	data, err := ll.GetAll()
+	ok(t, err)
+	equals(t, []byte(`{"X":1,"Y":2}`), data[0])
+}
+
+func TestNodeCodec(t *testing.T) {
+	for _, node := range []*pb.LinkedListNode{
+		{},
+		{Data: []byte("ABC")},
+		{Data: []byte("ABC"), Next: byteID(2)},
+		{Data: []byte("ABC"), Prev: byteID(1)},
+		{Data: []byte("ABC"), Next: byteID(3), Prev: byteID(1)},
+		{Next: byteID(3), Prev: byteID(1)},
+		{Data: []byte("ABC"), Next: byteID(3), Prev: byteID(1), Version: 7},
+		{Version: 1 << 40},
+	} {
+		nodeBytes, err := marshalNode(nil, node)
+		ok(t, err)
+		assert(t, isCompact(nodeBytes), "marshalNode expected the compact encoding")
+		decoded := &pb.LinkedListNode{}
+		err = unmarshalNode(nil, nodeBytes, decoded)
+		ok(t, err)
+		equals(t, node.GetData(), decoded.GetData())
+		equals(t, node.GetNext(), decoded.GetNext())
+		equals(t, node.GetPrev(), decoded.GetPrev())
+		equals(t, node.GetVersion(), decoded.GetVersion())
+		if node.GetVersion() == 0 {
+			// Nodes without a version are encoded like before versions were introduced
+			equals(t, compactDataOffset+len(node.GetData()), len(nodeBytes))
+		}
+
+		// Nodes written by earlier versions
+		legacyBytes, err := proto.Marshal(node)
+		ok(t, err)
+		assert(t, !isCompact(legacyBytes), "proto.Marshal expected not to look compact")
+		decoded = &pb.LinkedListNode{}
+		err = unmarshalNode(nil, legacyBytes, decoded)
+		ok(t, err)
+		equals(t, node.GetData(), decoded.GetData())
+		equals(t, node.GetNext(), decoded.GetNext())
+		equals(t, node.GetPrev(), decoded.GetPrev())
+		equals(t, node.GetVersion(), decoded.GetVersion())
+	}
+}
+
+func TestMigrateEncoding(t *testing.T) {
+	ll := NewTestLL()
+	defer ll.Close()
+	data := benchData(10)
+	err := ll.PushBackAll(data)
+	ok(t, err)
+	// Rewrite every other node with the encoding of earlier versions
+	err = (*bbolt.DB)(ll.db).Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(ll.name)
+		i := 0
+		return walk(bucket, false, func(key []byte, node *pb.LinkedListNode) error {
+			defer func() { i++ }()
+			if i%2 == 1 {
+				return nil
+			}
+			nodeBytes, err := proto.Marshal(node)
+			if err != nil {
+				return err
+			}
+			return bucket.Put(copyKey(key), nodeBytes)
+		})
+	})
+	ok(t, err)
+
+	// Nodes with both encodings can be read and modified
+	all, err := ll.GetAll()
+	ok(t, err)
+	equals(t, data, all)
+	all, err = ll.GetAllReverse()
+	ok(t, err)
+	equals(t, len(data), len(all))
+	front, err := ll.Front()
+	ok(t, err)
+	err = front.Data.Update([]byte("ABC"))
+	ok(t, err)
+
+	migrated, err := ll.MigrateEncoding()
+	ok(t, err)
+	equals(t, 4, migrated)
+	migrated, err = ll.MigrateEncoding()
+	ok(t, err)
+	equals(t, 0, migrated)
+	all, err = ll.GetAll()
+	ok(t, err)
+	equals(t, append([][]byte{[]byte("ABC")}, data[1:]...), all)
+	problems, err := ll.ValidateLinks()
+	ok(t, err)
+	equals(t, 0, len(problems))
+}
+
+func TestExportJSON(t *testing.T) {
+	ll := NewTestLL()
+	defer ll.Close()
+	err := ll.PushBackAll([][]byte{[]byte("a"), []byte("b"), {0xff, 0x00}, []byte("c")})
+	ok(t, err)
+	// The export follows the links, not the order of the keys
+	back, err := ll.Back()
+	ok(t, err)
+	err = ll.MoveToFront(back)
+	ok(t, err)
+
+	var buf bytes.Buffer
+	err = ll.ExportJSON(&buf)
+	ok(t, err)
+	golden, err := ioutil.ReadFile(filepath.Join("testdata", "export.golden"))
+	ok(t, err)
+	equals(t, string(golden), buf.String())
+
+	buf.Reset()
+	err = ll.ExportJSONWith(&buf, func(data []byte) (interface{}, error) {
+		return map[string]int{"length": len(data)}, nil
+	})
+	ok(t, err)
+	golden, err = ioutil.ReadFile(filepath.Join("testdata", "export_with.golden"))
+	ok(t, err)
+	equals(t, string(golden), buf.String())
+
+	// The error returned by the conversion function stops the export
+	errConvert := errors.New("conversion failed")
+	err = ll.ExportJSONWith(&buf, func(data []byte) (interface{}, error) {
+		return nil, errConvert
+	})
+	assert(t, errors.Is(err, errConvert), "expected the conversion error, got %v", err)
+}
+
+func TestReplaceAll(t *testing.T) {
+	ll := NewTestLL()
+	defer ll.Close()
+	data := benchData(5)
+	err := ll.PushBackAll(data)
+	ok(t, err)
+	front, err := ll.Front()
+	ok(t, err)
+
+	// A failed replacement leaves the list intact
+	err = ll.ReplaceAll([][]byte{[]byte("A"), nil, []byte("C")})
+	assert(t, err != nil, "ReplaceAll expected an error for nil data")
+	errInjected := errors.New("injected failure")
+	err = (*bbolt.DB)(ll.db).Update(func(tx *bbolt.Tx) error {
+		if err := replaceAll(tx.Bucket(ll.name), nil, [][]byte{[]byte("A")}); err != nil {
+			return err
+		}
+		return errInjected
+	})
+	equals(t, errInjected, err)
+	all, err := ll.GetAll()
+	ok(t, err)
+	equals(t, data, all)
+
+	replacement := [][]byte{[]byte("A"), []byte("B"), []byte("C")}
+	err = ll.ReplaceAll(replacement)
+	ok(t, err)
+	all, err = ll.GetAll()
+	ok(t, err)
+	equals(t, replacement, all)
+	all, err = ll.GetAllReverse()
+	ok(t, err)
+	equals(t, [][]byte{[]byte("C"), []byte("B"), []byte("A")}, all)
+	// The keys of the removed nodes are not reused
+	err = front.Data.Update([]byte("X"))
+	assert(t, errors.Is(err, ErrStaleItem), "expected ErrStaleItem, got %v", err)
+
+	err = ll.ReplaceAll(nil)
+	ok(t, err)
+	n, err := ll.Len()
+	ok(t, err)
+	equals(t, 0, n)
+	err = ll.PushBack([]byte("D"))
+	ok(t, err)
+	all, err = ll.GetAll()
+	ok(t, err)
+	equals(t, [][]byte{[]byte("D")}, all)
+}
+
+func TestImportJSON(t *testing.T) {
+	ll := NewTestLL()
+	defer ll.Close()
+	data := [][]byte{[]byte("c"), []byte("a"), {0xff, 0x00}, []byte("")}
+	err := ll.PushBackAll(data)
+	ok(t, err)
+	var buf bytes.Buffer
+	err = ll.ExportJSON(&buf)
+	ok(t, err)
+
+	imported := NewTestLL()
+	defer imported.Close()
+	err = imported.PushBack([]byte("old"))
+	ok(t, err)
+	err = imported.ImportJSON(bytes.NewReader(buf.Bytes()))
+	ok(t, err)
+	all, err := imported.GetAll()
+	ok(t, err)
+	equals(t, data, all)
+
+	// A failing import leaves the list intact
+	for _, invalid := range []string{
+		`[{"key": 1, "data": "a"}, {"key": 2, "data": "!", "encoding": "base64"}]`,
+		`[{"key": 1, "data": "a"}, {"key": 2, "data": "a", "encoding": "rot13"}]`,
+		`[{"key": 1, "data": "a"}, {"key": 2, "data": {"length": 1}}]`,
+		`[{"key": 1, "data": "a"}, {"key": 2}]`,
+		`[{"key": 1, "data": "a"}`,
+	} {
+		err = imported.ImportJSON(strings.NewReader(invalid))
+		assert(t, err != nil, "ImportJSON expected an error for %s", invalid)
+		all, err = imported.GetAll()
+		ok(t, err)
+		equals(t, data, all)
+	}
+}
+
+func TestUnique(t *testing.T) {
+	ll := NewTestLL()
+	defer ll.Close()
+	err := ll.PushBackAll([][]byte{[]byte("A"), []byte("B"), []byte("A")})
+	ok(t, err)
+	// The mode can not be turned on while there are duplicates
+	err = ll.SetUnique(true)
+	assert(t, errors.Is(err, ErrExists), "expected ErrExists, got %v", err)
+	unique, err := ll.IsUnique()
+	ok(t, err)
+	assert(t, !unique, "the linked list should not be in unique mode")
+	back, err := ll.Back()
+	ok(t, err)
+	err = back.Data.Remove()
+	ok(t, err)
+	err = ll.SetUnique(true)
+	ok(t, err)
+	unique, err = ll.IsUnique()
+	ok(t, err)
+	assert(t, unique, "the linked list should be in unique mode")
+
+	err = ll.PushBack([]byte("A"))
+	assert(t, errors.Is(err, ErrExists), "PushBack expected ErrExists, got %v", err)
+	err = ll.PushFront([]byte("B"))
+	assert(t, errors.Is(err, ErrExists), "PushFront expected ErrExists, got %v", err)
+	front, err := ll.Front()
+	ok(t, err)
+	err = ll.InsertAfter([]byte("B"), front)
+	assert(t, errors.Is(err, ErrExists), "InsertAfter expected ErrExists, got %v", err)
+	err = ll.InsertBefore([]byte("B"), front)
+	assert(t, errors.Is(err, ErrExists), "InsertBefore expected ErrExists, got %v", err)
+	err = front.Data.Update([]byte("B"))
+	assert(t, errors.Is(err, ErrExists), "Update expected ErrExists, got %v", err)
+	// Nothing is pushed if there are duplicates among the new data
+	err = ll.PushBackAll([][]byte{[]byte("C"), []byte("D"), []byte("C")})
+	assert(t, errors.Is(err, ErrExists), "PushBackAll expected ErrExists, got %v", err)
+	all, err := ll.GetAll()
+	ok(t, err)
+	equals(t, [][]byte{[]byte("A"), []byte("B")}, all)
+
+	// Updated and removed data can be inserted again
+	err = front.Data.Update([]byte("C"))
+	ok(t, err)
+	err = front.Data.Update([]byte("C"))
+	ok(t, err)
+	err = ll.PushBack([]byte("A"))
+	ok(t, err)
+	n, err := ll.RemoveFunc(func(data []byte) bool {
+		return bytes.Equal(data, []byte("B"))
+	})
+	ok(t, err)
+	equals(t, 1, n)
+	err = ll.InsertAfter([]byte("B"), front)
+	ok(t, err)
+	all, err = ll.GetAll()
+	ok(t, err)
+	equals(t, [][]byte{[]byte("C"), []byte("B"), []byte("A")}, all)
+	err = ll.ReplaceAll([][]byte{[]byte("A"), []byte("A")})
+	assert(t, errors.Is(err, ErrExists), "ReplaceAll expected ErrExists, got %v", err)
+	err = ll.ReplaceAll([][]byte{[]byte("D")})
+	ok(t, err)
+	err = ll.PushBack([]byte("C"))
+	ok(t, err)
+
+	// Nodes moved to another linked list are no longer indexed
+	back, err = ll.Back()
+	ok(t, err)
+	split, err := ll.SplitAt(back, "unique_split")
+	ok(t, err)
+	unique, err = split.IsUnique()
+	ok(t, err)
+	assert(t, !unique, "the new linked list should not be in unique mode")
+	err = ll.PushBack([]byte("C"))
+	ok(t, err)
+
+	err = ll.SetUnique(false)
+	ok(t, err)
+	err = ll.PushBack([]byte("C"))
+	ok(t, err)
+	all, err = ll.GetAll()
+	ok(t, err)
+	equals(t, [][]byte{[]byte("D"), []byte("C"), []byte("C")}, all)
+}
+
+func TestUniqueReserved(t *testing.T) {
+	ll := NewTestLL()
+	defer ll.Close()
+	_, err := New(ll.db, "tempLLname"+uniqueSuffix)
+	assert(t, errors.Is(err, ErrReservedID), "expected ErrReservedID, got %v", err)
+	_, err = ll.CopyTo("copy" + uniqueSuffix)
+	assert(t, errors.Is(err, ErrReservedID), "expected ErrReservedID, got %v", err)
+
+	// A bucket with the name of the unique index, that SetUnique did not
+	// create, does not turn the unique mode on and is left as it is
+	err = (*bbolt.DB)(ll.db).Update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucket(uniqueName(ll.name))
+		if err != nil {
+			return err
+		}
+		return bucket.Put(uniqueKey([]byte("A")), []byte("user data"))
+	})
+	ok(t, err)
+	unique, err := ll.IsUnique()
+	ok(t, err)
+	assert(t, !unique, "the linked list should not be in unique mode")
+	err = ll.PushBackAll([][]byte{[]byte("A"), []byte("A")})
+	ok(t, err)
+	err = ll.ReplaceAll([][]byte{[]byte("B")})
+	ok(t, err)
+	err = ll.SetUnique(true)
+	assert(t, err != nil, "expected the unique index not to be created in the existing bucket")
+	err = ll.SetUnique(false)
+	ok(t, err)
+	err = (*bbolt.DB)(ll.db).View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(uniqueName(ll.name))
+		assert(t, bucket != nil, "the bucket was removed")
+		equals(t, []byte("user data"), bucket.Get(uniqueKey([]byte("A"))))
+		return nil
+	})
+	ok(t, err)
+}
+
+func TestUniqueConcurrent(t *testing.T) {
+	ll := NewTestLL()
+	defer ll.Close()
+	err := ll.SetUnique(true)
+	ok(t, err)
+	const workers, values = 8, 50
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Every worker tries to push the same values
+			for i := 0; i < values; i++ {
+				if err := ll.PushBack([]byte(fmt.Sprintf("item%d", i))); err != nil && !errors.Is(err, ErrExists) {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	all, err := ll.GetAll()
+	ok(t, err)
+	equals(t, values, len(all))
+	seen := make(map[string]bool)
+	for _, data := range all {
+		assert(t, !seen[string(data)], "duplicated data %s", data)
+		seen[string(data)] = true
+	}
+}
+
+func TestInsertSorted(t *testing.T) {
+	ll := NewTestLL()
+	defer ll.Close()
+	less := func(a, b []byte) bool {
+		return bytes.Compare(a, b) < 0
+	}
+	// Insert the values in a shuffled order, including duplicates
+	const n = 50
+	for i := 0; i < 2*n; i++ {
+		err := ll.InsertSorted([]byte(fmt.Sprintf("%02d", (i*7)%n)), less)
+		ok(t, err)
+	}
+	all, err := ll.GetAll()
+	ok(t, err)
+	equals(t, 2*n, len(all))
+	for i := 1; i < len(all); i++ {
+		assert(t, !less(all[i], all[i-1]), "the linked list is not sorted at %d: %s %s", i, all[i-1], all[i])
+	}
+	reversed, err := ll.GetAllReverse()
+	ok(t, err)
+	for i := range reversed {
+		equals(t, all[len(all)-1-i], reversed[i])
+	}
+
+	// Equal data is inserted after the existing data
+	front, err := ll.Front()
+	ok(t, err)
+	err = ll.InsertSorted([]byte("00"), less)
+	ok(t, err)
+	next, err := front.NextItem()
+	ok(t, err)
+	next, err = next.NextItem()
+	ok(t, err)
+	equals(t, []byte("00"), next.Data.Value())
+	assert(t, next.Key()[7] == 2*n+1, "expected the new node after the existing ones")
+	next, err = next.NextItem()
+	ok(t, err)
+	equals(t, []byte("01"), next.Data.Value())
+
+	err = ll.InsertSorted(nil, less)
+	assert(t, err != nil, "InsertSorted expected an error for nil data")
+	err = ll.InsertSorted([]byte("00"), nil)
+	assert(t, err != nil, "InsertSorted expected an error for a nil function")
+}
+
+func TestInsertAtKey(t *testing.T) {
+	ll := NewTestLL()
+	defer ll.Close()
+	err := ll.PushBackAll([][]byte{[]byte("B"), []byte("D")})
+	ok(t, err)
+	front, err := ll.Front()
+	ok(t, err)
+	back, err := ll.Back()
+	ok(t, err)
+	frontKey, backKey := front.Key(), back.Key()
+
+	// Insert in the middle, and at both ends
+	ok(t, ll.InsertAfterKey([]byte("C"), frontKey))
+	ok(t, ll.InsertBeforeKey([]byte("A"), frontKey))
+	ok(t, ll.InsertAfterKey([]byte("E"), backKey))
+	all, err := ll.GetAll()
+	ok(t, err)
+	equals(t, [][]byte{[]byte("A"), []byte("B"), []byte("C"), []byte("D"), []byte("E")}, all)
+	reversed, err := ll.GetAllReverse()
+	ok(t, err)
+	equals(t, [][]byte{[]byte("E"), []byte("D"), []byte("C"), []byte("B"), []byte("A")}, reversed)
+	problems, err := ll.ValidateLinks()
+	ok(t, err)
+	equals(t, 0, len(problems))
+
+	// The key of a removed node can not be used
+	ok(t, front.Data.Remove())
+	err = ll.InsertAfterKey([]byte("F"), frontKey)
+	assert(t, errors.Is(err, ErrDoesNotExist), "expected ErrDoesNotExist, got %v", err)
+	err = ll.InsertBeforeKey([]byte("F"), []byte("FRONT"))
+	assert(t, errors.Is(err, ErrDoesNotExist), "expected ErrDoesNotExist, got %v", err)
+	err = ll.InsertBeforeKey(nil, backKey)
+	assert(t, errors.Is(err, ErrEmptyData), "expected ErrEmptyData, got %v", err)
+}
+
+func TestAt(t *testing.T) {
+	ll := NewTestLL()
+	defer ll.Close()
+
+	n, err := ll.Len()
+	ok(t, err)
+	equals(t, 0, n)
+	_, err = ll.At(0)
+	equals(t, ErrOutOfRange, err)
+
+	data := []string{"A", "B", "C", "D", "E", "F", "G"}
+	for _, d := range data {
+		err = ll.PushBack([]byte(d))
+		ok(t, err)
+	}
+	// Reorder the list, so that it no longer follows the key order
+	c, err := ll.Get([]byte("C"))
+	ok(t, err)
+	err = ll.MoveToFront(c)
+	ok(t, err)
+	data = []string{"C", "A", "B", "D", "E", "F", "G"}
+
+	n, err = ll.Len()
+	ok(t, err)
+	equals(t, len(data), n)
+	for i, d := range data {
+		it, err := ll.At(i)
+		ok(t, err)
+		equals(t, []byte(d), it.Data.Value())
+		it, err = ll.At(i - len(data))
+		ok(t, err)
+		equals(t, []byte(d), it.Data.Value())
+	}
+	_, err = ll.At(len(data))
+	equals(t, ErrOutOfRange, err)
+	_, err = ll.At(-len(data) - 1)
+	equals(t, ErrOutOfRange, err)
+
+	for _, tc := range []struct {
+		from, to int
+		expected []string
+	}{
+		{0, 3, []string{"C", "A", "B"}},
+		{2, 4, []string{"B", "D"}},
+		{5, 7, []string{"F", "G"}},
+		{-3, -1, []string{"E", "F"}},
+		{3, 3, nil},
+		{0, 7, data},
+	} {
+		items, err := ll.Slice(tc.from, tc.to)
+		ok(t, err)
+		var values []string
+		for _, it := range items {
+			values = append(values, string(it.Data.Value()))
+		}
+		equals(t, tc.expected, values)
+	}
+	_, err = ll.Slice(3, 2)
+	equals(t, ErrOutOfRange, err)
+	_, err = ll.Slice(0, 8)
+	equals(t, ErrOutOfRange, err)
+}
+
+func TestIndexOf(t *testing.T) {
+	ll := NewTestLL()
+	defer ll.Close()
+
+	err := ll.PushBackAll([][]byte{[]byte("ABC"), []byte("DEF"), []byte("GHI")})
+	ok(t, err)
+	ghi, err := ll.Get([]byte("GHI"))
+	ok(t, err)
+	index, err := ll.IndexOf(ghi)
+	ok(t, err)
+	equals(t, 2, index)
+
+	err = ll.MoveToFront(ghi)
+	ok(t, err)
+	index, err = ll.IndexOf(ghi)
+	ok(t, err)
+	equals(t, 0, index)
+
+	def, err := ll.Get([]byte("DEF"))
+	ok(t, err)
+	index, err = ll.IndexOf(def)
+	ok(t, err)
+	equals(t, 2, index)
+
+	// The node no longer exists
+	removed, err := ll.Get([]byte("DEF"))
+	ok(t, err)
+	err = removed.Data.Remove()
+	ok(t, err)
+	_, err = ll.IndexOf(def)
+	equals(t, ErrDoesNotExist, err)
+
+	// Items of other lists are rejected
+	other := NewTestLL()
+	defer other.Close()
+	err = other.PushBack([]byte("ABC"))
+	ok(t, err)
+	front, err := other.Front()
+	ok(t, err)
+	_, err = ll.IndexOf(front)
+	assert(t, err != nil, "IndexOf expected an error for an item of another list")
+	_, err = ll.IndexOf(nil)
+	assert(t, err != nil, "IndexOf expected an error for a nil item")
+}
+
+// corrupt modifies the node with the given key directly in Bolt
+func corrupt(t *testing.T, ll *TestLL, key []byte, modify func(node *pb.LinkedListNode)) {
+	err := (*bbolt.DB)(ll.db).Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(ll.name)
+		node, err := getNode(bucket, key)
+		if err != nil {
+			return err
+		}
+		modify(node)
+		return putNode(bucket, key, node)
+	})
+	ok(t, err)
+}
+
+func TestExportNodes(t *testing.T) {
+	ll := NewTestLL()
+	defer ll.Close()
+	err := ll.PushBackAll([][]byte{[]byte("ABC"), []byte("DEF"), []byte(""), []byte("GHI")})
+	ok(t, err)
+	back, err := ll.Back()
+	ok(t, err)
+	err = ll.MoveToFront(back)
+	ok(t, err)
+	// Break a link, which must be kept by the round trip
+	back, err = ll.Back()
+	ok(t, err)
+	corrupt(t, ll, back.Key(), func(node *pb.LinkedListNode) {
+		node.Prev = byteID(42)
+	})
+	problems, err := ll.ValidateLinks()
+	ok(t, err)
+	assert(t, len(problems) > 0, "expected a broken link")
+
+	var dump bytes.Buffer
+	err = ll.ExportNodes(&dump)
+	ok(t, err)
+	imported := NewTestLL()
+	defer imported.Close()
+	err = imported.PushBack([]byte("old"))
+	ok(t, err)
+	err = imported.ImportNodes(bytes.NewReader(dump.Bytes()))
+	ok(t, err)
+
+	// The structure is exactly the same
+	var again bytes.Buffer
+	err = imported.ExportNodes(&again)
+	ok(t, err)
+	equals(t, dump.Bytes(), again.Bytes())
+	importedProblems, err := imported.ValidateLinks()
+	ok(t, err)
+	equals(t, problems, importedProblems)
+	all, err := ll.GetAll()
+	ok(t, err)
+	importedAll, err := imported.GetAll()
+	ok(t, err)
+	equals(t, all, importedAll)
+	// New keys continue from the same sequence
+	err = imported.PushFront([]byte("JKL"))
+	ok(t, err)
+	front, err := imported.Front()
+	ok(t, err)
+	equals(t, byteID(5), front.Key())
+
+	// A truncated dump leaves the linked list intact
+	for _, n := range []int{0, 3, len(dumpMagic) + 1, dump.Len() - 1} {
+		err = ll.ImportNodes(bytes.NewReader(dump.Bytes()[:n]))
+		assert(t, err != nil, "ImportNodes expected an error for %d bytes", n)
+		again.Reset()
+		err = ll.ExportNodes(&again)
+		ok(t, err)
+		equals(t, dump.Bytes(), again.Bytes())
+	}
+}
+
+func TestValidateLinks(t *testing.T) {
+	data := [][]byte{[]byte("ABC"), []byte("DEF"), []byte("GHI"), []byte("JKL")}
+	for _, tc := range []struct {
+		name     string
+		corrupt  func(ll *TestLL, keys map[string][]byte)
+		expected [][]byte
+	}{
+		{
+			name:     "healthy",
+			corrupt:  func(ll *TestLL, keys map[string][]byte) {},
+			expected: data,
+		},
+		{
+			name: "dangling next",
+			corrupt: func(ll *TestLL, keys map[string][]byte) {
+				corrupt(t, ll, keys["DEF"], func(node *pb.LinkedListNode) {
+					node.Next = byteID(99)
+				})
+			},
+			expected: data,
+		},
+		{
+			name: "dangling prev",
+			corrupt: func(ll *TestLL, keys map[string][]byte) {
+				corrupt(t, ll, keys["GHI"], func(node *pb.LinkedListNode) {
+					node.Prev = byteID(99)
+				})
+			},
+			expected: data,
+		},
+		{
+			name: "cycle",
+			corrupt: func(ll *TestLL, keys map[string][]byte) {
+				corrupt(t, ll, keys["JKL"], func(node *pb.LinkedListNode) {
+					node.Next = keys["ABC"]
+				})
+			},
+			expected: data,
+		},
+		{
+			name: "orphan",
+			corrupt: func(ll *TestLL, keys map[string][]byte) {
+				// Unlink DEF from the list, keeping its own links
+				corrupt(t, ll, keys["ABC"], func(node *pb.LinkedListNode) {
+					node.Next = nil
+				})
+				corrupt(t, ll, keys["GHI"], func(node *pb.LinkedListNode) {
+					node.Prev = nil
+				})
+			},
+			expected: data,
+		},
+		{
+			name: "missing front",
+			corrupt: func(ll *TestLL, keys map[string][]byte) {
+				err := (*bbolt.DB)(ll.db).Update(func(tx *bbolt.Tx) error {
+					return tx.Bucket(ll.name).Delete([]byte("FRONT"))
+				})
+				ok(t, err)
+			},
+			expected: data,
+		},
+		{
+			name: "removed node",
+			corrupt: func(ll *TestLL, keys map[string][]byte) {
+				err := (*bbolt.DB)(ll.db).Update(func(tx *bbolt.Tx) error {
+					return tx.Bucket(ll.name).Delete(keys["GHI"])
+				})
+				ok(t, err)
+			},
+			expected: [][]byte{[]byte("ABC"), []byte("DEF"), []byte("JKL")},
+		},
+	} {
+		ll := NewTestLL()
+		err := ll.PushBackAll(data)
+		ok(t, err)
+		keys := make(map[string][]byte)
+		err = ll.ForEach(func(key, data []byte) error {
+			keys[string(data)] = append([]byte{}, key...)
+			return nil
+		})
+		ok(t, err)
+		tc.corrupt(ll, keys)
+
+		problems, err := ll.ValidateLinks()
+		ok(t, err)
+		if tc.name == "healthy" {
+			assert(t, len(problems) == 0, "%s: unexpected problems: %v", tc.name, problems)
+		} else {
+			assert(t, len(problems) > 0, "%s: expected problems", tc.name)
+		}
+
+		err = ll.Repair()
+		ok(t, err)
+		problems, err = ll.ValidateLinks()
+		ok(t, err)
+		assert(t, len(problems) == 0, "%s: problems after repair: %v", tc.name, problems)
+
+		all, err := ll.GetAll()
+		ok(t, err)
+		equals(t, tc.expected, all)
+		all, err = ll.GetAllReverse()
+		ok(t, err)
+		equals(t, len(tc.expected), len(all))
+		ll.Close()
+	}
+}
+
+// newBenchLL returns a linked list with n nodes, for benchmarking
+func newBenchLL(b *testing.B, n int) *TestLL {
+	ll := NewTestLL()
+	if err := ll.PushBackAll(benchData(n)); err != nil {
+		b.Fatal(err)
+	}
+	return ll
+}
+
+func TestItemVersion(t *testing.T) {
+	ll := NewTestLL()
+	defer ll.Close()
+	err := ll.PushBackAll([][]byte{[]byte("a"), []byte("b"), []byte("c")})
+	ok(t, err)
+
+	// Two workers retrieve the same node
+	first, err := ll.Get([]byte("b"))
+	ok(t, err)
+	second, err := ll.Get([]byte("b"))
+	ok(t, err)
+	equals(t, uint64(0), first.Version())
+
+	err = first.UpdateIfUnchanged([]byte("b1"))
+	ok(t, err)
+	equals(t, uint64(1), first.Version())
+	equals(t, []byte("b1"), first.Data.Value())
+
+	// The second worker has an outdated version
+	err = second.UpdateIfUnchanged([]byte("b2"))
+	equals(t, ErrConflict, err)
+	err = second.RemoveIfUnchanged()
+	equals(t, ErrConflict, err)
+	all, err := ll.GetAll()
+	ok(t, err)
+	equals(t, [][]byte{[]byte("a"), []byte("b1"), []byte("c")}, all)
+
+	// Plain updates do not check the version, but increase it
+	err = second.Data.Update([]byte("b2"))
+	ok(t, err)
+	equals(t, uint64(2), second.Version())
+	err = first.UpdateIfUnchanged([]byte("b3"))
+	equals(t, ErrConflict, err)
+
+	// Moving the node increases the version
+	err = ll.MoveToFront(second)
+	ok(t, err)
+	equals(t, uint64(3), second.Version())
+	err = ll.MoveToBack(second)
+	ok(t, err)
+	equals(t, uint64(4), second.Version())
+	back, err := ll.Back()
+	ok(t, err)
+	equals(t, uint64(4), back.Version())
+
+	// The version is kept by a dump
+	var buf bytes.Buffer
+	err = ll.ExportNodes(&buf)
+	ok(t, err)
+	err = ll.ImportNodes(&buf)
+	ok(t, err)
+	back, err = ll.Back()
+	ok(t, err)
+	equals(t, uint64(4), back.Version())
+
+	err = second.RemoveIfUnchanged()
+	ok(t, err)
+	err = second.RemoveIfUnchanged()
+	equals(t, ErrStaleItem, err)
+	all, err = ll.GetAll()
+	ok(t, err)
+	equals(t, [][]byte{[]byte("a"), []byte("c")}, all)
+
+	// Re-linking the nodes in bulk increases the versions of the nodes that moved
+	front, err := ll.Front()
+	ok(t, err)
+	err = ll.Reverse()
+	ok(t, err)
+	err = front.UpdateIfUnchanged([]byte("a1"))
+	equals(t, ErrConflict, err)
+	back, err = ll.Back()
+	ok(t, err)
+	equals(t, uint64(1), back.Version())
+	err = ll.Rotate(1)
+	ok(t, err)
+	front, err = ll.Front()
+	ok(t, err)
+	equals(t, uint64(2), front.Version())
+	back, err = ll.Back()
+	ok(t, err)
+	equals(t, uint64(2), back.Version())
+	err = ll.PushBack([]byte("b"))
+	ok(t, err)
+	err = ll.Sort(func(a, b []byte) bool { return bytes.Compare(a, b) < 0 })
+	ok(t, err)
+	versions := []uint64{}
+	for _, data := range []string{"a", "b", "c"} {
+		it, err := ll.Get([]byte(data))
+		ok(t, err)
+		versions = append(versions, it.Version())
+	}
+	equals(t, []uint64{3, 1, 3}, versions)
+
+	// Sorting a sorted list does not change any links
+	err = ll.Sort(func(a, b []byte) bool { return bytes.Compare(a, b) < 0 })
+	ok(t, err)
+	front, err = ll.Front()
+	ok(t, err)
+	equals(t, uint64(3), front.Version())
+}
+
+func TestFaultInjection(t *testing.T) {
+	errFault := errors.New("injected fault")
+	for _, tc := range []struct {
+		name string
+		op   func(ll *TestLL) error
+	}{
+		{"PushBack", func(ll *TestLL) error { return ll.PushBack([]byte("X")) }},
+		{"PushFront", func(ll *TestLL) error { return ll.PushFront([]byte("X")) }},
+		{"Update", func(ll *TestLL) error {
+			it, err := ll.Get([]byte("B"))
+			if err != nil {
+				return err
+			}
+			return it.Data.Update([]byte("X"))
+		}},
+		{"Remove", func(ll *TestLL) error {
+			it, err := ll.Get([]byte("B"))
+			if err != nil {
+				return err
+			}
+			return it.Data.Remove()
+		}},
+		{"MoveToFront", func(ll *TestLL) error {
+			it, err := ll.Get([]byte("B"))
+			if err != nil {
+				return err
+			}
+			return ll.MoveToFront(it)
+		}},
+		{"MoveToBack", func(ll *TestLL) error {
+			it, err := ll.Get([]byte("B"))
+			if err != nil {
+				return err
+			}
+			return ll.MoveToBack(it)
+		}},
+		{"InsertAfter", func(ll *TestLL) error {
+			it, err := ll.Get([]byte("B"))
+			if err != nil {
+				return err
+			}
+			return ll.InsertAfter([]byte("X"), it)
+		}},
+		{"InsertBefore", func(ll *TestLL) error {
+			it, err := ll.Get([]byte("B"))
+			if err != nil {
+				return err
+			}
+			return ll.InsertBefore([]byte("X"), it)
+		}},
+	} {
+		for _, faultOp := range []string{"marshal", "unmarshal"} {
+			// Fail the n-th operation, until the operation succeeds without failing
+			for n := 1; ; n++ {
+				ll := NewTestLL()
+				err := ll.PushBackAll([][]byte{[]byte("A"), []byte("B"), []byte("C")})
+				ok(t, err)
+				calls := 0
+				ll.db.SetFaultInjector(func(op string) error {
+					if op != faultOp {
+						return nil
+					}
+					calls++
+					if calls == n {
+						return errFault
+					}
+					return nil
+				})
+				err = tc.op(ll)
+				ll.db.SetFaultInjector(nil)
+				if calls < n {
+					ok(t, err)
+					ll.Close()
+					break
+				}
+				// The error may have been formatted into another error
+				if err == nil || !strings.Contains(err.Error(), errFault.Error()) {
+					t.Fatalf("%s: expected the injected fault at %s %d, got %v", tc.name, faultOp, n, err)
+				}
+				// Nothing has been changed
+				all, err := ll.GetAll()
+				ok(t, err)
+				equals(t, [][]byte{[]byte("A"), []byte("B"), []byte("C")}, all)
+				problems, err := ll.ValidateLinks()
+				ok(t, err)
+				equals(t, 0, len(problems))
+				ll.Close()
+			}
+		}
+	}
+}
+
+func TestCreator(t *testing.T) {
+	ll := NewTestLL()
+	defer ll.Close()
+
+	var creator pinterface.ICreator = NewCreator(ll.db)
+	llCreator, isLLCreator := creator.(ILinkedListCreator)
+	assert(t, isLLCreator, "Creator expected to implement ILinkedListCreator")
+	other, err := llCreator.NewLinkedList("creatorLLname")
+	ok(t, err)
+	err = other.PushBackAll([][]byte{[]byte("ABC"), []byte("DEF")})
+	ok(t, err)
+	var values []string
+	for it, err := other.Front(); it != nil; it = it.Next() {
+		ok(t, err)
+		values = append(values, string(it.Data.Value()))
+	}
+	equals(t, []string{"ABC", "DEF"}, values)
+
+	// The other data structures can still be created
+	list, err := creator.NewList("creatorListName")
+	ok(t, err)
+	err = list.Add("GHI")
+	ok(t, err)
+
+	// Errors from the constructor are returned
+	_, err = llCreator.NewLinkedList("")
+	assert(t, err != nil, "NewLinkedList expected an error for an empty id")
+}
+
+func TestErrors(t *testing.T) {
+	ll := NewTestLL()
+	defer ll.Close()
+	other := NewTestLL()
+	defer other.Close()
+
+	isErr := func(err, target error) {
+		t.Helper()
+		assert(t, errors.Is(err, target), "expected %v, got %v", target, err)
+	}
+
+	_, err := ll.Get([]byte("ABC"))
+	isErr(err, ErrEmptyList)
+	isErr(ll.PushBack(nil), ErrEmptyData)
+	ok(t, ll.PushBackAll([][]byte{[]byte("ABC"), []byte("DEF")}))
+	_, err = ll.Get(nil)
+	isErr(err, ErrEmptyValue)
+	_, err = ll.GetFunc([]byte("ABC"), nil)
+	isErr(err, ErrNilFunc)
+	isErr(ll.InsertAfter([]byte("GHI"), nil), ErrNilMark)
+	isErr(ll.MoveToFront(nil), ErrNilItem)
+	isErr(ll.MoveToFront(&Item{Data: fakeData("ABC")}), ErrInvalidItem)
+
+	// Items of other linked lists
+	ok(t, other.PushBack([]byte("ABC")))
+	otherFront, err := other.Front()
+	ok(t, err)
+	isErr(ll.MoveToFront(otherFront), ErrInvalidMove)
+	_, err = ll.IndexOf(otherFront)
+	isErr(err, ErrInvalidItem)
+
+	// Combining linked lists
+	isErr(ll.Concat(nil), ErrNilLinkedList)
+	isErr(ll.Concat(ll.LinkedList), ErrInvalidLinkedList)
+	err = ll.Concat(other.LinkedList)
+	isErr(err, ErrDifferentDatabase)
+	isErr(err, simplebolt.ErrDifferentDatabase)
+	_, err = ll.CopyToDatabase(nil, "errorsCopy")
+	isErr(err, ErrNilDatabase)
+	_, err = ll.CopyTo("errorsCopy")
+	ok(t, err)
+	_, err = ll.CopyTo("errorsCopy")
+	isErr(err, ErrBucketExists)
+
+	// The errors that are shared with simplebolt are the same values
+	_, err = ll.At(10)
+	isErr(err, ErrOutOfRange)
+	isErr(err, simplebolt.ErrOutOfRange)
+
+	// Reading invalid data
+	isErr(ll.ImportNodes(strings.NewReader("not a dump")), ErrInvalidDump)
+	isErr(ll.ImportJSON(strings.NewReader(`[{"key": 1}]`)), ErrInvalidData)
+}
+
+func TestContext(t *testing.T) {
+	ll := NewTestLL()
+	defer ll.Close()
+	data := benchData(2500)
+	ok(t, ll.PushBackAll(data))
+
+	// Cancel in the middle of the iteration
+	ctx, cancel := context.WithCancel(context.Background())
+	count := 0
+	err := ll.ForEachCtx(ctx, func(_, _ []byte) error {
+		count++
+		if count == 10 {
+			cancel()
+		}
+		return nil
+	})
+	assert(t, errors.Is(err, context.Canceled), "expected context.Canceled, got %v", err)
+	equals(t, 10, count)
+	_, err = ll.GetAllCtx(ctx)
+	assert(t, errors.Is(err, context.Canceled), "expected context.Canceled, got %v", err)
+
+	// Pushing in several batches keeps the order of the data
+	ok(t, ll.PushFrontAllCtx(context.Background(), data))
+	all, err := ll.GetAllCtx(context.Background())
+	ok(t, err)
+	equals(t, 2*len(data), len(all))
+	equals(t, data, all[:len(data)])
+	equals(t, data, all[len(data):])
+
+	// Cancel in the middle of the batches, which rolls back the whole transaction
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	marshalled := 0
+	ll.db.SetFaultInjector(func(op string) error {
+		if op == "marshal" {
+			marshalled++
+			if marshalled == 1500 {
+				cancel()
+			}
+		}
+		return nil
+	})
+	err = ll.PushBackAllCtx(ctx, data)
+	ll.db.SetFaultInjector(nil)
+	assert(t, errors.Is(err, context.Canceled), "expected context.Canceled, got %v", err)
+	n, err := ll.Len()
+	ok(t, err)
+	equals(t, 2*len(data), n)
+	problems, err := ll.ValidateLinks()
+	ok(t, err)
+	equals(t, 0, len(problems))
+}
+
+func TestFillPercent(t *testing.T) {
+	data := benchData(5000)
+	leafPages := make(map[float64]int)
+	// 0.5 is the default of Bolt, and 0 fills the pages completely when pushing
+	for _, fillPercent := range []float64{0.5, 0.9, 0} {
+		ll := NewTestLL()
+		ll.SetFillPercent(fillPercent)
+		ok(t, ll.PushBackAll(data))
+		all, err := ll.GetAll()
+		ok(t, err)
+		equals(t, data, all)
+		err = (*bbolt.DB)(ll.db).View(func(tx *bbolt.Tx) error {
+			leafPages[fillPercent] = tx.Bucket(ll.name).Stats().LeafPageN
+			return nil
+		})
+		ok(t, err)
+		ll.Close()
+	}
+	assert(t, leafPages[0.9] < leafPages[0.5], "expected fewer pages with a higher fill percent: %v", leafPages)
+	assert(t, leafPages[0] < leafPages[0.9], "expected the fewest pages by default: %v", leafPages)
+}
+
+// TestFillPercentFileSize documents the size of the database file after pushing
+// 100k nodes, with the default fill percent of Bolt and with the tuned one
+func TestFillPercentFileSize(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping the file size comparison in short mode")
+	}
+	data := benchData(100000)
+	sizes := make(map[float64]int64)
+	for _, fillPercent := range []float64{0.5, 0} {
+		sizes[fillPercent] = pushedFileSize(t, fillPercent, data)
+	}
+	t.Logf("file size with a fill percent of 0.5: %d bytes, tuned: %d bytes", sizes[0.5], sizes[0])
+	assert(t, sizes[0] < sizes[0.5], "expected a smaller file when tuned: %v", sizes)
+}
+
+// pushedFileSize returns the size of the database file after pushing the given
+// data to an empty linked list, with the given fill percent
+func pushedFileSize(tb testing.TB, fillPercent float64, data [][]byte) int64 {
+	ll := NewTestLL()
+	defer ll.Close()
+	ll.SetFillPercent(fillPercent)
+	if err := ll.PushBackAll(data); err != nil {
+		tb.Fatal(err)
+	}
+	info, err := os.Stat(ll.db.Path())
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return info.Size()
+}
+
+// metricsFunc is a simplebolt.Metrics that calls the given function
+type metricsFunc func(structure, op string, d time.Duration, err error)
+
+func (f metricsFunc) ObserveOp(structure, op string, d time.Duration, err error) {
+	f(structure, op, d, err)
+}
+
+func TestMetrics(t *testing.T) {
+	ll := NewTestLL()
+	defer ll.Close()
+	var ops []string
+	ll.db.SetMetrics(metricsFunc(func(structure, op string, _ time.Duration, err error) {
+		ops = append(ops, fmt.Sprintf("%s.%s %v", structure, op, err != nil))
+	}))
+	ok(t, ll.PushBack([]byte("ABC")))
+	ok(t, ll.PushFrontAll([][]byte{[]byte("DEF")}))
+	front, err := ll.Front()
+	ok(t, err)
+	front.Next()
+	ok(t, front.Data.Update([]byte("XYZ")))
+	ok(t, front.Data.Remove())
+	ok(t, ll.ForEachReverse(func(_, _ []byte) error { return nil }))
+	_, err = ll.TruncateFront(1)
+	ok(t, err)
+	_, err = ll.GetByKey(byteID(100))
+	assert(t, err != nil, "GetByKey expected an error for a missing key")
+	equals(t, []string{
+		"LinkedList.PushBack false",
+		"LinkedList.PushFrontAll false",
+		"LinkedList.Front false",
+		"LinkedList.Next false",
+		"LinkedList.Item.Update false",
+		"LinkedList.Item.Remove false",
+		"LinkedList.ForEachReverse false",
+		"LinkedList.TruncateFront false",
+		"LinkedList.GetByKey true",
+	}, ops)
+}
+
+func TestLogger(t *testing.T) {
+	ll := NewTestLL()
+	defer ll.Close()
+	ok(t, ll.PushBackAll([][]byte{[]byte("ABC"), []byte("DEF")}))
+	front, err := ll.Front()
+	ok(t, err)
+	corrupt(t, ll, front.Key(), func(node *pb.LinkedListNode) {
+		node.Next = byteID(100)
+	})
+
+	// Without a logger, the error is dropped
+	assert(t, front.Next() == nil, "Next expected nil for a missing node")
+
+	var buf bytes.Buffer
+	ll.db.SetLogger(log.New(&buf, "", 0))
+	assert(t, front.Next() == nil, "Next expected nil for a missing node")
+	assert(t, strings.HasPrefix(buf.String(), "Could not get next: "), "Next expected the error to be logged, got %q", buf.String())
+	_, err = front.NextItem()
+	assert(t, err != nil, "NextItem expected an error for a missing node")
+
+	buf.Reset()
+	ok(t, ll.Repair())
+	assert(t, strings.HasPrefix(buf.String(), "Repaired the links of 1 nodes"), "Repair expected to be logged, got %q", buf.String())
+	buf.Reset()
+	ok(t, ll.Repair())
+	equals(t, "", buf.String())
+}
+
+// TestConcurrentUse uses a linked list and an item from several goroutines.
+// Run it with -race.
+func TestConcurrentUse(t *testing.T) {
+	ll := NewTestLL()
+	defer ll.Close()
+	ok(t, ll.PushBack([]byte("ABC")))
+	front, err := ll.Front()
+	ok(t, err)
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				ok(t, ll.PushBack([]byte(fmt.Sprintf("%d-%d", g, i))))
+				_, err := ll.GetAll()
+				ok(t, err)
+				ll.SetFillPercent(0.9)
+				if err := front.Data.Update([]byte(fmt.Sprint(g))); err != nil && err != ErrItemInUse {
+					t.Errorf("Update expected nil or ErrItemInUse, got %v", err)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	all, err := ll.GetAll()
+	ok(t, err)
+	equals(t, 201, len(all))
+
+	// An item that is being modified can not be modified by another goroutine
+	sd := front.Data.(*storedData)
+	ok(t, sd.acquire())
+	equals(t, ErrItemInUse, front.Data.Update([]byte("DEF")))
+	equals(t, ErrItemInUse, front.Data.Remove())
+	equals(t, ErrItemInUse, ll.MoveToBack(front))
+	sd.release()
+	ok(t, front.Data.Update([]byte("DEF")))
+}
+
+func TestOpen(t *testing.T) {
+	ll := NewTestLL()
+	defer ll.Close()
+	_, err := Open(ll.db, "missing")
+	equals(t, ErrBucketNotFound, err)
+	// An empty linked list can be opened
+	opened, err := Open(ll.db, string(ll.name))
+	ok(t, err)
+	ok(t, ll.PushBack([]byte("ABC")))
+	front, err := opened.Front()
+	ok(t, err)
+	equals(t, []byte("ABC"), front.Data.Value())
+
+	kv, err := simplebolt.NewKeyValue(ll.db, "kv_open_test")
+	ok(t, err)
+	ok(t, kv.Set("key", "value"))
+	_, err = Open(ll.db, "kv_open_test")
+	equals(t, ErrNotLinkedList, err)
+}
+
+func TestContains(t *testing.T) {
+	ll := NewTestLL()
+	defer ll.Close()
+	found, err := ll.Contains([]byte("ABC"))
+	ok(t, err)
+	assert(t, !found, "Contains expected false for an empty list")
+	_, err = ll.Contains(nil)
+	equals(t, ErrEmptyValue, err)
+	_, err = ll.ContainsFunc("ABC", nil)
+	equals(t, ErrNilFunc, err)
+
+	ok(t, ll.PushBackAll([][]byte{[]byte("ABC"), []byte("DEF"), []byte("GHI")}))
+	for _, unique := range []bool{false, true} {
+		ok(t, ll.SetUnique(unique))
+		found, err = ll.Contains([]byte("GHI"))
+		ok(t, err)
+		assert(t, found, "Contains expected GHI to be found")
+		found, err = ll.Contains([]byte("XYZ"))
+		ok(t, err)
+		assert(t, !found, "Contains expected XYZ to not be found")
+	}
+	found, err = ll.ContainsFunc("def", func(a interface{}, b []byte) bool {
+		return strings.EqualFold(a.(string), string(b))
+	})
+	ok(t, err)
+	assert(t, found, "ContainsFunc expected DEF to be found")
+	calls := 0
+	found, err = ll.ContainsFunc("ABC", func(a interface{}, b []byte) bool {
+		calls++
+		return a.(string) == string(b)
+	})
+	ok(t, err)
+	assert(t, found, "ContainsFunc expected ABC to be found")
+	equals(t, 1, calls)
+}
+
+func TestCheck(t *testing.T) {
+	ll := NewTestLL()
+	defer ll.Close()
+	for _, data := range []string{"ABC", "DEF", "GHI"} {
+		ok(t, ll.PushBack([]byte(data)))
+	}
+	problems, err := simplebolt.Check(ll.db)
+	ok(t, err)
+	equals(t, 0, len(problems))
+
+	front, err := ll.Front()
+	ok(t, err)
+	corrupt(t, ll, front.Key(), func(node *pb.LinkedListNode) {
+		node.Next = byteID(99)
+	})
+	problems, err = simplebolt.Check(ll.db)
+	ok(t, err)
+	assert(t, len(problems) > 0, "expected problems")
+	for _, p := range problems {
+		equals(t, "tempLLname", p.Bucket)
+		equals(t, "LinkedList", p.Structure)
+	}
+	equals(t, front.Key(), problems[0].Key)
+	equals(t, "the next link refers to a missing node", problems[0].Description)
+
+	// The copy has the same problems, until it is repaired
+	other, err := ll.CopyTo("copyLLname")
+	ok(t, err)
+	ok(t, ll.Repair())
+	problems, err = simplebolt.Check(ll.db)
+	ok(t, err)
+	assert(t, len(problems) > 0, "expected problems in the copy")
+	for _, p := range problems {
+		equals(t, "copyLLname", p.Bucket)
+	}
+	ok(t, other.Repair())
+	problems, err = simplebolt.Check(ll.db)
+	ok(t, err)
+	equals(t, 0, len(problems))
+}
+
+func FuzzLinkedList(f *testing.F) {
+	ll := NewTestLL()
+	f.Cleanup(ll.Close)
+	f.Add([]byte{0, 1, 0, 1, 2, 3, 4, 5, 6, 7})
+	f.Add([]byte{0, 0, 0, 0, 16, 35, 52, 69, 86, 103, 120, 137, 154})
+	f.Add([]byte{14, 0, 0, 1, 17, 12, 28, 6, 22, 11, 15, 13})
+	f.Fuzz(func(t *testing.T, ops []byte) {
+		ok(t, ll.SetUnique(false))
+		ok(t, ll.clear())
+		for _, op := range ops {
+			// The high bits choose the data, the index of an item or a count
+			n := int(op >> 4)
+			data := []byte{'a' + byte(n%5)}
+			length, err := ll.Len()
+			ok(t, err)
+			var item *Item
+			if length > 0 {
+				item, err = ll.At(n % length)
+				ok(t, err)
+			}
+			switch op % 16 {
+			case 0:
+				ll.PushBack(data)
+			case 1:
+				ll.PushFront(data)
+			case 2:
+				if item != nil {
+					item.Data.Remove()
+				}
+			case 3:
+				ll.MoveToFront(item)
+			case 4:
+				ll.MoveToBack(item)
+			case 5:
+				ll.MoveToIndex(item, n%(length+1))
+			case 6:
+				ll.InsertAfter(data, item)
+			case 7:
+				ll.InsertBefore(data, item)
+			case 8:
+				ll.Truncate(n % 4)
+			case 9:
+				ll.TruncateFront(n % 4)
+			case 10:
+				ll.Reverse()
+			case 11:
+				ll.Rotate(n - 8)
+			case 12:
+				if item != nil {
+					item.Data.Update(data)
+				}
+			case 13:
+				ll.RemoveFunc(func(d []byte) bool { return bytes.Equal(d, data) })
+			case 14:
+				ll.SetUnique(n%2 == 0)
+			case 15:
+				ll.Sort(func(a, b []byte) bool { return bytes.Compare(a, b) < 0 })
+			}
+		}
+		problems, err := simplebolt.Check(ll.db)
+		ok(t, err)
+		for _, p := range problems {
+			t.Errorf("%s, after the operations %v", p, ops)
+		}
+		all, err := ll.GetAll()
+		ok(t, err)
+		reversed, err := ll.GetAllReverse()
+		ok(t, err)
+		length, err := ll.Len()
+		ok(t, err)
+		equals(t, len(all), length)
+		equals(t, len(all), len(reversed))
+		for i := range all {
+			equals(t, all[i], reversed[len(reversed)-1-i])
+		}
+	})
+}
+
+func TestOptions(t *testing.T) {
+	ll := NewTestLL()
+	defer ll.Close()
+	_, err := New(ll.db, "optionsLLname", WithFillPercent(-1))
+	assert(t, errors.Is(err, ErrInvalidOption), "expected ErrInvalidOption")
+	other, err := New(ll.db, "optionsLLname", WithFillPercent(0.9))
+	ok(t, err)
+	equals(t, 0.9, other.fillPercent.Load())
+	ok(t, other.PushBack([]byte("ABC")))
+	_, err = Open(ll.db, "optionsLLname", WithFillPercent(1.5))
+	assert(t, errors.Is(err, ErrInvalidOption), "expected ErrInvalidOption")
+	other, err = Open(ll.db, "optionsLLname", WithFillPercent(1.0))
+	ok(t, err)
+	equals(t, 1.0, other.fillPercent.Load())
+}
+
+// xorCipher returns a function that flips the bits of every byte with the key
+func xorCipher(key byte) func([]byte) ([]byte, error) {
+	return func(data []byte) ([]byte, error) {
+		out := make([]byte, len(data))
+		for i, b := range data {
+			out[i] = b ^ key
+		}
+		return out, nil
+	}
+}
+
+func TestValueCipher(t *testing.T) {
+	ll := NewTestLL()
+	defer ll.Close()
+	other := NewTestLL()
+	defer other.Close()
+	ok(t, ll.db.SetValueCipher(xorCipher(0x5a), xorCipher(0x5a)))
+	ok(t, other.db.SetValueCipher(xorCipher(0xa5), xorCipher(0xa5)))
+
+	ok(t, ll.PushBackAll([][]byte{[]byte("secret one"), []byte("secret two")}))
+	ok(t, ll.PushFront([]byte("secret zero")))
+	front, err := ll.Front()
+	ok(t, err)
+	equals(t, []byte("secret zero"), front.Data.Value())
+	ok(t, front.Data.Update([]byte("secret front")))
+	// The copy is encrypted with the cipher of the other database
+	copied, err := ll.CopyToDatabase(other.db, "copyLLname")
+	ok(t, err)
+
+	for _, l := range []*LinkedList{ll.LinkedList, copied} {
+		// The data of the nodes is not stored in plain text
+		err = (*bbolt.DB)(l.db).View(func(tx *bbolt.Tx) error {
+			return tx.Bucket(l.name).ForEach(func(key, value []byte) error {
+				assert(t, !bytes.Contains(value, []byte("secret")), "the node %x is not encrypted: %q", key, value)
+				return nil
+			})
+		})
+		ok(t, err)
+		all, err := l.GetAll()
+		ok(t, err)
+		equals(t, [][]byte{[]byte("secret front"), []byte("secret one"), []byte("secret two")}, all)
+		back, err := l.Back()
+		ok(t, err)
+		equals(t, []byte("secret two"), back.Data.Value())
+		problems, err := l.ValidateLinks()
+		ok(t, err)
+		equals(t, 0, len(problems))
+	}
+}
+
+func TestDatabaseClosed(t *testing.T) {
+	ll := NewTestLL()
+	err := ll.PushBack([]byte("A"))
+	ok(t, err)
+	ll.Close()
+	err = ll.PushBack([]byte("B"))
+	assert(t, errors.Is(err, ErrDatabaseClosed), "PushBack expected ErrDatabaseClosed, got %v", err)
+	_, err = ll.Front()
+	assert(t, errors.Is(err, ErrDatabaseClosed), "Front expected ErrDatabaseClosed, got %v", err)
+	_, err = ll.Cursor()
+	assert(t, errors.Is(err, ErrDatabaseClosed), "Cursor expected ErrDatabaseClosed, got %v", err)
+	_, err = New(ll.db, "closedLL")
+	assert(t, errors.Is(err, ErrDatabaseClosed), "New expected ErrDatabaseClosed, got %v", err)
+}
+
+func BenchmarkForEach(b *testing.B) {
+	ll := newBenchLL(b, 10000)
+	defer ll.Close()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		count := 0
+		if err := ll.ForEach(func(_, _ []byte) error {
+			count++
+			return nil
+		}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkItemNext(b *testing.B) {
+	ll := newBenchLL(b, 10000)
+	defer ll.Close()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		item, err := ll.Front()
+		if err != nil {
+			b.Fatal(err)
+		}
+		count := 0
+		for ; item != nil; item = item.Next() {
+			count++
+		}
+	}
+}
+
+func BenchmarkGet(b *testing.B) {
+	ll := newBenchLL(b, 10000)
+	defer ll.Close()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// Search for the node at the back of the list
+		if _, err := ll.Get([]byte("item9999")); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// benchData returns n distinct values to push, for benchmarking
+func benchData(n int) [][]byte {
+	data := make([][]byte, n)
+	for i := range data {
+		data[i] = []byte(fmt.Sprintf("item%d", i))
+	}
+	return data
+}
+
+func BenchmarkNodeDecode(b *testing.B) {
+	node := &pb.LinkedListNode{Data: []byte("some data of a node"), Next: byteID(3), Prev: byteID(1)}
+	for _, codec := range []struct {
+		name  string
+		codec nodeCodec
+	}{
+		{"compact", compactCodec{}},
+		{"proto", protoCodec{}},
+	} {
+		nodeBytes, err := codec.codec.encode(node)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(codec.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := unmarshalNode(nil, nodeBytes, &pb.LinkedListNode{}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkPushBack(b *testing.B) {
+	data := benchData(10000)
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		ll := NewTestLL()
+		b.StartTimer()
+		for _, d := range data {
+			if err := ll.PushBack(d); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.StopTimer()
+		ll.Close()
+		b.StartTimer()
+	}
+}
+
+func BenchmarkPushBackAll(b *testing.B) {
+	data := benchData(10000)
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		ll := NewTestLL()
+		b.StartTimer()
+		if err := ll.PushBackAll(data); err != nil {
+			b.Fatal(err)
+		}
+		b.StopTimer()
+		ll.Close()
+		b.StartTimer()
+	}
+}
+
+func BenchmarkPushBackAllFillPercent(b *testing.B) {
+	data := benchData(100000)
+	for _, bench := range []struct {
+		name        string
+		fillPercent float64
+	}{
+		{"bolt-default", 0.5},
+		{"tuned", 0},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			var size int64
+			for i := 0; i < b.N; i++ {
+				size = pushedFileSize(b, bench.fillPercent, data)
+			}
+			b.ReportMetric(float64(size), "file-bytes")
+		})
+	}
+}
+
 func getfunc(a interface{}, b []byte) bool {
 	return bytes.HasPrefix(b, a.([]byte))
 }
@@ -24,6 +24,7 @@ type LinkedListNode struct {
 	Data                 []byte   `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
 	Next                 []byte   `protobuf:"bytes,2,opt,name=next,proto3" json:"next,omitempty"`
 	Prev                 []byte   `protobuf:"bytes,3,opt,name=prev,proto3" json:"prev,omitempty"`
+	Version              uint64   `protobuf:"varint,4,opt,name=version,proto3" json:"version,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -75,6 +76,13 @@ func (m *LinkedListNode) GetPrev() []byte {
 	return nil
 }
 
+func (m *LinkedListNode) GetVersion() uint64 {
+	if m != nil {
+		return m.Version
+	}
+	return 0
+}
+
 func init() {
 	proto.RegisterType((*LinkedListNode)(nil), "nodes.LinkedListNode")
 }
@@ -82,13 +90,14 @@ func init() {
 func init() { proto.RegisterFile("nodes.proto", fileDescriptor_39b18f0c01aa3995) }
 
 var fileDescriptor_39b18f0c01aa3995 = []byte{
-	// 113 bytes of a gzipped FileDescriptorProto
+	// 130 bytes of a gzipped FileDescriptorProto
 	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0xe2, 0xce, 0xcb, 0x4f, 0x49,
-	0x2d, 0xd6, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0x62, 0x05, 0x73, 0x94, 0x7c, 0xb8, 0xf8, 0x7c,
+	0x2d, 0xd6, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0x62, 0x05, 0x73, 0x94, 0xd2, 0xb8, 0xf8, 0x7c,
 	0x32, 0xf3, 0xb2, 0x53, 0x53, 0x7c, 0x32, 0x8b, 0x4b, 0xfc, 0xf2, 0x53, 0x52, 0x85, 0x84, 0xb8,
 	0x58, 0x52, 0x12, 0x4b, 0x12, 0x25, 0x18, 0x15, 0x18, 0x35, 0x78, 0x82, 0xc0, 0x6c, 0x90, 0x58,
 	0x5e, 0x6a, 0x45, 0x89, 0x04, 0x13, 0x44, 0x0c, 0xc4, 0x06, 0x89, 0x15, 0x14, 0xa5, 0x96, 0x49,
-	0x30, 0x43, 0xc4, 0x40, 0x6c, 0x27, 0xae, 0x28, 0x0e, 0xb0, 0xb1, 0xf1, 0x05, 0x49, 0x49, 0x6c,
-	0x60, 0x7b, 0x8c, 0x01, 0x01, 0x00, 0x00, 0xff, 0xff, 0xb9, 0x48, 0xb0, 0xc1, 0x76, 0x00, 0x00,
-	0x00,
+	0x30, 0x43, 0xc4, 0x40, 0x6c, 0x21, 0x09, 0x2e, 0xf6, 0xb2, 0xd4, 0xa2, 0xe2, 0xcc, 0xfc, 0x3c,
+	0x09, 0x16, 0x05, 0x46, 0x0d, 0x96, 0x20, 0x18, 0xd7, 0x89, 0x2b, 0x8a, 0x03, 0x6c, 0x61, 0x7c,
+	0x41, 0x52, 0x12, 0x1b, 0xd8, 0x05, 0xc6, 0x80, 0x01, 0x00, 0x4b, 0x78, 0x48, 0xf5, 0x90, 0x00,
+	0x00, 0x00,
 }
@@ -0,0 +1,239 @@
+package linkedlist
+
+// typed.go provides a linked list of values of a given type, which are encoded
+// and decoded by a codec.Codec.
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/xyproto/simplebolt/codec"
+	pb "github.com/xyproto/simplebolt/linkedlist/nodes_pb"
+	"go.etcd.io/bbolt"
+)
+
+// DecodeError is returned when the data of a node can not be decoded
+type DecodeError struct {
+	ID  string // the id of the linked list
+	Key []byte // the key of the node
+	Err error  // the error returned by the codec
+}
+
+// Error returns a description of the error, including the key of the node
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("Could not decode node %s of %s. %v", hex.EncodeToString(e.Key), e.ID, e.Err)
+}
+
+// Unwrap returns the error returned by the codec
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// Typed is a linked list of values of type T. The values are stored in the given
+// linked list, encoded by the given codec.
+type Typed[T any] struct {
+	ll    *LinkedList
+	codec codec.Codec[T]
+}
+
+// TypedItem is an element of a Typed linked list, with the decoded value
+type TypedItem[T any] struct {
+	// Item is the underlying linked list item
+	Item *Item
+	// Value is the decoded data of the item
+	Value T
+	codec codec.Codec[T]
+}
+
+// NewTyped returns a linked list of values of type T, stored in the given linked
+// list. Any of the codecs in the codec package can be used, including
+// codec.Funcs for a codec made of two functions.
+func NewTyped[T any](ll *LinkedList, c codec.Codec[T]) *Typed[T] {
+	return &Typed[T]{ll: ll, codec: c}
+}
+
+// List returns the underlying linked list
+func (t *Typed[T]) List() *LinkedList {
+	return t.ll
+}
+
+// PushBack inserts the given value at the end of the linked list
+func (t *Typed[T]) PushBack(value T) error {
+	data, err := t.codec.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return t.ll.PushBack(data)
+}
+
+// PushFront inserts the given value at the beginning of the linked list
+func (t *Typed[T]) PushFront(value T) error {
+	data, err := t.codec.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return t.ll.PushFront(data)
+}
+
+// InsertBefore inserts the given value before the given item
+func (t *Typed[T]) InsertBefore(value T, mark *TypedItem[T]) error {
+	if mark == nil {
+		return ErrNilMark
+	}
+	data, err := t.codec.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return t.ll.InsertBefore(data, mark.Item)
+}
+
+// InsertAfter inserts the given value after the given item
+func (t *Typed[T]) InsertAfter(value T, mark *TypedItem[T]) error {
+	if mark == nil {
+		return ErrNilMark
+	}
+	data, err := t.codec.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return t.ll.InsertAfter(data, mark.Item)
+}
+
+// MoveToFront moves the given item to the front of the linked list
+func (t *Typed[T]) MoveToFront(it *TypedItem[T]) error {
+	if it == nil {
+		return ErrNilItem
+	}
+	return t.ll.MoveToFront(it.Item)
+}
+
+// MoveToBack moves the given item to the back of the linked list
+func (t *Typed[T]) MoveToBack(it *TypedItem[T]) error {
+	if it == nil {
+		return ErrNilItem
+	}
+	return t.ll.MoveToBack(it.Item)
+}
+
+// Front returns the item at the front of the linked list, or nil if the list is empty
+func (t *Typed[T]) Front() (*TypedItem[T], error) {
+	it, err := t.ll.Front()
+	if err != nil {
+		return nil, err
+	}
+	return decodeItem(it, t.codec)
+}
+
+// Back returns the item at the back of the linked list, or nil if the list is empty
+func (t *Typed[T]) Back() (*TypedItem[T], error) {
+	it, err := t.ll.Back()
+	if err != nil {
+		return nil, err
+	}
+	return decodeItem(it, t.codec)
+}
+
+// GetFunc returns the first item, from the front of the linked list, with a value
+// for which match returns true, or nil if there is no such item. It returns a
+// *DecodeError if the data of a node can not be decoded.
+func (t *Typed[T]) GetFunc(match func(value T) bool) (found *TypedItem[T], err error) {
+	err = view(t.ll.db, "GetFunc", func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(t.ll.name)
+		if bucket == nil {
+			return ErrBucketNotFound
+		}
+		return walk(bucket, false, func(key []byte, node *pb.LinkedListNode) error {
+			value, err := t.codec.Unmarshal(node.GetData())
+			if err != nil {
+				return &DecodeError{ID: string(t.ll.name), Key: copyKey(key), Err: err}
+			}
+			if match(value) {
+				found = &TypedItem[T]{Item: t.ll.newItem(key, node), Value: value, codec: t.codec}
+				return ErrFoundIt
+			}
+			return nil
+		})
+	})
+	if err != nil && err != ErrFoundIt {
+		return nil, err
+	}
+	return found, nil
+}
+
+// ForEach calls fn with the value of every node in the linked list, from the
+// front to the back, within a single transaction. See LinkedList.ForEach.
+// It returns a *DecodeError if the data of a node can not be decoded.
+func (t *Typed[T]) ForEach(fn func(value T) error) error {
+	return t.ll.ForEach(func(key, data []byte) error {
+		value, err := t.codec.Unmarshal(data)
+		if err != nil {
+			return &DecodeError{ID: string(t.ll.name), Key: copyKey(key), Err: err}
+		}
+		return fn(value)
+	})
+}
+
+// GetAll returns the values of all the nodes in the linked list, from the front
+// to the back. It returns a *DecodeError if the data of a node can not be decoded.
+func (t *Typed[T]) GetAll() ([]T, error) {
+	var values []T
+	if err := t.ForEach(func(value T) error {
+		values = append(values, value)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// Next returns the next item, or nil if the item is at the back of the linked list
+func (ti *TypedItem[T]) Next() (*TypedItem[T], error) {
+	it, err := ti.Item.NextItem()
+	if err != nil {
+		return nil, err
+	}
+	return decodeItem(it, ti.codec)
+}
+
+// Prev returns the previous item, or nil if the item is at the front of the linked list
+func (ti *TypedItem[T]) Prev() (*TypedItem[T], error) {
+	it, err := ti.Item.PrevItem()
+	if err != nil {
+		return nil, err
+	}
+	return decodeItem(it, ti.codec)
+}
+
+// Update replaces the value of the item, both in the linked list and in Value
+func (ti *TypedItem[T]) Update(value T) error {
+	data, err := ti.codec.Marshal(value)
+	if err != nil {
+		return err
+	}
+	if err := ti.Item.Data.Update(data); err != nil {
+		return err
+	}
+	ti.Value = value
+	return nil
+}
+
+// Remove removes the item from the linked list
+func (ti *TypedItem[T]) Remove() error {
+	return ti.Item.Data.Remove()
+}
+
+// decodeItem returns a typed item for the given item, or nil if the item is nil
+func decodeItem[T any](it *Item, c codec.Codec[T]) (*TypedItem[T], error) {
+	if it == nil {
+		return nil, nil
+	}
+	value, err := c.Unmarshal(it.Data.Value())
+	if err != nil {
+		decodeErr := &DecodeError{Key: it.Key(), Err: err}
+		if sd, ok := it.Data.(*storedData); ok && sd.internalLinkedList != nil {
+			decodeErr.ID = string(sd.internalLinkedList.name)
+		}
+		return nil, decodeErr
+	}
+	return &TypedItem[T]{Item: it, Value: value, codec: c}, nil
+}
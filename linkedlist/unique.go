@@ -0,0 +1,157 @@
+package linkedlist
+
+// unique.go provides the unique mode of a linked list, where the same data can
+// not be stored in more than one node.
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/xyproto/simplebolt"
+	pb "github.com/xyproto/simplebolt/linkedlist/nodes_pb"
+	"go.etcd.io/bbolt"
+)
+
+const (
+	// uniqueSuffix is appended to the name of a linked list, for the name of
+	// the bucket that indexes its data when it is in unique mode
+	uniqueSuffix = "__unique"
+
+	// uniqueStructure is recorded as the data structure of the unique index
+	// buckets, so that a bucket is only used as one if SetUnique created it
+	uniqueStructure = "LinkedListUnique"
+)
+
+func init() {
+	simplebolt.ReserveSuffix(uniqueSuffix)
+}
+
+// ErrExists is returned when inserting data into a linked list in unique mode,
+// if a node with the same data already exists
+var ErrExists = errors.New("Element already exists in linked list")
+
+// SetUnique turns the unique mode of the linked list on or off. In unique mode,
+// PushBack, PushFront, PushBackAll, PushFrontAll, InsertBefore, InsertAfter,
+// Concat and Item.Data.Update return ErrExists instead of storing data that is
+// byte-equal to the data of an existing node. The check is done within the same
+// transaction as the insertion, so concurrent insertions can not add duplicates.
+//
+// To avoid searching the whole list, the mode is implemented by a sibling bucket,
+// named by the id of the linked list followed by "__unique", which maps a SHA-256
+// hash of the data of every node to the key of the node. The bucket is kept up to
+// date by every method that modifies the linked list, which costs an extra write
+// and an extra 40 bytes of storage per node. The mode is stored in the database,
+// so it stays on until it is turned off.
+//
+// Turning the unique mode on returns ErrExists, and leaves it off, if the linked
+// list already contains duplicates. It returns an error if there already is a
+// bucket with the name of the unique index, that was not created by SetUnique.
+func (ll *LinkedList) SetUnique(unique bool) error {
+	return update(ll.db, "SetUnique", func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(ll.name)
+		if bucket == nil {
+			return ErrBucketNotFound
+		}
+		name := uniqueName(ll.name)
+		index := uniqueIndex(tx, ll.name)
+		if !unique {
+			if index == nil {
+				return nil
+			}
+			if err := tx.DeleteBucket(name); err != nil {
+				return err
+			}
+			return simplebolt.UnregisterBucket(tx, string(name))
+		}
+		if index != nil {
+			// Already in unique mode
+			return nil
+		}
+		index, err := tx.CreateBucket(name)
+		if err != nil {
+			return fmt.Errorf("Could not create bucket: %w", err)
+		}
+		if err := simplebolt.RegisterBucket(tx, string(name), uniqueStructure); err != nil {
+			return err
+		}
+		return walk(bucket, false, func(key []byte, node *pb.LinkedListNode) error {
+			return uniqueAdd(index, node.GetData(), key)
+		})
+	})
+}
+
+// IsUnique returns true if the linked list is in unique mode. See SetUnique.
+func (ll *LinkedList) IsUnique() (unique bool, err error) {
+	err = view(ll.db, "IsUnique", func(tx *bbolt.Tx) error {
+		if tx.Bucket(ll.name) == nil {
+			return ErrBucketNotFound
+		}
+		unique = uniqueIndex(tx, ll.name) != nil
+		return nil
+	})
+	return unique, err
+}
+
+// uniqueName returns the name of the unique index bucket of the linked list
+// with the given name
+func uniqueName(name []byte) []byte {
+	return append(append([]byte{}, name...), uniqueSuffix...)
+}
+
+// uniqueIndex returns the unique index bucket of the linked list with the given
+// name, or nil if the linked list is not in unique mode
+func uniqueIndex(tx *bbolt.Tx, name []byte) *bbolt.Bucket {
+	return simplebolt.RecordedBucket(tx, string(uniqueName(name)), uniqueStructure)
+}
+
+// uniqueKey returns the key of the given data in a unique index bucket
+func uniqueKey(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
+
+// uniqueCheck returns ErrExists if the given data is in the index. The index
+// may be nil, for linked lists that are not in unique mode.
+func uniqueCheck(index *bbolt.Bucket, data []byte) error {
+	if index != nil && index.Get(uniqueKey(data)) != nil {
+		return ErrExists
+	}
+	return nil
+}
+
+// uniqueAdd adds the given data and the key of its node to the index, or
+// returns ErrExists if the data is already there. The index may be nil.
+func uniqueAdd(index *bbolt.Bucket, data, key []byte) error {
+	if index == nil {
+		return nil
+	}
+	if err := uniqueCheck(index, data); err != nil {
+		return err
+	}
+	return index.Put(uniqueKey(data), copyKey(key))
+}
+
+// uniqueRemove removes the given data from the index. The index may be nil.
+func uniqueRemove(index *bbolt.Bucket, data []byte) error {
+	if index == nil {
+		return nil
+	}
+	return index.Delete(uniqueKey(data))
+}
+
+// uniqueClear removes all the data from the index. The index may be nil.
+func uniqueClear(index *bbolt.Bucket) error {
+	if index == nil {
+		return nil
+	}
+	// Seek to the first key again after each deletion, since the cursor may
+	// skip a key when Next is called after Delete
+	c := index.Cursor()
+	for key, _ := c.First(); key != nil; key, _ = c.First() {
+		if err := c.Delete(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,251 @@
+package linkedlist
+
+// validate.go provides methods for finding and repairing inconsistencies in the
+// links between the nodes of a linked list, for instance after a node has been
+// removed by other means than the linked list methods. The links are also
+// checked by simplebolt.Check, for the linked lists created by New.
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/xyproto/simplebolt"
+	pb "github.com/xyproto/simplebolt/linkedlist/nodes_pb"
+	"go.etcd.io/bbolt"
+)
+
+func init() {
+	simplebolt.RegisterChecker("LinkedList", checkLinkedList)
+}
+
+// Problem describes an inconsistency found in a linked list by ValidateLinks
+type Problem struct {
+	// Key of the node with the problem, or nil if the problem concerns the list
+	Key []byte
+	// Description of the problem
+	Description string
+}
+
+// String returns a description of the problem, including the key of the node
+func (p Problem) String() string {
+	if p.Key == nil {
+		return p.Description
+	}
+	return fmt.Sprintf("node %s: %s", hex.EncodeToString(p.Key), p.Description)
+}
+
+// ValidateLinks checks every node in the linked list and reports problems such as
+// links to nodes that do not exist, links that are not mirrored by the linked node,
+// nodes that can not be reached from the front of the list, several nodes claiming
+// to be at the front or the back of the list and cycles.
+//
+// It runs within a single bbolt.View transaction and never modifies the list.
+// An empty slice is returned if no problems were found.
+func (ll *LinkedList) ValidateLinks() ([]Problem, error) {
+	var problems []Problem
+	err := view(ll.db, "ValidateLinks", func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(ll.name)
+		if bucket == nil {
+			return ErrBucketNotFound
+		}
+		report := func(key []byte, format string, args ...interface{}) {
+			problems = append(problems, Problem{Key: copyKey(key), Description: fmt.Sprintf(format, args...)})
+		}
+		keys, nodes := loadNodes(bucket, report)
+
+		var heads, tails int
+		for _, key := range keys {
+			node := nodes[string(key)]
+			if prevKey := node.GetPrev(); prevKey == nil {
+				heads++
+			} else if prevNode, ok := nodes[string(prevKey)]; !ok {
+				report(key, "the prev link refers to a missing node")
+			} else if !bytes.Equal(prevNode.GetNext(), key) {
+				report(key, "the prev node does not link back to this node")
+			}
+			if nextKey := node.GetNext(); nextKey == nil {
+				tails++
+			} else if nextNode, ok := nodes[string(nextKey)]; !ok {
+				report(key, "the next link refers to a missing node")
+			} else if !bytes.Equal(nextNode.GetPrev(), key) {
+				report(key, "the next node does not link back to this node")
+			}
+		}
+		if heads > 1 {
+			report(nil, "there are %d nodes without a prev link", heads)
+		}
+		if tails > 1 {
+			report(nil, "there are %d nodes without a next link", tails)
+		}
+
+		// Check the keys of the nodes at the front and at the back of the list
+		frontKey := bucket.Get([]byte("FRONT"))
+		backKey := bucket.Get([]byte("BACK"))
+		if len(nodes) == 0 {
+			if frontKey != nil || backKey != nil {
+				report(nil, "the list is empty, but has a front or a back")
+			}
+			return nil
+		}
+		if node, ok := nodes[string(frontKey)]; !ok {
+			report(nil, "the front of the list refers to a missing node")
+		} else if node.GetPrev() != nil {
+			report(frontKey, "the node at the front has a prev link")
+		}
+		if node, ok := nodes[string(backKey)]; !ok {
+			report(nil, "the back of the list refers to a missing node")
+		} else if node.GetNext() != nil {
+			report(backKey, "the node at the back has a next link")
+		}
+
+		// Follow the links from the front, to find cycles and unreachable nodes
+		visited := make(map[string]bool)
+		for key := frontKey; key != nil; {
+			node, ok := nodes[string(key)]
+			if !ok {
+				break
+			}
+			if visited[string(key)] {
+				report(key, "the next links form a cycle")
+				break
+			}
+			visited[string(key)] = true
+			key = node.GetNext()
+		}
+		for _, key := range keys {
+			if !visited[string(key)] {
+				report(key, "the node can not be reached from the front of the list")
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return problems, nil
+}
+
+// Repair fixes the links of the linked list, so that ValidateLinks reports no
+// problems. The nodes that can be reached from the front of the list keep their
+// order, while links to missing nodes are dropped and the nodes that can not be
+// reached are linked at the back of the list, in the order of their keys.
+//
+// The whole repair is done within a single bbolt.Update transaction. It returns
+// an error, and repairs nothing, if any node can not be de-serialized. The number
+// of nodes that were re-linked is logged, see simplebolt.Database.SetLogger.
+func (ll *LinkedList) Repair() error {
+	var relinked int
+	err := update(ll.db, "Repair", func(tx *bbolt.Tx) error {
+		bucket := ll.bucket(tx)
+		if bucket == nil {
+			return ErrBucketNotFound
+		}
+		var unmarshalErr error
+		keys, nodes := loadNodes(bucket, func(key []byte, format string, args ...interface{}) {
+			unmarshalErr = fmt.Errorf("Could not repair node %s: "+format, append([]interface{}{hex.EncodeToString(key)}, args...)...)
+		})
+		if unmarshalErr != nil {
+			return unmarshalErr
+		}
+		if len(keys) == 0 {
+			return setEnds(bucket, nil, nil)
+		}
+
+		// Find the node to start from: the front of the list if it exists,
+		// or else the first node without a prev link, or else the first node.
+		startKey := copyKey(bucket.Get([]byte("FRONT")))
+		if _, ok := nodes[string(startKey)]; !ok {
+			startKey = keys[0]
+			for _, key := range keys {
+				if nodes[string(key)].GetPrev() == nil {
+					startKey = key
+					break
+				}
+			}
+		}
+
+		// Follow the links from the start, then add the nodes that were not reached
+		var chain [][]byte
+		visited := make(map[string]bool)
+		for key := startKey; key != nil; key = nodes[string(key)].GetNext() {
+			if _, ok := nodes[string(key)]; !ok || visited[string(key)] {
+				break
+			}
+			visited[string(key)] = true
+			chain = append(chain, key)
+		}
+		for _, key := range keys {
+			if !visited[string(key)] {
+				chain = append(chain, key)
+			}
+		}
+
+		// Re-link all the nodes according to the chain, saving only those that changed
+		for i, key := range chain {
+			var prevKey, nextKey []byte
+			if i > 0 {
+				prevKey = chain[i-1]
+			}
+			if i < len(chain)-1 {
+				nextKey = chain[i+1]
+			}
+			node := nodes[string(key)]
+			if bytes.Equal(node.GetPrev(), prevKey) && bytes.Equal(node.GetNext(), nextKey) {
+				continue
+			}
+			node.Prev, node.Next = prevKey, nextKey
+			if err := putNode(bucket, key, node); err != nil {
+				return err
+			}
+			relinked++
+		}
+		return setEnds(bucket, chain[0], chain[len(chain)-1])
+	})
+	if err == nil && relinked > 0 {
+		ll.db.Logf("Repaired the links of %d nodes in linked list %s", relinked, ll.name)
+	}
+	return err
+}
+
+// loadNodes de-serializes all the nodes stored in the given bucket and returns
+// their keys, in the order of the bucket, and the nodes by key. The nodes that
+// can not be de-serialized are reported and left out.
+func loadNodes(bucket *bbolt.Bucket, report func(key []byte, format string, args ...interface{})) ([][]byte, map[string]*pb.LinkedListNode) {
+	var keys [][]byte
+	nodes := make(map[string]*pb.LinkedListNode)
+	bucket.ForEach(func(key, nodeBytes []byte) error {
+		if !isNodeKey(key) {
+			return nil // Continue ForEach
+		}
+		node := &pb.LinkedListNode{}
+		if err := unmarshalNode(bucket, nodeBytes, node); err != nil {
+			report(key, "could not unmarshal. %v", err)
+			return nil // Continue ForEach
+		}
+		keys = append(keys, copyKey(key))
+		nodes[string(key)] = node
+		return nil // Continue ForEach
+	})
+	return keys, nodes
+}
+
+// checkLinkedList is the simplebolt.Checker of linked lists, which are checked
+// by simplebolt.Check with ValidateLinks
+func checkLinkedList(db *simplebolt.Database, id string) ([]simplebolt.Problem, error) {
+	ll := &LinkedList{db: db, name: []byte(id)}
+	found, err := ll.ValidateLinks()
+	if err != nil {
+		return nil, err
+	}
+	var problems []simplebolt.Problem
+	for _, p := range found {
+		problems = append(problems, simplebolt.Problem{
+			Bucket:      id,
+			Structure:   "LinkedList",
+			Key:         p.Key,
+			Description: p.Description,
+		})
+	}
+	return problems, nil
+}
@@ -0,0 +1,26 @@
+package simplebolt
+
+// logger.go provides a way to route the rare warnings of the data structures,
+// like repairs and errors that can not be returned, into the log of the caller.
+
+// Logger receives warnings about a database. A *log.Logger is a Logger.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// SetLogger sets the Logger that receives the warnings about this database and
+// its data structures, and those of the packages that are built on it. Pass nil
+// to stop logging, which is the default. The library never terminates the
+// process, errors are returned or, where that is not possible, logged.
+func (db *Database) SetLogger(l Logger) {
+	db.updateSettings(func(s *settings) {
+		s.logger = l
+	})
+}
+
+// Logf writes a warning to the Logger of the database, if one has been set
+func (db *Database) Logf(format string, v ...interface{}) {
+	if l := db.settings().logger; l != nil {
+		l.Printf(format, v...)
+	}
+}
@@ -0,0 +1,61 @@
+package simplebolt
+
+// metrics.go provides a hook for observing the number and the duration of the
+// transactions performed by the data structures.
+
+import (
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// Metrics observes the operations performed on a database. See SetMetrics.
+type Metrics interface {
+	// ObserveOp is called after every transaction, with the data structure,
+	// like "List", the operation, like "Add", the duration of the transaction
+	// and the error it returned, if any
+	ObserveOp(structure, op string, d time.Duration, err error)
+}
+
+// SetMetrics sets the Metrics that observes the transactions of the methods of
+// the data structures of this database, and of the packages that are built on
+// it. Methods that need more than one transaction are observed once for each
+// transaction. Pass nil to stop observing, which is the default. Then the
+// transactions are not timed at all.
+//
+// The Metrics is kept until the database is closed. It may be called from
+// several goroutines at once.
+func (db *Database) SetMetrics(m Metrics) {
+	db.updateSettings(func(s *settings) {
+		s.metrics = m
+	})
+}
+
+// Observe calls fn and reports its duration and the returned error to the
+// Metrics of the database, if one has been set, as the given operation on the
+// given data structure. It is called by the packages that are built on this one,
+// for each of their transactions.
+func (db *Database) Observe(structure, op string, fn func() error) error {
+	m := db.settings().metrics
+	if m == nil {
+		return fn()
+	}
+	start := time.Now()
+	err := fn()
+	m.ObserveOp(structure, op, time.Since(start), err)
+	return err
+}
+
+// update calls fn within a read-write transaction, observed as the given operation
+func (db *Database) update(structure, op string, fn func(tx *bbolt.Tx) error) error {
+	return db.Observe(structure, op, func() error {
+		return (*bbolt.DB)(db).Update(fn)
+	})
+}
+
+// view calls fn within a read-only transaction, observed as the given operation
+func (db *Database) view(structure, op string, fn func(tx *bbolt.Tx) error) error {
+	return db.Observe(structure, op, func() error {
+		return (*bbolt.DB)(db).View(fn)
+	})
+}
@@ -0,0 +1,284 @@
+// Package migrate copies data structures from another data store to a
+// simplebolt database. The data store is given as a pinterface.ICreator, which
+// is also implemented by the creator of simpleredis, so that data can be moved
+// from Redis with:
+//
+//	results, err := migrate.Copy(simpleredis.NewCreator(pool, 0), db, []migrate.Structure{
+//		{Type: migrate.List, ID: "messages"},
+//		{Type: migrate.KeyValue, ID: "settings", Keys: []string{"theme", "language"}},
+//	})
+//
+// Copying from Redis is only tested with an in-memory source, since simpleredis
+// is not a dependency of this module. A FromRedis(pool, db, ids...) wrapper,
+// which would look up the types of the data structures by their IDs, is still
+// a TODO.
+package migrate
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/xyproto/pinterface"
+	"github.com/xyproto/simplebolt"
+)
+
+// Type is the type of a data structure
+type Type string
+
+// The types of data structures that can be copied
+const (
+	List     Type = "List"
+	Set      Type = "Set"
+	HashMap  Type = "HashMap"
+	KeyValue Type = "KeyValue"
+)
+
+// defaultBatchSize is the number of values that are written within one
+// transaction, unless WithBatchSize is given
+const defaultBatchSize = 1000
+
+// ErrUnknownType is returned for a Structure with an unknown Type
+var ErrUnknownType = errors.New("Unknown data structure type")
+
+// Structure is a data structure to copy, with the same ID in the source and in
+// the database
+type Structure struct {
+	Type Type
+	ID   string
+	// Keys are the keys to copy from a KeyValue, since the keys of a
+	// pinterface.IKeyValue can not be listed. They are ignored for the other
+	// types.
+	Keys []string
+}
+
+// Result is the outcome of copying one data structure
+type Result struct {
+	Structure
+	// Found is false if the data structure is empty or missing in the source,
+	// which is the same for Redis. Then nothing is written.
+	Found bool
+	// Copied is the number of elements, members, fields or keys that were
+	// copied, or that would be copied in a dry run
+	Copied int
+	// Missing are the keys of a KeyValue that could not be read from the
+	// source. A missing key can not be told from a failed read through
+	// pinterface.IKeyValue, so they are skipped.
+	Missing []string
+	// Err is the error that stopped the copying, if any. The batches that were
+	// written before the error are kept.
+	Err error
+}
+
+// options are collected from the Option values given to Copy
+type options struct {
+	dryRun    bool
+	batchSize int
+}
+
+// Option configures Copy
+type Option func(o *options) error
+
+// WithDryRun reads the data structures from the source and reports what would
+// be copied, without writing anything to the database
+func WithDryRun() Option {
+	return func(o *options) error {
+		o.dryRun = true
+		return nil
+	}
+}
+
+// WithBatchSize sets the number of values that are written within one
+// transaction. The default is 1000.
+func WithBatchSize(n int) Option {
+	return func(o *options) error {
+		if n < 1 {
+			return fmt.Errorf("%w: batch size %d is not positive", simplebolt.ErrInvalidOption, n)
+		}
+		o.batchSize = n
+		return nil
+	}
+}
+
+// entry is a value read from the source: an element of a list, a member of a
+// set, a field of an element of a hash map, or a key and value of a key/value
+// store
+type entry struct {
+	owner, key, value string
+}
+
+// Copy copies the given data structures from the source to the database, and
+// returns the result for each of them, in the same order. The values of every
+// data structure are read from the source first, and then written in batches,
+// one transaction per batch. A data structure is created in the database if it
+// does not already exist, and else the values are added to it:
+//
+//   - the elements of a List are added in order, after any existing elements
+//   - the members of a Set are added, unless they are already there
+//   - the fields of a HashMap and the keys of a KeyValue are set
+//
+// A data structure that fails to be copied does not stop the others. If any of
+// them fails, the error of the first one is also returned, wrapped with its
+// type and ID. An invalid option is returned before anything is copied.
+func Copy(from pinterface.ICreator, db *simplebolt.Database, structures []Structure, opts ...Option) ([]Result, error) {
+	o := options{batchSize: defaultBatchSize}
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return nil, err
+		}
+	}
+	results := make([]Result, len(structures))
+	var firstErr error
+	for i, s := range structures {
+		results[i] = copyStructure(from, db, s, o)
+		if err := results[i].Err; err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("Could not copy %s %s: %w", s.Type, s.ID, err)
+		}
+	}
+	return results, firstErr
+}
+
+// copyStructure copies one data structure and returns the result
+func copyStructure(from pinterface.ICreator, db *simplebolt.Database, s Structure, o options) Result {
+	result := Result{Structure: s}
+	entries, missing, err := read(from, s)
+	result.Missing = missing
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	result.Found = len(entries) > 0
+	if o.dryRun {
+		result.Copied = len(entries)
+		return result
+	}
+	for start := 0; start < len(entries); start += o.batchSize {
+		end := start + o.batchSize
+		if end > len(entries) {
+			end = len(entries)
+		}
+		if err := db.Do(func(txdb *simplebolt.TxDatabase) error {
+			return write(txdb, s, entries[start:end])
+		}); err != nil {
+			result.Err = err
+			return result
+		}
+		result.Copied = end
+	}
+	return result
+}
+
+// read returns the values of the given data structure in the source, and the
+// keys of a KeyValue that could not be read
+func read(from pinterface.ICreator, s Structure) (entries []entry, missing []string, err error) {
+	switch s.Type {
+	case List:
+		l, err := from.NewList(s.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		values, err := l.All()
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, value := range values {
+			entries = append(entries, entry{value: value})
+		}
+	case Set:
+		set, err := from.NewSet(s.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		values, err := set.All()
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, value := range values {
+			entries = append(entries, entry{value: value})
+		}
+	case HashMap:
+		h, err := from.NewHashMap(s.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		owners, err := h.All()
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, owner := range owners {
+			keys, err := h.Keys(owner)
+			if err != nil {
+				return nil, nil, err
+			}
+			for _, key := range keys {
+				value, err := h.Get(owner, key)
+				if err != nil {
+					return nil, nil, err
+				}
+				entries = append(entries, entry{owner, key, value})
+			}
+		}
+	case KeyValue:
+		kv, err := from.NewKeyValue(s.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, key := range s.Keys {
+			value, err := kv.Get(key)
+			if err != nil {
+				missing = append(missing, key)
+				continue
+			}
+			entries = append(entries, entry{key: key, value: value})
+		}
+	default:
+		return nil, nil, fmt.Errorf("%w: %q", ErrUnknownType, s.Type)
+	}
+	return entries, missing, nil
+}
+
+// write stores the given values of a data structure within a transaction
+func write(txdb *simplebolt.TxDatabase, s Structure, batch []entry) error {
+	switch s.Type {
+	case List:
+		l, err := txdb.List(s.ID)
+		if err != nil {
+			return err
+		}
+		for _, e := range batch {
+			if err := l.Add(e.value); err != nil {
+				return err
+			}
+		}
+	case Set:
+		set, err := txdb.Set(s.ID)
+		if err != nil {
+			return err
+		}
+		for _, e := range batch {
+			if err := set.Add(e.value); err != nil && !errors.Is(err, simplebolt.ErrExistsInSet) {
+				return err
+			}
+		}
+	case HashMap:
+		h, err := txdb.HashMap(s.ID)
+		if err != nil {
+			return err
+		}
+		for _, e := range batch {
+			if err := h.Set(e.owner, e.key, e.value); err != nil {
+				return err
+			}
+		}
+	case KeyValue:
+		kv, err := txdb.KeyValue(s.ID)
+		if err != nil {
+			return err
+		}
+		for _, e := range batch {
+			if err := kv.Set(e.key, e.value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
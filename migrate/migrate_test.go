@@ -0,0 +1,424 @@
+package migrate
+
+import (
+	"errors"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/xyproto/pinterface"
+	"github.com/xyproto/simplebolt"
+)
+
+var errMissing = errors.New("missing")
+
+// fake is an in-memory pinterface.ICreator. Like Redis, it does not keep empty
+// data structures, and reading a missing key of a key/value store fails.
+type fake struct {
+	lists  map[string][]string
+	sets   map[string][]string
+	hashes map[string]map[string]map[string]string
+	kvs    map[string]map[string]string
+	// fail is returned when reading any data structure, if it is set
+	fail error
+}
+
+func newFake() *fake {
+	return &fake{
+		lists:  make(map[string][]string),
+		sets:   make(map[string][]string),
+		hashes: make(map[string]map[string]map[string]string),
+		kvs:    make(map[string]map[string]string),
+	}
+}
+
+func (f *fake) NewList(id string) (pinterface.IList, error) {
+	return &fakeList{f, id}, nil
+}
+
+func (f *fake) NewSet(id string) (pinterface.ISet, error) {
+	return &fakeSet{f, id}, nil
+}
+
+func (f *fake) NewHashMap(id string) (pinterface.IHashMap, error) {
+	return &fakeHashMap{f, id}, nil
+}
+
+func (f *fake) NewKeyValue(id string) (pinterface.IKeyValue, error) {
+	return &fakeKeyValue{f, id}, nil
+}
+
+type fakeList struct {
+	f  *fake
+	id string
+}
+
+func (l *fakeList) Add(value string) error {
+	l.f.lists[l.id] = append(l.f.lists[l.id], value)
+	return nil
+}
+
+func (l *fakeList) All() ([]string, error) {
+	return l.f.lists[l.id], l.f.fail
+}
+
+func (l *fakeList) Clear() error {
+	delete(l.f.lists, l.id)
+	return nil
+}
+
+func (l *fakeList) LastN(n int) ([]string, error) {
+	values := l.f.lists[l.id]
+	if n > len(values) {
+		n = len(values)
+	}
+	return values[len(values)-n:], nil
+}
+
+func (l *fakeList) Last() (string, error) {
+	values := l.f.lists[l.id]
+	if len(values) == 0 {
+		return "", errMissing
+	}
+	return values[len(values)-1], nil
+}
+
+func (l *fakeList) Remove() error {
+	return l.Clear()
+}
+
+type fakeSet struct {
+	f  *fake
+	id string
+}
+
+func (s *fakeSet) Add(value string) error {
+	if found, _ := s.Has(value); !found {
+		s.f.sets[s.id] = append(s.f.sets[s.id], value)
+	}
+	return nil
+}
+
+func (s *fakeSet) All() ([]string, error) {
+	return s.f.sets[s.id], s.f.fail
+}
+
+func (s *fakeSet) Clear() error {
+	delete(s.f.sets, s.id)
+	return nil
+}
+
+func (s *fakeSet) Del(value string) error {
+	members := s.f.sets[s.id][:0]
+	for _, member := range s.f.sets[s.id] {
+		if member != value {
+			members = append(members, member)
+		}
+	}
+	s.f.sets[s.id] = members
+	return nil
+}
+
+func (s *fakeSet) Has(value string) (bool, error) {
+	for _, member := range s.f.sets[s.id] {
+		if member == value {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *fakeSet) Remove() error {
+	return s.Clear()
+}
+
+type fakeHashMap struct {
+	f  *fake
+	id string
+}
+
+func (h *fakeHashMap) All() ([]string, error) {
+	var owners []string
+	for owner := range h.f.hashes[h.id] {
+		owners = append(owners, owner)
+	}
+	sort.Strings(owners)
+	return owners, h.f.fail
+}
+
+func (h *fakeHashMap) Clear() error {
+	delete(h.f.hashes, h.id)
+	return nil
+}
+
+func (h *fakeHashMap) DelKey(owner, key string) error {
+	delete(h.f.hashes[h.id][owner], key)
+	return nil
+}
+
+func (h *fakeHashMap) Del(owner string) error {
+	delete(h.f.hashes[h.id], owner)
+	return nil
+}
+
+func (h *fakeHashMap) Exists(owner string) (bool, error) {
+	_, found := h.f.hashes[h.id][owner]
+	return found, nil
+}
+
+func (h *fakeHashMap) Get(owner, key string) (string, error) {
+	value, found := h.f.hashes[h.id][owner][key]
+	if !found {
+		return "", errMissing
+	}
+	return value, nil
+}
+
+func (h *fakeHashMap) Has(owner, key string) (bool, error) {
+	_, found := h.f.hashes[h.id][owner][key]
+	return found, nil
+}
+
+func (h *fakeHashMap) Keys(owner string) ([]string, error) {
+	var keys []string
+	for key := range h.f.hashes[h.id][owner] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (h *fakeHashMap) Remove() error {
+	return h.Clear()
+}
+
+func (h *fakeHashMap) Set(owner, key, value string) error {
+	if h.f.hashes[h.id] == nil {
+		h.f.hashes[h.id] = make(map[string]map[string]string)
+	}
+	if h.f.hashes[h.id][owner] == nil {
+		h.f.hashes[h.id][owner] = make(map[string]string)
+	}
+	h.f.hashes[h.id][owner][key] = value
+	return nil
+}
+
+type fakeKeyValue struct {
+	f  *fake
+	id string
+}
+
+func (kv *fakeKeyValue) Clear() error {
+	delete(kv.f.kvs, kv.id)
+	return nil
+}
+
+func (kv *fakeKeyValue) Del(key string) error {
+	delete(kv.f.kvs[kv.id], key)
+	return nil
+}
+
+func (kv *fakeKeyValue) Get(key string) (string, error) {
+	value, found := kv.f.kvs[kv.id][key]
+	if !found {
+		return "", errMissing
+	}
+	return value, nil
+}
+
+func (kv *fakeKeyValue) Inc(key string) (string, error) {
+	return "", errors.New("not implemented")
+}
+
+func (kv *fakeKeyValue) Remove() error {
+	return kv.Clear()
+}
+
+func (kv *fakeKeyValue) Set(key, value string) error {
+	if kv.f.kvs[kv.id] == nil {
+		kv.f.kvs[kv.id] = make(map[string]string)
+	}
+	kv.f.kvs[kv.id][key] = value
+	return nil
+}
+
+// newTestDB returns a new, empty database, which is removed when the test ends
+func newTestDB(t *testing.T) *simplebolt.Database {
+	filename := path.Join(t.TempDir(), "bolt_migrate.db")
+	db, err := simplebolt.New(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		os.Remove(filename)
+	})
+	return db
+}
+
+// populate adds one data structure of every type to the given creator
+func populate(t *testing.T, c pinterface.ICreator) []Structure {
+	l, _ := c.NewList("messages")
+	for _, value := range []string{"c", "a", "b", "a"} {
+		if err := l.Add(value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s, _ := c.NewSet("tags")
+	for _, value := range []string{"go", "bolt", "redis"} {
+		if err := s.Add(value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h, _ := c.NewHashMap("users")
+	h.Set("alice", "email", "alice@example.com")
+	h.Set("alice", "password", "hunter2")
+	h.Set("bob", "email", "bob@example.com")
+	kv, _ := c.NewKeyValue("settings")
+	kv.Set("theme", "dark")
+	kv.Set("language", "nn")
+	return []Structure{
+		{Type: List, ID: "messages"},
+		{Type: Set, ID: "tags"},
+		{Type: HashMap, ID: "users"},
+		{Type: KeyValue, ID: "settings", Keys: []string{"theme", "language", "missing"}},
+		{Type: List, ID: "missing"},
+	}
+}
+
+// checkCopied checks that the data structures of populate are in the database
+func checkCopied(t *testing.T, db *simplebolt.Database) {
+	l, err := simplebolt.OpenList(db, "messages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values, err := l.All(); err != nil || strings.Join(values, "") != "caba" {
+		t.Errorf("Error, wrong list! %v %v", values, err)
+	}
+	s, err := simplebolt.OpenSet(db, "tags")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values, err := s.All(); err != nil || strings.Join(values, ",") != "go,bolt,redis" {
+		t.Errorf("Error, wrong set! %v %v", values, err)
+	}
+	h, err := simplebolt.OpenHashMap(db, "users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]map[string]string{
+		"alice": {"email": "alice@example.com", "password": "hunter2"},
+		"bob":   {"email": "bob@example.com"},
+	}
+	if maps, err := h.GetAllMaps(); err != nil || !reflect.DeepEqual(maps, expected) {
+		t.Errorf("Error, wrong hash map! %v %v", maps, err)
+	}
+	kv, err := simplebolt.OpenKeyValue(db, "settings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if all, err := kv.GetAllWithPrefix(""); err != nil || !reflect.DeepEqual(all, map[string]string{"theme": "dark", "language": "nn"}) {
+		t.Errorf("Error, wrong key/values! %v %v", all, err)
+	}
+	if _, err := simplebolt.OpenList(db, "missing"); !errors.Is(err, simplebolt.ErrBucketNotFound) {
+		t.Errorf("Error, expected ErrBucketNotFound for a missing list, got %v", err)
+	}
+}
+
+func TestCopy(t *testing.T) {
+	db := newTestDB(t)
+	from := newFake()
+	structures := populate(t, from)
+
+	results, err := Copy(from, db, structures, WithBatchSize(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Result{
+		{Structure: structures[0], Found: true, Copied: 4},
+		{Structure: structures[1], Found: true, Copied: 3},
+		{Structure: structures[2], Found: true, Copied: 3},
+		{Structure: structures[3], Found: true, Copied: 2, Missing: []string{"missing"}},
+		{Structure: structures[4]},
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("Error, wrong results!\n%+v\n%+v", results, expected)
+	}
+	checkCopied(t, db)
+
+	// Copying again does not add the members of the set twice
+	if _, err := Copy(from, db, structures[1:2]); err != nil {
+		t.Error(err)
+	}
+	checkCopied(t, db)
+}
+
+func TestDryRun(t *testing.T) {
+	db := newTestDB(t)
+	from := newFake()
+	structures := populate(t, from)
+
+	results, err := Copy(from, db, structures, WithDryRun())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, copied := range []int{4, 3, 3, 2, 0} {
+		if results[i].Copied != copied || results[i].Found != (copied > 0) {
+			t.Errorf("Error, wrong result for %s! %+v", structures[i].ID, results[i])
+		}
+	}
+	if buckets, err := db.Buckets(); err != nil || len(buckets) != 0 {
+		t.Errorf("Error, a dry run wrote to the database! %v %v", buckets, err)
+	}
+}
+
+func TestCopyErrors(t *testing.T) {
+	db := newTestDB(t)
+	from := newFake()
+	structures := populate(t, from)
+
+	if _, err := Copy(from, db, structures, WithBatchSize(0)); !errors.Is(err, simplebolt.ErrInvalidOption) {
+		t.Errorf("Error, expected ErrInvalidOption, got %v", err)
+	}
+	results, err := Copy(from, db, []Structure{{Type: "Queue", ID: "jobs"}, structures[0]})
+	if !errors.Is(err, ErrUnknownType) || !strings.Contains(err.Error(), "Queue jobs") {
+		t.Errorf("Error, expected ErrUnknownType for the queue, got %v", err)
+	}
+	if len(results) != 2 || results[1].Err != nil || results[1].Copied != 4 {
+		t.Errorf("Error, the list was not copied after the error! %+v", results)
+	}
+	// A data structure is not copied into a bucket that holds another one
+	if _, err := simplebolt.NewList(db, "tags"); err != nil {
+		t.Fatal(err)
+	}
+	results, err = Copy(from, db, structures[1:2])
+	if !errors.Is(err, simplebolt.ErrWrongType) || results[0].Copied != 0 {
+		t.Errorf("Error, expected ErrWrongType, got %v %+v", err, results)
+	}
+
+	// Errors from the source are reported
+	from.fail = errors.New("connection refused")
+	results, err = Copy(from, db, structures[:3])
+	if !errors.Is(err, from.fail) {
+		t.Errorf("Error, expected the error of the source, got %v", err)
+	}
+	for _, result := range results {
+		if !errors.Is(result.Err, from.fail) {
+			t.Errorf("Error, expected the error of the source for %s, got %v", result.ID, result.Err)
+		}
+	}
+}
+
+func TestCopyFromBolt(t *testing.T) {
+	// The creator of simplebolt also works as a source
+	source := newTestDB(t)
+	structures := populate(t, simplebolt.NewCreator(source))
+	db := newTestDB(t)
+	if _, err := Copy(simplebolt.NewCreator(source), db, structures[:4]); err != nil {
+		t.Fatal(err)
+	}
+	checkCopied(t, db)
+}
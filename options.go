@@ -0,0 +1,174 @@
+package simplebolt
+
+// options.go provides the functional options of New, for opening a database,
+// and of the constructors of the data structures.
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// defaultTimeout is how long New waits for the lock on the database file, in
+// case it is already in use, unless WithTimeout is given
+const defaultTimeout = 1 * time.Second
+
+// defaultFileMode is the file mode of a new database file, unless WithFileMode
+// is given
+const defaultFileMode os.FileMode = 0600
+
+// ErrInvalidOption is returned by New and by the constructors of the data
+// structures when given an option with an invalid value. It is wrapped with
+// the details.
+var ErrInvalidOption = errors.New("Invalid option")
+
+// options are collected from the Option values given to New
+type options struct {
+	fileMode os.FileMode
+	bolt     bbolt.Options
+	settings settings
+}
+
+// Option configures how New opens a database. Options that correspond to a
+// setter, like WithLogger and SetLogger, have the same effect as calling the
+// setter right after opening the database.
+type Option func(o *options) error
+
+// WithTimeout sets how long New waits for the lock on the database file, in
+// case another process has it open. The default is one second, and 0 waits
+// indefinitely.
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) error {
+		if timeout < 0 {
+			return fmt.Errorf("%w: negative timeout %v", ErrInvalidOption, timeout)
+		}
+		o.bolt.Timeout = timeout
+		return nil
+	}
+}
+
+// WithReadOnly opens the database file in read-only mode, which allows other
+// processes to open it in read-only mode at the same time. Methods that modify
+// the database then return bbolt.ErrDatabaseReadOnly, and the file must exist.
+func WithReadOnly() Option {
+	return func(o *options) error {
+		o.bolt.ReadOnly = true
+		return nil
+	}
+}
+
+// WithFileMode sets the permissions of the database file, if it is created.
+// The default is 0600.
+func WithFileMode(mode os.FileMode) Option {
+	return func(o *options) error {
+		if mode&^os.ModePerm != 0 {
+			return fmt.Errorf("%w: file mode %v is not only permissions", ErrInvalidOption, mode)
+		}
+		o.fileMode = mode
+		return nil
+	}
+}
+
+// WithNoSync skips the fsync after every commit. This makes writing much
+// faster, but the database may be corrupted if the operating system crashes,
+// so it is meant for bulk loading and for tests.
+func WithNoSync() Option {
+	return func(o *options) error {
+		o.bolt.NoSync = true
+		return nil
+	}
+}
+
+// WithLogger sets the Logger of the database, see SetLogger
+func WithLogger(l Logger) Option {
+	return func(o *options) error {
+		o.settings.logger = l
+		return nil
+	}
+}
+
+// WithMetrics sets the Metrics of the database, see SetMetrics
+func WithMetrics(m Metrics) Option {
+	return func(o *options) error {
+		o.settings.metrics = m
+		return nil
+	}
+}
+
+// WithCompression sets the compression method of the database, see
+// SetCompression. Returns ErrInvalidCompression for an unknown method.
+func WithCompression(c Compression) Option {
+	return func(o *options) error {
+		if c != NoCompression && c != Gzip {
+			return ErrInvalidCompression
+		}
+		o.settings.compression = c
+		return nil
+	}
+}
+
+// WithValueCipher sets the functions that encrypt and decrypt the values of
+// the database, see SetValueCipher. Returns ErrInvalidCipher if only one of
+// them is nil.
+func WithValueCipher(enc, dec func([]byte) ([]byte, error)) Option {
+	return func(o *options) error {
+		if (enc == nil) != (dec == nil) {
+			return ErrInvalidCipher
+		}
+		o.settings.encrypt, o.settings.decrypt = enc, dec
+		return nil
+	}
+}
+
+// WithCodec sets the codec of the database, see SetCodec
+func WithCodec(codec Codec) Option {
+	return func(o *options) error {
+		o.settings.codec = codec
+		return nil
+	}
+}
+
+// bucketOptions are collected from the BucketOption values given to the
+// constructors of the data structures
+type bucketOptions struct {
+	fillPercent float64
+}
+
+// BucketOption configures a data structure, when given to its constructor, like
+// NewList or OpenList
+type BucketOption func(o *bucketOptions) error
+
+// WithFillPercent sets the fill percent of the data structure, see
+// List.SetFillPercent. It must be 0, for the default, or between 0.1 and 1.0.
+func WithFillPercent(fillPercent float64) BucketOption {
+	return func(o *bucketOptions) error {
+		if fillPercent != 0 && (fillPercent < 0.1 || fillPercent > 1.0) {
+			return fmt.Errorf("%w: fill percent %v is not between 0.1 and 1.0", ErrInvalidOption, fillPercent)
+		}
+		o.fillPercent = fillPercent
+		return nil
+	}
+}
+
+// applyBucketOptions returns the options given to the constructor of a data
+// structure, or the first error returned by an option
+func applyBucketOptions(opts []BucketOption) (bucketOptions, error) {
+	var o bucketOptions
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return o, err
+		}
+	}
+	return o, nil
+}
+
+// newBucket returns a handle to the bucket with the given name, configured
+// with the given options
+func newBucket(db *Database, name []byte, o bucketOptions) *boltBucket {
+	b := &boltBucket{db: db, name: name}
+	b.fillPercent.Store(o.fillPercent)
+	return b
+}
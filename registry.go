@@ -0,0 +1,91 @@
+package simplebolt
+
+// registry.go keeps track of the databases that are open in this process, so
+// that opening the same file twice shares one database instead of waiting for
+// the file lock that Bolt already holds.
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"go.etcd.io/bbolt"
+)
+
+// openDatabase is a database in the registry, with the number of callers of
+// New that have not closed it yet
+type openDatabase struct {
+	db   *Database
+	refs int
+}
+
+var (
+	registryMutex sync.Mutex
+	registry      = make(map[string]*openDatabase)
+)
+
+// registryKey returns the absolute path of the given file, with symbolic links
+// resolved, so that every name of a file gives the same key. If the file does
+// not exist yet, only the links of the directory are resolved.
+func registryKey(filename string) (string, error) {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return "", err
+	}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		return resolved, nil
+	}
+	if dir, err := filepath.EvalSymlinks(filepath.Dir(abs)); err == nil {
+		return filepath.Join(dir, filepath.Base(abs)), nil
+	}
+	return abs, nil
+}
+
+// open returns the database that is already open for the given file, with one
+// more reference, or else opens it with the given options
+func open(filename string, o options) (*Database, error) {
+	key, err := registryKey(filename)
+	if err != nil {
+		return nil, err
+	}
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	if shared, ok := registry[key]; ok {
+		if o.bolt.ReadOnly != (*bbolt.DB)(shared.db).IsReadOnly() {
+			return nil, fmt.Errorf("%w: the database is already open with another read-only mode", ErrInvalidOption)
+		}
+		shared.refs++
+		return shared.db, nil
+	}
+	boltDB, err := bbolt.Open(filename, o.fileMode, &o.bolt)
+	if err != nil {
+		return nil, err
+	}
+	db := (*Database)(boltDB)
+	db.updateSettings(func(s *settings) {
+		*s = o.settings
+	})
+	registry[key] = &openDatabase{db: db, refs: 1}
+	return db, nil
+}
+
+// release removes one reference to the given database, and closes it when the
+// last reference has been removed, or if it is not in the registry. The
+// references are not tied to the callers of New, so a caller that releases
+// the database twice also removes the reference of another caller.
+func (db *Database) release() {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	for key, shared := range registry {
+		if shared.db != db {
+			continue
+		}
+		if shared.refs--; shared.refs > 0 {
+			return
+		}
+		delete(registry, key)
+		break
+	}
+	(*bbolt.DB)(db).Close()
+	db.forgetSettings()
+}
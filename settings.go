@@ -0,0 +1,51 @@
+package simplebolt
+
+// settings.go keeps track of the settings of each open database. Database is
+// defined as a bbolt.DB, so the settings can not be stored as struct fields.
+
+import "sync"
+
+// settings contains the options that can be changed for an open database
+type settings struct {
+	compression   Compression
+	faultInjector func(op string) error
+	codec         Codec
+	metrics       Metrics
+	logger        Logger
+	encrypt       func([]byte) ([]byte, error)
+	decrypt       func([]byte) ([]byte, error)
+}
+
+var (
+	settingsMutex sync.RWMutex
+	settingsByDB  = make(map[*Database]*settings)
+)
+
+// settings returns a copy of the current settings of the database
+func (db *Database) settings() settings {
+	settingsMutex.RLock()
+	defer settingsMutex.RUnlock()
+	if s, ok := settingsByDB[db]; ok {
+		return *s
+	}
+	return settings{}
+}
+
+// updateSettings changes the settings of the database with the given function
+func (db *Database) updateSettings(change func(s *settings)) {
+	settingsMutex.Lock()
+	defer settingsMutex.Unlock()
+	s, ok := settingsByDB[db]
+	if !ok {
+		s = &settings{}
+		settingsByDB[db] = s
+	}
+	change(s)
+}
+
+// forgetSettings removes the settings of the database, when it is closed
+func (db *Database) forgetSettings() {
+	settingsMutex.Lock()
+	defer settingsMutex.Unlock()
+	delete(settingsByDB, db)
+}
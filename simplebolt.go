@@ -4,10 +4,15 @@
 package simplebolt
 
 import (
+	"bytes"
+	"context"
 	"encoding/binary"
 	"errors"
+	"fmt"
+	"math"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"go.etcd.io/bbolt"
@@ -24,20 +29,27 @@ type (
 
 	// Used for each of the datatypes
 	boltBucket struct {
-		db   *Database // the Bolt database
-		name []byte    // the bucket name
+		db          *Database   // the Bolt database
+		name        []byte      // the bucket name, which is never changed
+		fillPercent atomicFloat // the fill percent of the bucket when writing, or 0 for the default
+		removed     atomic.Bool // set when the bucket has been removed with Remove
 	}
 
-	// List is a Bolt bucket, with methods for acting like a list
+	// List is a Bolt bucket, with methods for acting like a list.
+	// A *List is safe for concurrent use by multiple goroutines.
 	List boltBucket
 
-	// Set is a Bolt bucket, with methods for acting like a set, only allowing unique keys
+	// Set is a Bolt bucket, with methods for acting like a set, only allowing unique keys.
+	// A *Set is safe for concurrent use by multiple goroutines.
 	Set boltBucket
 
-	// HashMap is a Bolt bucket, with methods for acting like a hash map (with an ID and then key=>value)
+	// HashMap is a Bolt bucket, with methods for acting like a hash map (with an ID and then key=>value).
+	// Each hash map has a bucket of its own, where the keys are stored as "elementid:key".
+	// A *HashMap is safe for concurrent use by multiple goroutines.
 	HashMap boltBucket
 
-	// KeyValue is a Bolt bucket, with methods for acting like a key=>value store
+	// KeyValue is a Bolt bucket, with methods for acting like a key=>value store.
+	// A *KeyValue is safe for concurrent use by multiple goroutines.
 	KeyValue boltBucket
 )
 
@@ -45,7 +57,8 @@ var (
 	// ErrBucketNotFound may be returned if a no Bolt bucket was found
 	ErrBucketNotFound = errors.New("Bucket not found")
 
-	// ErrKeyNotFound will be returned if the key was not found in a HashMap or KeyValue struct
+	// ErrKeyNotFound will be returned if the key was not found in a HashMap or KeyValue struct,
+	// or if there is no element with the given key in a List
 	ErrKeyNotFound = errors.New("Key not found")
 
 	// ErrDoesNotExist will be returned if an element was not found. Used in List, Set, HashMap and KeyValue.
@@ -54,28 +67,81 @@ var (
 	// ErrExistsInSet is only returned if an element is added to a Set, but it already exists
 	ErrExistsInSet = errors.New("Element already exists in set")
 
+	// ErrKeyExists is returned by KeyValue.Rename if the new key already exists
+	ErrKeyExists = errors.New("Key already exists")
+
 	// ErrInvalidID is only returned if adding an element to a HashMap that contains a colon (:)
 	ErrInvalidID = errors.New("Element ID can not contain \":\"")
 
+	// ErrReservedID is returned when creating or opening a data structure with an
+	// ID that is reserved for the buckets that are used internally, see ValidateID
+	ErrReservedID = errors.New("ID is reserved")
+
+	// ErrWrongType is returned when creating a data structure in a bucket that
+	// has been recorded as holding another data structure
+	ErrWrongType = errors.New("Bucket holds another data structure")
+
+	// ErrOutOfRange is returned if an index is out of range. Used in List.
+	ErrOutOfRange = errors.New("Index out of range")
+
+	// ErrDatabaseClosed is returned when using a database, or any of its data
+	// structures, after the database has been closed
+	ErrDatabaseClosed = errors.New("Database is closed")
+
+	// ErrEmptyData is returned when trying to store empty data where it is not allowed
+	ErrEmptyData = errors.New("Empty data")
+
+	// ErrEmptyList is returned when an operation needs an element, but the list is empty
+	ErrEmptyList = errors.New("Empty list")
+
+	// ErrDifferentDatabase is returned when combining two data structures that
+	// are not stored in the same database
+	ErrDifferentDatabase = errors.New("The data structures must be stored in the same database")
+
+	// ErrNilFunc is returned when the given function, for comparing or for
+	// choosing elements, is nil
+	ErrNilFunc = errors.New("Empty comparing function")
+
 	// errFoundIt is only used internally, for breaking out of Bolt DB style for-loops
 	errFoundIt = errors.New("Found it")
 )
 
 /* --- Database functions --- */
 
-// New creates a new Bolt database struct, using the given file or creating a new file, as needed
-func New(filename string) (*Database, error) {
-	// Use a timeout, in case the database file is already in use
-	db, err := bbolt.Open(filename, 0600, &bbolt.Options{Timeout: 1 * time.Second})
-	if err != nil {
-		return nil, err
+// New creates a new Bolt database struct, using the given file or creating a new file, as needed.
+// The options are applied in order, and if one of them is invalid, its error is
+// returned and the file is not opened. Without options, New waits for up to a
+// second if the database file is already in use, and creates the file with
+// the permissions 0600.
+//
+// Bolt locks the file while it is open, so the database is shared within the
+// process: if the same file is already open, by another call to New with the
+// same path or another path to the same file, the same *Database is returned
+// and the options are only checked, not applied. It is then closed when every
+// call to New has been matched by a call to Close. Returns an error wrapping
+// ErrInvalidOption if the database is shared, but WithReadOnly does not match.
+//
+// Since the callers share the same *Database, each call to New must be matched
+// by exactly one call to Close. Closing it twice closes it for another caller.
+func New(filename string, opts ...Option) (*Database, error) {
+	o := options{
+		fileMode: defaultFileMode,
+		bolt:     bbolt.Options{Timeout: defaultTimeout},
 	}
-	return (*Database)(db), nil
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return nil, err
+		}
+	}
+	return open(filename, o)
 }
 
-// Close the database
+// Close the database. If the database is shared, see New, it is only closed
+// when every caller of New has closed it. Every call to Close counts, so it must
+// be called exactly once for each call to New. Any later use of the closed
+// database, or of its data structures, returns ErrDatabaseClosed.
 func (db *Database) Close() {
-	(*bbolt.DB)(db).Close()
+	db.release()
 }
 
 // Path returns the full path to the database file
@@ -83,36 +149,298 @@ func (db *Database) Path() string {
 	return (*bbolt.DB)(db).Path()
 }
 
-// Ping the database (only for fulfilling the pinterface.IHost interface)
+// Ping the database (only for fulfilling the pinterface.IHost interface).
+// Returns ErrDatabaseClosed if the database has been closed.
 func (db *Database) Ping() error {
-	// Always O.K.
-	return nil
+	return closedError(db.view("Database", "Ping", func(tx *bbolt.Tx) error {
+		return nil // Always O.K., as long as the database is open
+	}))
+}
+
+// Check runs the consistency check of Bolt on the whole database, and returns
+// the problems that were found, or nil if the database is consistent. It can be
+// used for refusing to use a database file that has been written by another
+// program, or that may be corrupt, before any data is read from it.
+//
+// Check is read-only, but it reads every page of the database within a single
+// read-only transaction, so it may be slow for large files.
+func (db *Database) Check() []error {
+	var problems []error
+	err := db.view("Database", "Check", func(tx *bbolt.Tx) error {
+		for err := range tx.Check() {
+			problems = append(problems, err)
+		}
+		return nil // Return from View function
+	})
+	if err != nil {
+		return []error{closedError(err)}
+	}
+	return problems
+}
+
+// NextSequence returns the next value of the persistent sequence counter that
+// belongs to the bucket with the given ID. The bucket is created if needed.
+// Useful for generating unique and monotonically increasing IDs.
+func (db *Database) NextSequence(bucketID string) (uint64, error) {
+	var n uint64
+	err := db.update("Database", "NextSequence", func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(bucketID))
+		if err != nil {
+			return fmt.Errorf("Could not create bucket: %w", err)
+		}
+		n, err = bucket.NextSequence()
+		return err
+	})
+	return n, wrapError("Database.NextSequence", []byte(bucketID), "", err)
+}
+
+// checkBucket returns ErrBucketNotFound if the given bucket does not exist. The
+// transaction is observed as opening the given data structure.
+func (db *Database) checkBucket(structure string, name []byte) error {
+	return db.view(structure, "Open", func(tx *bbolt.Tx) error {
+		if tx.Bucket(name) == nil {
+			return ErrBucketNotFound
+		}
+		return nil // Return from View function
+	})
 }
 
 /* --- List functions --- */
 
-// NewList loads or creates a new List struct, with the given ID
-func NewList(db *Database, id string) (*List, error) {
+// NewList loads or creates a new List struct, with the given ID and options,
+// like WithFillPercent
+func NewList(db *Database, id string, opts ...BucketOption) (*List, error) {
 	name := []byte(id)
-	if err := (*bbolt.DB)(db).Update(func(tx *bbolt.Tx) error {
-		if _, err := tx.CreateBucketIfNotExists(name); err != nil {
-			return errors.New("Could not create bucket: " + err.Error())
+	if err := ValidateID(id); err != nil {
+		return nil, wrapError("NewList", name, "", err)
+	}
+	o, err := applyBucketOptions(opts)
+	if err != nil {
+		return nil, wrapError("NewList", name, "", err)
+	}
+	if err := db.update("List", "New", func(tx *bbolt.Tx) error {
+		if _, err := createList(tx, name); err != nil {
+			return err
 		}
-		return nil // Return from Update function
+		return registerType(tx, name, "List")
 	}); err != nil {
-		return nil, err
+		return nil, wrapError("NewList", name, "", err)
 	}
 	// Success
-	return &List{db, name}, nil
+	return (*List)(newBucket(db, name, o)), nil
+}
+
+// OpenList loads an existing List struct, with the given ID and options.
+// Returns ErrBucketNotFound if it does not already exist.
+func OpenList(db *Database, id string, opts ...BucketOption) (*List, error) {
+	name := []byte(id)
+	if err := ValidateID(id); err != nil {
+		return nil, wrapError("OpenList", name, "", err)
+	}
+	o, err := applyBucketOptions(opts)
+	if err != nil {
+		return nil, wrapError("OpenList", name, "", err)
+	}
+	if err := db.checkBucket("List", name); err != nil {
+		return nil, wrapError("OpenList", name, "", err)
+	}
+	return (*List)(newBucket(db, name, o)), nil
+}
+
+// SetFillPercent sets how full the pages of the bucket of the list are filled
+// when they are split, by the methods that modify the list. Bolt uses 0.5 by
+// default, which leaves room for inserting keys in the middle of the pages.
+// Since new elements are added at the end of the list, a value close to 1.0,
+// like 0.9, makes the pages fuller. Then fewer pages are split when adding many
+// elements, and the database file is smaller, but prepending or inserting
+// elements may split more pages. Bolt limits the value to between 0.1 and 1.0.
+//
+// When no fill percent has been set, or it is reset with 0, Add, AddCapped and
+// AddTimed fill the pages completely, and the other methods use the default.
+func (l *List) SetFillPercent(fillPercent float64) {
+	l.fillPercent.Store(fillPercent)
+}
+
+// bucket returns the bucket of the list within the given transaction, with the
+// fill percent of the list, or nil if the bucket does not exist
+func (l *List) bucket(tx *bbolt.Tx) *bbolt.Bucket {
+	return withFillPercent(tx.Bucket(l.name), l.fillPercent.Load(), 0)
+}
+
+// appendBucket returns the bucket of the list, like bucket, for adding elements
+// at the end of the list. Unless a fill percent has been set, the pages are
+// filled completely, since the keys of the new elements are always increasing.
+func (l *List) appendBucket(tx *bbolt.Tx) *bbolt.Bucket {
+	return withFillPercent(tx.Bucket(l.name), l.fillPercent.Load(), appendFillPercent)
 }
 
 // Add an element to the list
 func (l *List) Add(value string) error {
-	if l.name == nil {
+	_, err := l.add("Add", value)
+	return err
+}
+
+// AddReturningKey adds an element to the list, like Add, and returns its key,
+// which is the next value of the sequence of the bucket. The key can be given
+// to GetByKey and DeleteByKey later on, regardless of the elements that are
+// added, prepended or removed in the meantime.
+//
+// The keys of the lists that were created by earlier versions of this package
+// count from 1. Such a list has its keys rewritten, once, the first time
+// elements are prepended to it, so keys returned before that are no longer
+// valid. See Prepend.
+func (l *List) AddReturningKey(value string) (uint64, error) {
+	return l.add("AddReturningKey", value)
+}
+
+// add adds an element to the end of the list, within a transaction that is
+// observed as the given operation, and returns its key
+func (l *List) add(op, value string) (uint64, error) {
+	var n uint64
+	if !l.exists() {
+		return 0, ErrDoesNotExist
+	}
+	err := l.db.update("List", op, func(tx *bbolt.Tx) (err error) {
+		bucket := l.appendBucket(tx)
+		if bucket == nil {
+			return ErrBucketNotFound
+		}
+		n, err = bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		encoded, err := l.db.encodeValue([]byte(value))
+		if err != nil {
+			return err
+		}
+		if err := bucket.Put(byteID(n), encoded); err != nil {
+			return err
+		}
+		if index := listIndex(tx, l.name); index != nil {
+			return indexAdd(index, []byte(value), byteID(n))
+		}
+		return nil // Return from Update function
+	})
+	if err != nil {
+		return 0, wrapError("List."+op, l.name, "", err)
+	}
+	return n, nil
+}
+
+// Prepend adds an element to the front of the list
+func (l *List) Prepend(value string) error {
+	if !l.exists() {
+		return ErrDoesNotExist
+	}
+	return wrapError("List.Prepend", l.name, "", l.prepend(context.Background(), "Prepend", []string{value}))
+}
+
+// PrependBatch adds all the given elements to the front of the list, within a
+// single transaction, so that the first of the given elements becomes the first
+// element of the list.
+func (l *List) PrependBatch(values []string) error {
+	return l.PrependBatchCtx(context.Background(), values)
+}
+
+// PrependBatchCtx works like PrependBatch, but stops and returns the error of
+// the context as soon as it is cancelled. Then none of the elements are added.
+func (l *List) PrependBatchCtx(ctx context.Context, values []string) error {
+	if !l.exists() {
 		return ErrDoesNotExist
 	}
-	return (*bbolt.DB)(l.db).Update(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket(l.name)
+	return wrapError("List.PrependBatch", l.name, "", l.prepend(ctx, "PrependBatch", values))
+}
+
+// prepend stores the given values with keys below the current first key. The
+// keys of a new list count from listMidpoint, which leaves room for prepending
+// elements for a very long time. The keys of lists that were created by earlier
+// versions of this package count from 1, so there is usually no room below the
+// first key the first time elements are prepended. Then all the keys of the
+// list are rewritten, once, counting from listMidpoint. The transaction is
+// observed as the given operation.
+func (l *List) prepend(ctx context.Context, op string, values []string) error {
+	if len(values) == 0 {
+		return nil
+	}
+	return l.db.update("List", op, func(tx *bbolt.Tx) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		bucket := l.bucket(tx)
+		if bucket == nil {
+			return ErrBucketNotFound
+		}
+		index := listIndex(tx, l.name)
+		first, _ := bucket.Cursor().First()
+		if first == nil {
+			// The list is empty, so the elements can just be added
+			for _, value := range values {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				n, err := bucket.NextSequence()
+				if err != nil {
+					return err
+				}
+				if err := l.put(bucket, index, byteID(n), value); err != nil {
+					return err
+				}
+			}
+			return nil // Return from Update function
+		}
+		n := uint64(len(values))
+		top, room := keyRoom(first)
+		if room < n {
+			if err := l.db.rekeyList(bucket, index); err != nil {
+				return err
+			}
+			top, room = listMidpoint-1, listMidpoint
+		}
+		for i, value := range values {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := l.put(bucket, index, byteID(top-n+1+uint64(i)), value); err != nil {
+				return err
+			}
+		}
+		// Let the elements that are added later come after the prepended ones,
+		// which may be above the sequence if the list only had AddTimed keys
+		if bucket.Sequence() < top {
+			return bucket.SetSequence(top)
+		}
+		return nil // Return from Update function
+	})
+}
+
+// put stores a value at the given key, and adds it to the index, if any
+func (l *List) put(bucket, index *bbolt.Bucket, key []byte, value string) error {
+	encoded, err := l.db.encodeValue([]byte(value))
+	if err != nil {
+		return err
+	}
+	if err := bucket.Put(key, encoded); err != nil {
+		return err
+	}
+	if index != nil {
+		return indexAdd(index, []byte(value), key)
+	}
+	return nil
+}
+
+// AddCapped adds an element to the list and removes the oldest elements, so that
+// the list holds at most maxLen elements. Both are done within a single
+// transaction, so the list never holds more than maxLen elements, which makes it
+// useful for fixed-size logs. Returns ErrOutOfRange if maxLen is less than 1.
+func (l *List) AddCapped(value string, maxLen int) error {
+	if !l.exists() {
+		return ErrDoesNotExist
+	}
+	if maxLen < 1 {
+		return wrapError("List.AddCapped", l.name, "", ErrOutOfRange)
+	}
+	err := l.db.update("List", "AddCapped", func(tx *bbolt.Tx) error {
+		bucket := l.appendBucket(tx)
 		if bucket == nil {
 			return ErrBucketNotFound
 		}
@@ -120,129 +448,562 @@ func (l *List) Add(value string) error {
 		if err != nil {
 			return err
 		}
-		return bucket.Put(byteID(n), []byte(value))
+		encoded, err := l.db.encodeValue([]byte(value))
+		if err != nil {
+			return err
+		}
+		if err := bucket.Put(byteID(n), encoded); err != nil {
+			return err
+		}
+		index := listIndex(tx, l.name)
+		if index != nil {
+			if err := indexAdd(index, []byte(value), byteID(n)); err != nil {
+				return err
+			}
+		}
+		// Find the oldest element to keep, by stepping back from the end of the list
+		c := bucket.Cursor()
+		key, _ := c.Last()
+		for i := 1; i < maxLen && key != nil; i++ {
+			key, _ = c.Prev()
+		}
+		if key == nil {
+			// There are no more than maxLen elements
+			return nil // Return from Update function
+		}
+		oldest := append([]byte{}, key...)
+		// Remove the elements before it. Seek again after each deletion, since
+		// the cursor may skip a key when Next is called after Delete.
+		for key, value := c.First(); key != nil && bytes.Compare(key, oldest) < 0; key, value = c.First() {
+			if index != nil {
+				if err := l.db.indexRemoveEncoded(index, value, key); err != nil {
+					return err
+				}
+			}
+			if err := c.Delete(); err != nil {
+				return err
+			}
+		}
+		return nil // Return from Update function
+	})
+	return wrapError("List.AddCapped", l.name, "", err)
+}
+
+// AddTimed adds an element to the list, using the current time as the key, and
+// returns the time that was used. The keys are nanosecond timestamps, followed by
+// a counter for elements added within the same nanosecond, so the elements are
+// sorted chronologically, also if the bucket is re-created. This makes the list
+// usable as a time-series log.
+func (l *List) AddTimed(value string) (time.Time, error) {
+	var added time.Time
+	if !l.exists() {
+		return added, ErrDoesNotExist
+	}
+	err := l.db.update("List", "AddTimed", func(tx *bbolt.Tx) error {
+		bucket := l.appendBucket(tx)
+		if bucket == nil {
+			return ErrBucketNotFound
+		}
+		nanos := time.Now().UnixNano()
+		prefix := byteID(uint64(nanos))
+		// Find the next free counter for this nanosecond
+		var n uint32
+		c := bucket.Cursor()
+		for key, _ := c.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, _ = c.Next() {
+			if len(key) == timedIDLength {
+				n = binary.BigEndian.Uint32(key[8:]) + 1
+			}
+		}
+		encoded, err := l.db.encodeValue([]byte(value))
+		if err != nil {
+			return err
+		}
+		if err := bucket.Put(timedID(nanos, n), encoded); err != nil {
+			return err
+		}
+		if index := listIndex(tx, l.name); index != nil {
+			if err := indexAdd(index, []byte(value), timedID(nanos, n)); err != nil {
+				return err
+			}
+		}
+		added = time.Unix(0, nanos)
+		return nil // Return from Update function
 	})
+	return added, wrapError("List.AddTimed", l.name, "", err)
 }
 
 // All returns all elements in the list
 func (l *List) All() ([]string, error) {
+	return l.AllCtx(context.Background())
+}
+
+// AllCtx returns all elements in the list, like All, but stops and returns the
+// error of the context as soon as it is cancelled
+func (l *List) AllCtx(ctx context.Context) ([]string, error) {
 	var results []string
-	if l.name == nil {
+	if !l.exists() {
 		return nil, ErrDoesNotExist
 	}
-	err := (*bbolt.DB)(l.db).View(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket(l.name)
+	err := l.db.view("List", "All", func(tx *bbolt.Tx) error {
+		bucket := l.bucket(tx)
 		if bucket == nil {
 			return ErrBucketNotFound
 		}
 		return bucket.ForEach(func(_, value []byte) error {
-			results = append(results, string(value))
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			decoded, err := l.db.decodeValue(value)
+			if err != nil {
+				return err
+			}
+			results = append(results, string(decoded))
 			return nil // Continue ForEach
 		})
 	})
-	return results, err
+	return results, wrapError("List.All", l.name, "", err)
+}
+
+// GetAllFunc returns the elements in the list for which keep returns true, in
+// order, like All followed by filtering, but without holding all the elements in
+// memory at once. The list is iterated once, within a single read-only
+// transaction. Returns ErrNilFunc if keep is nil, just like the GetFunc family
+// of methods of the linked lists in the linkedlist package.
+func (l *List) GetAllFunc(keep func(value string) bool) ([]string, error) {
+	var results []string
+	if !l.exists() {
+		return nil, ErrDoesNotExist
+	}
+	if keep == nil {
+		return nil, ErrNilFunc
+	}
+	err := l.db.view("List", "GetAllFunc", func(tx *bbolt.Tx) error {
+		bucket := l.bucket(tx)
+		if bucket == nil {
+			return ErrBucketNotFound
+		}
+		return bucket.ForEach(func(_, value []byte) error {
+			decoded, err := l.db.decodeValue(value)
+			if err != nil {
+				return err
+			}
+			if keep(string(decoded)) {
+				results = append(results, string(decoded))
+			}
+			return nil // Continue ForEach
+		})
+	})
+	return results, wrapError("List.GetAllFunc", l.name, "", err)
+}
+
+// AddInt adds a number to the list, stored as a decimal string, just like the
+// numbers of KeyValue.Inc
+func (l *List) AddInt(n int64) error {
+	return l.Add(strconv.FormatInt(n, 10))
+}
+
+// GetAllInts returns all elements in the list, parsed as decimal numbers.
+// If an element is not a number, the returned *OpError has the index of the
+// element as the key, and wraps the *strconv.NumError.
+func (l *List) GetAllInts() ([]int64, error) {
+	all, err := l.All()
+	if err != nil {
+		return nil, err
+	}
+	numbers := make([]int64, len(all))
+	for i, value := range all {
+		if numbers[i], err = strconv.ParseInt(value, 10, 64); err != nil {
+			return nil, wrapError("List.GetAllInts", l.name, "index "+strconv.Itoa(i), err)
+		}
+	}
+	return numbers, nil
 }
 
 // Last will return the last element of a list
 func (l *List) Last() (string, error) {
 	var result string
-	if l.name == nil {
+	if !l.exists() {
 		return "", ErrDoesNotExist
 	}
-	err := (*bbolt.DB)(l.db).View(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket(l.name)
+	err := l.db.view("List", "Last", func(tx *bbolt.Tx) error {
+		bucket := l.bucket(tx)
 		if bucket == nil {
 			return ErrBucketNotFound
 		}
 		cursor := bucket.Cursor()
 		// Ignore the key
 		_, value := cursor.Last()
-		result = string(value)
+		decoded, err := l.db.decodeValue(value)
+		if err != nil {
+			return err
+		}
+		result = string(decoded)
 		return nil // Return from View function
 	})
-	return result, err
+	return result, wrapError("List.Last", l.name, "", err)
 }
 
-// LastN will return the last N elements of a list
+// LastN will return the last N elements of a list. Returns ErrOutOfRange if the
+// list has fewer than N elements.
 func (l *List) LastN(n int) ([]string, error) {
 	var results []string
-	if l.name == nil {
+	if !l.exists() {
 		return nil, ErrDoesNotExist
 	}
-	err := (*bbolt.DB)(l.db).View(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket(l.name)
+	err := l.db.view("List", "LastN", func(tx *bbolt.Tx) error {
+		bucket := l.bucket(tx)
 		if bucket == nil {
 			return ErrBucketNotFound
 		}
+		// Step back n elements from the end of the list. The keys can not be used
+		// for calculating the position, since elements may have been removed, or
+		// added with AddTimed.
+		if n <= 0 {
+			return nil // Return from View function
+		}
 		c := bucket.Cursor()
-		sizeBytes, _ := c.Last()
-		size := binary.BigEndian.Uint64(sizeBytes)
-		if size < uint64(n) {
-			return errors.New("Too few items in list")
-		}
-		// Ok, fetch the n last items. startPos is counting from (size - n)+1.
-		// +1 because Seek() moves to a specific key.
-		// e.g. if the size of the list is, say, 50, and we want the last 4
-		// elements, say, from 47 to 50 inclusive, then the calculation would be like this:
-		// size = 50
-		// n = 4
-		// startPos = size - n // startPos = 46
-		// startPos += 1 // startPos = 47
-		startPos := byteID(size - uint64(n) + 1)
-		for key, value := c.Seek(startPos); key != nil; key, value = c.Next() {
-			results = append(results, string(value))
+		key, _ := c.Last()
+		for i := 1; i < n && key != nil; i++ {
+			key, _ = c.Prev()
+		}
+		if key == nil {
+			return fmt.Errorf("%w: too few items in list", ErrOutOfRange)
+		}
+		// Ok, fetch the n last items, from the current position
+		for key, value := c.Seek(key); key != nil; key, value = c.Next() {
+			decoded, err := l.db.decodeValue(value)
+			if err != nil {
+				return err
+			}
+			results = append(results, string(decoded))
 		}
 		return nil // Return from View function
 	})
-	return results, err
+	return results, wrapError("List.LastN", l.name, "", err)
+}
+
+// IndexOf returns the position of the first element in the list that is equal
+// to the given value, counting from 0. Returns -1 if the value is not in the list.
+// For lists with a value index, see NewIndexedList, the values are not read.
+func (l *List) IndexOf(value string) (int, error) {
+	index := -1
+	if !l.exists() {
+		return index, ErrDoesNotExist
+	}
+	err := l.db.view("List", "IndexOf", func(tx *bbolt.Tx) error {
+		bucket := l.bucket(tx)
+		if bucket == nil {
+			return ErrBucketNotFound
+		}
+		if valueIndex := listIndex(tx, l.name); valueIndex != nil {
+			keys := indexKeys(valueIndex, []byte(value))
+			if len(keys) == 0 {
+				return nil // Return from View function
+			}
+			// Count the elements before the first match, without reading the values
+			c := bucket.Cursor()
+			i := 0
+			for key, _ := c.First(); key != nil && !bytes.Equal(key, keys[0]); key, _ = c.Next() {
+				i++
+			}
+			index = i
+			return nil // Return from View function
+		}
+		i := 0
+		err := bucket.ForEach(func(_, byteValue []byte) error {
+			decoded, err := l.db.decodeValue(byteValue)
+			if err != nil {
+				return err
+			}
+			if value == string(decoded) {
+				index = i
+				return errFoundIt // break the ForEach by returning an error
+			}
+			i++
+			return nil // Continue ForEach
+		})
+		if err == errFoundIt {
+			return nil // Return from View function
+		}
+		return err
+	})
+	return index, wrapError("List.IndexOf", l.name, value, err)
+}
+
+// RemoveByIndex will remove the element at the given position in the list.
+// Negative indices count from the end of the list, -1 being the last element.
+// Returns ErrOutOfRange if there is no element at the given position.
+func (l *List) RemoveByIndex(index int) error {
+	if !l.exists() {
+		return ErrDoesNotExist
+	}
+	err := l.db.update("List", "RemoveByIndex", func(tx *bbolt.Tx) error {
+		bucket := l.bucket(tx)
+		if bucket == nil {
+			return ErrBucketNotFound
+		}
+		c := bucket.Cursor()
+		var key, value []byte
+		if index >= 0 {
+			key, value = c.First()
+			for i := 0; i < index && key != nil; i++ {
+				key, value = c.Next()
+			}
+		} else {
+			key, value = c.Last()
+			for i := -1; i > index && key != nil; i-- {
+				key, value = c.Prev()
+			}
+		}
+		if key == nil {
+			return ErrOutOfRange
+		}
+		if valueIndex := listIndex(tx, l.name); valueIndex != nil {
+			if err := l.db.indexRemoveEncoded(valueIndex, value, key); err != nil {
+				return err
+			}
+		}
+		return c.Delete()
+	})
+	return wrapError("List.RemoveByIndex", l.name, "", err)
+}
+
+// GetByKey returns the element with the given key, as returned by
+// AddReturningKey. Returns ErrKeyNotFound if there is no such element.
+func (l *List) GetByKey(key uint64) (string, error) {
+	var val string
+	if !l.exists() {
+		return "", ErrDoesNotExist
+	}
+	err := l.db.view("List", "GetByKey", func(tx *bbolt.Tx) error {
+		bucket := l.bucket(tx)
+		if bucket == nil {
+			return ErrBucketNotFound
+		}
+		value := bucket.Get(byteID(key))
+		if value == nil {
+			return ErrKeyNotFound
+		}
+		decoded, err := l.db.decodeValue(value)
+		if err != nil {
+			return err
+		}
+		val = string(decoded)
+		return nil // Return from View function
+	})
+	return val, wrapError("List.GetByKey", l.name, strconv.FormatUint(key, 10), err)
+}
+
+// DeleteByKey removes the element with the given key, as returned by
+// AddReturningKey. Returns ErrKeyNotFound if there is no such element.
+func (l *List) DeleteByKey(key uint64) error {
+	if !l.exists() {
+		return ErrDoesNotExist
+	}
+	err := l.db.update("List", "DeleteByKey", func(tx *bbolt.Tx) error {
+		bucket := l.bucket(tx)
+		if bucket == nil {
+			return ErrBucketNotFound
+		}
+		value := bucket.Get(byteID(key))
+		if value == nil {
+			return ErrKeyNotFound
+		}
+		if index := listIndex(tx, l.name); index != nil {
+			if err := l.db.indexRemoveEncoded(index, value, byteID(key)); err != nil {
+				return err
+			}
+		}
+		return bucket.Delete(byteID(key))
+	})
+	return wrapError("List.DeleteByKey", l.name, strconv.FormatUint(key, 10), err)
+}
+
+// PopN will remove up to n elements from the front of the list, the oldest
+// first, and return them. Fewer elements are returned if the list is shorter.
+// The elements are read and removed within a single transaction, so either all
+// of them are removed or none of them are.
+func (l *List) PopN(n int) ([]string, error) {
+	var results []string
+	if !l.exists() {
+		return nil, ErrDoesNotExist
+	}
+	err := l.db.update("List", "PopN", func(tx *bbolt.Tx) error {
+		bucket := l.bucket(tx)
+		if bucket == nil {
+			return ErrBucketNotFound
+		}
+		valueIndex := listIndex(tx, l.name)
+		// Seek to the first key again after each deletion, since the cursor may
+		// skip a key when Next is called after Delete
+		c := bucket.Cursor()
+		for key, value := c.First(); key != nil && len(results) < n; key, value = c.First() {
+			decoded, err := l.db.decodeValue(value)
+			if err != nil {
+				return err
+			}
+			// Convert the value before deleting, since it is only valid until then
+			results = append(results, string(decoded))
+			if valueIndex != nil {
+				if err := indexRemove(valueIndex, decoded, key); err != nil {
+					return err
+				}
+			}
+			if err := c.Delete(); err != nil {
+				return err
+			}
+		}
+		return nil // Return from Update function
+	})
+	if err != nil {
+		return nil, wrapError("List.PopN", l.name, "", err)
+	}
+	return results, nil
+}
+
+// exists reports whether the list has been created and not removed
+func (l *List) exists() bool {
+	return l.name != nil && !l.removed.Load()
 }
 
 // Remove this list
+//
+// Removing a list that is already removed, also through another handle or by
+// another program, does nothing. The other methods return ErrDoesNotExist
+// after Remove, until Recreate is called.
 func (l *List) Remove() error {
-	err := (*bbolt.DB)(l.db).Update(func(tx *bbolt.Tx) error {
-		return tx.DeleteBucket(l.name)
+	if l.name == nil {
+		return ErrDoesNotExist
+	}
+	err := l.db.update("List", "Remove", func(tx *bbolt.Tx) error {
+		if listIndex(tx, l.name) != nil {
+			if err := tx.DeleteBucket(indexName(l.name)); err != nil {
+				return err
+			}
+			if err := unregisterType(tx, indexName(l.name)); err != nil {
+				return err
+			}
+		}
+		if err := unregisterType(tx, l.name); err != nil {
+			return err
+		}
+		return deleteBucket(tx, l.name)
 	})
-	// Mark as removed by setting the name to nil
-	l.name = nil
-	return err
+	if err == nil {
+		l.removed.Store(true)
+	}
+	return wrapError("List.Remove", l.name, "", err)
+}
+
+// Recreate creates the bucket of the list again, after it has been removed, so
+// that the same handle can be used again. The list is then empty. It does
+// nothing if the list already exists.
+func (l *List) Recreate() error {
+	if l.name == nil {
+		return ErrDoesNotExist
+	}
+	err := l.db.update("List", "Recreate", func(tx *bbolt.Tx) error {
+		if _, err := createList(tx, l.name); err != nil {
+			return err
+		}
+		return registerType(tx, l.name, "List")
+	})
+	if err == nil {
+		l.removed.Store(false)
+	}
+	return wrapError("List.Recreate", l.name, "", err)
 }
 
 // Clear will remove all elements from this list
 func (l *List) Clear() error {
-	if l.name == nil {
+	if !l.exists() {
 		return ErrDoesNotExist
 	}
-	return (*bbolt.DB)(l.db).Update(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket(l.name)
+	err := l.db.update("List", "Clear", func(tx *bbolt.Tx) error {
+		bucket := l.bucket(tx)
 		if bucket == nil {
 			return ErrBucketNotFound
 		}
+		if listIndex(tx, l.name) != nil {
+			// Empty the index by re-creating it
+			if err := tx.DeleteBucket(indexName(l.name)); err != nil {
+				return err
+			}
+			if _, err := tx.CreateBucket(indexName(l.name)); err != nil {
+				return err
+			}
+		}
 		return bucket.ForEach(func(key, _ []byte) error {
 			return bucket.Delete(key)
 		})
 	})
+	return wrapError("List.Clear", l.name, "", err)
 }
 
 /* --- Set functions --- */
 
-// NewSet loads or creates a new Set struct, with the given ID
-func NewSet(db *Database, id string) (*Set, error) {
+// NewSet loads or creates a new Set struct, with the given ID and options,
+// like WithFillPercent
+func NewSet(db *Database, id string, opts ...BucketOption) (*Set, error) {
 	name := []byte(id)
-	if err := (*bbolt.DB)(db).Update(func(tx *bbolt.Tx) error {
+	if err := ValidateID(id); err != nil {
+		return nil, wrapError("NewSet", name, "", err)
+	}
+	o, err := applyBucketOptions(opts)
+	if err != nil {
+		return nil, wrapError("NewSet", name, "", err)
+	}
+	if err := db.update("Set", "New", func(tx *bbolt.Tx) error {
 		if _, err := tx.CreateBucketIfNotExists(name); err != nil {
-			return errors.New("Could not create bucket: " + err.Error())
+			return fmt.Errorf("Could not create bucket: %w", err)
 		}
-		return nil // Return from Update function
+		return registerType(tx, name, "Set")
 	}); err != nil {
-		return nil, err
+		return nil, wrapError("NewSet", name, "", err)
 	}
 	// Success
-	return &Set{db, name}, nil
+	return (*Set)(newBucket(db, name, o)), nil
+}
+
+// OpenSet loads an existing Set struct, with the given ID and options.
+// Returns ErrBucketNotFound if it does not already exist.
+func OpenSet(db *Database, id string, opts ...BucketOption) (*Set, error) {
+	name := []byte(id)
+	if err := ValidateID(id); err != nil {
+		return nil, wrapError("OpenSet", name, "", err)
+	}
+	o, err := applyBucketOptions(opts)
+	if err != nil {
+		return nil, wrapError("OpenSet", name, "", err)
+	}
+	if err := db.checkBucket("Set", name); err != nil {
+		return nil, wrapError("OpenSet", name, "", err)
+	}
+	return (*Set)(newBucket(db, name, o)), nil
+}
+
+// SetFillPercent sets how full the pages of the bucket of the set are filled
+// when they are split, by the methods that modify the set. See
+// List.SetFillPercent. When no fill percent has been set, Add and AddIfAbsent
+// fill the pages completely, since the keys of new elements are increasing.
+func (s *Set) SetFillPercent(fillPercent float64) {
+	s.fillPercent.Store(fillPercent)
+}
+
+// bucket returns the bucket of the set within the given transaction, with the
+// fill percent of the set, or nil if the bucket does not exist
+func (s *Set) bucket(tx *bbolt.Tx) *bbolt.Bucket {
+	return withFillPercent(tx.Bucket(s.name), s.fillPercent.Load(), 0)
+}
+
+// appendBucket returns the bucket of the set, like bucket, for adding elements
+func (s *Set) appendBucket(tx *bbolt.Tx) *bbolt.Bucket {
+	return withFillPercent(tx.Bucket(s.name), s.fillPercent.Load(), appendFillPercent)
 }
 
 // Add an element to the set
 func (s *Set) Add(value string) error {
-	if s.name == nil {
+	if !s.exists() {
 		return ErrDoesNotExist
 	}
 	exists, err := s.Has(value)
@@ -250,102 +1011,215 @@ func (s *Set) Add(value string) error {
 		return err
 	}
 	if exists {
-		return ErrExistsInSet
+		return wrapError("Set.Add", s.name, value, ErrExistsInSet)
 	}
-	return (*bbolt.DB)(s.db).Update(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket(s.name)
+	err = s.db.update("Set", "Add", func(tx *bbolt.Tx) error {
+		bucket := s.appendBucket(tx)
 		if bucket == nil {
 			return ErrBucketNotFound
 		}
-		n, err := bucket.NextSequence()
-		if err != nil {
+		return s.db.putMember(bucket, value)
+	})
+	return wrapError("Set.Add", s.name, value, err)
+}
+
+// AddIfAbsent adds an element to the set, if it is not already there.
+// Returns true if the element was added and false if it already existed.
+// Both the check and the insertion are done within the same transaction.
+func (s *Set) AddIfAbsent(value string) (bool, error) {
+	var added bool
+	if !s.exists() {
+		return false, ErrDoesNotExist
+	}
+	err := s.db.update("Set", "AddIfAbsent", func(tx *bbolt.Tx) error {
+		bucket := s.appendBucket(tx)
+		if bucket == nil {
+			return ErrBucketNotFound
+		}
+		key, err := s.db.setKey(bucket, value)
+		if err != nil || key != nil {
+			return err // Return from Update function
+		}
+		if err := s.db.putMember(bucket, value); err != nil {
 			return err
 		}
-		return bucket.Put(byteID(n), []byte(value))
+		added = true
+		return nil // Return from Update function
 	})
+	return added, wrapError("Set.AddIfAbsent", s.name, value, err)
 }
 
 // Has will check if a given value is in the set
 func (s *Set) Has(value string) (bool, error) {
 	var exists bool
-	if s.name == nil {
+	if !s.exists() {
 		return false, ErrDoesNotExist
 	}
-	err := (*bbolt.DB)(s.db).View(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket(s.name)
+	err := s.db.view("Set", "Has", func(tx *bbolt.Tx) error {
+		bucket := s.bucket(tx)
 		if bucket == nil {
 			return ErrBucketNotFound
 		}
-		bucket.ForEach(func(_, byteValue []byte) error {
-			if value == string(byteValue) {
-				exists = true
-				return errFoundIt // break the ForEach by returning an error
-			}
-			return nil // Continue ForEach
-		})
-		return nil // Return from View function
+		key, err := s.db.setKey(bucket, value)
+		exists = key != nil
+		return err // Return from View function
 	})
-	return exists, err
+	return exists, wrapError("Set.Has", s.name, value, err)
 }
 
-// All returns all elements in the set
+// All returns all elements in the set, in the order in which they were added.
+// The keys of the elements are big-endian sequence numbers, so the order holds
+// for any number of elements.
 func (s *Set) All() ([]string, error) {
+	return s.AllCtx(context.Background())
+}
+
+// AllCtx returns all elements in the set, like All, but stops and returns the
+// error of the context as soon as it is cancelled
+func (s *Set) AllCtx(ctx context.Context) ([]string, error) {
 	var values []string
-	if s.name == nil {
+	if !s.exists() {
 		return nil, ErrDoesNotExist
 	}
-	err := (*bbolt.DB)(s.db).View(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket(s.name)
+	err := s.db.view("Set", "All", func(tx *bbolt.Tx) error {
+		bucket := s.bucket(tx)
 		if bucket == nil {
 			return ErrBucketNotFound
 		}
-		return bucket.ForEach(func(_, value []byte) error {
-			values = append(values, string(value))
+		return s.db.forEachMember(bucket, func(_ []byte, value string) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			values = append(values, value)
 			return nil // Return from ForEach function
 		})
 	})
-	return values, err
+	return values, wrapError("Set.All", s.name, "", err)
 }
 
 // Del will remove an element from the set
 func (s *Set) Del(value string) error {
-	if s.name == nil {
+	if !s.exists() {
 		return ErrDoesNotExist
 	}
-	return (*bbolt.DB)(s.db).Update(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket(s.name)
+	err := s.db.update("Set", "Del", func(tx *bbolt.Tx) error {
+		bucket := s.bucket(tx)
 		if bucket == nil {
 			return ErrBucketNotFound
 		}
-		var foundKey []byte
-		bucket.ForEach(func(byteKey, byteValue []byte) error {
-			if value == string(byteValue) {
-				foundKey = byteKey
-				return errFoundIt // break the ForEach by returning an error
+		foundKey, err := s.db.setKey(bucket, value)
+		if err != nil {
+			return err
+		}
+		return bucket.Delete(foundKey)
+	})
+	return wrapError("Set.Del", s.name, value, err)
+}
+
+// DelBatch will remove all the given values from the set, within a single
+// transaction, and return the number of values that were removed.
+func (s *Set) DelBatch(values []string) (int, error) {
+	return s.DelBatchCtx(context.Background(), values)
+}
+
+// DelBatchCtx works like DelBatch, but stops and returns the error of the
+// context as soon as it is cancelled. Then none of the values are removed.
+func (s *Set) DelBatchCtx(ctx context.Context, values []string) (int, error) {
+	if !s.exists() {
+		return 0, ErrDoesNotExist
+	}
+	deleted := 0
+	err := s.db.update("Set", "DelBatch", func(tx *bbolt.Tx) error {
+		bucket := s.bucket(tx)
+		if bucket == nil {
+			return ErrBucketNotFound
+		}
+		wanted := make(map[string]bool, len(values))
+		for _, value := range values {
+			wanted[value] = true
+		}
+		// Find all the keys first, since the bucket can not be modified within ForEach
+		var foundKeys [][]byte
+		if err := s.db.forEachMember(bucket, func(byteKey []byte, value string) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if wanted[value] {
+				foundKeys = append(foundKeys, append([]byte{}, byteKey...))
 			}
 			return nil // Continue ForEach
-		})
-		return bucket.Delete([]byte(foundKey))
+		}); err != nil {
+			return err
+		}
+		for _, key := range foundKeys {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := bucket.Delete(key); err != nil {
+				return err
+			}
+			deleted++
+		}
+		return nil // Return from Update function
 	})
+	if err != nil {
+		return 0, wrapError("Set.DelBatch", s.name, "", err)
+	}
+	return deleted, nil
+}
+
+// exists reports whether the set has been created and not removed
+func (s *Set) exists() bool {
+	return s.name != nil && !s.removed.Load()
 }
 
 // Remove this set
+//
+// Removing a set that is already removed, also through another handle or by
+// another program, does nothing. The other methods return ErrDoesNotExist
+// after Remove, until Recreate is called.
 func (s *Set) Remove() error {
-	err := (*bbolt.DB)(s.db).Update(func(tx *bbolt.Tx) error {
-		return tx.DeleteBucket(s.name)
+	if s.name == nil {
+		return ErrDoesNotExist
+	}
+	err := s.db.update("Set", "Remove", func(tx *bbolt.Tx) error {
+		if err := unregisterType(tx, s.name); err != nil {
+			return err
+		}
+		return deleteBucket(tx, s.name)
 	})
-	// Mark as removed by setting the name to nil
-	s.name = nil
-	return err
+	if err == nil {
+		s.removed.Store(true)
+	}
+	return wrapError("Set.Remove", s.name, "", err)
+}
+
+// Recreate creates the bucket of the set again, after it has been removed, so
+// that the same handle can be used again. The set is then empty. It does
+// nothing if the set already exists.
+func (s *Set) Recreate() error {
+	if s.name == nil {
+		return ErrDoesNotExist
+	}
+	err := s.db.update("Set", "Recreate", func(tx *bbolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(s.name); err != nil {
+			return fmt.Errorf("Could not create bucket: %w", err)
+		}
+		return registerType(tx, s.name, "Set")
+	})
+	if err == nil {
+		s.removed.Store(false)
+	}
+	return wrapError("Set.Recreate", s.name, "", err)
 }
 
 // Clear will remove all elements from this set
 func (s *Set) Clear() error {
-	if s.name == nil {
+	if !s.exists() {
 		return ErrDoesNotExist
 	}
-	return (*bbolt.DB)(s.db).Update(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket(s.name)
+	err := s.db.update("Set", "Clear", func(tx *bbolt.Tx) error {
+		bucket := s.bucket(tx)
 		if bucket == nil {
 			return ErrBucketNotFound
 		}
@@ -353,50 +1227,258 @@ func (s *Set) Clear() error {
 			return bucket.Delete(key)
 		})
 	})
+	return wrapError("Set.Clear", s.name, "", err)
+}
+
+// UnionWith adds the elements of the other set that are not already in this
+// set to this set, within a single transaction. Both sets must be stored in
+// the same database.
+func (s *Set) UnionWith(other *Set) error {
+	return s.combine("Set.UnionWith", other, func(bucket *bbolt.Bucket, values, otherValues []string, keys [][]byte) error {
+		has := make(map[string]bool, len(values))
+		for _, value := range values {
+			has[value] = true
+		}
+		for _, value := range otherValues {
+			if has[value] {
+				continue
+			}
+			if err := s.db.putMember(bucket, value); err != nil {
+				return err
+			}
+			has[value] = true
+		}
+		return nil
+	})
+}
+
+// IntersectWith removes the elements that are not in the other set from this
+// set, within a single transaction. Both sets must be stored in the same
+// database.
+func (s *Set) IntersectWith(other *Set) error {
+	return s.combine("Set.IntersectWith", other, func(bucket *bbolt.Bucket, values, otherValues []string, keys [][]byte) error {
+		return deleteMembers(bucket, values, keys, otherValues, false)
+	})
+}
+
+// DifferenceWith removes the elements that are also in the other set from this
+// set, within a single transaction. Both sets must be stored in the same
+// database.
+func (s *Set) DifferenceWith(other *Set) error {
+	return s.combine("Set.DifferenceWith", other, func(bucket *bbolt.Bucket, values, otherValues []string, keys [][]byte) error {
+		return deleteMembers(bucket, values, keys, otherValues, true)
+	})
+}
+
+// combine calls fn within a single Update transaction, with the bucket of this
+// set, the values of both sets and the keys of the values of this set
+func (s *Set) combine(op string, other *Set, fn func(bucket *bbolt.Bucket, values, otherValues []string, keys [][]byte) error) error {
+	if !s.exists() || other == nil || !other.exists() {
+		return ErrDoesNotExist
+	}
+	if other.db != s.db {
+		return wrapError(op, s.name, "", ErrDifferentDatabase)
+	}
+	err := s.db.update("Set", strings.TrimPrefix(op, "Set."), func(tx *bbolt.Tx) error {
+		bucket := s.bucket(tx)
+		otherBucket := tx.Bucket(other.name)
+		if bucket == nil || otherBucket == nil {
+			return ErrBucketNotFound
+		}
+		var (
+			values, otherValues []string
+			keys                [][]byte
+		)
+		// Read both sets first, since the bucket can not be modified within ForEach
+		if err := s.db.forEachMember(bucket, func(byteKey []byte, value string) error {
+			keys = append(keys, append([]byte{}, byteKey...))
+			values = append(values, value)
+			return nil // Continue ForEach
+		}); err != nil {
+			return err
+		}
+		if err := s.db.forEachMember(otherBucket, func(_ []byte, value string) error {
+			otherValues = append(otherValues, value)
+			return nil // Continue ForEach
+		}); err != nil {
+			return err
+		}
+		return fn(bucket, values, otherValues, keys)
+	})
+	return wrapError(op, s.name, "", err)
+}
+
+// deleteMembers deletes the values of a set that are in the given other values,
+// if inOther is true, or that are not, if inOther is false
+func deleteMembers(bucket *bbolt.Bucket, values []string, keys [][]byte, otherValues []string, inOther bool) error {
+	has := make(map[string]bool, len(otherValues))
+	for _, value := range otherValues {
+		has[value] = true
+	}
+	for i, value := range values {
+		if has[value] != inOther {
+			continue
+		}
+		if err := bucket.Delete(keys[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MoveBetweenSets removes the given value from one set and adds it to another,
+// within a single transaction, so that the value is never in neither or both of
+// the sets. The value is just removed from the first set if it is already in the
+// other set. Both sets must be stored in the same database.
+// Returns ErrDoesNotExist if the value is not in the first set.
+func MoveBetweenSets(from, to *Set, value string) error {
+	if from == nil || !from.exists() || to == nil || !to.exists() {
+		return ErrDoesNotExist
+	}
+	if from.db != to.db {
+		return wrapError("MoveBetweenSets", from.name, value, ErrDifferentDatabase)
+	}
+	err := from.db.update("Set", "MoveBetweenSets", func(tx *bbolt.Tx) error {
+		fromBucket := tx.Bucket(from.name)
+		toBucket := tx.Bucket(to.name)
+		if fromBucket == nil || toBucket == nil {
+			return ErrBucketNotFound
+		}
+		fromKey, err := from.db.setKey(fromBucket, value)
+		if err != nil {
+			return err
+		}
+		if fromKey == nil {
+			return ErrDoesNotExist
+		}
+		if err := fromBucket.Delete(fromKey); err != nil {
+			return err
+		}
+		toKey, err := to.db.setKey(toBucket, value)
+		if err != nil || toKey != nil {
+			return err // Already in the other set, if there is no error
+		}
+		return to.db.putMember(toBucket, value)
+	})
+	return wrapError("MoveBetweenSets", from.name, value, err)
+}
+
+// setKey returns a copy of the key of the given value in the bucket of a set,
+// or nil if the value is not in the set. The members are decrypted one by one,
+// since an encrypted member can not be compared with the value.
+func (db *Database) setKey(bucket *bbolt.Bucket, value string) ([]byte, error) {
+	var foundKey []byte
+	err := db.forEachMember(bucket, func(key []byte, member string) error {
+		if member == value {
+			foundKey = append([]byte{}, key...)
+			return errFoundIt // break the ForEach by returning an error
+		}
+		return nil // Continue ForEach
+	})
+	if err != nil && err != errFoundIt {
+		return nil, err
+	}
+	return foundKey, nil
+}
+
+// forEachMember calls fn with the key and the decrypted value of every member
+// in the bucket of a set, in order, until fn returns an error
+func (db *Database) forEachMember(bucket *bbolt.Bucket, fn func(key []byte, value string) error) error {
+	return bucket.ForEach(func(key, stored []byte) error {
+		value, err := db.DecryptValue(stored)
+		if err != nil {
+			return err
+		}
+		return fn(key, string(value))
+	})
+}
+
+// putMember encrypts the given value and adds it to the bucket of a set, with
+// the next sequence number as the key
+func (db *Database) putMember(bucket *bbolt.Bucket, value string) error {
+	n, err := bucket.NextSequence()
+	if err != nil {
+		return err
+	}
+	encrypted, err := db.EncryptValue([]byte(value))
+	if err != nil {
+		return err
+	}
+	return bucket.Put(byteID(n), encrypted)
 }
 
 /* --- HashMap functions --- */
 
-// NewHashMap loads or creates a new HashMap struct, with the given ID
-func NewHashMap(db *Database, id string) (*HashMap, error) {
+// NewHashMap loads or creates a new HashMap struct, with the given ID and options,
+// like WithFillPercent
+func NewHashMap(db *Database, id string, opts ...BucketOption) (*HashMap, error) {
 	name := []byte(id)
-	if err := (*bbolt.DB)(db).Update(func(tx *bbolt.Tx) error {
+	if err := ValidateID(id); err != nil {
+		return nil, wrapError("NewHashMap", name, "", err)
+	}
+	o, err := applyBucketOptions(opts)
+	if err != nil {
+		return nil, wrapError("NewHashMap", name, "", err)
+	}
+	if err := db.update("HashMap", "New", func(tx *bbolt.Tx) error {
 		if _, err := tx.CreateBucketIfNotExists(name); err != nil {
-			return errors.New("Could not create bucket: " + err.Error())
+			return fmt.Errorf("Could not create bucket: %w", err)
 		}
-		return nil // Return from Update function
+		return registerType(tx, name, "HashMap")
 	}); err != nil {
-		return nil, err
+		return nil, wrapError("NewHashMap", name, "", err)
+	}
+	// Success
+	return (*HashMap)(newBucket(db, name, o)), nil
+}
+
+// OpenHashMap loads an existing HashMap struct, with the given ID and options.
+// Returns ErrBucketNotFound if it does not already exist.
+func OpenHashMap(db *Database, id string, opts ...BucketOption) (*HashMap, error) {
+	name := []byte(id)
+	if err := ValidateID(id); err != nil {
+		return nil, wrapError("OpenHashMap", name, "", err)
+	}
+	o, err := applyBucketOptions(opts)
+	if err != nil {
+		return nil, wrapError("OpenHashMap", name, "", err)
 	}
-	// Success
-	return &HashMap{db, name}, nil
+	if err := db.checkBucket("HashMap", name); err != nil {
+		return nil, wrapError("OpenHashMap", name, "", err)
+	}
+	return (*HashMap)(newBucket(db, name, o)), nil
 }
 
 // Set a value in a hashmap given the element id (for instance a user id) and the key (for instance "password")
 func (h *HashMap) Set(elementid, key, value string) error {
-	if h.name == nil {
+	if !h.exists() {
 		return ErrDoesNotExist
 	}
 	if strings.Contains(elementid, ":") {
-		return ErrInvalidID
+		return wrapError("HashMap.Set", h.name, elementid, ErrInvalidID)
 	}
-	return (*bbolt.DB)(h.db).Update(func(tx *bbolt.Tx) error {
+	err := h.db.update("HashMap", "Set", func(tx *bbolt.Tx) error {
 		bucket := tx.Bucket(h.name)
 		if bucket == nil {
 			return ErrBucketNotFound
 		}
+		encoded, err := h.db.encodeValue([]byte(value))
+		if err != nil {
+			return err
+		}
 		// Store the key and value
-		return bucket.Put([]byte(elementid+":"+key), []byte(value))
+		return bucket.Put([]byte(elementid+":"+key), encoded)
 	})
+	return wrapError("HashMap.Set", h.name, elementid+":"+key, err)
 }
 
 // All returns all ID's, for all hash elements
 func (h *HashMap) All() ([]string, error) {
 	var results []string
-	if h.name == nil {
+	if !h.exists() {
 		return nil, ErrDoesNotExist
 	}
-	err := (*bbolt.DB)(h.db).View(func(tx *bbolt.Tx) error {
+	err := h.db.view("HashMap", "All", func(tx *bbolt.Tx) error {
 		bucket := tx.Bucket(h.name)
 		if bucket == nil {
 			return ErrBucketNotFound
@@ -417,16 +1499,63 @@ func (h *HashMap) All() ([]string, error) {
 			return nil // Continue ForEach
 		})
 	})
-	return results, err
+	return results, wrapError("HashMap.All", h.name, "", err)
+}
+
+// GetAllMaps returns every element id, mapped to all the keys and values of
+// that element. The bucket is scanned once, within a single transaction, which
+// makes this useful for exporting or caching a whole hash map.
+func (h *HashMap) GetAllMaps() (map[string]map[string]string, error) {
+	return h.GetAllMapsCtx(context.Background())
+}
+
+// GetAllMapsCtx works like GetAllMaps, but stops and returns the error of the
+// context as soon as it is cancelled
+func (h *HashMap) GetAllMapsCtx(ctx context.Context) (map[string]map[string]string, error) {
+	if !h.exists() {
+		return nil, ErrDoesNotExist
+	}
+	results := make(map[string]map[string]string)
+	err := h.db.view("HashMap", "GetAllMaps", func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(h.name)
+		if bucket == nil {
+			return ErrBucketNotFound
+		}
+		return bucket.ForEach(func(byteKey, byteValue []byte) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			// The keys are grouped by element id, since they start with "elementid:"
+			fields := strings.SplitN(string(byteKey), ":", 2)
+			if len(fields) != 2 {
+				return nil // Continue ForEach
+			}
+			decoded, err := h.db.decodeValue(byteValue)
+			if err != nil {
+				return err
+			}
+			element, ok := results[fields[0]]
+			if !ok {
+				element = make(map[string]string)
+				results[fields[0]] = element
+			}
+			element[fields[1]] = string(decoded)
+			return nil // Continue ForEach
+		})
+	})
+	if err != nil {
+		return nil, wrapError("HashMap.GetAllMaps", h.name, "", err)
+	}
+	return results, nil
 }
 
 // Get a value from a hashmap given the element id (for instance a user id) and the key (for instance "password")
 func (h *HashMap) Get(elementid, key string) (string, error) {
 	var val string
-	if h.name == nil {
+	if !h.exists() {
 		return "", ErrDoesNotExist
 	}
-	err := (*bbolt.DB)(h.db).View(func(tx *bbolt.Tx) error {
+	err := h.db.view("HashMap", "Get", func(tx *bbolt.Tx) error {
 		bucket := tx.Bucket(h.name)
 		if bucket == nil {
 			return ErrBucketNotFound
@@ -435,19 +1564,24 @@ func (h *HashMap) Get(elementid, key string) (string, error) {
 		if byteval == nil {
 			return ErrKeyNotFound
 		}
-		val = string(byteval)
+		decoded, err := h.db.decodeValue(byteval)
+		if err != nil {
+			return err
+		}
+		val = string(decoded)
 		return nil // Return from View function
 	})
-	return val, err
+	return val, wrapError("HashMap.Get", h.name, elementid+":"+key, err)
 }
 
-// Has will check if a given elementid + key is in the hash map
+// Has will check if a given elementid + key is in the hash map, that is, if the
+// element has the given field. See Exists for checking if the element has any fields.
 func (h *HashMap) Has(elementid, key string) (bool, error) {
 	var found bool
-	if h.name == nil {
+	if !h.exists() {
 		return false, ErrDoesNotExist
 	}
-	err := (*bbolt.DB)(h.db).View(func(tx *bbolt.Tx) error {
+	err := h.db.view("HashMap", "Has", func(tx *bbolt.Tx) error {
 		bucket := tx.Bucket(h.name)
 		if bucket == nil {
 			return ErrBucketNotFound
@@ -458,79 +1592,72 @@ func (h *HashMap) Has(elementid, key string) (bool, error) {
 		}
 		return nil // Return from View function
 	})
-	return found, err
+	return found, wrapError("HashMap.Has", h.name, elementid+":"+key, err)
 }
 
 // Keys returns all names of all keys of a given owner.
 func (h *HashMap) Keys(owner string) ([]string, error) {
 	var props []string
-	err := (*bbolt.DB)(h.db).View(func(tx *bbolt.Tx) error {
+	err := h.db.view("HashMap", "Keys", func(tx *bbolt.Tx) error {
 		bucket := tx.Bucket(h.name)
 		if bucket == nil {
 			return ErrBucketNotFound
 		}
-		// Loop through the keys
-		return bucket.ForEach(func(byteKey, _ []byte) error {
-			combinedKey := string(byteKey)
-			if strings.HasPrefix(combinedKey, owner+":") {
-				// Store the right side of the bucket key, after ":"
-				fields := strings.SplitN(combinedKey, ":", 2)
-				props = append(props, string(fields[1]))
-			}
-			return nil // Continue ForEach
-		})
+		// Loop through the keys that start with owner + ":"
+		prefix := []byte(owner + ":")
+		c := bucket.Cursor()
+		for byteKey, _ := c.Seek(prefix); byteKey != nil && bytes.HasPrefix(byteKey, prefix); byteKey, _ = c.Next() {
+			// Store the right side of the bucket key, after ":"
+			props = append(props, string(byteKey[len(prefix):]))
+		}
+		return nil // Return from View function
 	})
-	return props, err
+	return props, wrapError("HashMap.Keys", h.name, owner, err)
 }
 
-// Exists will check if a given elementid exists as a hash map at all
+// Exists will check if a given elementid exists as a hash map at all, that is, if
+// the element has any fields. See Has for checking for a specific field.
 func (h *HashMap) Exists(elementid string) (bool, error) {
 	var found bool
-	if h.name == nil {
+	if !h.exists() {
 		return false, ErrDoesNotExist
 	}
-	err := (*bbolt.DB)(h.db).View(func(tx *bbolt.Tx) error {
+	err := h.db.view("HashMap", "Exists", func(tx *bbolt.Tx) error {
 		bucket := tx.Bucket(h.name)
 		if bucket == nil {
 			return ErrBucketNotFound
 		}
-		bucket.ForEach(func(byteKey, byteValue []byte) error {
-			combinedKey := string(byteKey)
-			if strings.Contains(combinedKey, ":") {
-				fields := strings.SplitN(combinedKey, ":", 2)
-				if fields[0] == elementid {
-					found = true
-					return errFoundIt
-				}
-			}
-			return nil // Continue ForEach
-		})
+		// Seek to the first key that starts with elementid + ":", if any
+		prefix := []byte(elementid + ":")
+		byteKey, _ := bucket.Cursor().Seek(prefix)
+		found = byteKey != nil && bytes.HasPrefix(byteKey, prefix)
 		return nil // Return from View function
 	})
-	return found, err
+	return found, wrapError("HashMap.Exists", h.name, elementid, err)
 }
 
 // DelKey will remove a key for an entry in a hashmap (for instance the email field for a user)
 func (h *HashMap) DelKey(elementid, key string) error {
-	if h.name == nil {
+	if !h.exists() {
 		return ErrDoesNotExist
 	}
-	return (*bbolt.DB)(h.db).Update(func(tx *bbolt.Tx) error {
+	err := h.db.update("HashMap", "DelKey", func(tx *bbolt.Tx) error {
 		bucket := tx.Bucket(h.name)
 		if bucket == nil {
 			return ErrBucketNotFound
 		}
 		return bucket.Delete([]byte(elementid + ":" + key))
 	})
+	return wrapError("HashMap.DelKey", h.name, elementid+":"+key, err)
 }
 
 // Del will remove an element (for instance a user)
 func (h *HashMap) Del(elementid string) error {
-	if h.name == nil {
+	if !h.exists() {
 		return ErrDoesNotExist
 	}
 	// Remove the keys starting with elementid + ":"
-	return (*bbolt.DB)(h.db).Update(func(tx *bbolt.Tx) error {
+	err := h.db.update("HashMap", "Del", func(tx *bbolt.Tx) error {
 		bucket := tx.Bucket(h.name)
 		if bucket == nil {
 			return ErrBucketNotFound
@@ -546,24 +1673,61 @@ func (h *HashMap) Del(elementid string) error {
 			return nil // Continue ForEach
 		})
 	})
+	return wrapError("HashMap.Del", h.name, elementid, err)
+}
+
+// exists reports whether the hash map has been created and not removed
+func (h *HashMap) exists() bool {
+	return h.name != nil && !h.removed.Load()
 }
 
-// Remove this hashmap
+// Remove this hashmap. Since every hash map has a bucket of its own,
+// this deletes the bucket and leaves any other hash maps intact.
+//
+// Removing a hash map that is already removed, also through another handle or by
+// another program, does nothing. The other methods return ErrDoesNotExist
+// after Remove, until Recreate is called.
 func (h *HashMap) Remove() error {
-	err := (*bbolt.DB)(h.db).Update(func(tx *bbolt.Tx) error {
-		return tx.DeleteBucket(h.name)
+	if h.name == nil {
+		return ErrDoesNotExist
+	}
+	err := h.db.update("HashMap", "Remove", func(tx *bbolt.Tx) error {
+		if err := unregisterType(tx, h.name); err != nil {
+			return err
+		}
+		return deleteBucket(tx, h.name)
 	})
-	// Mark as removed by setting the name to nil
-	h.name = nil
-	return err
+	if err == nil {
+		h.removed.Store(true)
+	}
+	return wrapError("HashMap.Remove", h.name, "", err)
+}
+
+// Recreate creates the bucket of the hash map again, after it has been removed, so
+// that the same handle can be used again. The hash map is then empty. It does
+// nothing if the hash map already exists.
+func (h *HashMap) Recreate() error {
+	if h.name == nil {
+		return ErrDoesNotExist
+	}
+	err := h.db.update("HashMap", "Recreate", func(tx *bbolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(h.name); err != nil {
+			return fmt.Errorf("Could not create bucket: %w", err)
+		}
+		return registerType(tx, h.name, "HashMap")
+	})
+	if err == nil {
+		h.removed.Store(false)
+	}
+	return wrapError("HashMap.Recreate", h.name, "", err)
 }
 
 // Clear will remove all elements from this hash map
 func (h *HashMap) Clear() error {
-	if h.name == nil {
+	if !h.exists() {
 		return ErrDoesNotExist
 	}
-	return (*bbolt.DB)(h.db).Update(func(tx *bbolt.Tx) error {
+	err := h.db.update("HashMap", "Clear", func(tx *bbolt.Tx) error {
 		bucket := tx.Bucket(h.name)
 		if bucket == nil {
 			return ErrBucketNotFound
@@ -572,46 +1736,77 @@ func (h *HashMap) Clear() error {
 			return bucket.Delete(key)
 		})
 	})
+	return wrapError("HashMap.Clear", h.name, "", err)
 }
 
 /* --- KeyValue functions --- */
 
-// NewKeyValue loads or creates a new KeyValue struct, with the given ID
-func NewKeyValue(db *Database, id string) (*KeyValue, error) {
+// NewKeyValue loads or creates a new KeyValue struct, with the given ID and options,
+// like WithFillPercent
+func NewKeyValue(db *Database, id string, opts ...BucketOption) (*KeyValue, error) {
 	name := []byte(id)
-	if err := (*bbolt.DB)(db).Update(func(tx *bbolt.Tx) error {
+	if err := ValidateID(id); err != nil {
+		return nil, wrapError("NewKeyValue", name, "", err)
+	}
+	o, err := applyBucketOptions(opts)
+	if err != nil {
+		return nil, wrapError("NewKeyValue", name, "", err)
+	}
+	if err := db.update("KeyValue", "New", func(tx *bbolt.Tx) error {
 		if _, err := tx.CreateBucketIfNotExists(name); err != nil {
-			return errors.New("Could not create bucket: " + err.Error())
+			return fmt.Errorf("Could not create bucket: %w", err)
 		}
-		return nil // Return from Update function
+		return registerType(tx, name, "KeyValue")
 	}); err != nil {
-		return nil, err
+		return nil, wrapError("NewKeyValue", name, "", err)
+	}
+	return (*KeyValue)(newBucket(db, name, o)), nil
+}
+
+// OpenKeyValue loads an existing KeyValue struct, with the given ID and options.
+// Returns ErrBucketNotFound if it does not already exist.
+func OpenKeyValue(db *Database, id string, opts ...BucketOption) (*KeyValue, error) {
+	name := []byte(id)
+	if err := ValidateID(id); err != nil {
+		return nil, wrapError("OpenKeyValue", name, "", err)
 	}
-	return &KeyValue{db, name}, nil
+	o, err := applyBucketOptions(opts)
+	if err != nil {
+		return nil, wrapError("OpenKeyValue", name, "", err)
+	}
+	if err := db.checkBucket("KeyValue", name); err != nil {
+		return nil, wrapError("OpenKeyValue", name, "", err)
+	}
+	return (*KeyValue)(newBucket(db, name, o)), nil
 }
 
 // Set a key and value
 func (kv *KeyValue) Set(key, value string) error {
-	if kv.name == nil {
+	if !kv.exists() {
 		return ErrDoesNotExist
 	}
-	return (*bbolt.DB)(kv.db).Update(func(tx *bbolt.Tx) error {
+	err := kv.db.update("KeyValue", "Set", func(tx *bbolt.Tx) error {
 		bucket := tx.Bucket(kv.name)
 		if bucket == nil {
 			return ErrBucketNotFound
 		}
-		return bucket.Put([]byte(key), []byte(value))
+		encoded, err := kv.db.encodeValue([]byte(value))
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(key), encoded)
 	})
+	return wrapError("KeyValue.Set", kv.name, key, err)
 }
 
 // Get a value given a key
 // Returns an error if the key was not found
 func (kv *KeyValue) Get(key string) (string, error) {
 	var val string
-	if kv.name == nil {
+	if !kv.exists() {
 		return "", ErrDoesNotExist
 	}
-	err := (*bbolt.DB)(kv.db).View(func(tx *bbolt.Tx) error {
+	err := kv.db.view("KeyValue", "Get", func(tx *bbolt.Tx) error {
 		bucket := tx.Bucket(kv.name)
 		if bucket == nil {
 			return ErrBucketNotFound
@@ -620,35 +1815,211 @@ func (kv *KeyValue) Get(key string) (string, error) {
 		if byteval == nil {
 			return ErrKeyNotFound
 		}
-		val = string(byteval)
+		decoded, err := kv.db.decodeValue(byteval)
+		if err != nil {
+			return err
+		}
+		val = string(decoded)
+		return nil // Return from View function
+	})
+	return val, wrapError("KeyValue.Get", kv.name, key, err)
+}
+
+// SetBytes sets a key and value, given as raw bytes. This allows keys to be
+// encoded in any way, for instance as fixed-width big-endian integers, which
+// are then sorted numerically by Bolt.
+//
+// The string and byte methods share the same bucket: a string key is stored as
+// its bytes, so Set("a", "b") and SetBytes([]byte("a"), []byte("b")) are equal.
+func (kv *KeyValue) SetBytes(key, value []byte) error {
+	if !kv.exists() {
+		return ErrDoesNotExist
+	}
+	err := kv.db.update("KeyValue", "SetBytes", func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(kv.name)
+		if bucket == nil {
+			return ErrBucketNotFound
+		}
+		encoded, err := kv.db.encodeValue(value)
+		if err != nil {
+			return err
+		}
+		return bucket.Put(key, encoded)
+	})
+	return wrapError("KeyValue.SetBytes", kv.name, string(key), err)
+}
+
+// GetBytes returns a copy of the value of the given raw key.
+// Returns an error if the key was not found. See SetBytes.
+func (kv *KeyValue) GetBytes(key []byte) ([]byte, error) {
+	var val []byte
+	if !kv.exists() {
+		return nil, ErrDoesNotExist
+	}
+	err := kv.db.view("KeyValue", "GetBytes", func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(kv.name)
+		if bucket == nil {
+			return ErrBucketNotFound
+		}
+		byteval := bucket.Get(key)
+		if byteval == nil {
+			return ErrKeyNotFound
+		}
+		decoded, err := kv.db.decodeValue(byteval)
+		if err != nil {
+			return err
+		}
+		val = append([]byte{}, decoded...)
+		return nil // Return from View function
+	})
+	return val, wrapError("KeyValue.GetBytes", kv.name, string(key), err)
+}
+
+// GetAllWithPrefix will return all keys and values where the key starts with
+// the given prefix. This is useful for grouped data, like "entityID:field" keys.
+func (kv *KeyValue) GetAllWithPrefix(prefix string) (map[string]string, error) {
+	return kv.GetAllWithPrefixCtx(context.Background(), prefix)
+}
+
+// GetAllWithPrefixCtx works like GetAllWithPrefix, but stops and returns the
+// error of the context as soon as it is cancelled
+func (kv *KeyValue) GetAllWithPrefixCtx(ctx context.Context, prefix string) (map[string]string, error) {
+	if !kv.exists() {
+		return nil, ErrDoesNotExist
+	}
+	results := make(map[string]string)
+	err := kv.db.view("KeyValue", "GetAllWithPrefix", func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(kv.name)
+		if bucket == nil {
+			return ErrBucketNotFound
+		}
+		p := []byte(prefix)
+		c := bucket.Cursor()
+		for key, value := c.Seek(p); key != nil && bytes.HasPrefix(key, p); key, value = c.Next() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			decoded, err := kv.db.decodeValue(value)
+			if err != nil {
+				return err
+			}
+			results[string(key)] = string(decoded)
+		}
+		return nil // Return from View function
+	})
+	if err != nil {
+		return nil, wrapError("KeyValue.GetAllWithPrefix", kv.name, prefix, err)
+	}
+	return results, nil
+}
+
+// Len returns the number of keys in the key/value store. The keys are counted
+// by the statistics of the bucket, without reading the values.
+func (kv *KeyValue) Len() (int, error) {
+	var n int
+	if !kv.exists() {
+		return 0, ErrDoesNotExist
+	}
+	err := kv.db.view("KeyValue", "Len", func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(kv.name)
+		if bucket == nil {
+			return ErrBucketNotFound
+		}
+		n = bucket.Stats().KeyN
 		return nil // Return from View function
 	})
-	return val, err
+	return n, wrapError("KeyValue.Len", kv.name, "", err)
 }
 
 // Del will remove a key
 func (kv *KeyValue) Del(key string) error {
-	if kv.name == nil {
+	if !kv.exists() {
 		return ErrDoesNotExist
 	}
-	return (*bbolt.DB)(kv.db).Update(func(tx *bbolt.Tx) error {
+	err := kv.db.update("KeyValue", "Del", func(tx *bbolt.Tx) error {
 		bucket := tx.Bucket(kv.name)
 		if bucket == nil {
 			return ErrBucketNotFound
 		}
 		return bucket.Delete([]byte(key))
 	})
+	return wrapError("KeyValue.Del", kv.name, key, err)
+}
+
+// Rename moves the value of oldKey to newKey, and removes oldKey, within a
+// single transaction. Returns ErrKeyNotFound if oldKey does not exist, and
+// ErrKeyExists, and changes nothing, if newKey already exists. Renaming a key
+// to itself does nothing. Like Set and Del, Rename does not change the versions
+// of the keys, see SetVersioned.
+func (kv *KeyValue) Rename(oldKey, newKey string) error {
+	if !kv.exists() {
+		return ErrDoesNotExist
+	}
+	err := kv.db.update("KeyValue", "Rename", func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(kv.name)
+		if bucket == nil {
+			return ErrBucketNotFound
+		}
+		value := bucket.Get([]byte(oldKey))
+		if value == nil {
+			return ErrKeyNotFound
+		}
+		if oldKey == newKey {
+			return nil // Return from Update function
+		}
+		if bucket.Get([]byte(newKey)) != nil {
+			return ErrKeyExists
+		}
+		// The value is stored as it is, so it does not need to be decoded
+		if err := bucket.Put([]byte(newKey), append([]byte{}, value...)); err != nil {
+			return err
+		}
+		return bucket.Delete([]byte(oldKey))
+	})
+	return wrapError("KeyValue.Rename", kv.name, oldKey, err)
+}
+
+// DelPrefix will remove all keys that start with the given prefix, within a
+// single transaction, and return the number of keys that were removed.
+// This is useful for namespaced keys, like "session:abc" and "session:def".
+func (kv *KeyValue) DelPrefix(prefix string) (int, error) {
+	if !kv.exists() {
+		return 0, ErrDoesNotExist
+	}
+	count := 0
+	err := kv.db.update("KeyValue", "DelPrefix", func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(kv.name)
+		if bucket == nil {
+			return ErrBucketNotFound
+		}
+		p := []byte(prefix)
+		c := bucket.Cursor()
+		// Seek again after each deletion, since the cursor may skip a key
+		// when Next is called after Delete.
+		for key, _ := c.Seek(p); key != nil && bytes.HasPrefix(key, p); key, _ = c.Seek(p) {
+			if err := c.Delete(); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil // Return from Update function
+	})
+	if err != nil {
+		return 0, wrapError("KeyValue.DelPrefix", kv.name, prefix, err)
+	}
+	return count, nil
 }
 
 // Inc will increase the value of a key, returns the new value
 // Returns an empty string if there were errors,
-// or "0" if the key does not already exist.
+// or "1" if the key does not already exist.
+// The value is read and written within the same transaction.
 func (kv *KeyValue) Inc(key string) (string, error) {
 	var val string
-	if kv.name == nil {
-		kv.name = []byte(key)
+	if !kv.exists() {
+		return "", ErrDoesNotExist
 	}
-	err := (*bbolt.DB)(kv.db).Update(func(tx *bbolt.Tx) (err error) {
+	err := kv.db.update("KeyValue", "Inc", func(tx *bbolt.Tx) (err error) {
 		// The numeric value
 		num := 0
 		// Get the string value
@@ -657,11 +2028,14 @@ func (kv *KeyValue) Inc(key string) (string, error) {
 			// Create the bucket if it does not already exist
 			bucket, err = tx.CreateBucketIfNotExists(kv.name)
 			if err != nil {
-				return errors.New("Could not create bucket: " + err.Error())
+				return fmt.Errorf("Could not create bucket: %w", err)
 			}
 		} else {
-			val := string(bucket.Get([]byte(key)))
-			if converted, err := strconv.Atoi(val); err == nil {
+			decoded, err := kv.db.decodeValue(bucket.Get([]byte(key)))
+			if err != nil {
+				return err
+			}
+			if converted, err := strconv.Atoi(string(decoded)); err == nil {
 				// Conversion successful
 				num = converted
 			}
@@ -670,28 +2044,75 @@ func (kv *KeyValue) Inc(key string) (string, error) {
 		num++
 		// Convert the new value to a string and save it
 		val = strconv.Itoa(num)
-		// Return the error, if any
-		return bucket.Put([]byte(key), []byte(val))
+		// The number is short, so it is never compressed, only encrypted
+		encrypted, err := kv.db.EncryptValue([]byte(val))
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(key), encrypted)
 	})
-	return val, err
+	return val, wrapError("KeyValue.Inc", kv.name, key, err)
+}
+
+// exists reports whether the key/value store has been created and not removed
+func (kv *KeyValue) exists() bool {
+	return kv.name != nil && !kv.removed.Load()
 }
 
 // Remove this key/value
+//
+// Removing a key/value store that is already removed, also through another handle or by
+// another program, does nothing. The other methods return ErrDoesNotExist
+// after Remove, until Recreate is called.
 func (kv *KeyValue) Remove() error {
-	err := (*bbolt.DB)(kv.db).Update(func(tx *bbolt.Tx) error {
-		return tx.DeleteBucket(kv.name)
+	if kv.name == nil {
+		return ErrDoesNotExist
+	}
+	err := kv.db.update("KeyValue", "Remove", func(tx *bbolt.Tx) error {
+		if keyValueVersions(tx, kv.name) != nil {
+			if err := tx.DeleteBucket(versionsName(kv.name)); err != nil {
+				return err
+			}
+			if err := unregisterType(tx, versionsName(kv.name)); err != nil {
+				return err
+			}
+		}
+		if err := unregisterType(tx, kv.name); err != nil {
+			return err
+		}
+		return deleteBucket(tx, kv.name)
 	})
-	// Mark as removed by setting the name to nil
-	kv.name = nil
-	return err
+	if err == nil {
+		kv.removed.Store(true)
+	}
+	return wrapError("KeyValue.Remove", kv.name, "", err)
+}
+
+// Recreate creates the bucket of the key/value store again, after it has been removed, so
+// that the same handle can be used again. The key/value store is then empty. It does
+// nothing if the key/value store already exists.
+func (kv *KeyValue) Recreate() error {
+	if kv.name == nil {
+		return ErrDoesNotExist
+	}
+	err := kv.db.update("KeyValue", "Recreate", func(tx *bbolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(kv.name); err != nil {
+			return fmt.Errorf("Could not create bucket: %w", err)
+		}
+		return registerType(tx, kv.name, "KeyValue")
+	})
+	if err == nil {
+		kv.removed.Store(false)
+	}
+	return wrapError("KeyValue.Recreate", kv.name, "", err)
 }
 
 // Clear will remove all elements from this key/value
 func (kv *KeyValue) Clear() error {
-	if kv.name == nil {
+	if !kv.exists() {
 		return ErrDoesNotExist
 	}
-	return (*bbolt.DB)(kv.db).Update(func(tx *bbolt.Tx) error {
+	err := kv.db.update("KeyValue", "Clear", func(tx *bbolt.Tx) error {
 		bucket := tx.Bucket(kv.name)
 		if bucket == nil {
 			return ErrBucketNotFound
@@ -700,13 +2121,154 @@ func (kv *KeyValue) Clear() error {
 			return bucket.Delete(key)
 		})
 	})
+	return wrapError("KeyValue.Clear", kv.name, "", err)
 }
 
 /* --- Utility functions --- */
 
+// timedIDLength is the length of the keys used by List.AddTimed
+const timedIDLength = 12
+
+// Create a byte slice from a nanosecond timestamp and a counter
+func timedID(nanos int64, n uint32) []byte {
+	b := make([]byte, timedIDLength)
+	binary.BigEndian.PutUint64(b, uint64(nanos))
+	binary.BigEndian.PutUint32(b[8:], n)
+	return b
+}
+
+// listMidpoint is the first key of a new list, and the first key used when the
+// keys of a list are rewritten by rekeyList. It is far below the keys used by
+// AddTimed, so that elements added later with AddTimed still come last.
+const listMidpoint = 1 << 56
+
+// createList creates the bucket of a list, if it does not already exist, and
+// returns it. The sequence of a new bucket is set so that the first key is
+// listMidpoint, which leaves room for prepending elements without rewriting
+// the keys of the list.
+func createList(tx *bbolt.Tx, name []byte) (*bbolt.Bucket, error) {
+	if bucket := tx.Bucket(name); bucket != nil {
+		return bucket, nil
+	}
+	bucket, err := tx.CreateBucket(name)
+	if err != nil {
+		return nil, fmt.Errorf("Could not create bucket: %w", err)
+	}
+	return bucket, bucket.SetSequence(listMidpoint - 1)
+}
+
+// keyRoom returns the largest 8 byte key that sorts before the given key, and
+// the number of 8 byte keys that do, which is 0 if there are none
+func keyRoom(key []byte) (top, room uint64) {
+	if len(key) < 8 {
+		return 0, 0
+	}
+	v := binary.BigEndian.Uint64(key)
+	if len(key) > 8 {
+		// The 8 byte prefix of a longer key sorts before it, as for AddTimed keys
+		return v, v + 1
+	}
+	if v == 0 {
+		return 0, 0
+	}
+	return v - 1, v
+}
+
+// rekeyList rewrites the keys of all the elements of the list in the given
+// bucket, keeping their order, so that they count from listMidpoint. The index,
+// if any, is rebuilt.
+func (db *Database) rekeyList(bucket, index *bbolt.Bucket) error {
+	var keys, values [][]byte
+	if err := bucket.ForEach(func(key, value []byte) error {
+		keys = append(keys, append([]byte{}, key...))
+		values = append(values, append([]byte{}, value...))
+		return nil // Continue ForEach
+	}); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := bucket.Delete(key); err != nil {
+			return err
+		}
+	}
+	if index != nil {
+		// Seek to the first key again after each deletion, since the cursor may
+		// skip a key when Next is called after Delete
+		c := index.Cursor()
+		for key, _ := c.First(); key != nil; key, _ = c.First() {
+			if err := c.Delete(); err != nil {
+				return err
+			}
+		}
+	}
+	for i, value := range values {
+		key := byteID(listMidpoint + uint64(i))
+		if err := bucket.Put(key, value); err != nil {
+			return err
+		}
+		if index != nil {
+			decoded, err := db.decodeValue(value)
+			if err != nil {
+				return err
+			}
+			if err := indexAdd(index, decoded, key); err != nil {
+				return err
+			}
+		}
+	}
+	// Let the elements that are added later come after the rewritten ones
+	if last := listMidpoint + uint64(len(values)) - 1; bucket.Sequence() < last {
+		return bucket.SetSequence(last)
+	}
+	return nil
+}
+
+// deleteBucket deletes the bucket with the given name, if it exists
+func deleteBucket(tx *bbolt.Tx, name []byte) error {
+	if err := tx.DeleteBucket(name); err != bbolt.ErrBucketNotFound {
+		return err
+	}
+	return nil
+}
+
 // Create a byte slice from an uint64
 func byteID(x uint64) []byte {
 	b := make([]byte, 8)
 	binary.BigEndian.PutUint64(b, x)
 	return b
 }
+
+// appendFillPercent is the fill percent used when adding elements with
+// increasing keys, when no fill percent has been set. The pages are then filled
+// completely, which nearly halves the number of pages compared to the default
+// fill percent of Bolt, since the pages are never split for inserting keys in
+// the middle.
+const appendFillPercent = 1.0
+
+// atomicFloat is a float64 that can be loaded and stored atomically
+type atomicFloat struct {
+	bits atomic.Uint64
+}
+
+// Load returns the value
+func (f *atomicFloat) Load() float64 {
+	return math.Float64frombits(f.bits.Load())
+}
+
+// Store sets the value
+func (f *atomicFloat) Store(value float64) {
+	f.bits.Store(math.Float64bits(value))
+}
+
+// withFillPercent sets the fill percent of the given bucket, if it is not nil,
+// to the given fill percent, or to the fallback if it is 0. The default of Bolt
+// is kept if both are 0.
+func withFillPercent(bucket *bbolt.Bucket, fillPercent, fallback float64) *bbolt.Bucket {
+	if fillPercent == 0 {
+		fillPercent = fallback
+	}
+	if bucket != nil && fillPercent != 0 {
+		bucket.FillPercent = fillPercent
+	}
+	return bucket
+}
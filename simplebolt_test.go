@@ -1,10 +1,28 @@
 package simplebolt
 
 import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
 	"github.com/xyproto/pinterface"
+	"github.com/xyproto/simplebolt/codec"
+	"go.etcd.io/bbolt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"log"
 	"os"
 	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestList(t *testing.T) {
@@ -113,6 +131,14 @@ func TestInc(t *testing.T) {
 	if _, err := kv.Get(testkey); err == nil {
 		t.Errorf("Error, could get key! %s", err.Error())
 	}
+	// A removed key/value can not be increased
+	if _, err := kv.Inc(testkey); err != ErrDoesNotExist {
+		t.Errorf("Error, expected ErrDoesNotExist, got %v", err)
+	}
+	kv, err = NewKeyValue(db, kvname)
+	if err != nil {
+		t.Error(err)
+	}
 	// Creates "0" and increases the value with 1
 	kv.Inc(testkey)
 	if val, err := kv.Get(testkey); err != nil {
@@ -228,6 +254,10 @@ func TestVarious(t *testing.T) {
 	// Check that the set qualifies for the ISet interface
 	var _ pinterface.ISet = s
 
+	kv, err = NewKeyValue(db, "fruit")
+	if err != nil {
+		t.Error(err)
+	}
 	val, err := kv.Inc("counter")
 	if (val != "1") || (err != nil) {
 		t.Error("counter should be 1 but is", val)
@@ -357,3 +387,2941 @@ func TestHashMap(t *testing.T) {
 		t.Errorf("Error, could not remove hash map! %s", err.Error())
 	}
 }
+
+func TestNextSequence(t *testing.T) {
+	const seqname = "seq_234_test_test_test"
+	db, err := New(path.Join(os.TempDir(), "bolt.db"))
+	if err != nil {
+		t.Error(err)
+	}
+	defer db.Close()
+	first, err := db.NextSequence(seqname)
+	if err != nil {
+		t.Error(err)
+	}
+	for i := uint64(1); i <= 3; i++ {
+		n, err := db.NextSequence(seqname)
+		if err != nil {
+			t.Error(err)
+		}
+		if n != first+i {
+			t.Errorf("Error, wrong sequence value! %d != %d", n, first+i)
+		}
+	}
+}
+
+func TestRemoveByIndex(t *testing.T) {
+	const listname = "list_removebyindex_test"
+	db, err := New(path.Join(os.TempDir(), "bolt.db"))
+	if err != nil {
+		t.Error(err)
+	}
+	defer db.Close()
+	list, err := NewList(db, listname)
+	if err != nil {
+		t.Error(err)
+	}
+	defer list.Remove()
+	list.Clear()
+	for _, value := range []string{"a", "b", "b", "c", "d"} {
+		if err := list.Add(value); err != nil {
+			t.Error(err)
+		}
+	}
+	// Remove the second "b"
+	if err := list.RemoveByIndex(2); err != nil {
+		t.Error(err)
+	}
+	// Remove "d"
+	if err := list.RemoveByIndex(-1); err != nil {
+		t.Error(err)
+	}
+	if err := list.RemoveByIndex(3); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("Error, expected ErrOutOfRange, got %v", err)
+	}
+	if err := list.RemoveByIndex(-4); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("Error, expected ErrOutOfRange, got %v", err)
+	}
+	items, err := list.All()
+	if err != nil {
+		t.Error(err)
+	}
+	if strings.Join(items, ",") != "a,b,c" {
+		t.Errorf("Error, wrong list contents! %v", items)
+	}
+}
+
+func TestOpError(t *testing.T) {
+	const kvname = "kv_operror_test"
+	db, err := New(path.Join(os.TempDir(), "bolt.db"))
+	if err != nil {
+		t.Error(err)
+	}
+	defer db.Close()
+	kv, err := NewKeyValue(db, kvname)
+	if err != nil {
+		t.Error(err)
+	}
+	defer kv.Remove()
+	_, err = kv.Get("missing")
+	if !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Error, expected ErrKeyNotFound, got %v", err)
+	}
+	var opErr *OpError
+	if !errors.As(err, &opErr) {
+		t.Fatalf("Error, expected an *OpError, got %T", err)
+	}
+	if opErr.Op != "KeyValue.Get" || opErr.Bucket != kvname || opErr.Key != "missing" {
+		t.Errorf("Error, wrong error context! %+v", opErr)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	const listname = "list_open_test"
+	db, err := New(path.Join(os.TempDir(), "bolt.db"))
+	if err != nil {
+		t.Error(err)
+	}
+	defer db.Close()
+	if _, err := OpenList(db, listname); !errors.Is(err, ErrBucketNotFound) {
+		t.Errorf("Error, expected ErrBucketNotFound, got %v", err)
+	}
+	if _, err := OpenKeyValue(db, listname); !errors.Is(err, ErrBucketNotFound) {
+		t.Errorf("Error, expected ErrBucketNotFound, got %v", err)
+	}
+	list, err := NewList(db, listname)
+	if err != nil {
+		t.Error(err)
+	}
+	if err := list.Add("hello"); err != nil {
+		t.Error(err)
+	}
+	opened, err := OpenList(db, listname)
+	if err != nil {
+		t.Error(err)
+	}
+	if last, err := opened.Last(); err != nil || last != "hello" {
+		t.Errorf("Error, wrong last element! %s %v", last, err)
+	}
+	if err := list.Remove(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAddIfAbsent(t *testing.T) {
+	const setname = "set_addifabsent_test"
+	db, err := New(path.Join(os.TempDir(), "bolt.db"))
+	if err != nil {
+		t.Error(err)
+	}
+	defer db.Close()
+	s, err := NewSet(db, setname)
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.Remove()
+	s.Clear()
+	if added, err := s.AddIfAbsent("a"); err != nil || !added {
+		t.Errorf("Error, expected the element to be added! %v", err)
+	}
+	if added, err := s.AddIfAbsent("a"); err != nil || added {
+		t.Errorf("Error, expected the element to already exist! %v", err)
+	}
+	if values, err := s.All(); err != nil || len(values) != 1 {
+		t.Errorf("Error, wrong set contents! %v %v", values, err)
+	}
+}
+
+func TestDelBatch(t *testing.T) {
+	const setname = "set_delbatch_test"
+	db, err := New(path.Join(os.TempDir(), "bolt.db"))
+	if err != nil {
+		t.Error(err)
+	}
+	defer db.Close()
+	s, err := NewSet(db, setname)
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.Remove()
+	s.Clear()
+	for _, value := range []string{"a", "b", "c", "d"} {
+		if err := s.Add(value); err != nil {
+			t.Error(err)
+		}
+	}
+	deleted, err := s.DelBatch([]string{"a", "c", "c", "x"})
+	if err != nil {
+		t.Error(err)
+	}
+	if deleted != 2 {
+		t.Errorf("Error, expected 2 deleted values, got %d", deleted)
+	}
+	if values, err := s.All(); err != nil || len(values) != 2 || values[0] != "b" || values[1] != "d" {
+		t.Errorf("Error, wrong set contents! %v %v", values, err)
+	}
+}
+
+func TestHashMapHasExists(t *testing.T) {
+	db, err := New(path.Join(os.TempDir(), "bolt.db"))
+	if err != nil {
+		t.Error(err)
+	}
+	defer db.Close()
+	users, err := NewHashMap(db, "hashmap_hasexists_test")
+	if err != nil {
+		t.Error(err)
+	}
+	defer users.Remove()
+	if err := users.Set("bob", "email", "bob@example.com"); err != nil {
+		t.Error(err)
+	}
+	// An element with an id that has "bob" as a prefix
+	if err := users.Set("bobby", "password", "hunter2"); err != nil {
+		t.Error(err)
+	}
+	if has, err := users.Has("bob", "email"); err != nil || !has {
+		t.Errorf("Error, bob should have an email field! %v", err)
+	}
+	if has, err := users.Has("bob", "password"); err != nil || has {
+		t.Errorf("Error, bob should not have a password field! %v", err)
+	}
+	if exists, err := users.Exists("bob"); err != nil || !exists {
+		t.Errorf("Error, bob should exist! %v", err)
+	}
+	if exists, err := users.Exists("bo"); err != nil || exists {
+		t.Errorf("Error, bo should not exist! %v", err)
+	}
+	if keys, err := users.Keys("bob"); err != nil || len(keys) != 1 || keys[0] != "email" {
+		t.Errorf("Error, wrong keys for bob! %v %v", keys, err)
+	}
+}
+
+func TestHashMapRemoveIsolated(t *testing.T) {
+	db, err := New(path.Join(os.TempDir(), "bolt.db"))
+	if err != nil {
+		t.Error(err)
+	}
+	defer db.Close()
+	users, err := NewHashMap(db, "hashmap_users_test")
+	if err != nil {
+		t.Error(err)
+	}
+	admins, err := NewHashMap(db, "hashmap_users_test_admins")
+	if err != nil {
+		t.Error(err)
+	}
+	defer admins.Remove()
+	if err := users.Set("bob", "password", "hunter1"); err != nil {
+		t.Error(err)
+	}
+	if err := admins.Set("alice", "password", "hunter2"); err != nil {
+		t.Error(err)
+	}
+	if err := users.Remove(); err != nil {
+		t.Error(err)
+	}
+	if val, err := admins.Get("alice", "password"); err != nil || val != "hunter2" {
+		t.Errorf("Error, the other hash map was modified! %s %v", val, err)
+	}
+}
+
+func TestIndexOf(t *testing.T) {
+	const listname = "list_indexof_test"
+	db, err := New(path.Join(os.TempDir(), "bolt.db"))
+	if err != nil {
+		t.Error(err)
+	}
+	defer db.Close()
+	list, err := NewList(db, listname)
+	if err != nil {
+		t.Error(err)
+	}
+	defer list.Remove()
+	list.Clear()
+	for _, value := range []string{"a", "b", "c", "b"} {
+		if err := list.Add(value); err != nil {
+			t.Error(err)
+		}
+	}
+	for value, expected := range map[string]int{"a": 0, "b": 1, "c": 2, "d": -1} {
+		if index, err := list.IndexOf(value); err != nil || index != expected {
+			t.Errorf("Error, wrong index for %s! %d != %d %v", value, index, expected, err)
+		}
+	}
+}
+
+func TestKeyValueBytes(t *testing.T) {
+	const kvname = "kv_bytes_test"
+	db, err := New(path.Join(os.TempDir(), "bolt.db"))
+	if err != nil {
+		t.Error(err)
+	}
+	defer db.Close()
+	kv, err := NewKeyValue(db, kvname)
+	if err != nil {
+		t.Error(err)
+	}
+	defer kv.Remove()
+	key := byteID(42)
+	if err := kv.SetBytes(key, []byte{0, 1, 2}); err != nil {
+		t.Error(err)
+	}
+	if val, err := kv.GetBytes(key); err != nil || string(val) != string([]byte{0, 1, 2}) {
+		t.Errorf("Error, wrong value! %v %v", val, err)
+	}
+	if _, err := kv.GetBytes(byteID(43)); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Error, expected ErrKeyNotFound, got %v", err)
+	}
+	// The string and byte views share the bucket
+	if err := kv.Set("fruit", "banana"); err != nil {
+		t.Error(err)
+	}
+	if val, err := kv.GetBytes([]byte("fruit")); err != nil || string(val) != "banana" {
+		t.Errorf("Error, wrong value! %s %v", val, err)
+	}
+}
+
+func TestDelPrefix(t *testing.T) {
+	const kvname = "kv_delprefix_test"
+	db, err := New(path.Join(os.TempDir(), "bolt.db"))
+	if err != nil {
+		t.Error(err)
+	}
+	defer db.Close()
+	kv, err := NewKeyValue(db, kvname)
+	if err != nil {
+		t.Error(err)
+	}
+	defer kv.Remove()
+	for _, key := range []string{"session", "session:abc", "session:def", "session:ghi", "sessions", "user:abc"} {
+		if err := kv.Set(key, "x"); err != nil {
+			t.Error(err)
+		}
+	}
+	count, err := kv.DelPrefix("session:")
+	if err != nil {
+		t.Error(err)
+	}
+	if count != 3 {
+		t.Errorf("Error, expected 3 deleted keys, got %d", count)
+	}
+	for _, key := range []string{"session:abc", "session:def", "session:ghi"} {
+		if _, err := kv.Get(key); err == nil {
+			t.Errorf("Error, %s should have been deleted", key)
+		}
+	}
+	for _, key := range []string{"session", "sessions", "user:abc"} {
+		if _, err := kv.Get(key); err != nil {
+			t.Errorf("Error, %s should have been kept: %v", key, err)
+		}
+	}
+	if count, err := kv.DelPrefix("nothing:"); err != nil || count != 0 {
+		t.Errorf("Error, expected nothing to be deleted, got %d %v", count, err)
+	}
+}
+
+func TestGetAllWithPrefix(t *testing.T) {
+	const kvname = "kv_getallwithprefix_test"
+	db, err := New(path.Join(os.TempDir(), "bolt.db"))
+	if err != nil {
+		t.Error(err)
+	}
+	defer db.Close()
+	kv, err := NewKeyValue(db, kvname)
+	if err != nil {
+		t.Error(err)
+	}
+	defer kv.Remove()
+	for key, value := range map[string]string{"a:name": "Alice", "a:age": "30", "ab:name": "Bob", "b:name": "Carol"} {
+		if err := kv.Set(key, value); err != nil {
+			t.Error(err)
+		}
+	}
+	results, err := kv.GetAllWithPrefix("a:")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(results) != 2 || results["a:name"] != "Alice" || results["a:age"] != "30" {
+		t.Errorf("Error, wrong results for prefix a: %v", results)
+	}
+	results, err = kv.GetAllWithPrefix("c:")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(results) != 0 {
+		t.Errorf("Error, expected no results for prefix c: %v", results)
+	}
+}
+
+func TestIncKeepsName(t *testing.T) {
+	const kvname = "kv_inc_name_test"
+	db, err := New(path.Join(os.TempDir(), "bolt.db"))
+	if err != nil {
+		t.Error(err)
+	}
+	defer db.Close()
+	kv, err := NewKeyValue(db, kvname)
+	if err != nil {
+		t.Error(err)
+	}
+	defer kv.Remove()
+	if val, err := kv.Inc("counter"); err != nil || val != "1" {
+		t.Errorf("Error, wrong inc value! %s %v", val, err)
+	}
+	if string(kv.name) != kvname {
+		t.Errorf("Error, the bucket name was changed! %s != %s", kv.name, kvname)
+	}
+}
+
+func TestCompression(t *testing.T) {
+	db, err := New(path.Join(os.TempDir(), "bolt.db"))
+	if err != nil {
+		t.Error(err)
+	}
+	defer db.Close()
+	l, err := NewList(db, "list_compression_test")
+	if err != nil {
+		t.Error(err)
+	}
+	defer l.Remove()
+	kv, err := NewKeyValue(db, "kv_compression_test")
+	if err != nil {
+		t.Error(err)
+	}
+	defer kv.Remove()
+
+	// Uncompressed values, as written by older versions
+	if err := l.Add("legacy"); err != nil {
+		t.Error(err)
+	}
+	if err := kv.Set("legacy", "value"); err != nil {
+		t.Error(err)
+	}
+	// Uncompressed binary values that begin like compressed or escaped values
+	binary := string([]byte{0, 0x1f, 0x8b, 1, 2})
+	escaped := string([]byte{0, 0x1f, 0, 7})
+	if err := l.Add(binary); err != nil {
+		t.Error(err)
+	}
+	if err := kv.SetBytes([]byte("binary"), []byte(binary)); err != nil {
+		t.Error(err)
+	}
+	if err := kv.SetBytes([]byte("escaped"), []byte(escaped)); err != nil {
+		t.Error(err)
+	}
+
+	if err := db.SetCompression(Gzip); err != nil {
+		t.Error(err)
+	}
+	if db.Compression() != Gzip {
+		t.Error("Error, compression should be enabled")
+	}
+	large := strings.Repeat(`{"level":"info","msg":"hello"}`, 100)
+	if err := l.Add(large); err != nil {
+		t.Error(err)
+	}
+	if err := kv.Set("large", large); err != nil {
+		t.Error(err)
+	}
+	if err := kv.SetBytes([]byte("bytes"), []byte{1, 2, 3}); err != nil {
+		t.Error(err)
+	}
+
+	// The new values are stored compressed
+	if err := (*bbolt.DB)(db).View(func(tx *bbolt.Tx) error {
+		value := tx.Bucket([]byte("kv_compression_test")).Get([]byte("large"))
+		if !isCompressed(value) || len(value) >= len(large) {
+			t.Errorf("Error, the value should be compressed, got %d bytes", len(value))
+		}
+		return nil
+	}); err != nil {
+		t.Error(err)
+	}
+
+	// Both the compressed and the uncompressed values can be read
+	if values, err := l.All(); err != nil || len(values) != 3 || values[0] != "legacy" || values[1] != binary || values[2] != large {
+		t.Errorf("Error, wrong list contents! %d %v", len(values), err)
+	}
+	if last, err := l.Last(); err != nil || last != large {
+		t.Errorf("Error, wrong last element! %v", err)
+	}
+	if index, err := l.IndexOf(large); err != nil || index != 2 {
+		t.Errorf("Error, wrong index! %d %v", index, err)
+	}
+	for key, expected := range map[string]string{"binary": binary, "escaped": escaped} {
+		if val, err := kv.GetBytes([]byte(key)); err != nil || string(val) != expected {
+			t.Errorf("Error, wrong binary value! %v %v", val, err)
+		}
+	}
+	if val, err := kv.Get("legacy"); err != nil || val != "value" {
+		t.Errorf("Error, wrong value! %s %v", val, err)
+	}
+	if val, err := kv.Get("large"); err != nil || val != large {
+		t.Errorf("Error, wrong value! %v", err)
+	}
+	if val, err := kv.GetBytes([]byte("bytes")); err != nil || string(val) != string([]byte{1, 2, 3}) {
+		t.Errorf("Error, wrong value! %v %v", val, err)
+	}
+
+	// Compressed values can still be read after disabling compression
+	if err := db.SetCompression(NoCompression); err != nil {
+		t.Error(err)
+	}
+	if val, err := kv.Get("large"); err != nil || val != large {
+		t.Errorf("Error, wrong value! %v", err)
+	}
+	if err := db.SetCompression(Compression(42)); !errors.Is(err, ErrInvalidCompression) {
+		t.Errorf("Error, expected ErrInvalidCompression, got %v", err)
+	}
+}
+
+func TestAddTimed(t *testing.T) {
+	db, err := New(path.Join(os.TempDir(), "bolt.db"))
+	if err != nil {
+		t.Error(err)
+	}
+	defer db.Close()
+	l, err := NewList(db, "list_addtimed_test")
+	if err != nil {
+		t.Error(err)
+	}
+	defer l.Remove()
+	var previous time.Time
+	for _, value := range []string{"a", "b", "c", "d"} {
+		added, err := l.AddTimed(value)
+		if err != nil {
+			t.Error(err)
+		}
+		if added.Before(previous) {
+			t.Errorf("Error, %v was added before %v", added, previous)
+		}
+		previous = added
+	}
+	if values, err := l.All(); err != nil || strings.Join(values, "") != "abcd" {
+		t.Errorf("Error, wrong list contents! %v %v", values, err)
+	}
+	if err := l.RemoveByIndex(-1); err != nil {
+		t.Error(err)
+	}
+	if values, err := l.LastN(2); err != nil || strings.Join(values, "") != "bc" {
+		t.Errorf("Error, wrong last elements! %v %v", values, err)
+	}
+	if _, err := l.LastN(4); err == nil {
+		t.Error("Error, expected an error for too few items")
+	}
+	if values, err := l.LastN(0); err != nil || len(values) != 0 {
+		t.Errorf("Error, expected no elements! %v %v", values, err)
+	}
+}
+
+func TestAddCapped(t *testing.T) {
+	db, err := New(path.Join(os.TempDir(), "bolt.db"))
+	if err != nil {
+		t.Error(err)
+	}
+	defer db.Close()
+	l, err := NewList(db, "list_addcapped_test")
+	if err != nil {
+		t.Error(err)
+	}
+	defer l.Remove()
+	for _, value := range []string{"a", "b", "c", "d", "e"} {
+		if err := l.AddCapped(value, 3); err != nil {
+			t.Error(err)
+		}
+	}
+	if values, err := l.All(); err != nil || strings.Join(values, "") != "cde" {
+		t.Errorf("Error, wrong list contents! %v %v", values, err)
+	}
+	// Lowering the cap removes several elements at once
+	if err := l.AddCapped("f", 1); err != nil {
+		t.Error(err)
+	}
+	if values, err := l.All(); err != nil || strings.Join(values, "") != "f" {
+		t.Errorf("Error, wrong list contents! %v %v", values, err)
+	}
+	if err := l.AddCapped("g", 0); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("Error, expected ErrOutOfRange, got %v", err)
+	}
+}
+
+func TestDo(t *testing.T) {
+	db, err := New(path.Join(os.TempDir(), "bolt.db"))
+	if err != nil {
+		t.Error(err)
+	}
+	defer db.Close()
+	from, err := NewList(db, "list_do_from_test")
+	if err != nil {
+		t.Error(err)
+	}
+	defer from.Remove()
+	to, err := NewList(db, "list_do_to_test")
+	if err != nil {
+		t.Error(err)
+	}
+	defer to.Remove()
+	kv, err := NewKeyValue(db, "kv_do_test")
+	if err != nil {
+		t.Error(err)
+	}
+	defer kv.Remove()
+	h, err := NewHashMap(db, "hashmap_do_test")
+	if err != nil {
+		t.Error(err)
+	}
+	defer h.Remove()
+	if err := from.Add("a"); err != nil {
+		t.Error(err)
+	}
+	if err := from.Add("b"); err != nil {
+		t.Error(err)
+	}
+	// Move an element from one list to the other and count the moves
+	if err := db.Do(func(txdb *TxDatabase) error {
+		txFrom, err := txdb.List("list_do_from_test")
+		if err != nil {
+			return err
+		}
+		txTo, err := txdb.List("list_do_to_test")
+		if err != nil {
+			return err
+		}
+		txKV, err := txdb.KeyValue("kv_do_test")
+		if err != nil {
+			return err
+		}
+		value, err := txFrom.Pop()
+		if err != nil {
+			return err
+		}
+		if err := txTo.Add(value); err != nil {
+			return err
+		}
+		txHash, err := txdb.HashMap("hashmap_do_test")
+		if err != nil {
+			return err
+		}
+		if err := txHash.Set("moves", "last", value); err != nil {
+			return err
+		}
+		if last, err := txHash.Get("moves", "last"); err != nil || last != value {
+			t.Errorf("Error, wrong value within the transaction! %v %v", last, err)
+		}
+		if err := txHash.Set("a:b", "last", value); !errors.Is(err, ErrInvalidID) {
+			t.Errorf("Error, expected ErrInvalidID, got %v", err)
+		}
+		_, err = txKV.Inc("moved")
+		return err
+	}); err != nil {
+		t.Error(err)
+	}
+	if val, err := h.Get("moves", "last"); err != nil || val != "b" {
+		t.Errorf("Error, wrong value! %v %v", val, err)
+	}
+	if values, err := from.All(); err != nil || strings.Join(values, "") != "a" {
+		t.Errorf("Error, wrong list contents! %v %v", values, err)
+	}
+	if values, err := to.All(); err != nil || strings.Join(values, "") != "b" {
+		t.Errorf("Error, wrong list contents! %v %v", values, err)
+	}
+	if val, err := kv.Get("moved"); err != nil || val != "1" {
+		t.Errorf("Error, wrong value! %v %v", val, err)
+	}
+	// Nothing is stored if the function returns an error
+	err = db.Do(func(txdb *TxDatabase) error {
+		txFrom, err := txdb.List("list_do_from_test")
+		if err != nil {
+			return err
+		}
+		if _, err := txFrom.Pop(); err != nil {
+			return err
+		}
+		txSet, err := txdb.Set("set_do_test")
+		if err != nil {
+			return err
+		}
+		if err := txSet.Add("a"); err != nil {
+			return err
+		}
+		return txSet.Add("a")
+	})
+	if !errors.Is(err, ErrExistsInSet) {
+		t.Errorf("Error, expected ErrExistsInSet, got %v", err)
+	}
+	if values, err := from.All(); err != nil || strings.Join(values, "") != "a" {
+		t.Errorf("Error, wrong list contents! %v %v", values, err)
+	}
+	if _, err := OpenSet(db, "set_do_test"); !errors.Is(err, ErrBucketNotFound) {
+		t.Errorf("Error, expected ErrBucketNotFound, got %v", err)
+	}
+}
+
+func TestIndexedList(t *testing.T) {
+	db, err := New(path.Join(os.TempDir(), "bolt.db"))
+	if err != nil {
+		t.Error(err)
+	}
+	defer db.Close()
+	plain, err := NewList(db, "list_indexed_test")
+	if err != nil {
+		t.Error(err)
+	}
+	defer plain.Remove()
+	// Existing elements are indexed
+	if err := plain.Add("a"); err != nil {
+		t.Error(err)
+	}
+	l, err := NewIndexedList(db, "list_indexed_test")
+	if err != nil {
+		t.Error(err)
+	}
+	for _, value := range []string{"b", "a", "c"} {
+		if err := l.Add(value); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err := l.AddTimed("d"); err != nil {
+		t.Error(err)
+	}
+	// The index is also used by lists loaded with OpenList
+	l, err = OpenList(db, "list_indexed_test")
+	if err != nil {
+		t.Error(err)
+	}
+	if found, err := l.Contains("d"); err != nil || !found {
+		t.Errorf("Error, expected to find d! %v", err)
+	}
+	if found, err := l.Contains("e"); err != nil || found {
+		t.Errorf("Error, did not expect to find e! %v", err)
+	}
+	if index, err := l.IndexOf("c"); err != nil || index != 3 {
+		t.Errorf("Error, wrong index of c! %d %v", index, err)
+	}
+	if removed, err := l.RemoveByValue("a"); err != nil || removed != 2 {
+		t.Errorf("Error, expected to remove 2 elements! %d %v", removed, err)
+	}
+	if found, err := l.Contains("a"); err != nil || found {
+		t.Errorf("Error, did not expect to find a! %v", err)
+	}
+	if index, err := l.IndexOf("c"); err != nil || index != 1 {
+		t.Errorf("Error, wrong index of c! %d %v", index, err)
+	}
+	if err := l.RemoveByIndex(0); err != nil {
+		t.Error(err)
+	}
+	if found, err := l.Contains("b"); err != nil || found {
+		t.Errorf("Error, did not expect to find b! %v", err)
+	}
+	// The index is kept up to date within Database.Do
+	if err := db.Do(func(txdb *TxDatabase) error {
+		txList, err := txdb.List("list_indexed_test")
+		if err != nil {
+			return err
+		}
+		if _, err := txList.Pop(); err != nil {
+			return err
+		}
+		return txList.Add("e")
+	}); err != nil {
+		t.Error(err)
+	}
+	if found, err := l.Contains("d"); err != nil || found {
+		t.Errorf("Error, did not expect to find d! %v", err)
+	}
+	if found, err := l.Contains("e"); err != nil || !found {
+		t.Errorf("Error, expected to find e! %v", err)
+	}
+	for _, value := range []string{"f", "g"} {
+		if err := l.AddCapped(value, 2); err != nil {
+			t.Error(err)
+		}
+	}
+	if found, err := l.Contains("c"); err != nil || found {
+		t.Errorf("Error, did not expect to find c! %v", err)
+	}
+	if values, err := l.All(); err != nil || strings.Join(values, "") != "fg" {
+		t.Errorf("Error, wrong list contents! %v %v", values, err)
+	}
+	if err := l.Clear(); err != nil {
+		t.Error(err)
+	}
+	if found, err := l.Contains("f"); err != nil || found {
+		t.Errorf("Error, did not expect to find f! %v", err)
+	}
+	// The index is removed together with the list
+	if err := l.Remove(); err != nil {
+		t.Error(err)
+	}
+	if err := (*bbolt.DB)(db).View(func(tx *bbolt.Tx) error {
+		if tx.Bucket([]byte("list_indexed_test"+indexSuffix)) != nil {
+			t.Error("Error, the index should have been removed")
+		}
+		return nil
+	}); err != nil {
+		t.Error(err)
+	}
+
+	// Lists without an index give the same results
+	plain, err = NewList(db, "list_unindexed_test")
+	if err != nil {
+		t.Error(err)
+	}
+	defer plain.Remove()
+	for _, value := range []string{"a", "b", "a"} {
+		if err := plain.Add(value); err != nil {
+			t.Error(err)
+		}
+	}
+	if found, err := plain.Contains("b"); err != nil || !found {
+		t.Errorf("Error, expected to find b! %v", err)
+	}
+	if removed, err := plain.RemoveByValue("a"); err != nil || removed != 2 {
+		t.Errorf("Error, expected to remove 2 elements! %d %v", removed, err)
+	}
+	if values, err := plain.All(); err != nil || strings.Join(values, "") != "b" {
+		t.Errorf("Error, wrong list contents! %v %v", values, err)
+	}
+}
+
+func TestDatabaseClosed(t *testing.T) {
+	db, err := New(path.Join(os.TempDir(), "bolt.db"))
+	if err != nil {
+		t.Error(err)
+	}
+	l, err := NewList(db, "list_closed_test")
+	if err != nil {
+		t.Error(err)
+	}
+	if err := db.Ping(); err != nil {
+		t.Error(err)
+	}
+	db.Close()
+	if err := l.Add("a"); !errors.Is(err, ErrDatabaseClosed) {
+		t.Errorf("Error, expected ErrDatabaseClosed, got %v", err)
+	}
+	var opErr *OpError
+	if err := l.Add("a"); !errors.As(err, &opErr) || opErr.Op != "List.Add" {
+		t.Errorf("Error, expected an *OpError for List.Add, got %v", err)
+	}
+	if _, err := NewKeyValue(db, "kv_closed_test"); !errors.Is(err, ErrDatabaseClosed) {
+		t.Errorf("Error, expected ErrDatabaseClosed, got %v", err)
+	}
+	if err := db.Do(func(txdb *TxDatabase) error { return nil }); !errors.Is(err, ErrDatabaseClosed) {
+		t.Errorf("Error, expected ErrDatabaseClosed, got %v", err)
+	}
+	if err := db.Ping(); !errors.Is(err, ErrDatabaseClosed) {
+		t.Errorf("Error, expected ErrDatabaseClosed, got %v", err)
+	}
+	// Closing twice is harmless
+	db.Close()
+
+	db, err = New(path.Join(os.TempDir(), "bolt.db"))
+	if err != nil {
+		t.Error(err)
+	}
+	defer db.Close()
+	if l, err = OpenList(db, "list_closed_test"); err != nil {
+		t.Error(err)
+	}
+	l.Remove()
+}
+
+func TestGetAllMaps(t *testing.T) {
+	db, err := New(path.Join(os.TempDir(), "bolt.db"))
+	if err != nil {
+		t.Error(err)
+	}
+	defer db.Close()
+	users, err := NewHashMap(db, "hashmap_getallmaps_test")
+	if err != nil {
+		t.Error(err)
+	}
+	defer users.Remove()
+	if maps, err := users.GetAllMaps(); err != nil || len(maps) != 0 {
+		t.Errorf("Error, expected no elements! %v %v", maps, err)
+	}
+	if err := users.Set("bob", "email", "bob@example.com"); err != nil {
+		t.Error(err)
+	}
+	if err := users.Set("bob", "password", "hunter2"); err != nil {
+		t.Error(err)
+	}
+	// Values may contain colons
+	if err := users.Set("alice", "url", "https://example.com"); err != nil {
+		t.Error(err)
+	}
+	maps, err := users.GetAllMaps()
+	if err != nil {
+		t.Error(err)
+	}
+	if len(maps) != 2 || len(maps["bob"]) != 2 || len(maps["alice"]) != 1 {
+		t.Errorf("Error, wrong elements! %v", maps)
+	}
+	if maps["bob"]["email"] != "bob@example.com" || maps["bob"]["password"] != "hunter2" {
+		t.Errorf("Error, wrong fields for bob! %v", maps["bob"])
+	}
+	if maps["alice"]["url"] != "https://example.com" {
+		t.Errorf("Error, wrong fields for alice! %v", maps["alice"])
+	}
+}
+
+func TestPrepend(t *testing.T) {
+	db, err := New(path.Join(os.TempDir(), "bolt.db"))
+	if err != nil {
+		t.Error(err)
+	}
+	defer db.Close()
+	l, err := NewIndexedList(db, "list_prepend_test")
+	if err != nil {
+		t.Error(err)
+	}
+	defer l.Remove()
+	// Interleave appends and prepends, and keep track of the expected order
+	var expected []string
+	for i := 0; i < 100; i++ {
+		value := strconv.Itoa(i)
+		switch i % 3 {
+		case 0:
+			if err := l.Add(value); err != nil {
+				t.Error(err)
+			}
+			expected = append(expected, value)
+		case 1:
+			if err := l.Prepend(value); err != nil {
+				t.Error(err)
+			}
+			expected = append([]string{value}, expected...)
+		default:
+			batch := []string{value + "a", value + "b"}
+			if err := l.PrependBatch(batch); err != nil {
+				t.Error(err)
+			}
+			expected = append(batch, expected...)
+		}
+	}
+	if _, err := l.AddTimed("timed"); err != nil {
+		t.Error(err)
+	}
+	if err := l.Prepend("first"); err != nil {
+		t.Error(err)
+	}
+	expected = append(append([]string{"first"}, expected...), "timed")
+	values, err := l.All()
+	if err != nil {
+		t.Error(err)
+	}
+	if strings.Join(values, ",") != strings.Join(expected, ",") {
+		t.Errorf("Error, wrong list contents!\n%v\n%v", values, expected)
+	}
+	for i, value := range expected {
+		if index, err := l.IndexOf(value); err != nil || index != i {
+			t.Errorf("Error, wrong index of %s! %d %v", value, index, err)
+		}
+	}
+	if last, err := l.Last(); err != nil || last != "timed" {
+		t.Errorf("Error, wrong last element! %v %v", last, err)
+	}
+
+	// The keys of a new list stay valid when elements are prepended
+	key, err := l.AddReturningKey("kept")
+	if err != nil {
+		t.Error(err)
+	}
+	if err := l.PrependBatch([]string{"x", "y"}); err != nil {
+		t.Error(err)
+	}
+	if value, err := l.GetByKey(key); err != nil || value != "kept" {
+		t.Errorf("Error, the key is no longer valid! %s %v", value, err)
+	}
+
+	// The keys of a list created by an earlier version count from 1, and are
+	// rewritten the first time an element is prepended
+	if err := (*bbolt.DB)(db).Update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucket([]byte("list_prepend_legacy_test"))
+		if err != nil {
+			return err
+		}
+		for _, value := range []string{"a", "b"} {
+			n, err := bucket.NextSequence()
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put(byteID(n), []byte(value)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	legacy, err := NewIndexedList(db, "list_prepend_legacy_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer legacy.Remove()
+	if err := legacy.Prepend("first"); err != nil {
+		t.Error(err)
+	}
+	if err := legacy.Add("last"); err != nil {
+		t.Error(err)
+	}
+	if values, err := legacy.All(); err != nil || strings.Join(values, ",") != "first,a,b,last" {
+		t.Errorf("Error, wrong list contents! %v %v", values, err)
+	}
+	// The index is kept up to date when the keys are rewritten
+	if index, err := legacy.IndexOf("b"); err != nil || index != 2 {
+		t.Errorf("Error, wrong index of b! %d %v", index, err)
+	}
+}
+
+func TestSetInPlace(t *testing.T) {
+	db, err := New(path.Join(os.TempDir(), "bolt.db"))
+	if err != nil {
+		t.Error(err)
+	}
+	defer db.Close()
+	a, err := NewSet(db, "set_inplace_a_test")
+	if err != nil {
+		t.Error(err)
+	}
+	defer a.Remove()
+	b, err := NewSet(db, "set_inplace_b_test")
+	if err != nil {
+		t.Error(err)
+	}
+	defer b.Remove()
+	reset := func(s *Set, values ...string) {
+		s.Clear()
+		for _, value := range values {
+			if err := s.Add(value); err != nil {
+				t.Error(err)
+			}
+		}
+	}
+	check := func(s *Set, expected ...string) {
+		values, err := s.All()
+		if err != nil || strings.Join(values, ",") != strings.Join(expected, ",") {
+			t.Errorf("Error, wrong set contents! %v %v", values, err)
+		}
+	}
+
+	reset(a, "a", "b", "c")
+	reset(b, "c", "d", "a", "e")
+	if err := a.UnionWith(b); err != nil {
+		t.Error(err)
+	}
+	check(a, "a", "b", "c", "d", "e")
+	check(b, "c", "d", "a", "e")
+
+	reset(a, "a", "b", "c")
+	if err := a.IntersectWith(b); err != nil {
+		t.Error(err)
+	}
+	check(a, "a", "c")
+
+	reset(a, "a", "b", "c")
+	if err := a.DifferenceWith(b); err != nil {
+		t.Error(err)
+	}
+	check(a, "b")
+
+	// A set combined with itself
+	if err := a.UnionWith(a); err != nil {
+		t.Error(err)
+	}
+	check(a, "b")
+	if err := a.DifferenceWith(a); err != nil {
+		t.Error(err)
+	}
+	check(a)
+
+	// Sets in different databases can not be combined
+	otherDB, err := New(path.Join(os.TempDir(), "bolt_other.db"))
+	if err != nil {
+		t.Error(err)
+	}
+	defer otherDB.Close()
+	c, err := NewSet(otherDB, "set_inplace_c_test")
+	if err != nil {
+		t.Error(err)
+	}
+	defer c.Remove()
+	if err := a.UnionWith(c); err == nil {
+		t.Error("Error, expected an error for sets in different databases")
+	}
+}
+
+func TestKeyValueLen(t *testing.T) {
+	db, err := New(path.Join(os.TempDir(), "bolt.db"))
+	if err != nil {
+		t.Error(err)
+	}
+	defer db.Close()
+	kv, err := NewKeyValue(db, "kv_len_test")
+	if err != nil {
+		t.Error(err)
+	}
+	defer kv.Remove()
+	if n, err := kv.Len(); err != nil || n != 0 {
+		t.Errorf("Error, expected no keys! %d %v", n, err)
+	}
+	for _, key := range []string{"a", "b", "c", "a"} {
+		if err := kv.Set(key, "value"); err != nil {
+			t.Error(err)
+		}
+	}
+	if err := kv.Del("b"); err != nil {
+		t.Error(err)
+	}
+	if n, err := kv.Len(); err != nil || n != 2 {
+		t.Errorf("Error, expected 2 keys! %d %v", n, err)
+	}
+	kv.Remove()
+	if _, err := kv.Len(); err != ErrDoesNotExist {
+		t.Errorf("Error, expected ErrDoesNotExist, got %v", err)
+	}
+}
+
+func TestFaultInjector(t *testing.T) {
+	db, err := New(path.Join(os.TempDir(), "bolt.db"))
+	if err != nil {
+		t.Error(err)
+	}
+	defer db.Close()
+	l, err := NewList(db, "list_fault_test")
+	if err != nil {
+		t.Error(err)
+	}
+	defer l.Remove()
+	errFault := errors.New("injected fault")
+	var ops []string
+	db.SetFaultInjector(func(op string) error {
+		ops = append(ops, op)
+		return errFault
+	})
+	if err := l.Add("a"); !errors.Is(err, errFault) {
+		t.Errorf("Error, expected the injected fault, got %v", err)
+	}
+	if len(ops) != 1 || ops[0] != "encode" {
+		t.Errorf("Error, wrong operations! %v", ops)
+	}
+	if values, err := l.All(); err != nil || len(values) != 0 {
+		t.Errorf("Error, expected no elements! %v %v", values, err)
+	}
+	db.SetFaultInjector(nil)
+	if err := l.Add("a"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSetVersioned(t *testing.T) {
+	db, err := New(path.Join(os.TempDir(), "bolt.db"))
+	if err != nil {
+		t.Error(err)
+	}
+	defer db.Close()
+	kv, err := NewKeyValue(db, "kv_versioned_test")
+	if err != nil {
+		t.Error(err)
+	}
+	defer kv.Remove()
+	kv.Clear()
+
+	version, err := kv.SetVersioned("doc", "first", 0)
+	if err != nil || version != 1 {
+		t.Errorf("Error, expected version 1! %d %v", version, err)
+	}
+	// Two writers with the same version
+	if version, err = kv.SetVersioned("doc", "second", 1); err != nil || version != 2 {
+		t.Errorf("Error, expected version 2! %d %v", version, err)
+	}
+	if _, err = kv.SetVersioned("doc", "third", 1); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("Error, expected ErrVersionConflict, got %v", err)
+	}
+	val, version, err := kv.GetVersioned("doc")
+	if err != nil || val != "second" || version != 2 {
+		t.Errorf("Error, wrong value or version! %s %d %v", val, version, err)
+	}
+	// Keys that are set with Set have version 0
+	if err := kv.Set("plain", "value"); err != nil {
+		t.Error(err)
+	}
+	if val, version, err := kv.GetVersioned("plain"); err != nil || val != "value" || version != 0 {
+		t.Errorf("Error, wrong value or version! %s %d %v", val, version, err)
+	}
+	if _, _, err := kv.GetVersioned("missing"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Error, expected ErrKeyNotFound, got %v", err)
+	}
+	// The versions are not reused after a key is deleted
+	if err := kv.Del("doc"); err != nil {
+		t.Error(err)
+	}
+	if _, err = kv.SetVersioned("doc", "again", 0); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("Error, expected ErrVersionConflict, got %v", err)
+	}
+	if version, err = kv.SetVersioned("doc", "again", 2); err != nil || version != 3 {
+		t.Errorf("Error, expected version 3! %d %v", version, err)
+	}
+}
+
+func TestPopN(t *testing.T) {
+	db, err := New(path.Join(os.TempDir(), "bolt.db"))
+	if err != nil {
+		t.Error(err)
+	}
+	defer db.Close()
+	l, err := NewIndexedList(db, "list_popn_test")
+	if err != nil {
+		t.Error(err)
+	}
+	defer l.Remove()
+	l.Clear()
+	for _, value := range []string{"a", "b", "c", "d", "e"} {
+		if err := l.Add(value); err != nil {
+			t.Error(err)
+		}
+	}
+	if values, err := l.PopN(2); err != nil || strings.Join(values, ",") != "a,b" {
+		t.Errorf("Error, wrong elements! %v %v", values, err)
+	}
+	if found, err := l.Contains("a"); err != nil || found {
+		t.Errorf("Error, expected the element to be removed from the index! %v", err)
+	}
+	if values, err := l.PopN(0); err != nil || len(values) != 0 {
+		t.Errorf("Error, expected no elements! %v %v", values, err)
+	}
+	if values, err := l.PopN(10); err != nil || strings.Join(values, ",") != "c,d,e" {
+		t.Errorf("Error, wrong elements! %v %v", values, err)
+	}
+	if values, err := l.PopN(1); err != nil || len(values) != 0 {
+		t.Errorf("Error, expected no elements! %v %v", values, err)
+	}
+}
+
+func TestCodec(t *testing.T) {
+	type user struct {
+		Name string
+		Age  int
+	}
+	db, err := New(path.Join(os.TempDir(), "bolt.db"))
+	if err != nil {
+		t.Error(err)
+	}
+	defer db.Close()
+	if _, ok := db.Codec().(JSONCodec); !ok {
+		t.Errorf("Error, expected JSONCodec to be the default!")
+	}
+	for _, codec := range []Codec{JSONCodec{}, GobCodec{}} {
+		db.SetCodec(codec)
+		l, err := NewList(db, "list_codec_test")
+		if err != nil {
+			t.Error(err)
+		}
+		l.Clear()
+		users := []user{{"Alice", 30}, {"Bob", 40}}
+		for _, u := range users {
+			if err := l.AddValue(u); err != nil {
+				t.Error(err)
+			}
+		}
+		var got []user
+		if err := l.GetAllValues(&got); err != nil || len(got) != 2 || got[0] != users[0] || got[1] != users[1] {
+			t.Errorf("Error, wrong values! %v %v", got, err)
+		}
+		if err := l.GetAllValues(got); !errors.Is(err, ErrInvalidOutput) {
+			t.Errorf("Error, expected ErrInvalidOutput, got %v", err)
+		}
+		l.Remove()
+
+		kv, err := NewKeyValue(db, "kv_codec_test")
+		if err != nil {
+			t.Error(err)
+		}
+		var u user
+		if err := kv.SetValue("alice", users[0]); err != nil {
+			t.Error(err)
+		}
+		if err := kv.GetValue("alice", &u); err != nil || u != users[0] {
+			t.Errorf("Error, wrong value! %v %v", u, err)
+		}
+		if err := kv.GetValue("missing", &u); !errors.Is(err, ErrKeyNotFound) {
+			t.Errorf("Error, expected ErrKeyNotFound, got %v", err)
+		}
+		kv.Remove()
+
+		h, err := NewHashMap(db, "hashmap_codec_test")
+		if err != nil {
+			t.Error(err)
+		}
+		u = user{}
+		if err := h.SetValue("bob", "profile", users[1]); err != nil {
+			t.Error(err)
+		}
+		if err := h.GetValue("bob", "profile", &u); err != nil || u != users[1] {
+			t.Errorf("Error, wrong value! %v %v", u, err)
+		}
+		h.Remove()
+	}
+	db.SetCodec(nil)
+	if _, ok := db.Codec().(JSONCodec); !ok {
+		t.Errorf("Error, expected JSONCodec after resetting the codec!")
+	}
+}
+
+func TestErrors(t *testing.T) {
+	db, err := New(path.Join(os.TempDir(), "bolt.db"))
+	if err != nil {
+		t.Error(err)
+	}
+	defer db.Close()
+	l, err := NewList(db, "list_errors_test")
+	if err != nil {
+		t.Error(err)
+	}
+	defer l.Remove()
+	l.Clear()
+	if err := l.Add("a"); err != nil {
+		t.Error(err)
+	}
+	if _, err := l.LastN(2); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("Error, expected ErrOutOfRange, got %v", err)
+	}
+
+	otherDB, err := New(path.Join(os.TempDir(), "bolt_errors.db"))
+	if err != nil {
+		t.Error(err)
+	}
+	defer os.Remove(otherDB.Path())
+	defer otherDB.Close()
+	s, err := NewSet(db, "set_errors_test")
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.Remove()
+	other, err := NewSet(otherDB, "set_errors_test")
+	if err != nil {
+		t.Error(err)
+	}
+	var opErr *OpError
+	if err := s.UnionWith(other); !errors.Is(err, ErrDifferentDatabase) || !errors.As(err, &opErr) || opErr.Bucket != "set_errors_test" {
+		t.Errorf("Error, expected ErrDifferentDatabase with the bucket name, got %v", err)
+	}
+}
+
+func TestContext(t *testing.T) {
+	db, err := New(path.Join(os.TempDir(), "bolt.db"))
+	if err != nil {
+		t.Error(err)
+	}
+	defer db.Close()
+	l, err := NewList(db, "list_context_test")
+	if err != nil {
+		t.Error(err)
+	}
+	defer l.Remove()
+	l.Clear()
+	values := make([]string, 100)
+	for i := range values {
+		values[i] = strconv.Itoa(i)
+	}
+	if err := l.PrependBatchCtx(context.Background(), values); err != nil {
+		t.Error(err)
+	}
+
+	// Cancel in the middle of a batch, which rolls back the whole transaction
+	ctx, cancel := context.WithCancel(context.Background())
+	encoded := 0
+	db.SetFaultInjector(func(op string) error {
+		if encoded++; encoded == 50 {
+			cancel()
+		}
+		return nil
+	})
+	err = l.PrependBatchCtx(ctx, values)
+	db.SetFaultInjector(nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Error, expected context.Canceled, got %v", err)
+	}
+	if all, err := l.AllCtx(context.Background()); err != nil || len(all) != len(values) {
+		t.Errorf("Error, expected the list to be unchanged! %d %v", len(all), err)
+	}
+	if _, err := l.AllCtx(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Error, expected context.Canceled, got %v", err)
+	}
+
+	s, err := NewSet(db, "set_context_test")
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.Remove()
+	s.Add("a")
+	if _, err := s.AllCtx(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Error, expected context.Canceled, got %v", err)
+	}
+	if deleted, err := s.DelBatchCtx(ctx, []string{"a"}); !errors.Is(err, context.Canceled) || deleted != 0 {
+		t.Errorf("Error, expected context.Canceled, got %d %v", deleted, err)
+	}
+	if found, err := s.Has("a"); err != nil || !found {
+		t.Errorf("Error, expected the set to be unchanged! %v", err)
+	}
+
+	h, err := NewHashMap(db, "hashmap_context_test")
+	if err != nil {
+		t.Error(err)
+	}
+	defer h.Remove()
+	h.Set("bob", "name", "Bob")
+	if _, err := h.GetAllMapsCtx(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Error, expected context.Canceled, got %v", err)
+	}
+
+	kv, err := NewKeyValue(db, "kv_context_test")
+	if err != nil {
+		t.Error(err)
+	}
+	defer kv.Remove()
+	kv.Set("user:bob", "Bob")
+	if _, err := kv.GetAllWithPrefixCtx(ctx, "user:"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Error, expected context.Canceled, got %v", err)
+	}
+}
+
+func TestMoveBetweenSets(t *testing.T) {
+	db, err := New(path.Join(os.TempDir(), "bolt.db"))
+	if err != nil {
+		t.Error(err)
+	}
+	defer db.Close()
+	pending, err := NewSet(db, "set_pending_test")
+	if err != nil {
+		t.Error(err)
+	}
+	defer pending.Remove()
+	approved, err := NewSet(db, "set_approved_test")
+	if err != nil {
+		t.Error(err)
+	}
+	defer approved.Remove()
+	pending.Clear()
+	approved.Clear()
+	pending.Add("a")
+	pending.Add("b")
+	approved.Add("b")
+
+	if err := MoveBetweenSets(pending, approved, "a"); err != nil {
+		t.Error(err)
+	}
+	if found, err := pending.Has("a"); err != nil || found {
+		t.Errorf("Error, expected the value to be removed! %v", err)
+	}
+	if found, err := approved.Has("a"); err != nil || !found {
+		t.Errorf("Error, expected the value to be added! %v", err)
+	}
+	// A value that is already in the other set is not added twice
+	if err := MoveBetweenSets(pending, approved, "b"); err != nil {
+		t.Error(err)
+	}
+	if values, err := approved.All(); err != nil || strings.Join(values, ",") != "b,a" {
+		t.Errorf("Error, wrong values! %v %v", values, err)
+	}
+	if values, err := pending.All(); err != nil || len(values) != 0 {
+		t.Errorf("Error, expected an empty set! %v %v", values, err)
+	}
+	if err := MoveBetweenSets(pending, approved, "c"); !errors.Is(err, ErrDoesNotExist) {
+		t.Errorf("Error, expected ErrDoesNotExist, got %v", err)
+	}
+}
+
+func TestTyped(t *testing.T) {
+	type user struct {
+		Name string
+		Age  int
+	}
+	db, err := New(path.Join(os.TempDir(), "bolt.db"))
+	if err != nil {
+		t.Error(err)
+	}
+	defer db.Close()
+	l, err := NewList(db, "list_typed_test")
+	if err != nil {
+		t.Error(err)
+	}
+	defer l.Remove()
+	l.Clear()
+	users := NewTypedList[user](l, codec.JSONCodec[user]{})
+	if err := users.Add(user{"Alice", 30}); err != nil {
+		t.Error(err)
+	}
+	if all, err := users.All(); err != nil || len(all) != 1 || all[0].Name != "Alice" {
+		t.Errorf("Error, wrong values! %v %v", all, err)
+	}
+	// Decoding errors have the index of the value
+	l.Add("not json")
+	var opErr *OpError
+	if _, err := users.All(); !errors.As(err, &opErr) || opErr.Bucket != "list_typed_test" || opErr.Key != "index 1" {
+		t.Errorf("Error, expected an OpError with the index, got %v", err)
+	}
+
+	s, err := NewSet(db, "set_typed_test")
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.Remove()
+	ids := NewTypedSet[int](s, codec.GobCodec[int]{})
+	ids.Add(7)
+	if found, err := ids.Has(7); err != nil || !found {
+		t.Errorf("Error, expected the value to be in the set! %v", err)
+	}
+	if err := ids.Add(7); !errors.Is(err, ErrExistsInSet) {
+		t.Errorf("Error, expected ErrExistsInSet, got %v", err)
+	}
+
+	kv, err := NewKeyValue(db, "kv_typed_test")
+	if err != nil {
+		t.Error(err)
+	}
+	defer kv.Remove()
+	raw := NewTypedKeyValue[[]byte](kv, codec.RawBytesCodec{})
+	raw.Set("key", []byte("value"))
+	if value, err := raw.Get("key"); err != nil || string(value) != "value" {
+		t.Errorf("Error, wrong value! %q %v", value, err)
+	}
+	kv.Set("bad", "{")
+	if _, err := NewTypedKeyValue[user](kv, codec.JSONCodec[user]{}).Get("bad"); !errors.As(err, &opErr) || opErr.Key != "bad" {
+		t.Errorf("Error, expected an OpError with the key, got %v", err)
+	}
+
+	h, err := NewHashMap(db, "hashmap_typed_test")
+	if err != nil {
+		t.Error(err)
+	}
+	defer h.Remove()
+	profiles := NewTypedHashMap[user](h, codec.JSONCodec[user]{})
+	profiles.Set("bob", "profile", user{"Bob", 40})
+	if u, err := profiles.Get("bob", "profile"); err != nil || u.Age != 40 {
+		t.Errorf("Error, wrong value! %v %v", u, err)
+	}
+}
+
+func TestFillPercent(t *testing.T) {
+	db, err := New(path.Join(os.TempDir(), "bolt.db"))
+	if err != nil {
+		t.Error(err)
+	}
+	defer db.Close()
+	values := make([]string, 5000)
+	for i := range values {
+		values[i] = strconv.Itoa(i)
+	}
+	leafPages := make(map[float64]int)
+	for _, fillPercent := range []float64{0, 0.9} {
+		l, err := NewList(db, "list_fillpercent_test")
+		if err != nil {
+			t.Error(err)
+		}
+		l.Clear()
+		l.SetFillPercent(fillPercent)
+		if err := l.PrependBatch(values); err != nil {
+			t.Error(err)
+		}
+		if all, err := l.All(); err != nil || len(all) != len(values) {
+			t.Errorf("Error, wrong number of elements! %d %v", len(all), err)
+		}
+		(*bbolt.DB)(db).View(func(tx *bbolt.Tx) error {
+			leafPages[fillPercent] = tx.Bucket([]byte("list_fillpercent_test")).Stats().LeafPageN
+			return nil
+		})
+		l.Remove()
+	}
+	if leafPages[0.9] >= leafPages[0] {
+		t.Errorf("Error, expected fewer pages with a higher fill percent! %v", leafPages)
+	}
+}
+
+func TestListInts(t *testing.T) {
+	db, err := New(path.Join(os.TempDir(), "bolt.db"))
+	if err != nil {
+		t.Error(err)
+	}
+	defer db.Close()
+	l, err := NewList(db, "list_ints_test")
+	if err != nil {
+		t.Error(err)
+	}
+	defer l.Remove()
+	l.Clear()
+	for _, n := range []int64{3, -1, 9223372036854775807} {
+		if err := l.AddInt(n); err != nil {
+			t.Error(err)
+		}
+	}
+	numbers, err := l.GetAllInts()
+	if err != nil || len(numbers) != 3 || numbers[0] != 3 || numbers[1] != -1 || numbers[2] != 9223372036854775807 {
+		t.Errorf("Error, wrong numbers! %v %v", numbers, err)
+	}
+	l.Add("four")
+	var numErr *strconv.NumError
+	var opErr *OpError
+	if _, err := l.GetAllInts(); !errors.As(err, &numErr) || !errors.As(err, &opErr) || opErr.Key != "index 3" {
+		t.Errorf("Error, expected an error for the element that is not a number, got %v", err)
+	}
+}
+
+// observedOp is an operation observed by recordingMetrics
+type observedOp struct {
+	structure, op string
+	failed        bool
+}
+
+// recordingMetrics is a Metrics that records the observed operations
+type recordingMetrics struct {
+	ops []observedOp
+}
+
+func (m *recordingMetrics) ObserveOp(structure, op string, d time.Duration, err error) {
+	m.ops = append(m.ops, observedOp{structure, op, err != nil})
+}
+
+func TestMetrics(t *testing.T) {
+	db, err := New(path.Join(os.TempDir(), "bolt.db"))
+	if err != nil {
+		t.Error(err)
+	}
+	defer db.Close()
+	m := &recordingMetrics{}
+	db.SetMetrics(m)
+	l, err := NewList(db, "list_metrics_test")
+	if err != nil {
+		t.Error(err)
+	}
+	defer l.Remove()
+	l.Add("a")
+	l.All()
+	OpenList(db, "list_metrics_test")
+	kv, err := NewKeyValue(db, "kv_metrics_test")
+	if err != nil {
+		t.Error(err)
+	}
+	defer kv.Remove()
+	kv.Get("missing")
+	s, err := NewSet(db, "set_metrics_test")
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.Remove()
+	s.UnionWith(s)
+	db.SetMetrics(nil)
+	l.Add("b")
+
+	expected := []observedOp{
+		{"List", "New", false},
+		{"List", "Add", false},
+		{"List", "All", false},
+		{"List", "Open", false},
+		{"KeyValue", "New", false},
+		{"KeyValue", "Get", true},
+		{"Set", "New", false},
+		{"Set", "UnionWith", false},
+	}
+	if len(m.ops) != len(expected) {
+		t.Fatalf("Error, wrong operations! %v", m.ops)
+	}
+	for i, op := range expected {
+		if m.ops[i] != op {
+			t.Errorf("Error, expected %v, got %v", op, m.ops[i])
+		}
+	}
+}
+
+func TestSetOrder(t *testing.T) {
+	db, err := New(path.Join(os.TempDir(), "bolt.db"))
+	if err != nil {
+		t.Error(err)
+	}
+	defer db.Close()
+	for _, n := range []int{1, 9, 10, 100} {
+		s, err := NewSet(db, "set_order_test")
+		if err != nil {
+			t.Error(err)
+		}
+		var expected []string
+		for i := 0; i < n; i++ {
+			// Let the values sort in another order than they are added in
+			value := strconv.Itoa((n - i) * 7)
+			expected = append(expected, value)
+			if err := s.Add(value); err != nil {
+				t.Errorf("Error, could not add %s! %s", value, err)
+			}
+		}
+		values, err := s.All()
+		if err != nil {
+			t.Error(err)
+		}
+		if strings.Join(values, ",") != strings.Join(expected, ",") {
+			t.Errorf("Error, wrong order for %d elements! %v", n, values)
+		}
+		s.Remove()
+	}
+}
+
+// TestNoFatal checks that the library code never terminates the process
+func TestNoFatal(t *testing.T) {
+	for _, dir := range []string{".", "codec", "expvarmetrics", "linkedlist"} {
+		files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, filename := range files {
+			if strings.HasSuffix(filename, "_test.go") {
+				continue
+			}
+			fset := token.NewFileSet()
+			f, err := parser.ParseFile(fset, filename, nil, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ast.Inspect(f, func(n ast.Node) bool {
+				sel, ok := n.(*ast.SelectorExpr)
+				if !ok {
+					return true
+				}
+				if pkg, ok := sel.X.(*ast.Ident); ok {
+					name := pkg.Name + "." + sel.Sel.Name
+					if name == "os.Exit" || strings.HasPrefix(name, "log.Fatal") || strings.HasPrefix(name, "log.Panic") {
+						t.Errorf("Error, %s calls %s!", fset.Position(n.Pos()), name)
+					}
+				}
+				return true
+			})
+		}
+	}
+}
+
+func TestLogger(t *testing.T) {
+	db, err := New(path.Join(os.TempDir(), "bolt.db"))
+	if err != nil {
+		t.Error(err)
+	}
+	defer db.Close()
+	// Logging without a logger does nothing
+	db.Logf("Silent %d", 1)
+	var buf bytes.Buffer
+	db.SetLogger(log.New(&buf, "", 0))
+	db.Logf("Logged %d", 2)
+	db.SetLogger(nil)
+	db.Logf("Silent %d", 3)
+	if buf.String() != "Logged 2\n" {
+		t.Errorf("Error, wrong log! %q", buf.String())
+	}
+}
+
+// TestConcurrentRemove uses each data structure from several goroutines while
+// it is removed. Run it with -race.
+func TestConcurrentRemove(t *testing.T) {
+	db, err := New(path.Join(os.TempDir(), "bolt.db"))
+	if err != nil {
+		t.Error(err)
+	}
+	defer db.Close()
+	l, err := NewList(db, "list_concurrent_test")
+	if err != nil {
+		t.Error(err)
+	}
+	s, err := NewSet(db, "set_concurrent_test")
+	if err != nil {
+		t.Error(err)
+	}
+	h, err := NewHashMap(db, "hashmap_concurrent_test")
+	if err != nil {
+		t.Error(err)
+	}
+	kv, err := NewKeyValue(db, "kv_concurrent_test")
+	if err != nil {
+		t.Error(err)
+	}
+	for name, structure := range map[string]struct {
+		add    func(i int) error
+		all    func() error
+		remove func() error
+	}{
+		"List": {
+			func(i int) error { return l.Add(strconv.Itoa(i)) },
+			func() error { _, err := l.All(); return err },
+			l.Remove,
+		},
+		"Set": {
+			func(i int) error { return s.Add(strconv.Itoa(i)) },
+			func() error { _, err := s.All(); return err },
+			s.Remove,
+		},
+		"HashMap": {
+			func(i int) error { return h.Set(strconv.Itoa(i), "key", "value") },
+			func() error { _, err := h.All(); return err },
+			h.Remove,
+		},
+		"KeyValue": {
+			func(i int) error { return kv.Set(strconv.Itoa(i), "value") },
+			func() error { _, err := kv.GetAllWithPrefix(""); return err },
+			kv.Remove,
+		},
+	} {
+		var wg sync.WaitGroup
+		errs := make(chan error, 1000)
+		for g := 0; g < 4; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				for i := 0; i < 50; i++ {
+					errs <- structure.add(g*100 + i)
+					errs <- structure.all()
+				}
+			}(g)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			time.Sleep(time.Millisecond)
+			errs <- structure.remove()
+		}()
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			if err != nil && !errors.Is(err, ErrDoesNotExist) && !errors.Is(err, ErrBucketNotFound) {
+				t.Errorf("Error, unexpected error from %s! %v", name, err)
+			}
+		}
+		if err := structure.add(0); !errors.Is(err, ErrDoesNotExist) {
+			t.Errorf("Error, expected ErrDoesNotExist from %s after Remove, got %v", name, err)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	filename := path.Join(os.TempDir(), "bolt_check.db")
+	os.Remove(filename)
+	defer os.Remove(filename)
+	db, err := New(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := NewList(db, "list_check_test")
+	if err != nil {
+		t.Error(err)
+	}
+	for i := 0; i < 1000; i++ {
+		l.Add(strconv.Itoa(i))
+	}
+	if problems := db.Check(); problems != nil {
+		t.Errorf("Error, expected no problems! %v", problems)
+	}
+	db.Close()
+	if problems := db.Check(); len(problems) != 1 || !errors.Is(problems[0], ErrDatabaseClosed) {
+		t.Errorf("Error, expected ErrDatabaseClosed! %v", problems)
+	}
+
+	// Move a key out of order, directly in the file
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pos := bytes.Index(data, byteID(listMidpoint+500))
+	if pos < 0 {
+		t.Fatal("Error, could not find the key in the file!")
+	}
+	copy(data[pos:], byteID(listMidpoint))
+	if err := os.WriteFile(filename, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	db, err = New(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if problems := db.Check(); len(problems) == 0 {
+		t.Error("Error, expected the key order to be reported!")
+	}
+}
+
+func TestRecreate(t *testing.T) {
+	db, err := New(path.Join(os.TempDir(), "bolt.db"))
+	if err != nil {
+		t.Error(err)
+	}
+	defer db.Close()
+	l, err := NewList(db, "list_recreate_test")
+	if err != nil {
+		t.Error(err)
+	}
+	other, err := OpenList(db, "list_recreate_test")
+	if err != nil {
+		t.Error(err)
+	}
+	l.Add("a")
+	if err := l.Remove(); err != nil {
+		t.Error(err)
+	}
+	if err := l.Remove(); err != nil {
+		t.Errorf("Error, expected a second Remove to do nothing! %v", err)
+	}
+	if err := other.Remove(); err != nil {
+		t.Errorf("Error, expected Remove of a removed bucket to do nothing! %v", err)
+	}
+	if err := l.Add("b"); !errors.Is(err, ErrDoesNotExist) {
+		t.Errorf("Error, expected ErrDoesNotExist after Remove, got %v", err)
+	}
+	if err := l.Recreate(); err != nil {
+		t.Error(err)
+	}
+	if err := l.Recreate(); err != nil {
+		t.Errorf("Error, expected Recreate of an existing list to do nothing! %v", err)
+	}
+	if err := l.Add("b"); err != nil {
+		t.Error(err)
+	}
+	if values, err := l.All(); err != nil || strings.Join(values, ",") != "b" {
+		t.Errorf("Error, wrong values after Recreate! %v %v", values, err)
+	}
+	l.Remove()
+
+	s, _ := NewSet(db, "set_recreate_test")
+	h, _ := NewHashMap(db, "hashmap_recreate_test")
+	kv, _ := NewKeyValue(db, "kv_recreate_test")
+	for name, structure := range map[string]interface {
+		Remove() error
+		Recreate() error
+	}{"Set": s, "HashMap": h, "KeyValue": kv} {
+		for i := 0; i < 2; i++ {
+			if err := structure.Remove(); err != nil {
+				t.Errorf("Error, could not remove %s! %v", name, err)
+			}
+		}
+		if err := structure.Recreate(); err != nil {
+			t.Errorf("Error, could not recreate %s! %v", name, err)
+		}
+	}
+	if err := s.Add("a"); err != nil {
+		t.Error(err)
+	}
+	if err := h.Set("a", "b", "c"); err != nil {
+		t.Error(err)
+	}
+	if err := kv.Set("a", "b"); err != nil {
+		t.Error(err)
+	}
+	s.Remove()
+	h.Remove()
+	kv.Remove()
+
+	if err := (&List{db: db}).Remove(); err != ErrDoesNotExist {
+		t.Errorf("Error, expected ErrDoesNotExist for a list without a name, got %v", err)
+	}
+}
+
+func TestRename(t *testing.T) {
+	db, err := New(path.Join(os.TempDir(), "bolt.db"))
+	if err != nil {
+		t.Error(err)
+	}
+	defer db.Close()
+	kv, err := NewKeyValue(db, "kv_rename_test")
+	if err != nil {
+		t.Error(err)
+	}
+	defer kv.Remove()
+	kv.Set("old", "value")
+	kv.Set("taken", "other")
+	if err := kv.Rename("old", "taken"); !errors.Is(err, ErrKeyExists) {
+		t.Errorf("Error, expected ErrKeyExists, got %v", err)
+	}
+	if err := kv.Rename("missing", "new"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Error, expected ErrKeyNotFound, got %v", err)
+	}
+	if err := kv.Rename("old", "old"); err != nil {
+		t.Error(err)
+	}
+	if err := kv.Rename("old", "new"); err != nil {
+		t.Error(err)
+	}
+	if value, err := kv.Get("new"); err != nil || value != "value" {
+		t.Errorf("Error, wrong value for the new key! %s %v", value, err)
+	}
+	if _, err := kv.Get("old"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Error, expected the old key to be removed, got %v", err)
+	}
+	if value, _ := kv.Get("taken"); value != "other" {
+		t.Errorf("Error, the other key was changed! %s", value)
+	}
+}
+
+func TestInspect(t *testing.T) {
+	filename := path.Join(os.TempDir(), "bolt_inspect.db")
+	compacted := path.Join(os.TempDir(), "bolt_inspect_compacted.db")
+	os.Remove(filename)
+	os.Remove(compacted)
+	defer os.Remove(filename)
+	defer os.Remove(compacted)
+	db, err := New(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	kv, err := NewKeyValue(db, "kv_inspect_test")
+	if err != nil {
+		t.Error(err)
+	}
+	for i := 0; i < 1000; i++ {
+		kv.Set(strconv.Itoa(i), strings.Repeat("x", 100))
+	}
+	NewSet(db, "set_inspect_test")
+	if ids, err := db.Buckets(); err != nil || strings.Join(ids, ",") != "kv_inspect_test,set_inspect_test" {
+		t.Errorf("Error, wrong buckets! %v %v", ids, err)
+	}
+	stats, err := db.Stats("kv_inspect_test")
+	if err != nil || stats.Keys != 1000 || stats.Pages < 2 || stats.Depth < 2 || stats.InUse < 100000 {
+		t.Errorf("Error, wrong stats! %+v %v", stats, err)
+	}
+	if _, err := db.Stats("missing"); !errors.Is(err, ErrBucketNotFound) {
+		t.Errorf("Error, expected ErrBucketNotFound, got %v", err)
+	}
+
+	kv.DelPrefix("")
+	if err := db.CompactTo(compacted); err != nil {
+		t.Error(err)
+	}
+	if err := db.CompactTo(compacted); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("Error, expected fs.ErrExist, got %v", err)
+	}
+	before, _ := os.Stat(filename)
+	after, _ := os.Stat(compacted)
+	if after.Size() >= before.Size() {
+		t.Errorf("Error, the compacted file is not smaller! %d >= %d", after.Size(), before.Size())
+	}
+}
+
+func TestCheckStructures(t *testing.T) {
+	filename := path.Join(os.TempDir(), "bolt_check_structures.db")
+	os.Remove(filename)
+	defer os.Remove(filename)
+	db, err := New(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	l, err := NewIndexedList(db, "list_check_structures_test")
+	if err != nil {
+		t.Error(err)
+	}
+	s, err := NewSet(db, "set_check_structures_test")
+	if err != nil {
+		t.Error(err)
+	}
+	h, err := NewHashMap(db, "hashmap_check_structures_test")
+	if err != nil {
+		t.Error(err)
+	}
+	kv, err := NewKeyValue(db, "kv_check_structures_test")
+	if err != nil {
+		t.Error(err)
+	}
+	for _, value := range []string{"a", "b", "c"} {
+		l.Add(value)
+		s.Add(value)
+		h.Set("bob", value, value)
+		kv.SetVersioned(value, value, 0)
+	}
+	if problems, err := Check(db); err != nil || len(problems) != 0 {
+		t.Errorf("Error, expected no problems! %v %v", problems, err)
+	}
+
+	// Break the invariants of the list and the set, directly in the buckets
+	err = (*bbolt.DB)(db).Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("list_check_structures_test"))
+		if err := bucket.Put(byteID(listMidpoint+100), copyBytes(bucket.Get(byteID(listMidpoint)))); err != nil {
+			return err
+		}
+		bucket = tx.Bucket([]byte("set_check_structures_test"))
+		return bucket.Put(byteID(2), copyBytes(bucket.Get(byteID(1))))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	problems, err := Check(db)
+	if err != nil {
+		t.Error(err)
+	}
+	var descriptions []string
+	for _, p := range problems {
+		descriptions = append(descriptions, p.String())
+	}
+	expected := []string{
+		"List list_check_structures_test, key 0100000000000064: the key is above the sequence of the bucket, 72057594037927938",
+		"List list_check_structures_test, key 0100000000000064: the element is missing from the index",
+		"List list_check_structures_test: the index has 3 keys, but the list has 4 elements",
+		"Set set_check_structures_test, key 0000000000000002: the member \"a\" is not unique",
+	}
+	if strings.Join(descriptions, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Error, wrong problems!\n%s", strings.Join(descriptions, "\n"))
+	}
+
+	// Removed data structures are no longer checked, but missing buckets are reported
+	if err := l.Remove(); err != nil {
+		t.Error(err)
+	}
+	if err := (*bbolt.DB)(db).Update(func(tx *bbolt.Tx) error {
+		return tx.DeleteBucket([]byte("set_check_structures_test"))
+	}); err != nil {
+		t.Fatal(err)
+	}
+	problems, err = Check(db)
+	if err != nil || len(problems) != 1 || problems[0].Bucket != "set_check_structures_test" || problems[0].Description != "the bucket is missing" {
+		t.Errorf("Error, expected a missing bucket! %v %v", problems, err)
+	}
+}
+
+// fuzzDatabase opens a database for a fuzz test, which is removed when the
+// fuzz test is done
+func fuzzDatabase(f *testing.F, name string) *Database {
+	filename := path.Join(f.TempDir(), name)
+	db, err := New(filename)
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Cleanup(func() { db.Close() })
+	return db
+}
+
+// fuzzValue returns one of a few values, so that the operations of a fuzz test
+// often concern the same elements
+func fuzzValue(b byte) string {
+	return string(rune('a' + b%5))
+}
+
+// checkAfterFuzz fails the fuzz test if Check finds any problems
+func checkAfterFuzz(t *testing.T, db *Database, ops []byte) {
+	problems, err := Check(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range problems {
+		t.Errorf("Error, %s, after the operations %v", p, ops)
+	}
+}
+
+func FuzzList(f *testing.F) {
+	db := fuzzDatabase(f, "fuzz_list.db")
+	f.Add([]byte{0, 1, 2, 3, 4, 5, 6, 7})
+	f.Add([]byte{0, 0, 0, 11, 11, 12, 0, 22, 33})
+	f.Add([]byte{2, 13, 24, 3, 14, 25, 4, 5, 6, 7})
+	f.Add([]byte{0, 8, 1, 8, 19, 9, 10, 2})
+	f.Fuzz(func(t *testing.T, ops []byte) {
+		l, err := NewIndexedList(db, "list_fuzz")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Remove()
+		var keys []uint64
+		for _, op := range ops {
+			n := int(op / 11)
+			value := fuzzValue(byte(n))
+			switch op % 11 {
+			case 0:
+				l.Add(value)
+			case 1:
+				l.Prepend(value)
+			case 2:
+				l.PrependBatch([]string{value, value, fuzzValue(byte(n + 1))})
+			case 3:
+				l.AddCapped(value, n%4+1)
+			case 4:
+				l.RemoveByIndex(n%4 - 2)
+			case 5:
+				l.RemoveByValue(value)
+			case 6:
+				l.PopN(n%3 + 1)
+			case 7:
+				l.Clear()
+			case 8:
+				l.AddTimed(value)
+			case 9:
+				if key, err := l.AddReturningKey(value); err == nil {
+					keys = append(keys, key)
+				}
+			case 10:
+				if len(keys) > 0 {
+					l.DeleteByKey(keys[n%len(keys)])
+				}
+			}
+		}
+		checkAfterFuzz(t, db, ops)
+	})
+}
+
+func FuzzSet(f *testing.F) {
+	db := fuzzDatabase(f, "fuzz_set.db")
+	f.Add([]byte{0, 1, 2, 3, 4, 5})
+	f.Add([]byte{0, 8, 16, 2, 10, 0, 8})
+	f.Fuzz(func(t *testing.T, ops []byte) {
+		s, err := NewSet(db, "set_fuzz")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Remove()
+		for _, op := range ops {
+			value := fuzzValue(op >> 3)
+			switch op % 6 {
+			case 0:
+				s.Add(value)
+			case 1:
+				s.AddIfAbsent(value)
+			case 2:
+				s.Del(value)
+			case 3:
+				s.DelBatch([]string{value, fuzzValue(op>>3 + 1)})
+			case 4:
+				s.Clear()
+			case 5:
+				s.Remove()
+				s.Recreate()
+			}
+		}
+		checkAfterFuzz(t, db, ops)
+	})
+}
+
+func FuzzHashMap(f *testing.F) {
+	db := fuzzDatabase(f, "fuzz_hashmap.db")
+	f.Add([]byte{0, 1, 2, 3})
+	f.Add([]byte{0, 8, 16, 1, 9, 2})
+	f.Fuzz(func(t *testing.T, ops []byte) {
+		h, err := NewHashMap(db, "hashmap_fuzz")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer h.Remove()
+		for _, op := range ops {
+			owner, key := fuzzValue(op>>3), fuzzValue(op>>5)
+			switch op % 4 {
+			case 0:
+				h.Set(owner, key, "value")
+			case 1:
+				h.DelKey(owner, key)
+			case 2:
+				h.Del(owner)
+			case 3:
+				h.Clear()
+			}
+		}
+		checkAfterFuzz(t, db, ops)
+	})
+}
+
+func FuzzKeyValue(f *testing.F) {
+	db := fuzzDatabase(f, "fuzz_kv.db")
+	f.Add([]byte{0, 1, 2, 3, 4, 5, 6})
+	f.Add([]byte{0, 8, 3, 11, 4, 12, 1, 9})
+	f.Fuzz(func(t *testing.T, ops []byte) {
+		kv, err := NewKeyValue(db, "kv_fuzz")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer kv.Remove()
+		for _, op := range ops {
+			key := fuzzValue(op >> 3)
+			switch op % 7 {
+			case 0:
+				kv.Set(key, "value")
+			case 1:
+				kv.Del(key)
+			case 2:
+				kv.Rename(key, fuzzValue(op>>3+1))
+			case 3:
+				kv.Inc(key)
+			case 4:
+				_, version, _ := kv.GetVersioned(key)
+				kv.SetVersioned(key, "value", version)
+			case 5:
+				kv.DelPrefix(key)
+			case 6:
+				kv.Clear()
+			}
+		}
+		checkAfterFuzz(t, db, ops)
+	})
+}
+
+func TestGetAllFunc(t *testing.T) {
+	const listname = "list_getallfunc_test"
+	db, err := New(path.Join(os.TempDir(), "bolt.db"))
+	if err != nil {
+		t.Error(err)
+	}
+	defer db.Close()
+	list, err := NewList(db, listname)
+	if err != nil {
+		t.Error(err)
+	}
+	defer list.Remove()
+	list.Clear()
+	for _, value := range []string{"apple", "banana", "avocado", "cherry", "apricot"} {
+		if err := list.Add(value); err != nil {
+			t.Error(err)
+		}
+	}
+	kept, err := list.GetAllFunc(func(value string) bool {
+		return strings.HasPrefix(value, "a")
+	})
+	if err != nil || strings.Join(kept, ",") != "apple,avocado,apricot" {
+		t.Errorf("Error, wrong elements! %v %v", kept, err)
+	}
+	if kept, err := list.GetAllFunc(func(string) bool { return false }); err != nil || len(kept) != 0 {
+		t.Errorf("Error, expected no elements! %v %v", kept, err)
+	}
+	if _, err := list.GetAllFunc(nil); !errors.Is(err, ErrNilFunc) {
+		t.Errorf("Error, expected ErrNilFunc, got %v", err)
+	}
+}
+
+func TestOptions(t *testing.T) {
+	filename := path.Join(os.TempDir(), "bolt_options.db")
+	os.Remove(filename)
+	defer os.Remove(filename)
+
+	// Invalid options are returned, and the file is not created
+	for _, opt := range []Option{WithTimeout(-time.Second), WithFileMode(os.ModeDir | 0600)} {
+		if _, err := New(filename, opt); !errors.Is(err, ErrInvalidOption) {
+			t.Errorf("Error, expected ErrInvalidOption, got %v", err)
+		}
+	}
+	if _, err := New(filename, WithCompression(42)); !errors.Is(err, ErrInvalidCompression) {
+		t.Errorf("Error, expected ErrInvalidCompression, got %v", err)
+	}
+	if _, err := os.Stat(filename); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Error, the file should not have been created! %v", err)
+	}
+
+	var buf bytes.Buffer
+	m := &recordingMetrics{}
+	db, err := New(filename,
+		WithTimeout(time.Second),
+		WithFileMode(0640),
+		WithNoSync(),
+		WithLogger(log.New(&buf, "", 0)),
+		WithMetrics(m),
+		WithCompression(Gzip),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(filename); err != nil || info.Mode().Perm() != 0640 {
+		t.Errorf("Error, wrong file mode! %v %v", info.Mode(), err)
+	}
+	if !(*bbolt.DB)(db).NoSync || db.Compression() != Gzip {
+		t.Error("Error, the options were not applied!")
+	}
+	db.Logf("hello")
+	if buf.String() != "hello\n" {
+		t.Errorf("Error, wrong log! %q", buf.String())
+	}
+
+	if _, err := NewList(db, "list_options_test", WithFillPercent(2)); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("Error, expected ErrInvalidOption, got %v", err)
+	}
+	list, err := NewList(db, "list_options_test", WithFillPercent(0.9))
+	if err != nil {
+		t.Error(err)
+	}
+	if list.fillPercent.Load() != 0.9 {
+		t.Errorf("Error, wrong fill percent! %v", list.fillPercent.Load())
+	}
+	list.Add("a")
+	if len(m.ops) == 0 {
+		t.Error("Error, no operations were observed!")
+	}
+	db.Close()
+
+	// A read-only database can be read, but not modified
+	db, err = New(filename, WithReadOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	list, err = OpenList(db, "list_options_test")
+	if err != nil {
+		t.Error(err)
+	}
+	if all, err := list.All(); err != nil || strings.Join(all, ",") != "a" {
+		t.Errorf("Error, wrong elements! %v %v", all, err)
+	}
+	if err := list.Add("b"); !errors.Is(err, bbolt.ErrDatabaseReadOnly) {
+		t.Errorf("Error, expected bbolt.ErrDatabaseReadOnly, got %v", err)
+	}
+	// A failed Remove leaves the list usable
+	if err := list.Remove(); !errors.Is(err, bbolt.ErrDatabaseReadOnly) {
+		t.Errorf("Error, expected bbolt.ErrDatabaseReadOnly, got %v", err)
+	}
+	if all, err := list.All(); err != nil || strings.Join(all, ",") != "a" {
+		t.Errorf("Error, wrong elements after a failed Remove! %v %v", all, err)
+	}
+	set, err := OpenSet(db, "list_options_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashMap, err := OpenHashMap(db, "list_options_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kv, err := OpenKeyValue(db, "list_options_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, structure := range map[string]interface {
+		Remove() error
+		Clear() error
+	}{"Set": set, "HashMap": hashMap, "KeyValue": kv} {
+		if err := structure.Remove(); !errors.Is(err, bbolt.ErrDatabaseReadOnly) {
+			t.Errorf("Error, expected bbolt.ErrDatabaseReadOnly for %s, got %v", name, err)
+		}
+		if err := structure.Clear(); errors.Is(err, ErrDoesNotExist) {
+			t.Errorf("Error, the %s was marked as removed after a failed Remove", name)
+		}
+	}
+}
+
+func TestSharedDatabase(t *testing.T) {
+	dir := t.TempDir()
+	filename := path.Join(dir, "bolt_shared.db")
+	db, err := New(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	link := path.Join(dir, "link.db")
+	if err := os.Symlink(filename, link); err != nil {
+		t.Fatal(err)
+	}
+	other, err := New(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other != db {
+		t.Error("Error, expected the same database!")
+	}
+	if _, err := New(filename, WithReadOnly()); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("Error, expected ErrInvalidOption, got %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			db, err := New(filename)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer db.Close()
+			if err := db.Ping(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// The database is closed when every caller of New has closed it
+	db.Close()
+	if err := other.Ping(); err != nil {
+		t.Errorf("Error, the database should still be open! %v", err)
+	}
+	other.Close()
+	if err := other.Ping(); !errors.Is(err, ErrDatabaseClosed) {
+		t.Errorf("Error, expected ErrDatabaseClosed, got %v", err)
+	}
+	db, err = New(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if db == other {
+		t.Error("Error, expected a new database!")
+	}
+}
+
+func TestSharedDatabaseDoubleClose(t *testing.T) {
+	filename := path.Join(t.TempDir(), "bolt_shared.db")
+	db, err := New(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := New(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Each call to New must be matched by exactly one call to Close, since a
+	// second Close removes the reference of the other caller
+	db.Close()
+	db.Close()
+	if err := other.Ping(); !errors.Is(err, ErrDatabaseClosed) {
+		t.Errorf("Error, expected the database to be closed for the other caller, got %v", err)
+	}
+	other.Close()
+}
+
+// aesCipher returns functions that encrypt and decrypt with AES-GCM, with a
+// random nonce in front of every encrypted value
+func aesCipher(t *testing.T, key []byte) (enc, dec func([]byte) ([]byte, error)) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc = func(plaintext []byte) ([]byte, error) {
+		nonce := make([]byte, gcm.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return nil, err
+		}
+		return gcm.Seal(nonce, nonce, plaintext, nil), nil
+	}
+	dec = func(ciphertext []byte) ([]byte, error) {
+		if len(ciphertext) < gcm.NonceSize() {
+			return nil, errors.New("the value is too short")
+		}
+		nonce, sealed := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+		return gcm.Open(nil, nonce, sealed, nil)
+	}
+	return enc, dec
+}
+
+// xorCipher returns a function that XORs every byte with the given byte, for
+// both encrypting and decrypting
+func xorCipher(b byte) func([]byte) ([]byte, error) {
+	return func(value []byte) ([]byte, error) {
+		result := make([]byte, len(value))
+		for i := range value {
+			result[i] = value[i] ^ b
+		}
+		return result, nil
+	}
+}
+
+func TestValueCipher(t *testing.T) {
+	filename := path.Join(os.TempDir(), "bolt_cipher.db")
+	os.Remove(filename)
+	defer os.Remove(filename)
+	enc, dec := aesCipher(t, bytes.Repeat([]byte{42}, 32))
+	if _, err := New(filename, WithValueCipher(enc, nil)); !errors.Is(err, ErrInvalidCipher) {
+		t.Errorf("Error, expected ErrInvalidCipher, got %v", err)
+	}
+	db, err := New(filename, WithValueCipher(enc, dec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.SetValueCipher(nil, dec); !errors.Is(err, ErrInvalidCipher) {
+		t.Errorf("Error, expected ErrInvalidCipher, got %v", err)
+	}
+	list, err := NewIndexedList(db, "list_cipher_test")
+	if err != nil {
+		t.Error(err)
+	}
+	kv, err := NewKeyValue(db, "kv_cipher_test")
+	if err != nil {
+		t.Error(err)
+	}
+	h, err := NewHashMap(db, "hashmap_cipher_test")
+	if err != nil {
+		t.Error(err)
+	}
+	set, err := NewSet(db, "set_cipher_test")
+	if err != nil {
+		t.Error(err)
+	}
+	other, err := NewSet(db, "other_set_cipher_test")
+	if err != nil {
+		t.Error(err)
+	}
+	list.Add("first secret")
+	db.SetCompression(Gzip)
+	list.Add("second secret")
+	h.Set("bob", "password", "hunter2")
+	db.SetCompression(NoCompression)
+	kv.Set("password", "hunter2")
+	kv.Inc("counter")
+	h.Set("alice", "password", "secret sauce")
+	set.Add("secret member")
+	set.AddIfAbsent("secret agent")
+	other.Add("secret moved")
+	other.Add("secret united")
+	MoveBetweenSets(other, set, "secret moved")
+	set.UnionWith(other)
+	db.Do(func(txdb *TxDatabase) error {
+		txSet, err := txdb.Set("set_cipher_test")
+		if err != nil {
+			return err
+		}
+		return txSet.Add("secret in a transaction")
+	})
+
+	// Nothing is stored in plain text, but everything can be read
+	err = (*bbolt.DB)(db).View(func(tx *bbolt.Tx) error {
+		for _, id := range []string{"list_cipher_test", "kv_cipher_test", "hashmap_cipher_test", "set_cipher_test", "other_set_cipher_test"} {
+			tx.Bucket([]byte(id)).ForEach(func(key, value []byte) error {
+				if bytes.Contains(value, []byte("secret")) || bytes.Contains(value, []byte("hunter2")) || string(value) == "1" {
+					t.Errorf("Error, the value of %q is not encrypted! %q", key, value)
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		t.Error(err)
+	}
+	if all, err := list.All(); err != nil || strings.Join(all, ",") != "first secret,second secret" {
+		t.Errorf("Error, wrong elements! %v %v", all, err)
+	}
+	if found, err := list.Contains("second secret"); err != nil || !found {
+		t.Errorf("Error, the element was not found! %v", err)
+	}
+	if value, err := kv.Get("password"); err != nil || value != "hunter2" {
+		t.Errorf("Error, wrong value! %q %v", value, err)
+	}
+	if value, err := kv.Inc("counter"); err != nil || value != "2" {
+		t.Errorf("Error, wrong count! %q %v", value, err)
+	}
+	if value, err := h.Get("bob", "password"); err != nil || value != "hunter2" {
+		t.Errorf("Error, wrong value! %q %v", value, err)
+	}
+	if maps, err := h.GetAllMaps(); err != nil || maps["alice"]["password"] != "secret sauce" || maps["bob"]["password"] != "hunter2" {
+		t.Errorf("Error, wrong maps! %v %v", maps, err)
+	}
+	if all, err := set.All(); err != nil || strings.Join(all, ",") != "secret member,secret agent,secret moved,secret united,secret in a transaction" {
+		t.Errorf("Error, wrong members! %v %v", all, err)
+	}
+	if found, err := set.Has("secret agent"); err != nil || !found {
+		t.Errorf("Error, the member was not found! %v", err)
+	}
+	if added, err := set.AddIfAbsent("secret member"); err != nil || added {
+		t.Errorf("Error, the member was added twice! %v", err)
+	}
+	if err := set.Add("secret member"); !errors.Is(err, ErrExistsInSet) {
+		t.Errorf("Error, expected ErrExistsInSet, got %v", err)
+	}
+	if err := set.Del("secret agent"); err != nil {
+		t.Error(err)
+	}
+	if found, err := set.Has("secret agent"); err != nil || found {
+		t.Errorf("Error, the member was not removed! %v", err)
+	}
+	if all, err := other.All(); err != nil || strings.Join(all, ",") != "secret united" {
+		t.Errorf("Error, wrong members! %v %v", all, err)
+	}
+	if problems, err := Check(db); err != nil || len(problems) != 0 {
+		t.Errorf("Error, expected no problems! %v %v", problems, err)
+	}
+
+	// Another cipher can not read the values
+	xor := xorCipher(0x5a)
+	if err := db.SetValueCipher(xor, xor); err != nil {
+		t.Error(err)
+	}
+	if value, err := kv.Get("password"); err == nil && value == "hunter2" {
+		t.Error("Error, the value could be read with another cipher!")
+	}
+	if value, err := h.Get("alice", "password"); err == nil && value == "secret sauce" {
+		t.Error("Error, the value could be read with another cipher!")
+	}
+	if found, err := set.Has("secret member"); err == nil && found {
+		t.Error("Error, the member could be found with another cipher!")
+	}
+	kv.Set("xor", "round trip")
+	if value, err := kv.Get("xor"); err != nil || value != "round trip" {
+		t.Errorf("Error, wrong value! %q %v", value, err)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	type user struct {
+		Name string `json:"name"`
+		Age  int    `json:"age"`
+	}
+	db, err := New(path.Join(os.TempDir(), "bolt.db"))
+	if err != nil {
+		t.Error(err)
+	}
+	defer db.Close()
+	// The JSON helpers do not depend on the codec of the database
+	db.SetCodec(GobCodec{})
+	defer db.SetCodec(nil)
+	kv, err := NewKeyValue(db, "kv_json_test")
+	if err != nil {
+		t.Error(err)
+	}
+	defer kv.Remove()
+	if err := kv.SetJSON("alice", user{"Alice", 30}); err != nil {
+		t.Error(err)
+	}
+	if value, err := kv.Get("alice"); err != nil || value != `{"name":"Alice","age":30}` {
+		t.Errorf("Error, wrong JSON! %s %v", value, err)
+	}
+	var u user
+	if err := kv.GetJSON("alice", &u); err != nil || u != (user{"Alice", 30}) {
+		t.Errorf("Error, wrong user! %v %v", u, err)
+	}
+	kv.Set("broken", "{")
+	var opErr *OpError
+	if err := kv.GetJSON("broken", &u); !errors.As(err, &opErr) || opErr.Key != "broken" {
+		t.Errorf("Error, expected an error naming the key, got %v", err)
+	}
+	if err := kv.SetJSON("channel", make(chan int)); !errors.As(err, &opErr) || opErr.Key != "channel" {
+		t.Errorf("Error, expected an error naming the key, got %v", err)
+	}
+	if err := kv.GetJSON("missing", &u); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Error, expected ErrKeyNotFound, got %v", err)
+	}
+
+	h, err := NewHashMap(db, "hashmap_json_test")
+	if err != nil {
+		t.Error(err)
+	}
+	defer h.Remove()
+	if err := h.SetJSONField("bob", "profile", user{"Bob", 40}); err != nil {
+		t.Error(err)
+	}
+	if value, err := h.Get("bob", "profile"); err != nil || value != `{"name":"Bob","age":40}` {
+		t.Errorf("Error, wrong JSON! %s %v", value, err)
+	}
+	if err := h.GetJSONField("bob", "profile", &u); err != nil || u != (user{"Bob", 40}) {
+		t.Errorf("Error, wrong user! %v %v", u, err)
+	}
+	h.Set("bob", "broken", "[")
+	if err := h.GetJSONField("bob", "broken", &u); !errors.As(err, &opErr) || opErr.Key != "bob:broken" {
+		t.Errorf("Error, expected an error naming the key, got %v", err)
+	}
+}
+
+func TestListKeys(t *testing.T) {
+	db, err := New(path.Join(os.TempDir(), "bolt.db"))
+	if err != nil {
+		t.Error(err)
+	}
+	defer db.Close()
+	list, err := NewIndexedList(db, "list_keys_test")
+	if err != nil {
+		t.Error(err)
+	}
+	defer list.Remove()
+	list.Clear()
+	var keys []uint64
+	for _, value := range []string{"a", "b", "c"} {
+		key, err := list.AddReturningKey(value)
+		if err != nil {
+			t.Error(err)
+		}
+		keys = append(keys, key)
+	}
+	if keys[0] >= keys[1] || keys[1] >= keys[2] {
+		t.Errorf("Error, the keys are not increasing! %v", keys)
+	}
+	// The keys stay valid when other elements are removed
+	if err := list.RemoveByIndex(0); err != nil {
+		t.Error(err)
+	}
+	if value, err := list.GetByKey(keys[1]); err != nil || value != "b" {
+		t.Errorf("Error, wrong element! %q %v", value, err)
+	}
+	if err := list.DeleteByKey(keys[1]); err != nil {
+		t.Error(err)
+	}
+	if all, err := list.All(); err != nil || strings.Join(all, ",") != "c" {
+		t.Errorf("Error, wrong elements! %v %v", all, err)
+	}
+	if found, err := list.Contains("b"); err != nil || found {
+		t.Errorf("Error, the deleted element is still indexed! %v", err)
+	}
+	if _, err := list.GetByKey(keys[1]); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Error, expected ErrKeyNotFound, got %v", err)
+	}
+	if err := list.DeleteByKey(keys[1]); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Error, expected ErrKeyNotFound, got %v", err)
+	}
+	if problems, err := Check(db); err != nil || len(problems) != 0 {
+		t.Errorf("Error, expected no problems! %v %v", problems, err)
+	}
+}
+
+func TestCheckTimedList(t *testing.T) {
+	filename := path.Join(os.TempDir(), "bolt_check_timed.db")
+	os.Remove(filename)
+	defer os.Remove(filename)
+	db, err := New(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	l, err := NewList(db, "log")
+	if err != nil {
+		t.Error(err)
+	}
+	l.Add("a")
+	if _, err := l.AddTimed("b"); err != nil {
+		t.Error(err)
+	}
+	l.Prepend("c")
+	if problems, err := Check(db); err != nil || len(problems) != 0 {
+		t.Errorf("Error, expected no problems! %v %v", problems, err)
+	}
+}
+
+func TestReservedID(t *testing.T) {
+	filename := path.Join(os.TempDir(), "bolt_reserved.db")
+	os.Remove(filename)
+	defer os.Remove(filename)
+	db, err := New(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, id := range []string{"users" + indexSuffix, "cfg" + versionsSuffix, "__types"} {
+		if _, err := NewKeyValue(db, id); !errors.Is(err, ErrReservedID) {
+			t.Errorf("Error, expected ErrReservedID for %s, got %v", id, err)
+		}
+		if _, err := OpenList(db, id); !errors.Is(err, ErrReservedID) {
+			t.Errorf("Error, expected ErrReservedID for %s, got %v", id, err)
+		}
+		if err := db.Do(func(txdb *TxDatabase) error {
+			_, err := txdb.Set(id)
+			return err
+		}); !errors.Is(err, ErrReservedID) {
+			t.Errorf("Error, expected ErrReservedID for %s, got %v", id, err)
+		}
+	}
+
+	// A bucket with the name of an index, that was not created as one, is not
+	// used as the index of the list
+	if err := (*bbolt.DB)(db).Update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucket([]byte("users" + indexSuffix))
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte("theme"), []byte("dark"))
+	}); err != nil {
+		t.Fatal(err)
+	}
+	l, err := NewList(db, "users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Add("bob"); err != nil {
+		t.Error(err)
+	}
+	if found, err := l.Contains("bob"); err != nil || !found {
+		t.Errorf("Error, expected to find bob! %v", err)
+	}
+	if err := l.Clear(); err != nil {
+		t.Error(err)
+	}
+	if _, err := NewIndexedList(db, "users"); err == nil {
+		t.Error("Error, expected the list not to be indexed into the existing bucket")
+	}
+	if err := l.Remove(); err != nil {
+		t.Error(err)
+	}
+	if err := (*bbolt.DB)(db).View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("users" + indexSuffix))
+		if bucket == nil {
+			t.Fatal("Error, the bucket was removed together with the list")
+		}
+		if n := bucket.Stats().KeyN; n != 1 || string(bucket.Get([]byte("theme"))) != "dark" {
+			t.Errorf("Error, the bucket was changed! %d keys", n)
+		}
+		return nil
+	}); err != nil {
+		t.Error(err)
+	}
+
+	// The same goes for the versions of a key/value store
+	if err := (*bbolt.DB)(db).Update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucket([]byte("cfg" + versionsSuffix))
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte("theme"), []byte{0, 0, 0, 0, 0, 0, 0, 7})
+	}); err != nil {
+		t.Fatal(err)
+	}
+	kv, err := NewKeyValue(db, "cfg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := kv.Set("theme", "dark"); err != nil {
+		t.Error(err)
+	}
+	if _, version, err := kv.GetVersioned("theme"); err != nil || version != 0 {
+		t.Errorf("Error, expected version 0! %d %v", version, err)
+	}
+	if _, err := kv.SetVersioned("theme", "light", 0); err == nil {
+		t.Error("Error, expected the versions not to be stored in the existing bucket")
+	}
+	if problems, err := Check(db); err != nil || len(problems) != 0 {
+		t.Errorf("Error, expected no problems! %v %v", problems, err)
+	}
+	if err := kv.Remove(); err != nil {
+		t.Error(err)
+	}
+	if err := (*bbolt.DB)(db).View(func(tx *bbolt.Tx) error {
+		if tx.Bucket([]byte("cfg"+versionsSuffix)) == nil {
+			t.Error("Error, the bucket was removed together with the key/value store")
+		}
+		return nil
+	}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWrongType(t *testing.T) {
+	filename := path.Join(os.TempDir(), "bolt_wrong_type.db")
+	os.Remove(filename)
+	defer os.Remove(filename)
+	db, err := New(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	l, err := NewList(db, "users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Add("bob")
+	if _, err := NewKeyValue(db, "users"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Error, expected ErrWrongType, got %v", err)
+	}
+	if err := db.Do(func(txdb *TxDatabase) error {
+		_, err := txdb.Set("users")
+		return err
+	}); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Error, expected ErrWrongType, got %v", err)
+	}
+	if structure, err := db.BucketType("users"); err != nil || structure != "List" {
+		t.Errorf("Error, wrong type! %s %v", structure, err)
+	}
+	if _, err := db.BucketType("missing"); !errors.Is(err, ErrBucketNotFound) {
+		t.Errorf("Error, expected ErrBucketNotFound, got %v", err)
+	}
+	// The bucket can hold another data structure after it has been removed
+	if err := l.Remove(); err != nil {
+		t.Error(err)
+	}
+	kv, err := NewKeyValue(db, "users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer kv.Remove()
+	if structure, err := db.BucketType("users"); err != nil || structure != "KeyValue" {
+		t.Errorf("Error, wrong type! %s %v", structure, err)
+	}
+}
@@ -0,0 +1,306 @@
+package simplebolt
+
+// transaction.go provides access to several data structures within a single
+// Bolt transaction, so that they can be modified atomically.
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.etcd.io/bbolt"
+)
+
+type (
+	// TxDatabase gives access to the data structures of a database, within the
+	// single transaction of a call to Database.Do. It must not be used after
+	// the function given to Do has returned.
+	TxDatabase struct {
+		db *Database
+		tx *bbolt.Tx
+	}
+
+	// Used for each of the datatypes within a transaction
+	txBucket struct {
+		db     *Database     // the Bolt database, for the settings
+		bucket *bbolt.Bucket // the bucket, within the transaction
+		name   []byte        // the bucket name
+	}
+
+	// TxList is a List within a transaction
+	TxList txBucket
+
+	// TxSet is a Set within a transaction
+	TxSet txBucket
+
+	// TxHashMap is a HashMap within a transaction
+	TxHashMap txBucket
+
+	// TxKeyValue is a KeyValue within a transaction
+	TxKeyValue txBucket
+)
+
+// Do calls fn within a single read-write transaction. The data structures that
+// are retrieved from the given TxDatabase are all modified within the same
+// transaction, so that for instance an element can be moved from one list to
+// another atomically. If fn returns an error, none of the changes are stored,
+// and the error is returned. Returns ErrDatabaseClosed if the database has
+// been closed.
+func (db *Database) Do(fn func(txdb *TxDatabase) error) error {
+	return closedError(db.update("Database", "Do", func(tx *bbolt.Tx) error {
+		return fn(&TxDatabase{db, tx})
+	}))
+}
+
+// bucket loads or creates the bucket with the given ID, for the given data structure
+func (txdb *TxDatabase) bucket(structure, id string) (txBucket, error) {
+	name := []byte(id)
+	if err := ValidateID(id); err != nil {
+		return txBucket{}, wrapError("TxDatabase."+structure, name, "", err)
+	}
+	var (
+		bucket *bbolt.Bucket
+		err    error
+	)
+	if structure == "List" {
+		bucket, err = createList(txdb.tx, name)
+	} else if bucket, err = txdb.tx.CreateBucketIfNotExists(name); err != nil {
+		err = fmt.Errorf("Could not create bucket: %w", err)
+	}
+	if err != nil {
+		return txBucket{}, wrapError("TxDatabase."+structure, name, "", err)
+	}
+	if err := registerType(txdb.tx, name, structure); err != nil {
+		return txBucket{}, wrapError("TxDatabase."+structure, name, "", err)
+	}
+	return txBucket{txdb.db, bucket, name}, nil
+}
+
+// List loads or creates the List with the given ID, within the transaction
+func (txdb *TxDatabase) List(id string) (*TxList, error) {
+	b, err := txdb.bucket("List", id)
+	if err != nil {
+		return nil, err
+	}
+	return (*TxList)(&b), nil
+}
+
+// Set loads or creates the Set with the given ID, within the transaction
+func (txdb *TxDatabase) Set(id string) (*TxSet, error) {
+	b, err := txdb.bucket("Set", id)
+	if err != nil {
+		return nil, err
+	}
+	return (*TxSet)(&b), nil
+}
+
+// HashMap loads or creates the HashMap with the given ID, within the transaction
+func (txdb *TxDatabase) HashMap(id string) (*TxHashMap, error) {
+	b, err := txdb.bucket("HashMap", id)
+	if err != nil {
+		return nil, err
+	}
+	return (*TxHashMap)(&b), nil
+}
+
+// KeyValue loads or creates the KeyValue with the given ID, within the transaction
+func (txdb *TxDatabase) KeyValue(id string) (*TxKeyValue, error) {
+	b, err := txdb.bucket("KeyValue", id)
+	if err != nil {
+		return nil, err
+	}
+	return (*TxKeyValue)(&b), nil
+}
+
+/* --- TxList functions --- */
+
+// Add an element to the list
+func (l *TxList) Add(value string) error {
+	n, err := l.bucket.NextSequence()
+	if err != nil {
+		return wrapError("TxList.Add", l.name, "", err)
+	}
+	encoded, err := l.db.encodeValue([]byte(value))
+	if err != nil {
+		return wrapError("TxList.Add", l.name, "", err)
+	}
+	if err := l.bucket.Put(byteID(n), encoded); err != nil {
+		return wrapError("TxList.Add", l.name, "", err)
+	}
+	if index := listIndex(l.bucket.Tx(), l.name); index != nil {
+		return wrapError("TxList.Add", l.name, "", indexAdd(index, []byte(value), byteID(n)))
+	}
+	return nil
+}
+
+// All returns all elements in the list
+func (l *TxList) All() ([]string, error) {
+	var results []string
+	err := l.bucket.ForEach(func(_, value []byte) error {
+		decoded, err := l.db.decodeValue(value)
+		if err != nil {
+			return err
+		}
+		results = append(results, string(decoded))
+		return nil // Continue ForEach
+	})
+	return results, wrapError("TxList.All", l.name, "", err)
+}
+
+// Last will return the last element of the list
+func (l *TxList) Last() (string, error) {
+	_, value := l.bucket.Cursor().Last()
+	decoded, err := l.db.decodeValue(value)
+	if err != nil {
+		return "", wrapError("TxList.Last", l.name, "", err)
+	}
+	return string(decoded), nil
+}
+
+// Pop will remove the last element of the list and return it.
+// Returns ErrDoesNotExist if the list is empty.
+func (l *TxList) Pop() (string, error) {
+	c := l.bucket.Cursor()
+	key, value := c.Last()
+	if key == nil {
+		return "", wrapError("TxList.Pop", l.name, "", ErrDoesNotExist)
+	}
+	decoded, err := l.db.decodeValue(value)
+	if err != nil {
+		return "", wrapError("TxList.Pop", l.name, "", err)
+	}
+	// Convert the value before deleting, since it is only valid until then
+	result := string(decoded)
+	if index := listIndex(l.bucket.Tx(), l.name); index != nil {
+		if err := indexRemove(index, decoded, key); err != nil {
+			return "", wrapError("TxList.Pop", l.name, "", err)
+		}
+	}
+	if err := c.Delete(); err != nil {
+		return "", wrapError("TxList.Pop", l.name, "", err)
+	}
+	return result, nil
+}
+
+/* --- TxSet functions --- */
+
+// Add an element to the set. Returns ErrExistsInSet if it is already there.
+func (s *TxSet) Add(value string) error {
+	exists, err := s.Has(value)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return wrapError("TxSet.Add", s.name, value, ErrExistsInSet)
+	}
+	return wrapError("TxSet.Add", s.name, value, s.db.putMember(s.bucket, value))
+}
+
+// Has will check if a given value is in the set
+func (s *TxSet) Has(value string) (bool, error) {
+	key, err := s.find(value)
+	return key != nil, wrapError("TxSet.Has", s.name, value, err)
+}
+
+// All returns all elements in the set
+func (s *TxSet) All() ([]string, error) {
+	var values []string
+	err := s.db.forEachMember(s.bucket, func(_ []byte, value string) error {
+		values = append(values, value)
+		return nil // Continue ForEach
+	})
+	return values, wrapError("TxSet.All", s.name, "", err)
+}
+
+// Del will remove an element from the set
+func (s *TxSet) Del(value string) error {
+	key, err := s.find(value)
+	if err != nil || key == nil {
+		return wrapError("TxSet.Del", s.name, value, err)
+	}
+	return wrapError("TxSet.Del", s.name, value, s.bucket.Delete(key))
+}
+
+// find returns a copy of the key of the given value, or nil if it is not in the set
+func (s *TxSet) find(value string) ([]byte, error) {
+	return s.db.setKey(s.bucket, value)
+}
+
+/* --- TxHashMap functions --- */
+
+// Set a value in the hash map given the element id and the key. See HashMap.Set.
+func (h *TxHashMap) Set(elementid, key, value string) error {
+	if strings.Contains(elementid, ":") {
+		return wrapError("TxHashMap.Set", h.name, elementid, ErrInvalidID)
+	}
+	encoded, err := h.db.encodeValue([]byte(value))
+	if err != nil {
+		return wrapError("TxHashMap.Set", h.name, elementid+":"+key, err)
+	}
+	return wrapError("TxHashMap.Set", h.name, elementid+":"+key, h.bucket.Put([]byte(elementid+":"+key), encoded))
+}
+
+// Get a value from the hash map given the element id and the key.
+// Returns an error if the key was not found.
+func (h *TxHashMap) Get(elementid, key string) (string, error) {
+	byteval := h.bucket.Get([]byte(elementid + ":" + key))
+	if byteval == nil {
+		return "", wrapError("TxHashMap.Get", h.name, elementid+":"+key, ErrKeyNotFound)
+	}
+	decoded, err := h.db.decodeValue(byteval)
+	if err != nil {
+		return "", wrapError("TxHashMap.Get", h.name, elementid+":"+key, err)
+	}
+	return string(decoded), nil
+}
+
+/* --- TxKeyValue functions --- */
+
+// Set a key and value
+func (kv *TxKeyValue) Set(key, value string) error {
+	encoded, err := kv.db.encodeValue([]byte(value))
+	if err != nil {
+		return wrapError("TxKeyValue.Set", kv.name, key, err)
+	}
+	return wrapError("TxKeyValue.Set", kv.name, key, kv.bucket.Put([]byte(key), encoded))
+}
+
+// Get a value given a key
+// Returns an error if the key was not found
+func (kv *TxKeyValue) Get(key string) (string, error) {
+	byteval := kv.bucket.Get([]byte(key))
+	if byteval == nil {
+		return "", wrapError("TxKeyValue.Get", kv.name, key, ErrKeyNotFound)
+	}
+	decoded, err := kv.db.decodeValue(byteval)
+	if err != nil {
+		return "", wrapError("TxKeyValue.Get", kv.name, key, err)
+	}
+	return string(decoded), nil
+}
+
+// Del will remove a key
+func (kv *TxKeyValue) Del(key string) error {
+	return wrapError("TxKeyValue.Del", kv.name, key, kv.bucket.Delete([]byte(key)))
+}
+
+// Inc will increase the value of a key, returns the new value.
+// Returns "1" if the key does not already exist. See KeyValue.Inc.
+func (kv *TxKeyValue) Inc(key string) (string, error) {
+	decoded, err := kv.db.decodeValue(kv.bucket.Get([]byte(key)))
+	if err != nil {
+		return "", wrapError("TxKeyValue.Inc", kv.name, key, err)
+	}
+	// The numeric value, which is 0 if there is no previous numeric value
+	num, _ := strconv.Atoi(string(decoded))
+	num++
+	val := strconv.Itoa(num)
+	encrypted, err := kv.db.EncryptValue([]byte(val))
+	if err != nil {
+		return "", wrapError("TxKeyValue.Inc", kv.name, key, err)
+	}
+	if err := kv.bucket.Put([]byte(key), encrypted); err != nil {
+		return "", wrapError("TxKeyValue.Inc", kv.name, key, err)
+	}
+	return val, nil
+}
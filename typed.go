@@ -0,0 +1,207 @@
+package simplebolt
+
+// typed.go provides wrappers around List, Set, KeyValue and HashMap for values
+// of a given type, which are encoded and decoded by a codec.Codec.
+
+import (
+	"strconv"
+
+	"github.com/xyproto/simplebolt/codec"
+)
+
+// TypedList is a List of values of type T, encoded by the given codec
+type TypedList[T any] struct {
+	list  *List
+	codec codec.Codec[T]
+}
+
+// NewTypedList returns a list of values of type T, stored in the given list
+func NewTypedList[T any](l *List, c codec.Codec[T]) *TypedList[T] {
+	return &TypedList[T]{list: l, codec: c}
+}
+
+// List returns the underlying list
+func (t *TypedList[T]) List() *List {
+	return t.list
+}
+
+// Add a value to the list
+func (t *TypedList[T]) Add(value T) error {
+	data, err := t.codec.Marshal(value)
+	if err != nil {
+		return wrapError("TypedList.Add", t.list.name, "", err)
+	}
+	return t.list.Add(string(data))
+}
+
+// All returns all values in the list. If a value can not be decoded, the
+// returned *OpError has the index of the value as the key.
+func (t *TypedList[T]) All() ([]T, error) {
+	all, err := t.list.All()
+	if err != nil {
+		return nil, err
+	}
+	values := make([]T, len(all))
+	for i, data := range all {
+		if values[i], err = t.codec.Unmarshal([]byte(data)); err != nil {
+			return nil, wrapError("TypedList.All", t.list.name, "index "+strconv.Itoa(i), err)
+		}
+	}
+	return values, nil
+}
+
+// Last returns the last value of the list
+func (t *TypedList[T]) Last() (T, error) {
+	var value T
+	data, err := t.list.Last()
+	if err != nil {
+		return value, err
+	}
+	value, err = t.codec.Unmarshal([]byte(data))
+	return value, wrapError("TypedList.Last", t.list.name, "", err)
+}
+
+// TypedSet is a Set of values of type T, encoded by the given codec. Values are
+// compared by their encoding, so the codec must always encode equal values the
+// same way.
+type TypedSet[T any] struct {
+	set   *Set
+	codec codec.Codec[T]
+}
+
+// NewTypedSet returns a set of values of type T, stored in the given set
+func NewTypedSet[T any](s *Set, c codec.Codec[T]) *TypedSet[T] {
+	return &TypedSet[T]{set: s, codec: c}
+}
+
+// Set returns the underlying set
+func (t *TypedSet[T]) Set() *Set {
+	return t.set
+}
+
+// Add a value to the set. Returns ErrExistsInSet if it is already there.
+func (t *TypedSet[T]) Add(value T) error {
+	data, err := t.codec.Marshal(value)
+	if err != nil {
+		return wrapError("TypedSet.Add", t.set.name, "", err)
+	}
+	return t.set.Add(string(data))
+}
+
+// Has checks if the given value is in the set
+func (t *TypedSet[T]) Has(value T) (bool, error) {
+	data, err := t.codec.Marshal(value)
+	if err != nil {
+		return false, wrapError("TypedSet.Has", t.set.name, "", err)
+	}
+	return t.set.Has(string(data))
+}
+
+// Del removes a value from the set
+func (t *TypedSet[T]) Del(value T) error {
+	data, err := t.codec.Marshal(value)
+	if err != nil {
+		return wrapError("TypedSet.Del", t.set.name, "", err)
+	}
+	return t.set.Del(string(data))
+}
+
+// All returns all values in the set. If a value can not be decoded, the
+// returned *OpError has the index of the value as the key.
+func (t *TypedSet[T]) All() ([]T, error) {
+	all, err := t.set.All()
+	if err != nil {
+		return nil, err
+	}
+	values := make([]T, len(all))
+	for i, data := range all {
+		if values[i], err = t.codec.Unmarshal([]byte(data)); err != nil {
+			return nil, wrapError("TypedSet.All", t.set.name, "index "+strconv.Itoa(i), err)
+		}
+	}
+	return values, nil
+}
+
+// TypedKeyValue is a KeyValue with values of type T, encoded by the given codec
+type TypedKeyValue[T any] struct {
+	kv    *KeyValue
+	codec codec.Codec[T]
+}
+
+// NewTypedKeyValue returns a key/value store with values of type T, stored in
+// the given KeyValue
+func NewTypedKeyValue[T any](kv *KeyValue, c codec.Codec[T]) *TypedKeyValue[T] {
+	return &TypedKeyValue[T]{kv: kv, codec: c}
+}
+
+// KeyValue returns the underlying KeyValue
+func (t *TypedKeyValue[T]) KeyValue() *KeyValue {
+	return t.kv
+}
+
+// Set a key and value
+func (t *TypedKeyValue[T]) Set(key string, value T) error {
+	data, err := t.codec.Marshal(value)
+	if err != nil {
+		return wrapError("TypedKeyValue.Set", t.kv.name, key, err)
+	}
+	return t.kv.Set(key, string(data))
+}
+
+// Get the value of the given key
+func (t *TypedKeyValue[T]) Get(key string) (T, error) {
+	var value T
+	data, err := t.kv.Get(key)
+	if err != nil {
+		return value, err
+	}
+	value, err = t.codec.Unmarshal([]byte(data))
+	return value, wrapError("TypedKeyValue.Get", t.kv.name, key, err)
+}
+
+// Del removes the given key
+func (t *TypedKeyValue[T]) Del(key string) error {
+	return t.kv.Del(key)
+}
+
+// TypedHashMap is a HashMap with values of type T, encoded by the given codec
+type TypedHashMap[T any] struct {
+	h     *HashMap
+	codec codec.Codec[T]
+}
+
+// NewTypedHashMap returns a hash map with values of type T, stored in the
+// given HashMap
+func NewTypedHashMap[T any](h *HashMap, c codec.Codec[T]) *TypedHashMap[T] {
+	return &TypedHashMap[T]{h: h, codec: c}
+}
+
+// HashMap returns the underlying HashMap
+func (t *TypedHashMap[T]) HashMap() *HashMap {
+	return t.h
+}
+
+// Set a value given the element id and the key
+func (t *TypedHashMap[T]) Set(elementid, key string, value T) error {
+	data, err := t.codec.Marshal(value)
+	if err != nil {
+		return wrapError("TypedHashMap.Set", t.h.name, elementid+":"+key, err)
+	}
+	return t.h.Set(elementid, key, string(data))
+}
+
+// Get a value given the element id and the key
+func (t *TypedHashMap[T]) Get(elementid, key string) (T, error) {
+	var value T
+	data, err := t.h.Get(elementid, key)
+	if err != nil {
+		return value, err
+	}
+	value, err = t.codec.Unmarshal([]byte(data))
+	return value, wrapError("TypedHashMap.Get", t.h.name, elementid+":"+key, err)
+}
+
+// DelKey removes a key of the given element
+func (t *TypedHashMap[T]) DelKey(elementid, key string) error {
+	return t.h.DelKey(elementid, key)
+}
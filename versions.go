@@ -0,0 +1,131 @@
+package simplebolt
+
+// versions.go provides optimistic concurrency for key/value stores, by keeping
+// a version for each key that is written with SetVersioned.
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"go.etcd.io/bbolt"
+)
+
+// versionsSuffix is appended to the name of a key/value store, for the name of
+// the bucket that holds the versions of its keys
+const versionsSuffix = "__versions"
+
+// versionsStructure is recorded as the data structure of the versions buckets,
+// so that a bucket is only used for versions if it has been created for them
+const versionsStructure = "KeyValueVersions"
+
+// ErrVersionConflict is returned by KeyValue.SetVersioned if the version of the
+// key is not the expected one
+var ErrVersionConflict = errors.New("Version conflict")
+
+// SetVersioned sets a key and value, if the current version of the key is
+// equal to expectedVersion, and returns the new version of the key. The version
+// of a key that has never been set with SetVersioned is 0, and it is increased by
+// one every time the key is set with SetVersioned. Returns ErrVersionConflict,
+// and leaves the value as it is, if the version is not the expected one. The
+// check and the write are done within the same transaction.
+//
+// The versions are stored in a sibling bucket, named by the ID followed by
+// "__versions". Set, SetBytes, Del and Clear do not change the versions, so
+// that a version is never reused for a key, and should not be used for keys
+// that are written with SetVersioned. Returns an error if there already is a
+// bucket with the name of the versions bucket, that was not created by
+// SetVersioned.
+func (kv *KeyValue) SetVersioned(key, value string, expectedVersion uint64) (uint64, error) {
+	var newVersion uint64
+	if !kv.exists() {
+		return 0, ErrDoesNotExist
+	}
+	err := kv.db.update("KeyValue", "SetVersioned", func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(kv.name)
+		if bucket == nil {
+			return ErrBucketNotFound
+		}
+		versions := keyValueVersions(tx, kv.name)
+		if versions == nil {
+			var err error
+			if versions, err = tx.CreateBucket(versionsName(kv.name)); err != nil {
+				return fmt.Errorf("Could not create bucket: %w", err)
+			}
+			if err := registerType(tx, versionsName(kv.name), versionsStructure); err != nil {
+				return err
+			}
+		}
+		if keyVersion(versions, []byte(key)) != expectedVersion {
+			return ErrVersionConflict
+		}
+		encoded, err := kv.db.encodeValue([]byte(value))
+		if err != nil {
+			return err
+		}
+		if err := bucket.Put([]byte(key), encoded); err != nil {
+			return err
+		}
+		newVersion = expectedVersion + 1
+		buf := make([]byte, 8)
+		binary.BigEndian.PutUint64(buf, newVersion)
+		return versions.Put([]byte(key), buf)
+	})
+	if err != nil {
+		return 0, wrapError("KeyValue.SetVersioned", kv.name, key, err)
+	}
+	return newVersion, nil
+}
+
+// GetVersioned returns the value and the current version of a key, which can
+// then be given to SetVersioned. Returns an error if the key was not found.
+func (kv *KeyValue) GetVersioned(key string) (string, uint64, error) {
+	var (
+		val     string
+		version uint64
+	)
+	if !kv.exists() {
+		return "", 0, ErrDoesNotExist
+	}
+	err := kv.db.view("KeyValue", "GetVersioned", func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(kv.name)
+		if bucket == nil {
+			return ErrBucketNotFound
+		}
+		byteval := bucket.Get([]byte(key))
+		if byteval == nil {
+			return ErrKeyNotFound
+		}
+		decoded, err := kv.db.decodeValue(byteval)
+		if err != nil {
+			return err
+		}
+		val = string(decoded)
+		if versions := keyValueVersions(tx, kv.name); versions != nil {
+			version = keyVersion(versions, []byte(key))
+		}
+		return nil // Return from View function
+	})
+	return val, version, wrapError("KeyValue.GetVersioned", kv.name, key, err)
+}
+
+// versionsName returns the name of the versions bucket of the key/value store
+// with the given name
+func versionsName(name []byte) []byte {
+	return append(append([]byte{}, name...), versionsSuffix...)
+}
+
+// keyValueVersions returns the versions bucket of the key/value store with the
+// given name, or nil if no key has been set with SetVersioned
+func keyValueVersions(tx *bbolt.Tx, name []byte) *bbolt.Bucket {
+	return recordedBucket(tx, versionsName(name), versionsStructure)
+}
+
+// keyVersion returns the version of the given key, or 0 if it has none
+func keyVersion(versions *bbolt.Bucket, key []byte) uint64 {
+	stored := versions.Get(key)
+	if len(stored) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(stored)
+}